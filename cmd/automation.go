@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/automation"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetAutomationRules returns all automation rules.
+func (a *App) GetAutomationRules(c echo.Context) error {
+	out, err := a.core.GetAutomationRules(false)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetAutomationRule returns a single automation rule.
+func (a *App) GetAutomationRule(c echo.Context) error {
+	out, err := a.core.GetAutomationRule(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateAutomationRule handles automation rule creation.
+func (a *App) CreateAutomationRule(c echo.Context) error {
+	var r models.AutomationRule
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+
+	r, err := a.validateAutomationRule(r)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateAutomationRule(r)
+	if err != nil {
+		return err
+	}
+	a.reloadAutomationRules()
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateAutomationRule handles automation rule modification.
+func (a *App) UpdateAutomationRule(c echo.Context) error {
+	var r models.AutomationRule
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+
+	r, err := a.validateAutomationRule(r)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateAutomationRule(getID(c), r)
+	if err != nil {
+		return err
+	}
+	a.reloadAutomationRules()
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteAutomationRule deletes an automation rule.
+func (a *App) DeleteAutomationRule(c echo.Context) error {
+	if err := a.core.DeleteAutomationRule(getID(c)); err != nil {
+		return err
+	}
+	a.reloadAutomationRules()
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// GetAutomationRuleLogs returns the run log of an automation rule.
+func (a *App) GetAutomationRuleLogs(c echo.Context) error {
+	var (
+		status = c.FormValue("status")
+		pg     = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	switch status {
+	case "", models.AutomationRunSuccess, models.AutomationRunFailed:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	res, total, err := a.core.QueryAutomationLogs(getID(c), status, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.AutomationLog{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// reloadAutomationRules reloads the rules in the automation engine after
+// they've been modified.
+func (a *App) reloadAutomationRules() {
+	if err := a.automation.Load(); err != nil {
+		a.log.Printf("error reloading automation rules: %v", err)
+	}
+}
+
+// validateAutomationRule validates an incoming automation rule.
+func (a *App) validateAutomationRule(r models.AutomationRule) (models.AutomationRule, error) {
+	r.Name = strings.TrimSpace(r.Name)
+	if !strHasLen(r.Name, 1, stdInputMaxLen) {
+		return r, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if !slices.Contains(automation.Triggers, r.Trigger) {
+		return r, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("automation.invalidTrigger", "name", r.Trigger))
+	}
+
+	r.TriggerAttrib = strings.TrimSpace(r.TriggerAttrib)
+	if r.Trigger != automation.TriggerAttribChange {
+		r.TriggerAttrib = ""
+	}
+
+	r.Condition = strings.TrimSpace(r.Condition)
+	if _, err := automation.ParseCondition(r.Condition); err != nil {
+		return r, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("automation.invalidCondition", "error", err.Error()))
+	}
+
+	if len(r.Actions) == 0 {
+		return r, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "actions"))
+	}
+	for _, ac := range r.Actions {
+		switch ac.Type {
+		case models.AutomationActionAddLists, models.AutomationActionRemoveLists:
+			if len(ac.ListIDs) == 0 {
+				return r, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "list_ids"))
+			}
+			switch ac.Status {
+			case "", models.SubscriptionStatusUnconfirmed, models.SubscriptionStatusConfirmed:
+			default:
+				return r, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+			}
+
+		case models.AutomationActionSetAttribs:
+			if len(ac.Attribs) == 0 {
+				return r, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "attribs"))
+			}
+
+		case models.AutomationActionSendTx:
+			if _, err := a.manager.GetTpl(ac.TemplateID); err != nil {
+				return r, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "template_id"))
+			}
+
+		case models.AutomationActionBlocklist:
+
+		default:
+			return r, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("automation.invalidAction", "name", ac.Type))
+		}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/knadh/listmonk/internal/core"
+	"github.com/knadh/listmonk/internal/manager"
+	"github.com/knadh/listmonk/models"
+)
+
+// automationStore implements automation.Store. Rule actions run through the
+// core so that they behave exactly like the equivalent API calls.
+type automationStore struct {
+	core      *core.Core
+	manager   *manager.Manager
+	fromEmail string
+}
+
+func newAutomationStore(co *core.Core, m *manager.Manager, fromEmail string) *automationStore {
+	return &automationStore{core: co, manager: m, fromEmail: fromEmail}
+}
+
+// GetRules returns all enabled automation rules.
+func (s *automationStore) GetRules() ([]models.AutomationRule, error) {
+	return s.core.GetAutomationRules(true)
+}
+
+// GetSubscriber fetches a subscriber by ID or UUID.
+func (s *automationStore) GetSubscriber(id int, uuid string) (models.Subscriber, error) {
+	return s.core.GetSubscriber(id, uuid, "")
+}
+
+// AddSubscriptions subscribes a subscriber to lists.
+func (s *automationStore) AddSubscriptions(subID int, listIDs []int, status string) error {
+	if status == "" {
+		status = models.SubscriptionStatusUnconfirmed
+	}
+	return s.core.AddSubscriptions([]int{subID}, listIDs, status)
+}
+
+// DeleteSubscriptions removes a subscriber from lists.
+func (s *automationStore) DeleteSubscriptions(subID int, listIDs []int) error {
+	return s.core.DeleteSubscriptions([]int{subID}, listIDs)
+}
+
+// SetAttribs merges attributes into a subscriber's top level attributes.
+func (s *automationStore) SetAttribs(subID int, attribs map[string]any) error {
+	sub, err := s.core.GetSubscriber(subID, "", "")
+	if err != nil {
+		return err
+	}
+
+	if sub.Attribs == nil {
+		sub.Attribs = models.JSON{}
+	}
+	for k, v := range attribs {
+		sub.Attribs[k] = v
+	}
+
+	// Empty fields are left unchanged.
+	_, err = s.core.UpdateSubscriber(subID, models.Subscriber{Base: models.Base{ID: subID}, Attribs: sub.Attribs})
+	return err
+}
+
+// SendTx sends a transactional template to a subscriber.
+func (s *automationStore) SendTx(sub models.Subscriber, tplID int, data map[string]any) error {
+	tpl, err := s.manager.GetTpl(tplID)
+	if err != nil {
+		return fmt.Errorf("template %d not found", tplID)
+	}
+
+	m := models.TxMessage{
+		TemplateID: tplID,
+		Data:       data,
+		FromEmail:  s.fromEmail,
+		Messenger:  emailMsgr,
+	}
+	if err := m.Render(sub, tpl); err != nil {
+		return err
+	}
+
+	return s.manager.PushMessage(models.Message{
+		Subscriber:  sub,
+		To:          []string{sub.Email},
+		From:        m.FromEmail,
+		Subject:     m.Subject,
+		ContentType: m.ContentType,
+		Messenger:   m.Messenger,
+		Body:        m.Body,
+	})
+}
+
+// Blocklist blocklists a subscriber.
+func (s *automationStore) Blocklist(subID int) error {
+	return s.core.BlocklistSubscribers([]int{subID})
+}
+
+// LogRun records a run of a rule.
+func (s *automationStore) LogRun(l models.AutomationLog) error {
+	return s.core.InsertAutomationLog(l)
+}
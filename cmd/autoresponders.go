@@ -1,11 +1,21 @@
 package main
 
 import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/auth"
 	"github.com/knadh/listmonk/internal/core"
 	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
 )
 
+// reInterval matches simple Postgres interval strings used as sequence step delays.
+// eg: "0", "30 minutes", "3 days", "1 week 2 days".
+var reInterval = regexp.MustCompile(`^(0|(\d+\s*(second|minute|hour|day|week|month)s?\s*)+)$`)
+
 // makeAutoresponderHook returns a callback that triggers autoresponder campaigns
 // when subscribers are added to lists. This is plugged into the 'core' package.
 func makeAutoresponderHook(co *core.Core, m *manager.Manager) func(sub models.Subscriber, listIDs []int, isConfirmation bool) error {
@@ -15,6 +25,12 @@ func makeAutoresponderHook(co *core.Core, m *manager.Manager) func(sub models.Su
 			return nil
 		}
 
+		// Schedule the steps of drip sequences on the lists. They're sent
+		// later by the autoresponder scheduler.
+		if err := co.ScheduleAutoresponderSequences(sub.ID, listIDs, isConfirmation); err != nil {
+			lo.Printf("error scheduling autoresponder sequences for subscriber %d: %v", sub.ID, err)
+		}
+
 		for _, listID := range listIDs {
 			// Get autoresponders for this list.
 			camps, err := co.GetAutorespondersForList(listID)
@@ -57,3 +73,173 @@ func makeAutoresponderHook(co *core.Core, m *manager.Manager) func(sub models.Su
 		return nil
 	}
 }
+
+// GetAutoresponderSequences returns all autoresponder sequences on the lists
+// the user has access to.
+func (a *App) GetAutoresponderSequences(c echo.Context) error {
+	out, err := a.core.GetAutoresponderSequences()
+	if err != nil {
+		return err
+	}
+
+	// Filter out sequences on lists the user doesn't have access to.
+	user := auth.GetUser(c)
+	if !user.HasPerm(auth.PermCampaignsGetAll) {
+		res := make([]models.AutoresponderSequence, 0, len(out))
+		for _, s := range out {
+			if user.HasListPerm(auth.PermTypeGet, s.ListID) == nil {
+				res = append(res, s)
+			}
+		}
+		out = res
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetAutoresponderSequence returns a single autoresponder sequence.
+func (a *App) GetAutoresponderSequence(c echo.Context) error {
+	out, err := a.core.GetAutoresponderSequence(getID(c))
+	if err != nil {
+		return err
+	}
+
+	user := auth.GetUser(c)
+	if !user.HasPerm(auth.PermCampaignsGetAll) {
+		if err := user.HasListPerm(auth.PermTypeGet, out.ListID); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateAutoresponderSequence handles autoresponder sequence creation.
+func (a *App) CreateAutoresponderSequence(c echo.Context) error {
+	var s models.AutoresponderSequence
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+
+	s, err := a.validateAutoresponderSequence(s, c)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateAutoresponderSequence(s)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateAutoresponderSequence handles autoresponder sequence modification.
+func (a *App) UpdateAutoresponderSequence(c echo.Context) error {
+	id := getID(c)
+
+	// Check access to the existing sequence's list.
+	seq, err := a.core.GetAutoresponderSequence(id)
+	if err != nil {
+		return err
+	}
+	if err := a.checkSequencePerm(seq, c); err != nil {
+		return err
+	}
+
+	var s models.AutoresponderSequence
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+
+	s, err = a.validateAutoresponderSequence(s, c)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateAutoresponderSequence(id, s)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteAutoresponderSequence deletes an autoresponder sequence.
+func (a *App) DeleteAutoresponderSequence(c echo.Context) error {
+	id := getID(c)
+
+	seq, err := a.core.GetAutoresponderSequence(id)
+	if err != nil {
+		return err
+	}
+	if err := a.checkSequencePerm(seq, c); err != nil {
+		return err
+	}
+
+	if err := a.core.DeleteAutoresponderSequence(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateAutoresponderSequence validates an incoming sequence and checks that
+// the user can manage its list and step campaigns.
+func (a *App) validateAutoresponderSequence(s models.AutoresponderSequence, c echo.Context) (models.AutoresponderSequence, error) {
+	s.Name = strings.TrimSpace(s.Name)
+	if !strHasLen(s.Name, 1, stdInputMaxLen) {
+		return s, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if s.ListID < 1 {
+		return s, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "list_id"))
+	}
+	if _, err := a.core.GetList(s.ListID, ""); err != nil {
+		return s, err
+	}
+	if err := a.checkSequencePerm(s, c); err != nil {
+		return s, err
+	}
+
+	seen := map[int]bool{}
+	for n, st := range s.Steps {
+		if seen[st.CampaignID] {
+			return s, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.sequenceDuplicateStep"))
+		}
+		seen[st.CampaignID] = true
+
+		st.Delay = strings.ToLower(strings.TrimSpace(st.Delay))
+		if st.Delay == "" {
+			st.Delay = "0"
+		}
+		if !reInterval.MatchString(st.Delay) {
+			return s, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("campaigns.sequenceInvalidDelay", "delay", st.Delay))
+		}
+		s.Steps[n].Delay = st.Delay
+
+		// Only autoresponder campaigns can be steps.
+		camp, err := a.core.GetCampaign(st.CampaignID, "", "")
+		if err != nil {
+			return s, err
+		}
+		if camp.Type != models.CampaignTypeAutoresponder {
+			return s, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("campaigns.sequenceInvalidStep", "name", camp.Name))
+		}
+		if err := a.checkCampaignPerm(auth.PermTypeManage, camp.ID, c); err != nil {
+			return s, err
+		}
+	}
+
+	return s, nil
+}
+
+// checkSequencePerm checks if the user can manage sequences on the sequence's list.
+func (a *App) checkSequencePerm(s models.AutoresponderSequence, c echo.Context) error {
+	user := auth.GetUser(c)
+	if user.HasPerm(auth.PermCampaignsManageAll) {
+		return nil
+	}
+
+	return user.HasListPerm(auth.PermTypeManage, s.ListID)
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/knadh/listmonk/internal/bounce"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
@@ -234,6 +235,24 @@ func (a *App) BounceWebhook(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
+// GetBounceMailboxes returns the scan status of the enabled bounce mailboxes.
+func (a *App) GetBounceMailboxes(c echo.Context) error {
+	if a.bounce == nil {
+		return c.JSON(http.StatusOK, okResp{[]bounce.MailboxStatus{}})
+	}
+
+	return c.JSON(http.StatusOK, okResp{a.bounce.MailboxStatus()})
+}
+
+// ScanBounceMailbox scans an enabled bounce mailbox right away.
+func (a *App) ScanBounceMailbox(c echo.Context) error {
+	if a.bounce == nil || a.bounce.ScanMailbox(c.Param("uuid")) != nil {
+		return echo.NewHTTPError(http.StatusNotFound, a.i18n.Ts("globals.messages.notFound", "name", "{bounces.mailbox}"))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
 func (a *App) validateBounceFields(b models.Bounce) (models.Bounce, error) {
 	if b.Email == "" && b.SubscriberUUID == "" {
 		return b, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "email / subscriber_uuid"))
@@ -9,11 +9,15 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gdgvda/cron"
 	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/feed"
+	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/internal/notifs"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
@@ -32,6 +36,9 @@ type campReq struct {
 	// to the outside world.
 	ListIDs []int `json:"lists"`
 
+	// Likewise, overrides Campaign.Segments.
+	SegmentIDs []int `json:"segments"`
+
 	MediaIDs []int `json:"media"`
 
 	// This is only relevant to campaign test requests.
@@ -46,6 +53,18 @@ type campContentReq struct {
 	To   string `json:"to"`
 }
 
+const (
+	// Max number of variants in a campaign's A/B test.
+	maxCampaignVariants = 10
+
+	// Default number of minutes to wait after an A/B test is sent
+	// before picking the winning variant.
+	defaultABWait = 240
+
+	// Default priority of campaigns (1-10) among running campaigns.
+	defaultCampaignPriority = 5
+)
+
 var (
 	reFromAddress = regexp.MustCompile(`((.+?)\s)?<(.+?)@(.+?)>`)
 	reSlug        = regexp.MustCompile(`[^\p{L}\p{M}\p{N}]`)
@@ -76,10 +95,13 @@ func (a *App) GetCampaigns(c echo.Context) error {
 		orderBy   = c.FormValue("order_by")
 		order     = c.FormValue("order")
 		noBody, _ = strconv.ParseBool(c.QueryParam("no_body"))
+
+		// Runs of a recurring or feed campaign.
+		parentID, _ = strconv.Atoi(c.QueryParam("parent_id"))
 	)
 
 	// Query and retrieve campaigns from the DB.
-	res, total, err := a.core.QueryCampaigns(query, status, tags, orderBy, order, hasAllPerm, permittedLists, pg.Offset, pg.Limit)
+	res, total, err := a.core.QueryCampaigns(query, status, tags, parentID, orderBy, order, hasAllPerm, permittedLists, pg.Offset, pg.Limit)
 	if err != nil {
 		return err
 	}
@@ -133,6 +155,52 @@ func (a *App) GetCampaign(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// GetCampaignSends handles retrieval of the send log of a campaign.
+func (a *App) GetCampaignSends(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	return a.queryCampaignSends(c, id, 0)
+}
+
+// queryCampaignSends queries the send log of a campaign and/or a subscriber
+// and writes the paginated results as the response.
+func (a *App) queryCampaignSends(c echo.Context, campID, subID int) error {
+	var (
+		status = c.FormValue("status")
+		pg     = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	switch status {
+	case "", models.CampaignSendStatusSent, models.CampaignSendStatusFailed, models.CampaignSendStatusCapped:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	res, total, err := a.core.QueryCampaignSends(campID, subID, status, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.CampaignSend{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // PreviewCampaign renders the HTML preview of a campaign body.
 func (a *App) PreviewCampaign(c echo.Context) error {
 	// Get the campaign ID.
@@ -170,6 +238,8 @@ func (a *App) PreviewCampaign(c echo.Context) error {
 		}
 	}
 
+	a.loadFeedPreview(&camp)
+
 	// Use a dummy campaign ID to prevent views and clicks from {{ TrackView }}
 	// and {{ TrackLink }} being registered on preview.
 	camp.UUID = dummySubscriber.UUID
@@ -260,6 +330,13 @@ func (a *App) CreateCampaign(c echo.Context) error {
 	// Filter lists against the current user's permitted lists.
 	user := auth.GetUser(c)
 	o.ListIDs = user.FilterListsByPerm(auth.PermTypeGet|auth.PermTypeManage, o.ListIDs)
+	o.Exclusions.Lists = user.FilterListsByPerm(auth.PermTypeGet|auth.PermTypeManage, o.Exclusions.Lists)
+
+	// Segments are arbitrary subscriber queries.
+	if (len(o.SegmentIDs) > 0 || len(o.Exclusions.Segments) > 0) && !user.HasPerm(auth.PermSubscribersSqlQuery) {
+		return echo.NewHTTPError(http.StatusForbidden,
+			a.i18n.Ts("globals.messages.permissionDenied", "name", auth.PermSubscribersSqlQuery))
+	}
 
 	// If the campaign's 'opt-in', prepare a default message.
 	switch o.Type {
@@ -293,7 +370,7 @@ func (a *App) CreateCampaign(c echo.Context) error {
 		o.ArchiveTemplateID = o.TemplateID
 	}
 
-	out, err := a.core.CreateCampaign(o.Campaign, o.ListIDs, o.MediaIDs)
+	out, err := a.core.CreateCampaign(o.Campaign, o.ListIDs, o.SegmentIDs, o.MediaIDs)
 	if err != nil {
 		return err
 	}
@@ -341,13 +418,29 @@ func (a *App) UpdateCampaign(c echo.Context) error {
 		return err
 	}
 
+	// If segments aren't in the request, retain the existing ones. Changing
+	// them, or the excluded segments, requires the permission to query subscribers.
+	var (
+		user   = auth.GetUser(c)
+		segIDs = campaignSegmentIDs(cm)
+	)
+	if o.SegmentIDs == nil {
+		o.SegmentIDs = segIDs
+	}
+	if !user.HasPerm(auth.PermSubscribersSqlQuery) &&
+		(!slices.Equal(slices.Sorted(slices.Values(o.SegmentIDs)), segIDs) ||
+			!slices.Equal(slices.Sorted(slices.Values(o.Exclusions.Segments)), slices.Sorted(slices.Values(cm.Exclusions.Segments)))) {
+		return echo.NewHTTPError(http.StatusForbidden,
+			a.i18n.Ts("globals.messages.permissionDenied", "name", auth.PermSubscribersSqlQuery))
+	}
+
 	if c, err := a.validateCampaignFields(o); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	} else {
 		o = c
 	}
 
-	out, err := a.core.UpdateCampaign(id, o.Campaign, o.ListIDs, o.MediaIDs)
+	out, err := a.core.UpdateCampaign(id, o.Campaign, o.ListIDs, o.SegmentIDs, o.MediaIDs)
 	if err != nil {
 		return err
 	}
@@ -386,6 +479,36 @@ func (a *App) UpdateCampaignStatus(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// SkipCampaignRun skips the next occurrence of a recurring campaign.
+func (a *App) SkipCampaignRun(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeManage, id, c); err != nil {
+		return err
+	}
+
+	camp, err := a.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+	if camp.Recurrence == "" || camp.Status != models.CampaignStatusScheduled {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.cantSkipRun"))
+	}
+
+	next, err := manager.SkipRecurrence(&camp, time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "recurrence"))
+	}
+
+	out, err := a.core.UpdateCampaignRecurrence(id, camp.RecurrenceNext, next)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // UpdateCampaignArchive handles campaign status modification.
 func (a *App) UpdateCampaignArchive(c echo.Context) error {
 	id := getID(c)
@@ -420,6 +543,63 @@ func (a *App) UpdateCampaignArchive(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{req})
 }
 
+// ResendCampaign handles the creation of a draft campaign that resends a finished
+// campaign to the recipients that it failed to reach, or that didn't open or click it.
+func (a *App) ResendCampaign(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeManage, id, c); err != nil {
+		return err
+	}
+
+	req := struct {
+		Name     string `json:"name"`
+		Audience string `json:"audience"`
+	}{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	switch req.Audience {
+	case models.CampaignResendFailed:
+		// Failed messages are only known from the send log.
+		if !a.cfg.SendLogEnabled {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.resendNoSendLog"))
+		}
+	case models.CampaignResendNotOpened, models.CampaignResendNotClicked:
+		// Views and clicks can only be attributed to subscribers with individual tracking.
+		if !a.cfg.Privacy.IndividualTracking {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.resendNoTracking"))
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "audience"))
+	}
+
+	camp, err := a.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+	if camp.Status != models.CampaignStatusFinished {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.cantResend"))
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = a.i18n.Ts("campaigns.resendOf", "name", camp.Name)
+	}
+	if !strHasLen(req.Name, 1, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.fieldInvalidName"))
+	}
+
+	out, err := a.core.ResendCampaign(id, req.Name, req.Audience)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // DeleteCampaign handles campaign deletion.
 // Only scheduled campaigns that have not started yet can be deleted.
 func (a *App) DeleteCampaign(c echo.Context) error {
@@ -512,8 +692,16 @@ func (a *App) GetRunningCampaignStats(c echo.Context) error {
 			// Rate since the starting of the campaign.
 			out[i].NetRate = rate
 
-			// Realtime running rate over the last minute.
-			out[i].Rate = a.manager.GetCampaignStats(c.ID).SendRate
+			// Realtime running rate over the last minute and the
+			// messages sent to throttled domains.
+			st := a.manager.GetCampaignStats(c.ID)
+			out[i].Rate = st.SendRate
+			out[i].Domains = st.Domains
+
+			if !st.SuspendedUntil.IsZero() {
+				out[i].Suspended = true
+				out[i].ResumeAt = null.TimeFrom(st.SuspendedUntil)
+			}
 		}
 	}
 
@@ -580,6 +768,7 @@ func (a *App) TestCampaign(c echo.Context) error {
 			camp.MediaIDs = append(camp.MediaIDs, int64(id))
 		}
 	}
+	a.loadFeedPreview(&camp)
 
 	// Send the test messages.
 	for _, s := range subs {
@@ -617,6 +806,16 @@ func (a *App) GetCampaignViewAnalytics(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("analytics.invalidDates"))
 	}
 
+	// Per-variant stats of A/B tested campaigns.
+	if typ == "variants" {
+		out, err := a.core.GetCampaignAnalyticsVariants(ids, from, to)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
 	// Campaign link stats.
 	if typ == "links" {
 		out, err := a.core.GetCampaignAnalyticsLinks(ids, typ, from, to)
@@ -654,6 +853,21 @@ func (a *App) sendTestMessage(sub models.Subscriber, camp *models.Campaign) erro
 	return a.manager.PushCampaignMessage(msg)
 }
 
+// loadFeedPreview loads the latest items of a feed campaign's feed for previewing and
+// testing the campaign. Runs of the campaign have the new items they were created for.
+func (a *App) loadFeedPreview(camp *models.Campaign) {
+	if camp.FeedURL == "" || len(camp.Feed.Items) > 0 {
+		return
+	}
+
+	f, err := feed.Fetch(camp.FeedURL)
+	if err != nil {
+		a.log.Printf("error fetching feed of campaign (%s): %v", camp.Name, err)
+		return
+	}
+	camp.Feed = f
+}
+
 // validateCampaignFields validates incoming campaign field values.
 func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 	if c.FromEmail == "" {
@@ -693,9 +907,31 @@ func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 		}
 	}
 
-	if len(c.ListIDs) == 0 {
+	// Campaigns are sent to the subscribers of their lists and segments.
+	if len(c.ListIDs) == 0 && len(c.SegmentIDs) == 0 {
 		return c, errors.New(a.i18n.T("campaigns.fieldInvalidListIDs"))
 	}
+	if len(c.SegmentIDs) > 0 && c.Type != models.CampaignTypeRegular {
+		return c, errors.New(a.i18n.T("campaigns.segmentsInvalidType"))
+	}
+
+	// Subscribers excluded from the campaign.
+	if len(c.Exclusions.Segments) > 0 && c.Type != models.CampaignTypeRegular {
+		return c, errors.New(a.i18n.T("campaigns.segmentsInvalidType"))
+	}
+	if c.Exclusions.SentWithinDays < 0 {
+		return c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "exclusions.sent_within_days"))
+	}
+	// Recent recipients are looked up in the send log.
+	if c.Exclusions.SentWithinDays > 0 && !a.cfg.SendLogEnabled {
+		return c, errors.New(a.i18n.T("campaigns.excludeNoSendLog"))
+	}
+	if c.Exclusions.Lists == nil {
+		c.Exclusions.Lists = []int{}
+	}
+	if c.Exclusions.Segments == nil {
+		c.Exclusions.Segments = []int{}
+	}
 
 	if !a.manager.HasMessenger(c.Messenger) {
 		return c, errors.New(a.i18n.Ts("campaigns.fieldInvalidMessenger", "name", c.Messenger))
@@ -710,6 +946,90 @@ func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 		c.Headers = make([]map[string]string, 0)
 	}
 
+	if c.ABPercent != 0 {
+		if err := a.validateABTest(&c); err != nil {
+			return c, err
+		}
+	} else {
+		c.Variants = nil
+	}
+
+	// Sending in subscribers' local time needs the local send time (send_at)
+	// and a fallback timezone for subscribers without one.
+	if c.LocalSend {
+		if !c.SendAt.Valid {
+			return c, errors.New(a.i18n.T("campaigns.localNoSendAt"))
+		}
+		if c.Type != models.CampaignTypeRegular || c.ABPercent != 0 {
+			return c, errors.New(a.i18n.T("campaigns.localInvalidType"))
+		}
+	}
+
+	// Recurring campaigns start at send_at and can't be A/B tested or sent in local time.
+	c.Recurrence = strings.TrimSpace(c.Recurrence)
+	if c.Recurrence != "" {
+		if !c.SendAt.Valid {
+			return c, errors.New(a.i18n.T("campaigns.needsSendAt"))
+		}
+		if c.Type != models.CampaignTypeRegular || c.ABPercent != 0 || c.LocalSend {
+			return c, errors.New(a.i18n.T("campaigns.recurrenceInvalidType"))
+		}
+		if _, err := cron.ParseStandard(c.Recurrence); err != nil {
+			return c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "recurrence"))
+		}
+	}
+
+	// Feed campaigns watch their feeds from send_at and are sent like recurring campaigns.
+	c.FeedURL = strings.TrimSpace(c.FeedURL)
+	if c.FeedURL != "" {
+		if !c.SendAt.Valid {
+			return c, errors.New(a.i18n.T("campaigns.needsSendAt"))
+		}
+		if c.Type != models.CampaignTypeRegular || c.ABPercent != 0 || c.LocalSend || c.Recurrence != "" {
+			return c, errors.New(a.i18n.T("campaigns.feedInvalidType"))
+		}
+		if u, err := url.Parse(c.FeedURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "feed_url"))
+		}
+	}
+	if c.FeedInterval == "" {
+		c.FeedInterval = "1h"
+	}
+	if d, err := time.ParseDuration(c.FeedInterval); err != nil || d < 0 {
+		return c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "feed_interval"))
+	}
+	if c.FeedMinItems == 0 {
+		c.FeedMinItems = 1
+	} else if c.FeedMinItems < 1 {
+		return c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "feed_min_items"))
+	}
+
+	if err := manager.ValidateQuietHours(c.QuietHours); err != nil {
+		return c, errors.New(a.i18n.Ts("settings.performance.invalidQuietHours", "error", err.Error()))
+	}
+
+	// Priority and rate limits.
+	if c.Priority == 0 {
+		c.Priority = defaultCampaignPriority
+	} else if c.Priority < 1 || c.Priority > 10 {
+		return c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "priority"))
+	}
+	if c.MessageRate < 0 || c.SlidingWindowRate < 0 {
+		return c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "message_rate"))
+	}
+	if c.SlidingWindowDuration == "" {
+		c.SlidingWindowDuration = "1h"
+	}
+	if d, err := time.ParseDuration(c.SlidingWindowDuration); err != nil || (c.SlidingWindowRate > 0 && d <= time.Second) {
+		return c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "sliding_window_duration"))
+	}
+
+	if c.LocalTimezone == "" {
+		c.LocalTimezone = "UTC"
+	} else if _, err := time.LoadLocation(c.LocalTimezone); err != nil || c.LocalTimezone == "Local" {
+		return c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "local_timezone"))
+	}
+
 	if len(c.ArchiveMeta) == 0 {
 		c.ArchiveMeta = json.RawMessage("{}")
 	}
@@ -729,6 +1049,61 @@ func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 	return c, nil
 }
 
+// validateABTest validates the A/B test fields of a campaign and sets defaults.
+func (a *App) validateABTest(c *campReq) error {
+	if c.ABPercent < 1 || c.ABPercent > 100 {
+		return errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "ab_percent"))
+	}
+
+	// Variants are picked by opens or clicks of individual subscribers.
+	if !a.cfg.Privacy.IndividualTracking {
+		return errors.New(a.i18n.T("campaigns.abNoTracking"))
+	}
+
+	if c.Type != models.CampaignTypeRegular {
+		return errors.New(a.i18n.T("campaigns.abInvalidType"))
+	}
+
+	if len(c.Variants) < 2 || len(c.Variants) > maxCampaignVariants {
+		return errors.New(a.i18n.Ts("campaigns.abInvalidVariants", "num", strconv.Itoa(maxCampaignVariants)))
+	}
+
+	switch c.ABMetric {
+	case models.CampaignABMetricOpens, models.CampaignABMetricClicks:
+	case "":
+		c.ABMetric = models.CampaignABMetricOpens
+	default:
+		return errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "ab_metric"))
+	}
+
+	if c.ABWait == 0 {
+		c.ABWait = defaultABWait
+	} else if c.ABWait < 1 {
+		return errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "ab_wait"))
+	}
+
+	for i, v := range c.Variants {
+		v.Label = strings.TrimSpace(v.Label)
+		if v.Label == "" {
+			v.Label = string(rune('A' + i))
+		}
+		if !strHasLen(v.Label, 1, stdInputMaxLen) || len(v.Subject) > 5000 {
+			return errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "variants"))
+		}
+
+		if v.Body != "" {
+			camp := models.Campaign{Body: v.Body, TemplateBody: tplTag}
+			if err := camp.CompileTemplate(a.manager.TemplateFuncs(&camp)); err != nil {
+				return errors.New(a.i18n.Ts("campaigns.fieldInvalidBody", "error", err.Error()))
+			}
+		}
+
+		c.Variants[i] = v
+	}
+
+	return nil
+}
+
 // makeOptinCampaignMessage makes a default opt-in campaign message body.
 func (a *App) makeOptinCampaignMessage(o campReq) (campReq, error) {
 	if len(o.ListIDs) == 0 {
@@ -808,6 +1183,26 @@ func (a *App) checkCampaignPerm(types auth.PermType, id int, c echo.Context) err
 	return nil
 }
 
+// campaignSegmentIDs returns the sorted IDs of a campaign's (existing) segments.
+func campaignSegmentIDs(c models.Campaign) []int {
+	var segs []struct {
+		ID null.Int `json:"id"`
+	}
+	if err := c.Segments.Unmarshal(&segs); err != nil {
+		return []int{}
+	}
+
+	out := make([]int, 0, len(segs))
+	for _, s := range segs {
+		if s.ID.Valid {
+			out = append(out, s.ID.Int)
+		}
+	}
+	slices.Sort(out)
+
+	return out
+}
+
 // canEditCampaign returns true if a campaign is in a status where updating
 // its properties is allowed.
 func canEditCampaign(status string) bool {
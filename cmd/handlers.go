@@ -105,11 +105,26 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.GET("/api/dashboard/charts", a.GetDashboardCharts)
 		g.GET("/api/dashboard/counts", a.GetDashboardCounts)
 		g.GET("/api/webhooks/stats", a.GetWebhookStats)
+		g.GET("/api/webhooks/failed", pm(a.GetWebhookDeadLetters, "settings:get"))
+		g.GET("/api/webhooks/failed/:id", pm(hasID(a.GetWebhookDeadLetter), "settings:get"))
+		g.POST("/api/webhooks/failed/replay", pm(a.ReplayWebhookDeadLetters, "settings:manage"))
+		g.POST("/api/webhooks/failed/:id/replay", pm(hasID(a.ReplayWebhookDeadLetters), "settings:manage"))
+		g.DELETE("/api/webhooks/failed", pm(a.DeleteWebhookDeadLetters, "settings:manage"))
+		g.DELETE("/api/webhooks/failed/:id", pm(hasID(a.DeleteWebhookDeadLetters), "settings:manage"))
+		g.GET("/api/webhooks/:uuid/deliveries", pm(a.GetWebhookDeliveries, "settings:get"))
+
+		g.GET("/api/automation/rules", pm(a.GetAutomationRules, "settings:get"))
+		g.GET("/api/automation/rules/:id", pm(hasID(a.GetAutomationRule), "settings:get"))
+		g.GET("/api/automation/rules/:id/logs", pm(hasID(a.GetAutomationRuleLogs), "settings:get"))
+		g.POST("/api/automation/rules", pm(a.CreateAutomationRule, "settings:manage"))
+		g.PUT("/api/automation/rules/:id", pm(hasID(a.UpdateAutomationRule), "settings:manage"))
+		g.DELETE("/api/automation/rules/:id", pm(hasID(a.DeleteAutomationRule), "settings:manage"))
 
 		g.GET("/api/settings", pm(a.GetSettings, "settings:get"))
 		g.PUT("/api/settings", pm(a.UpdateSettings, "settings:manage"))
 		g.PUT("/api/settings/:key", pm(a.UpdateSettingsByKey, "settings:manage"))
 		g.POST("/api/settings/smtp/test", pm(a.TestSMTPSettings, "settings:manage"))
+		g.POST("/api/settings/webhooks/test", pm(a.TestWebhookSettings, "settings:manage"))
 		g.POST("/api/admin/reload", pm(a.ReloadApp, "settings:manage"))
 		g.GET("/api/logs", pm(a.GetLogs, "settings:get"))
 		g.GET("/api/events", pm(a.EventStream, "settings:get"))
@@ -118,6 +133,7 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.GET("/api/subscribers", pm(a.QuerySubscribers, "subscribers:get_all", "subscribers:get"))
 		g.GET("/api/subscribers/:id", pm(hasID(a.GetSubscriber), "subscribers:get_all", "subscribers:get"))
 		g.GET("/api/subscribers/:id/activity", pm(hasID(a.GetSubscriberActivity), "subscribers:get_all", "subscribers:get"))
+		g.GET("/api/subscribers/:id/sends", pm(hasID(a.GetSubscriberSends), "subscribers:get_all", "subscribers:get"))
 		g.GET("/api/subscribers/:id/export", pm(hasID(a.ExportSubscriberData), "subscribers:get_all", "subscribers:get"))
 		g.GET("/api/subscribers/:id/bounces", pm(hasID(a.GetSubscriberBounces), "bounces:get"))
 		g.DELETE("/api/subscribers/:id/bounces", pm(hasID(a.DeleteSubscriberBounces), "bounces:manage"))
@@ -133,6 +149,8 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 
 		g.GET("/api/bounces", pm(a.GetBounces, "bounces:get"))
 		g.PUT("/api/bounces/blocklist", pm(a.BlocklistBouncedSubscribers, "bounces:manage"))
+		g.GET("/api/bounces/mailboxes", pm(a.GetBounceMailboxes, "bounces:get"))
+		g.POST("/api/bounces/mailboxes/:uuid/scan", pm(a.ScanBounceMailbox, "bounces:manage"))
 		g.GET("/api/bounces/:id", pm(hasID(a.GetBounce), "bounces:get"))
 		g.DELETE("/api/bounces", pm(a.DeleteBounces, "bounces:manage"))
 		g.DELETE("/api/bounces/:id", pm(hasID(a.DeleteBounce), "bounces:manage"))
@@ -158,9 +176,21 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.DELETE("/api/lists", a.DeleteLists)
 		g.DELETE("/api/lists/:id", hasID(a.DeleteList))
 
+		g.GET("/api/segments", pm(a.GetSegments, "subscribers:sql_query"))
+		g.GET("/api/segments/:id", pm(hasID(a.GetSegment), "subscribers:sql_query"))
+		g.POST("/api/segments", pm(a.CreateSegment, "subscribers:sql_query"))
+		g.PUT("/api/segments/:id", pm(hasID(a.UpdateSegment), "subscribers:sql_query"))
+		g.DELETE("/api/segments/:id", pm(hasID(a.DeleteSegment), "subscribers:sql_query"))
+
 		g.GET("/api/campaigns", pm(a.GetCampaigns, "campaigns:get_all", "campaigns:get"))
 		g.GET("/api/campaigns/running/stats", pm(a.GetRunningCampaignStats, "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/sequences", pm(a.GetAutoresponderSequences, "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/sequences/:id", pm(hasID(a.GetAutoresponderSequence), "campaigns:get_all", "campaigns:get"))
+		g.POST("/api/campaigns/sequences", pm(a.CreateAutoresponderSequence, "campaigns:manage_all", "campaigns:manage"))
+		g.PUT("/api/campaigns/sequences/:id", pm(hasID(a.UpdateAutoresponderSequence), "campaigns:manage_all", "campaigns:manage"))
+		g.DELETE("/api/campaigns/sequences/:id", pm(hasID(a.DeleteAutoresponderSequence), "campaigns:manage_all", "campaigns:manage"))
 		g.GET("/api/campaigns/:id", pm(hasID(a.GetCampaign), "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/:id/sends", pm(hasID(a.GetCampaignSends), "campaigns:get_all", "campaigns:get"))
 		g.GET("/api/campaigns/analytics/:type", pm(a.GetCampaignViewAnalytics, "campaigns:get_analytics"))
 		g.GET("/api/campaigns/:id/preview", pm(hasID(a.PreviewCampaign), "campaigns:get_all", "campaigns:get"))
 		g.POST("/api/campaigns/:id/preview/archive", pm(hasID(a.PreviewCampaignArchive), "campaigns:get_all", "campaigns:get"))
@@ -168,10 +198,12 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.POST("/api/campaigns/:id/content", pm(hasID(a.CampaignContent), "campaigns:manage_all", "campaigns:manage"))
 		g.POST("/api/campaigns/:id/text", pm(hasID(a.PreviewCampaign), "campaigns:get"))
 		g.POST("/api/campaigns/:id/test", pm(hasID(a.TestCampaign), "campaigns:manage_all", "campaigns:manage"))
+		g.POST("/api/campaigns/:id/resend", pm(hasID(a.ResendCampaign), "campaigns:manage_all", "campaigns:manage"))
 		g.POST("/api/campaigns", pm(a.CreateCampaign, "campaigns:manage_all", "campaigns:manage"))
 		g.PUT("/api/campaigns/:id", pm(hasID(a.UpdateCampaign), "campaigns:manage_all", "campaigns:manage"))
 		g.PUT("/api/campaigns/:id/status", pm(hasID(a.UpdateCampaignStatus), "campaigns:manage_all", "campaigns:manage"))
 		g.PUT("/api/campaigns/:id/archive", pm(hasID(a.UpdateCampaignArchive), "campaigns:manage_all", "campaigns:manage"))
+		g.PUT("/api/campaigns/:id/skip", pm(hasID(a.SkipCampaignRun), "campaigns:manage_all", "campaigns:manage"))
 		g.DELETE("/api/campaigns", pm(a.DeleteCampaigns, "campaigns:manage", "campaigns:manage_all"))
 		g.DELETE("/api/campaigns/:id", pm(hasID(a.DeleteCampaign), "campaigns:manage_all", "campaigns:manage"))
 
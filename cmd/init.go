@@ -34,6 +34,7 @@ import (
 	"github.com/knadh/koanf/providers/posflag"
 	"github.com/knadh/koanf/v2"
 	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/automation"
 	"github.com/knadh/listmonk/internal/bounce"
 	"github.com/knadh/listmonk/internal/bounce/mailbox"
 	"github.com/knadh/listmonk/internal/captcha"
@@ -45,9 +46,9 @@ import (
 	"github.com/knadh/listmonk/internal/media/providers/s3"
 	"github.com/knadh/listmonk/internal/messenger/email"
 	"github.com/knadh/listmonk/internal/messenger/postback"
-	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/internal/notifs"
 	"github.com/knadh/listmonk/internal/subimporter"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/stuffbin"
 	"github.com/labstack/echo/v4"
@@ -147,6 +148,9 @@ type Config struct {
 	BouncePostmarkEnabled     bool
 	BounceForwardemailEnabled bool
 
+	// SendLogEnabled is true when the per-recipient campaign send log is recorded.
+	SendLogEnabled bool
+
 	PermissionsRaw json.RawMessage
 	Permissions    map[string]struct{}
 }
@@ -391,6 +395,18 @@ func prepareQueries(qMap goyesql.Queries, db *sqlx.DB, ko *koanf.Koanf) *models.
 	}
 	qMap["get-campaign-link-counts"].Query = fmt.Sprintf(qMap["get-campaign-link-counts"].Query, linkSel)
 
+	// Substitute the audience filters shared by the queries that pick the subscribers of campaigns.
+	r := strings.NewReplacer(
+		"%campaign_audience%", qMap["campaign-audience"].Query,
+		"%list_optin_filter%", qMap["campaign-list-optin-filter"].Query,
+		"%segment_optin_filter%", qMap["campaign-segment-optin-filter"].Query,
+		"%resend_filter%", qMap["campaign-resend-filter"].Query,
+		"%exclusion_filter%", qMap["campaign-exclusion-filter"].Query,
+	)
+	for _, name := range []string{"next-campaigns", "count-campaign-segment-subscribers", "next-campaign-subscribers"} {
+		qMap[name].Query = r.Replace(qMap[name].Query)
+	}
+
 	// Scan and prepare all queries.
 	var q models.Queries
 	if err := goyesqlx.ScanToStruct(&q, qMap, db); err != nil {
@@ -485,6 +501,7 @@ func initConstConfig(ko *koanf.Koanf) *Config {
 	c.BounceSendgridEnabled = ko.Bool("bounce.sendgrid_enabled")
 	c.BouncePostmarkEnabled = ko.Bool("bounce.postmark.enabled")
 	c.BounceForwardemailEnabled = ko.Bool("bounce.forwardemail.enabled")
+	c.SendLogEnabled = ko.Bool("maintenance.send_log.enabled")
 	c.HasLegacyUser = ko.Exists("app.admin_username") || ko.Exists("app.admin_password")
 
 	b := md5.Sum([]byte(time.Now().String()))
@@ -532,7 +549,7 @@ func initI18n(lang string, fs stuffbin.FileSystem) *i18n.I18n {
 }
 
 // initCore initializes the CRUD DB core .
-func initCore(fnNotify func(sub models.Subscriber, listIDs []int) (int, error), wh *webhooks.Manager, queries *models.Queries, db *sqlx.DB, i *i18n.I18n, ko *koanf.Koanf) *core.Core {
+func initCore(fnNotify func(sub models.Subscriber, listIDs []int) (int, error), fnDispatch func(event string, data any), queries *models.Queries, db *sqlx.DB, i *i18n.I18n, ko *koanf.Koanf) *core.Core {
 	opt := &core.Opt{
 		Constants: core.Constants{
 			SendOptinConfirmation: ko.Bool("app.send_optin_confirmation"),
@@ -549,31 +566,19 @@ func initCore(fnNotify func(sub models.Subscriber, listIDs []int) (int, error),
 		lo.Fatalf("error unmarshalling bounce config: %v", err)
 	}
 
-	// Create the webhook dispatch function if webhooks are enabled.
-	var fnDispatchWebhook func(event string, data any)
-	if wh != nil {
-		fnDispatchWebhook = wh.Dispatch
-	}
-
 	// Initialize the CRUD core.
 	return core.New(opt, &core.Hooks{
 		SendOptinConfirmation: fnNotify,
-		DispatchWebhook:       fnDispatchWebhook,
+		DispatchWebhook:       fnDispatch,
 	})
 }
 
 // initCampaignManager initializes the campaign manager.
-func initCampaignManager(msgrs []manager.Messenger, q *models.Queries, u *UrlConfig, co *core.Core, md media.Store, wh *webhooks.Manager, i *i18n.I18n, ko *koanf.Koanf) *manager.Manager {
+func initCampaignManager(msgrs []manager.Messenger, q *models.Queries, db *sqlx.DB, u *UrlConfig, co *core.Core, md media.Store, fnDispatch func(event string, data any), i *i18n.I18n, ko *koanf.Koanf) *manager.Manager {
 	if ko.Bool("passive") {
 		lo.Println("running in passive mode. won't process campaigns.")
 	}
 
-	// Create the webhook dispatch function if webhooks are enabled.
-	var fnDispatchWebhook func(event string, data any)
-	if wh != nil {
-		fnDispatchWebhook = wh.Dispatch
-	}
-
 	mgr := manager.New(manager.Config{
 		BatchSize:             ko.Int("app.batch_size"),
 		Concurrency:           ko.Int("app.concurrency"),
@@ -592,10 +597,15 @@ func initCampaignManager(msgrs []manager.Messenger, q *models.Queries, u *UrlCon
 		SlidingWindow:         ko.Bool("app.message_sliding_window"),
 		SlidingWindowDuration: ko.Duration("app.message_sliding_window_duration"),
 		SlidingWindowRate:     ko.Int("app.message_sliding_window_rate"),
+		MessengerLimits:       initMessengerLimits(ko),
+		DomainLimits:          initDomainLimits(ko),
+		QuietHours:            initQuietHours(ko),
+		FrequencyCap:          initFrequencyCap(ko),
 		ScanInterval:          time.Second * 5,
 		ScanCampaigns:         !ko.Bool("passive"),
-		DispatchWebhook:       fnDispatchWebhook,
-	}, newManagerStore(q, co, md), i, lo)
+		SendLog:               ko.Bool("maintenance.send_log.enabled"),
+		DispatchWebhook:       fnDispatch,
+	}, newManagerStore(q, db, co, md), i, lo)
 
 	// Attach all messengers to the campaign manager.
 	for _, m := range msgrs {
@@ -605,6 +615,51 @@ func initCampaignManager(msgrs []manager.Messenger, q *models.Queries, u *UrlCon
 	return mgr
 }
 
+// initMessengerLimits returns the rate limits of individual messengers from the settings.
+func initMessengerLimits(ko *koanf.Koanf) map[string]manager.RateLimit {
+	out := make(map[string]manager.RateLimit)
+	for _, item := range ko.Slices("app.messenger_limits") {
+		l := manager.RateLimit{MessageRate: item.Int("message_rate")}
+		if item.Bool("sliding_window") {
+			l.SlidingWindowRate = item.Int("sliding_window_rate")
+			l.SlidingWindowDuration, _ = time.ParseDuration(item.String("sliding_window_duration"))
+		}
+		out[item.String("messenger")] = l
+	}
+
+	return out
+}
+
+// initDomainLimits returns the per minute rate limits of recipient domains from the settings.
+func initDomainLimits(ko *koanf.Koanf) map[string]int {
+	out := make(map[string]int)
+	for _, item := range ko.Slices("app.domain_limits") {
+		out[item.String("domain")] = item.Int("rate")
+	}
+
+	return out
+}
+
+// initQuietHours returns the global quiet hours from the settings.
+func initQuietHours(ko *koanf.Koanf) models.QuietHours {
+	var out models.QuietHours
+	if err := ko.UnmarshalWithConf("app.quiet_hours", &out, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+		lo.Printf("error loading quiet hours: %v", err)
+	}
+
+	return out
+}
+
+// initFrequencyCap returns the global per-subscriber frequency cap from the settings.
+func initFrequencyCap(ko *koanf.Koanf) models.FrequencyCap {
+	var out models.FrequencyCap
+	if err := ko.UnmarshalWithConf("app.frequency_cap", &out, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+		lo.Printf("error loading frequency cap: %v", err)
+	}
+
+	return out
+}
+
 // initTxTemplates initializes and compiles the transactional templates and caches them in-memory.
 func initTxTemplates(m *manager.Manager, co *core.Core) {
 	tpls, err := co.GetTemplates(models.TemplateTypeTx, false)
@@ -623,7 +678,7 @@ func initTxTemplates(m *manager.Manager, co *core.Core) {
 }
 
 // initImporter initializes the bulk subscriber importer.
-func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, i *i18n.I18n, ko *koanf.Koanf) *subimporter.Importer {
+func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, fnDispatch func(event string, data any), i *i18n.I18n, ko *koanf.Koanf) *subimporter.Importer {
 	return subimporter.New(
 		subimporter.Options{
 			DomainBlocklist:    ko.Strings("privacy.domain_blocklist"),
@@ -642,14 +697,18 @@ func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, i *i18n.I18n,
 				notifs.NotifySystem(subject, notifs.TplImport, data, nil)
 				return nil
 			},
+			DispatchWebhook: fnDispatch,
 		}, db.DB, i)
 }
 
 // initSMTPMessenger initializes the combined and individual SMTP messengers.
-func initSMTPMessengers() []manager.Messenger {
+func initSMTPMessengers(q *models.Queries) []manager.Messenger {
 	var (
 		servers = []email.Server{}
 		out     = []manager.Messenger{}
+
+		// Daily volumes of the servers being warmed up, saved in the DB.
+		warmup = email.NewWarmup(newWarmupStore(q), lo)
 	)
 
 	// Load the config for multiple SMTP servers.
@@ -670,7 +729,7 @@ func initSMTPMessengers() []manager.Messenger {
 		// If the server has a name, initialize it as a standalone e-mail messenger
 		// allowing campaigns to select individual SMTPs. In the UI and config, it'll appear as `email / $name`.
 		if s.Name != "" {
-			msgr, err := email.New(s.Name, s)
+			msgr, err := email.New(s.Name, warmup, s)
 			if err != nil {
 				lo.Fatalf("error initializing e-mail messenger: %v", err)
 			}
@@ -679,7 +738,7 @@ func initSMTPMessengers() []manager.Messenger {
 	}
 
 	// Initialize the 'email' messenger with all SMTP servers.
-	msgr, err := email.New(email.MessengerName, servers...)
+	msgr, err := email.New(email.MessengerName, warmup, servers...)
 	if err != nil {
 		lo.Fatalf("error initializing e-mail messenger: %v", err)
 	}
@@ -732,7 +791,7 @@ func initPostbackMessengers(ko *koanf.Koanf) []manager.Messenger {
 }
 
 // initWebhooks initializes the webhook manager for dispatching events to external URLs.
-func initWebhooks(ko *koanf.Koanf, lo *log.Logger) *webhooks.Manager {
+func initWebhooks(q *models.Queries, ko *koanf.Koanf, lo *log.Logger) *webhooks.Manager {
 	items := ko.Slices("webhooks")
 	if len(items) == 0 {
 		return nil
@@ -748,15 +807,37 @@ func initWebhooks(ko *koanf.Koanf, lo *log.Logger) *webhooks.Manager {
 		if timeout == 0 {
 			timeout = 5 * time.Second
 		}
+		batchInterval, _ := time.ParseDuration(item.String("batch_interval"))
+
+		// The default number of retries applies only if it isn't set as 0 disables retries.
+		var maxRetries *int
+		if item.Exists("max_retries") {
+			n := item.Int("max_retries")
+			maxRetries = &n
+		}
 
 		opts = append(opts, webhooks.Opt{
-			UUID:     item.String("uuid"),
-			Name:     item.String("name"),
-			URL:      item.String("url"),
-			Secret:   item.String("secret"),
-			Events:   item.Strings("events"),
-			MaxConns: item.Int("max_conns"),
-			Timeout:  timeout,
+			UUID:       item.String("uuid"),
+			Name:       item.String("name"),
+			URL:        item.String("url"),
+			Secret:     item.String("secret"),
+			Events:     item.Strings("events"),
+			MaxConns:   item.Int("max_conns"),
+			MaxRetries: maxRetries,
+			Timeout:    timeout,
+
+			BatchSize:     item.Int("batch_size"),
+			BatchInterval: batchInterval,
+
+			Filter: webhooks.Filter{
+				CampaignTags: item.Strings("filter.campaign_tags"),
+				ListIDs:      item.Ints("filter.list_ids"),
+				Attribs:      item.Cut("filter.attribs").Raw(),
+			},
+			Fields: item.Strings("fields"),
+
+			PreviousSecret:       item.String("previous_secret"),
+			PreviousSecretExpiry: item.Time("previous_secret_expiry", time.RFC3339),
 		})
 
 		lo.Printf("loaded webhook endpoint: %s", item.String("name"))
@@ -766,7 +847,8 @@ func initWebhooks(ko *koanf.Koanf, lo *log.Logger) *webhooks.Manager {
 		return nil
 	}
 
-	m, err := webhooks.New(opts, lo)
+	// Deliveries are persisted in the DB and retried on failure.
+	m, err := webhooks.New(opts, newWebhookStore(q, ko.Bool("maintenance.webhook_log.enabled")), lo)
 	if err != nil {
 		lo.Printf("error initializing webhooks: %v", err)
 		return nil
@@ -775,6 +857,25 @@ func initWebhooks(ko *koanf.Koanf, lo *log.Logger) *webhooks.Manager {
 	return m
 }
 
+// initAutomation starts the automation rules engine. Rule actions run through
+// the core and the campaign manager (for transactional messages).
+func initAutomation(au *automation.Manager, co *core.Core, m *manager.Manager, ko *koanf.Koanf) {
+	if err := au.Start(newAutomationStore(co, m, ko.String("app.from_email"))); err != nil {
+		lo.Printf("error loading automation rules: %v", err)
+	}
+}
+
+// makeEventHook returns the hook that sends app events (subscriber.created etc.)
+// to the webhooks and automation managers.
+func makeEventHook(wh *webhooks.Manager, au *automation.Manager) func(event string, data any) {
+	return func(event string, data any) {
+		if wh != nil {
+			wh.Dispatch(event, data)
+		}
+		au.Handle(event, data)
+	}
+}
+
 // initMediaStore initializes Upload manager with a custom backend.
 func initMediaStore(ko *koanf.Koanf) media.Store {
 	switch provider := ko.String("upload.provider"); provider {
@@ -868,7 +969,7 @@ func initBounceManager(cb func(models.Bounce) error, stmt *sqlx.Stmt, lo *log.Lo
 		RecordBounceCB: cb,
 	}
 
-	// For now, only one mailbox is supported.
+	// Enabled mailboxes, which are scanned concurrently.
 	for _, b := range ko.Slices("bounce.mailboxes") {
 		if !b.Bool("enabled") {
 			continue
@@ -879,10 +980,11 @@ func initBounceManager(cb func(models.Bounce) error, stmt *sqlx.Stmt, lo *log.Lo
 			lo.Fatalf("error reading bounce mailbox config: %v", err)
 		}
 
-		opt.MailboxType = b.String("type")
-		opt.MailboxEnabled = true
-		opt.Mailbox = boxOpt
-		break
+		opt.Mailboxes = append(opt.Mailboxes, bounce.MailboxOpt{
+			UUID: b.String("uuid"),
+			Type: b.String("type"),
+			Opt:  boxOpt,
+		})
 	}
 
 	// Initialize the bounce manager.
@@ -1042,6 +1144,30 @@ func initCron(co *core.Core, db *sqlx.DB) {
 		}
 	}
 
+	// Webhook delivery log cleanup cron job.
+	if days := ko.Int("maintenance.webhook_log.retention_days"); days > 0 {
+		_, err := c.Add("@hourly", func() {
+			if n, err := co.DeleteWebhookLog(days); err == nil && n > 0 {
+				lo.Printf("deleted %d webhook delivery log entries older than %d days", n, days)
+			}
+		})
+		if err != nil {
+			lo.Printf("error initializing webhook delivery log cleanup cron: %v", err)
+		}
+	}
+
+	// Campaign send log cleanup cron job.
+	if days := ko.Int("maintenance.send_log.retention_days"); days > 0 {
+		_, err := c.Add("@hourly", func() {
+			if n, err := co.DeleteCampaignSends(days); err == nil && n > 0 {
+				lo.Printf("deleted %d campaign send log entries older than %d days", n, days)
+			}
+		})
+		if err != nil {
+			lo.Printf("error initializing campaign send log cleanup cron: %v", err)
+		}
+	}
+
 	if len(c.Entries()) > 0 {
 		c.Start()
 	}
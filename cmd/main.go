@@ -16,6 +16,7 @@ import (
 	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/v2"
 	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/automation"
 	"github.com/knadh/listmonk/internal/bounce"
 	"github.com/knadh/listmonk/internal/buflog"
 	"github.com/knadh/listmonk/internal/captcha"
@@ -48,6 +49,7 @@ type App struct {
 	media      media.Store
 	bounce     *bounce.Manager
 	webhooks   *webhooks.Manager
+	automation *automation.Manager
 	captcha    *captcha.Captcha
 	i18n       *i18n.I18n
 	pg         *paginator.Paginator
@@ -55,8 +57,9 @@ type App struct {
 	log        *log.Logger
 	bufLog     *buflog.BufLog
 
-	about         about
-	fnOptinNotify func(models.Subscriber, []int) (int, error)
+	about           about
+	fnOptinNotify   func(models.Subscriber, []int) (int, error)
+	fnDispatchEvent func(event string, data any)
 
 	// Channel for passing reload signals.
 	chReload chan os.Signal
@@ -186,19 +189,26 @@ func main() {
 		fbOptinNotify = makeOptinNotifyHook(ko.Bool("privacy.unsubscribe_header"), urlCfg, queries, i18n)
 
 		// Initialize the event webhooks manager.
-		webhooksMgr = initWebhooks(ko, lo)
+		webhooksMgr = initWebhooks(queries, ko, lo)
+
+		// Automation rules engine. It's started once the core and the campaign
+		// manager that it depends on are ready.
+		automationMgr = automation.New(lo)
+
+		// Hook that sends app events to webhooks and automation rules.
+		fnDispatchEvent = makeEventHook(webhooksMgr, automationMgr)
 
 		// Crud core.
-		core = initCore(fbOptinNotify, webhooksMgr, queries, db, i18n, ko)
+		core = initCore(fbOptinNotify, fnDispatchEvent, queries, db, i18n, ko)
 
 		// Initialize all messengers, SMTP and postback.
-		msgrs = append(initSMTPMessengers(), initPostbackMessengers(ko)...)
+		msgrs = append(initSMTPMessengers(queries), initPostbackMessengers(ko)...)
 
 		// Campaign manager.
-		mgr = initCampaignManager(msgrs, queries, urlCfg, core, media, webhooksMgr, i18n, ko)
+		mgr = initCampaignManager(msgrs, queries, db, urlCfg, core, media, fnDispatchEvent, i18n, ko)
 
 		// Bulk importer.
-		importer = initImporter(queries, db, core, i18n, ko)
+		importer = initImporter(queries, db, core, fnDispatchEvent, i18n, ko)
 
 		// Initialize the auth manager.
 		hasUsers, auth = initAuth(core, db.DB, ko)
@@ -230,6 +240,9 @@ func main() {
 	// Initialize and cache tx templates in memory.
 	initTxTemplates(mgr, core)
 
+	// Start the automation rules engine.
+	initAutomation(automationMgr, core, mgr, ko)
+
 	// Initialize the bounce manager that processes bounces from webhooks and
 	// POP3 mailbox scanning.
 	if ko.Bool("bounce.enabled") {
@@ -242,6 +255,13 @@ func main() {
 	// Set up the autoresponder hook now that both core and manager are available.
 	core.SetAutoresponderHook(makeAutoresponderHook(core, mgr))
 
+	// Start the scheduler that sends the delayed steps of autoresponder sequences.
+	// Like campaigns, they're not processed in passive mode. It's stopped when
+	// the manager is closed.
+	if !ko.Bool("passive") {
+		go mgr.RunAutoresponders(core)
+	}
+
 	// Start the campaign manager workers. The campaign batches (fetch from DB, push out
 	// messages) get processed at the specified interval.
 	go mgr.Run()
@@ -263,6 +283,7 @@ func main() {
 		media:      media,
 		bounce:     bounce,
 		webhooks:   webhooksMgr,
+		automation: automationMgr,
 		captcha:    initCaptcha(),
 		i18n:       i18n,
 		log:        lo,
@@ -278,9 +299,10 @@ func main() {
 			AllowAll:       true,
 		}),
 
-		fnOptinNotify: fbOptinNotify,
-		about:         initAbout(queries, db),
-		chReload:      chReload,
+		fnOptinNotify:   fbOptinNotify,
+		fnDispatchEvent: fnDispatchEvent,
+		about:           initAbout(queries, db),
+		chReload:        chReload,
 
 		// If there are no users, then the app needs to prompt for new user setup.
 		needsUserSetup: !hasUsers,
@@ -310,19 +332,21 @@ func main() {
 		// Close the campaign manager.
 		mgr.Close()
 
-		// Close the DB pool.
-		db.Close()
-
-		// Close the messenger pool.
+		// Close the messenger pool. This is done before closing the DB pool
+		// as messengers may save their state, eg: SMTP warm-up counts.
 		for _, m := range app.messengers {
 			m.Close()
 		}
 
-		// Close the webhooks manager.
+		// Close the webhooks manager. This is done before closing the DB pool
+		// as the dispatched events that are pending are persisted on close.
 		if app.webhooks != nil {
 			app.webhooks.Close()
 		}
 
+		// Close the DB pool.
+		db.Close()
+
 		// Signal the close.
 		closerWait <- true
 	})
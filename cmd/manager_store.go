@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
 	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
 	"github.com/knadh/listmonk/internal/core"
 	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/internal/media"
 	"github.com/knadh/listmonk/models"
 	"github.com/lib/pq"
+	null "gopkg.in/volatiletech/null.v6"
 )
 
 // store implements DataSource over the primary
 // database.
 type store struct {
 	queries *models.Queries
+	db      *sqlx.DB
 	core    *core.Core
 	media   media.Store
 }
@@ -23,11 +31,27 @@ type runningCamp struct {
 	LastSubscriberID int    `db:"last_subscriber_id"`
 	MaxSubscriberID  int    `db:"max_subscriber_id"`
 	ListID           int    `db:"list_id"`
+
+	ResendOf               int    `db:"resend_of"`
+	ResendAudience         string `db:"resend_audience"`
+	ResendLastSubscriberID int    `db:"resend_last_subscriber_id"`
+
+	ABPercent int  `db:"ab_percent"`
+	ABTesting bool `db:"ab_testing"`
+
+	LocalSend      bool      `db:"local_send"`
+	LocalTimezone  string    `db:"local_timezone"`
+	LocalTime      time.Time `db:"local_time"`
+	LocalWaveFrom  time.Time `db:"local_wave_from"`
+	LocalWaveUntil time.Time `db:"local_wave_until"`
+
+	Exclusions models.CampaignExclusions `db:"exclusions"`
 }
 
-func newManagerStore(q *models.Queries, c *core.Core, m media.Store) *store {
+func newManagerStore(q *models.Queries, db *sqlx.DB, c *core.Core, m media.Store) *store {
 	return &store{
 		queries: q,
+		db:      db,
 		core:    c,
 		media:   m,
 	}
@@ -38,8 +62,45 @@ func newManagerStore(q *models.Queries, c *core.Core, m media.Store) *store {
 // of campaigns that are being processed and updates them in the DB.
 func (s *store) NextCampaigns(currentIDs []int64, sentCounts []int64) ([]*models.Campaign, error) {
 	var out []*models.Campaign
-	err := s.queries.NextCampaigns.Select(&out, pq.Int64Array(currentIDs), pq.Int64Array(sentCounts))
-	return out, err
+	if err := s.queries.NextCampaigns.Select(&out, pq.Int64Array(currentIDs), pq.Int64Array(sentCounts)); err != nil {
+		return nil, err
+	}
+
+	// next-campaigns only counts the subscribers of the campaigns' lists. Count the
+	// campaigns that have segments or excluded segments when they (or their local time
+	// waves) start, and not every time they're picked up.
+	for _, c := range out {
+		if len(c.SegmentQueries) == 0 && len(c.ExcludeSegmentQueries) == 0 {
+			continue
+		}
+		if c.StartedAt.Valid && (!c.LocalSend || c.LocalWaveUntil.Valid) {
+			continue
+		}
+
+		var (
+			counts struct {
+				ToSend          int `db:"to_send"`
+				MaxSubscriberID int `db:"max_subscriber_id"`
+			}
+			stmt = strings.NewReplacer("%segments%", segmentsExp(c.SegmentQueries), "%exclude_segments%", segmentsExp(c.ExcludeSegmentQueries)).
+				Replace(s.queries.CountCampaignSegmentSubscribers)
+		)
+		err := s.readOnly(func(tx *sqlx.Tx) error {
+			return tx.Get(&counts, stmt, c.ID)
+		})
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if _, err := s.queries.UpdateCampaignSegmentCounts.Exec(c.ID, counts.ToSend, counts.MaxSubscriberID); err != nil {
+			return nil, err
+		}
+		c.ToSend = counts.ToSend
+	}
+
+	return out, nil
 }
 
 // NextSubscribers retrieves a subset of subscribers of a given campaign.
@@ -52,18 +113,80 @@ func (s *store) NextSubscribers(campID, limit int) ([]models.Subscriber, error)
 		return nil, err
 	}
 
-	var listIDs []int
+	if len(camps) == 0 {
+		return nil, nil
+	}
+
+	// A campaign without lists (only segments) has a single row with list_id 0.
+	listIDs := []int{}
 	for _, c := range camps {
-		listIDs = append(listIDs, c.ListID)
+		if c.ListID != 0 {
+			listIDs = append(listIDs, c.ListID)
+		}
+	}
+
+	var segs, exSegs []string
+	if err := s.queries.GetCampaignSegments.Select(&segs, campID); err != nil {
+		return nil, err
+	}
+	if err := s.queries.GetCampaignExclusionSegments.Select(&exSegs, campID); err != nil {
+		return nil, err
 	}
 
-	if len(listIDs) == 0 {
+	if len(listIDs) == 0 && len(segs) == 0 {
 		return nil, nil
 	}
 
-	var out []models.Subscriber
-	err := s.queries.NextCampaignSubscribers.Select(&out, camps[0].CampaignID, camps[0].CampaignType, camps[0].LastSubscriberID, camps[0].MaxSubscriberID, pq.Array(listIDs), limit)
-	return out, err
+	var (
+		out  []models.Subscriber
+		ex   = camps[0].Exclusions
+		stmt = strings.NewReplacer("%segments%", segmentsExp(segs), "%exclude_segments%", segmentsExp(exSegs)).
+			Replace(s.queries.NextCampaignSubscribers)
+	)
+	err := s.readOnly(func(tx *sqlx.Tx) error {
+		return tx.Select(&out, stmt, camps[0].CampaignID, camps[0].CampaignType, camps[0].LastSubscriberID, camps[0].MaxSubscriberID, pq.Array(listIDs), limit,
+			camps[0].ResendOf, camps[0].ResendAudience, camps[0].ResendLastSubscriberID, camps[0].ABPercent, camps[0].ABTesting,
+			camps[0].LocalSend, camps[0].LocalTimezone, camps[0].LocalTime, camps[0].LocalWaveFrom, camps[0].LocalWaveUntil,
+			pq.Array(ex.Lists), ex.SentWithinDays)
+	})
+	if err != nil || len(out) == 0 {
+		return out, err
+	}
+
+	// Move the checkpoint to the last subscriber in the batch so that the next fetch
+	// returns the next batch.
+	if _, err := s.queries.UpdateCampaignCounts.Exec(campID, 0, 0, out[len(out)-1].ID); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// readOnly runs fn in a read-only transaction. Queries with the query expressions of
+// segments, which are arbitrary SQL, are run in it like subscriber queries are.
+func (s *store) readOnly(fn func(tx *sqlx.Tx) error) error {
+	tx, err := s.db.BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return fn(tx)
+}
+
+// segmentsExp combines the query expressions of segments into a single expression
+// that matches the subscribers in any of them.
+func segmentsExp(queries []string) string {
+	if len(queries) == 0 {
+		return "FALSE"
+	}
+
+	exps := make([]string, 0, len(queries))
+	for _, q := range queries {
+		exps = append(exps, "("+q+")")
+	}
+
+	return strings.Join(exps, " OR ")
 }
 
 // GetCampaign fetches a campaign from the database.
@@ -73,6 +196,89 @@ func (s *store) GetCampaign(campID int) (*models.Campaign, error) {
 	return out, err
 }
 
+// FinishLocalWave marks the current wave of a local time campaign as sent and
+// returns the end of the wave.
+func (s *store) FinishLocalWave(campID int) (time.Time, error) {
+	var until time.Time
+	err := s.queries.FinishCampaignLocalWave.Get(&until, campID)
+	return until, err
+}
+
+// GetRecurringCampaigns retrieves the active recurring campaigns.
+func (s *store) GetRecurringCampaigns() ([]models.Campaign, error) {
+	var out []models.Campaign
+	err := s.queries.GetRecurringCampaigns.Select(&out)
+	return out, err
+}
+
+// UpdateRecurrence moves the next occurrence of a recurring campaign.
+func (s *store) UpdateRecurrence(campID int, cur null.Time, next time.Time) error {
+	_, err := s.queries.UpdateCampaignRecurrence.Exec(campID, cur, next)
+	return err
+}
+
+// CreateCampaignRun creates a run of a recurring campaign for an occurrence and moves
+// the campaign to its next occurrence. It returns 0 if the occurrence has already been run.
+func (s *store) CreateCampaignRun(campID int, name string, at, next time.Time) (int, error) {
+	var id int
+	err := s.queries.CreateCampaignRun.Get(&id, campID, at, next, uuid.Must(uuid.NewV4()), name)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// GetFeedCampaigns retrieves the active feed campaigns.
+func (s *store) GetFeedCampaigns() ([]models.Campaign, error) {
+	var out []models.Campaign
+	err := s.queries.GetFeedCampaigns.Select(&out)
+	return out, err
+}
+
+// UpdateFeedGUID records the last seen item of a feed campaign and its date.
+func (s *store) UpdateFeedGUID(campID int, cur, guid string, published null.Time) error {
+	_, err := s.queries.UpdateCampaignFeedGUID.Exec(campID, cur, guid, published)
+	return err
+}
+
+// CreateFeedRun creates a run of a feed campaign with the new items of its feed and records
+// the latest of them as the last seen item. It returns 0 if the items have already been run.
+func (s *store) CreateFeedRun(campID int, name, lastGUID string, f models.Feed) (int, error) {
+	var id int
+	err := s.queries.CreateFeedCampaignRun.Get(&id, campID, lastGUID, f.Items[0].GUID, uuid.Must(uuid.NewV4()), name, f,
+		f.Items[0].PublishedAt)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// UpdateVariantCounts increments the sent counts of a campaign's A/B test variants.
+func (s *store) UpdateVariantCounts(ids []int, counts []int) error {
+	_, err := s.queries.UpdateCampaignVariantCounts.Exec(pq.Array(ids), pq.Array(counts))
+	return err
+}
+
+// FinishABTest marks the A/B test of a campaign as sent.
+func (s *store) FinishABTest(campID int) error {
+	_, err := s.queries.FinishCampaignABTest.Exec(campID)
+	return err
+}
+
+// GetABTestResults returns the sent counts and the unique views and clicks of
+// the A/B test variants of a campaign by the subscribers in the test.
+func (s *store) GetABTestResults(campID int) ([]models.CampaignAnalyticsVariant, error) {
+	var out []models.CampaignAnalyticsVariant
+	err := s.queries.GetCampaignVariantStats.Select(&out, pq.Array([]int{campID}), "-infinity", "infinity")
+	return out, err
+}
+
+// SetABWinner records the winning A/B test variant of a campaign.
+func (s *store) SetABWinner(campID, variantID int) error {
+	_, err := s.queries.UpdateCampaignABWinner.Exec(campID, variantID)
+	return err
+}
+
 // UpdateCampaignStatus updates a campaign's status.
 func (s *store) UpdateCampaignStatus(campID int, status string) error {
 	_, err := s.queries.UpdateCampaignStatus.Exec(campID, status)
@@ -150,3 +356,73 @@ func (s *store) DeleteSubscriber(id int64) error {
 	_, err := s.queries.DeleteSubscribers.Exec(pq.Int64Array{id})
 	return err
 }
+
+// RecordSends writes a batch of campaign sends to the send log.
+func (s *store) RecordSends(sends []models.CampaignSend) error {
+	var (
+		campIDs    = make([]int, len(sends))
+		subIDs     = make([]int, len(sends))
+		messengers = make([]string, len(sends))
+		statuses   = make([]string, len(sends))
+		errs       = make([]string, len(sends))
+		dates      = make([]string, len(sends))
+	)
+	for i, c := range sends {
+		campIDs[i] = c.CampaignID
+		subIDs[i] = c.SubscriberID
+		messengers[i] = c.Messenger
+		statuses[i] = c.Status
+		errs[i] = strings.ToValidUTF8(c.Error, "")
+		dates[i] = c.CreatedAt.Time.Format(time.RFC3339Nano)
+	}
+
+	_, err := s.queries.InsertCampaignSends.Exec(pq.Array(campIDs), pq.Array(subIDs), pq.Array(messengers),
+		pq.Array(statuses), pq.Array(errs), pq.Array(dates))
+	return err
+}
+
+// GetFrequencyCounts returns the number of campaign messages sent to each of
+// the given subscribers since a time.
+func (s *store) GetFrequencyCounts(subIDs []int, since time.Time) (map[int]int, error) {
+	var res []struct {
+		SubscriberID int `db:"subscriber_id"`
+		Num          int `db:"num"`
+	}
+	if err := s.queries.GetFrequencyCounts.Select(&res, pq.Array(subIDs), since); err != nil {
+		return nil, err
+	}
+
+	out := make(map[int]int, len(res))
+	for _, r := range res {
+		out[r.SubscriberID] = r.Num
+	}
+
+	return out, nil
+}
+
+// RecordFrequencySends writes a batch of messages counted towards the frequency cap.
+func (s *store) RecordFrequencySends(sends []models.FrequencySend) error {
+	var (
+		campIDs = make([]int, len(sends))
+		subIDs  = make([]int, len(sends))
+		capped  = make([]bool, len(sends))
+		dates   = make([]string, len(sends))
+	)
+	for i, c := range sends {
+		campIDs[i] = c.CampaignID
+		subIDs[i] = c.SubscriberID
+		capped[i] = c.Capped
+		dates[i] = c.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	_, err := s.queries.InsertFrequencySends.Exec(pq.Array(campIDs), pq.Array(subIDs), pq.Array(capped), pq.Array(dates))
+	return err
+}
+
+// DeleteFrequencySends deletes the sent messages before a time that no longer
+// count towards the frequency cap.
+func (s *store) DeleteFrequencySends(before time.Time) (int, error) {
+	var n int
+	err := s.queries.DeleteFrequencySends.Get(&n, before)
+	return n, err
+}
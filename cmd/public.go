@@ -544,19 +544,20 @@ func (a *App) LinkRedirect(c echo.Context) error {
 		linkUUID = c.Param("linkUUID")
 		campUUID = c.Param("campUUID")
 	)
-	url, err := a.core.RegisterCampaignLinkClick(linkUUID, campUUID, subUUID)
+	url, tags, err := a.core.RegisterCampaignLinkClick(linkUUID, campUUID, subUUID)
 	if err != nil {
 		e := err.(*echo.HTTPError)
 		return c.Render(e.Code, tplMessage, makeMsgTpl(a.i18n.T("public.errorTitle"), "", e.Error()))
 	}
 
 	// Dispatch webhook event.
-	if a.webhooks != nil {
-		a.webhooks.Dispatch(webhooks.EventLinkClick, map[string]any{
+	if a.fnDispatchEvent != nil {
+		a.fnDispatchEvent(webhooks.EventLinkClick, map[string]any{
 			"link_uuid":       linkUUID,
 			"campaign_uuid":   campUUID,
 			"subscriber_uuid": subUUID,
 			"url":             url,
+			"campaign_tags":   tags,
 		})
 	}
 
@@ -577,13 +578,14 @@ func (a *App) RegisterCampaignView(c echo.Context) error {
 	// Exclude dummy hits from template previews.
 	campUUID := c.Param("campUUID")
 	if campUUID != dummyUUID && subUUID != dummyUUID {
-		if err := a.core.RegisterCampaignView(campUUID, subUUID); err != nil {
+		if tags, err := a.core.RegisterCampaignView(campUUID, subUUID); err != nil {
 			a.log.Printf("error registering campaign view: %s", err)
-		} else if a.webhooks != nil {
+		} else if a.fnDispatchEvent != nil {
 			// Dispatch webhook event on success.
-			a.webhooks.Dispatch(webhooks.EventEmailOpen, map[string]any{
+			a.fnDispatchEvent(webhooks.EventEmailOpen, map[string]any{
 				"campaign_uuid":   campUUID,
 				"subscriber_uuid": subUUID,
+				"campaign_tags":   tags,
 			})
 		}
 	}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetSegments retrieves all segments with their subscriber counts.
+func (a *App) GetSegments(c echo.Context) error {
+	out, err := a.core.GetSegments()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetSegment retrieves a single segment by id.
+func (a *App) GetSegment(c echo.Context) error {
+	out, err := a.core.GetSegment(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateSegment handles segment creation.
+func (a *App) CreateSegment(c echo.Context) error {
+	var s models.Segment
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+
+	s, err := a.validateSegment(s)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateSegment(s)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateSegment handles segment modification.
+func (a *App) UpdateSegment(c echo.Context) error {
+	var s models.Segment
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+
+	s, err := a.validateSegment(s)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateSegment(getID(c), s)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteSegment deletes a segment.
+func (a *App) DeleteSegment(c echo.Context) error {
+	if err := a.core.DeleteSegment(getID(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateSegment validates segment fields.
+func (a *App) validateSegment(s models.Segment) (models.Segment, error) {
+	s.Name = strings.TrimSpace(s.Name)
+	if !strHasLen(s.Name, 1, stdInputMaxLen) {
+		return s, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("segments.invalidName"))
+	}
+
+	s.Query = formatSQLExp(s.Query)
+	if s.Query == "" {
+		return s, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("segments.invalidQuery"))
+	}
+
+	return s, nil
+}
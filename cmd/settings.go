@@ -20,13 +20,21 @@ import (
 	"github.com/knadh/koanf/providers/rawbytes"
 	"github.com/knadh/koanf/v2"
 	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/internal/messenger/email"
 	"github.com/knadh/listmonk/internal/notifs"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
 
-const pwdMask = "•"
+const (
+	pwdMask = "•"
+
+	// Duration for which the previous secret of a webhook remains valid
+	// after the secret is changed.
+	webhookSecretRotationWindow = 24 * time.Hour
+)
 
 type aboutHost struct {
 	OS       string `json:"os"`
@@ -73,6 +81,7 @@ func (a *App) GetSettings(c echo.Context) error {
 	}
 	for i := range s.Webhooks {
 		s.Webhooks[i].Secret = strings.Repeat(pwdMask, utf8.RuneCountInString(s.Webhooks[i].Secret))
+		s.Webhooks[i].PreviousSecret = ""
 	}
 
 	s.UploadS3AwsSecretAccessKey = strings.Repeat(pwdMask, utf8.RuneCountInString(s.UploadS3AwsSecretAccessKey))
@@ -148,6 +157,21 @@ func (a *App) UpdateSettings(c echo.Context) error {
 				}
 			}
 		}
+
+		// Warm-up plan. It starts today unless a start date is given.
+		if s.WarmupEnabled {
+			if _, err := email.ParseWarmupVolumes(s.WarmupVolumes); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					a.i18n.Ts("settings.smtp.invalidWarmup", "error", err.Error()))
+			}
+
+			if s.WarmupStart == "" {
+				set.SMTP[i].WarmupStart = time.Now().Format("2006-01-02")
+			} else if _, err := time.Parse("2006-01-02", s.WarmupStart); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					a.i18n.Ts("settings.smtp.invalidWarmup", "error", s.WarmupStart))
+			}
+		}
 	}
 	if !has {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("settings.errorNoSMTP"))
@@ -170,10 +194,27 @@ func (a *App) UpdateSettings(c echo.Context) error {
 		// This is a common mistake when copy-pasting SMTP settings.
 		set.BounceBoxes[i].Host = strings.TrimSpace(s.Host)
 
+		if s.Type != "pop" && s.Type != "imap" {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "type"))
+		}
+
 		if d, _ := time.ParseDuration(s.ScanInterval); d.Minutes() < 1 {
 			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("settings.bounces.invalidScanInterval"))
 		}
 
+		// IMAP messages can't be moved to the folder that's scanned (INBOX by default).
+		set.BounceBoxes[i].Folder = strings.TrimSpace(s.Folder)
+		set.BounceBoxes[i].MoveTo = strings.TrimSpace(s.MoveTo)
+		if s.Type == "imap" && set.BounceBoxes[i].MoveTo != "" {
+			folder := set.BounceBoxes[i].Folder
+			if folder == "" {
+				folder = "INBOX"
+			}
+			if strings.EqualFold(set.BounceBoxes[i].MoveTo, folder) {
+				return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("settings.bounces.invalidMoveTo"))
+			}
+		}
+
 		// If there's no password coming in from the frontend, copy the existing
 		// password by matching the UUID.
 		if s.Password == "" {
@@ -212,6 +253,41 @@ func (a *App) UpdateSettings(c echo.Context) error {
 		names[name] = true
 	}
 
+	// Messenger rate limits. There can be one per messenger.
+	limits := make(map[string]bool, len(set.AppMessengerLimits))
+	for _, l := range set.AppMessengerLimits {
+		dur, _ := time.ParseDuration(l.SlidingWindowDuration)
+		if !names[l.Messenger] || limits[l.Messenger] || l.MessageRate < 0 || l.SlidingWindowRate < 0 ||
+			(l.SlidingWindow && dur <= time.Second) {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("settings.performance.invalidMessengerLimit", "name", l.Messenger))
+		}
+		limits[l.Messenger] = true
+	}
+
+	// Recipient domain rate limits. Domains are normalized, eg: *@Gmail.com => gmail.com.
+	domains := make(map[string]bool, len(set.AppDomainLimits))
+	for i, l := range set.AppDomainLimits {
+		d := strings.ToLower(strings.TrimLeft(strings.TrimSpace(l.Domain), "*@"))
+		if d == "" || strings.ContainsAny(d, "@ ") || domains[d] || l.Rate < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("settings.performance.invalidDomainLimit", "name", l.Domain))
+		}
+
+		set.AppDomainLimits[i].Domain = d
+		domains[d] = true
+	}
+
+	if err := manager.ValidateQuietHours(set.AppQuietHours); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("settings.performance.invalidQuietHours", "error", err.Error()))
+	}
+
+	if err := manager.ValidateFrequencyCap(set.AppFrequencyCap); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("settings.performance.invalidFrequencyCap", "error", err.Error()))
+	}
+
 	// Webhooks.
 	for i, w := range set.Webhooks {
 		// UUID to keep track of secret changes similar to the SMTP logic above.
@@ -219,11 +295,22 @@ func (a *App) UpdateSettings(c echo.Context) error {
 			set.Webhooks[i].UUID = uuid.Must(uuid.NewV4()).String()
 		}
 
-		if w.Secret == "" {
-			for _, c := range cur.Webhooks {
-				if w.UUID == c.UUID {
-					set.Webhooks[i].Secret = c.Secret
-				}
+		// The previous secret is never sent by the client. Retain the current one, or
+		// if the secret has changed, keep the old secret valid for the rotation window.
+		set.Webhooks[i].PreviousSecret = ""
+		set.Webhooks[i].PreviousSecretExpiry = ""
+		for _, c := range cur.Webhooks {
+			if w.UUID != c.UUID {
+				continue
+			}
+
+			if w.Secret == "" || w.Secret == c.Secret {
+				set.Webhooks[i].Secret = c.Secret
+				set.Webhooks[i].PreviousSecret = c.PreviousSecret
+				set.Webhooks[i].PreviousSecretExpiry = c.PreviousSecretExpiry
+			} else if c.Secret != "" {
+				set.Webhooks[i].PreviousSecret = c.Secret
+				set.Webhooks[i].PreviousSecretExpiry = time.Now().Add(webhookSecretRotationWindow).Format(time.RFC3339)
 			}
 		}
 	}
@@ -394,7 +481,7 @@ func (a *App) TestSMTPSettings(c echo.Context) error {
 	req.MaxConns = 1
 	req.IdleTimeout = time.Second * 2
 	req.PoolWaitTimeout = time.Second * 2
-	msgr, err := email.New("", req)
+	msgr, err := email.New("", nil, req)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest,
 			a.i18n.Ts("globals.messages.errorCreating", "name", "SMTP", "error", err.Error()))
@@ -419,6 +506,65 @@ func (a *App) TestSMTPSettings(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{a.bufLog.Lines()})
 }
 
+// TestWebhookSettings sends a sample payload of an event to a webhook endpoint
+// and returns the endpoint's response.
+func (a *App) TestWebhookSettings(c echo.Context) error {
+	var req struct {
+		UUID      string `json:"uuid"`
+		Name      string `json:"name"`
+		URL       string `json:"url"`
+		Secret    string `json:"secret"`
+		Timeout   string `json:"timeout"`
+		BatchSize int    `json:"batch_size"`
+		Event     string `json:"event"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if !strHasLen(req.URL, 1, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "url"))
+	}
+	if req.Event == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.missingFields", "name", "event"))
+	}
+
+	timeout, _ := time.ParseDuration(req.Timeout)
+	o := webhooks.Opt{
+		UUID:      req.UUID,
+		Name:      req.Name,
+		URL:       req.URL,
+		Secret:    req.Secret,
+		Timeout:   timeout,
+		BatchSize: req.BatchSize,
+	}
+
+	// The secret of a saved endpoint is masked in the UI. Use the stored one
+	// along with the previous secret if it's being rotated.
+	if req.Secret != "" && strings.Trim(req.Secret, pwdMask) == "" {
+		cur, err := a.core.GetSettings()
+		if err != nil {
+			return err
+		}
+
+		o.Secret = ""
+		for _, w := range cur.Webhooks {
+			if w.UUID == req.UUID {
+				o.Secret = w.Secret
+				o.PreviousSecret = w.PreviousSecret
+				o.PreviousSecretExpiry, _ = time.Parse(time.RFC3339, w.PreviousSecretExpiry)
+			}
+		}
+	}
+
+	res, err := webhooks.Test(o, req.Event)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, okResp{res})
+}
+
 func (a *App) GetAboutInfo(c echo.Context) error {
 	var mem runtime.MemStats
 	runtime.ReadMemStats(&mem)
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/lib/pq"
+)
+
+// warmupStore implements email.WarmupStore over the primary database.
+type warmupStore struct {
+	queries *models.Queries
+}
+
+func newWarmupStore(q *models.Queries) *warmupStore {
+	return &warmupStore{queries: q}
+}
+
+// GetWarmupCounts returns the number of messages sent by SMTP servers on a day.
+func (s *warmupStore) GetWarmupCounts(day time.Time) (map[string]int, error) {
+	var res []struct {
+		UUID string `db:"server_uuid"`
+		Sent int    `db:"sent"`
+	}
+	if err := s.queries.GetSMTPWarmup.Select(&res, day.Format("2006-01-02")); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]int, len(res))
+	for _, r := range res {
+		out[r.UUID] = r.Sent
+	}
+
+	return out, nil
+}
+
+// AddWarmupCounts adds to the number of messages sent by SMTP servers on a day.
+func (s *warmupStore) AddWarmupCounts(day time.Time, counts map[string]int) error {
+	var (
+		uuids = make([]string, 0, len(counts))
+		sent  = make([]int64, 0, len(counts))
+	)
+	for u, n := range counts {
+		uuids = append(uuids, u)
+		sent = append(sent, int64(n))
+	}
+
+	_, err := s.queries.AddSMTPWarmup.Exec(pq.Array(uuids), day.Format("2006-01-02"), pq.Array(sent))
+	return err
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetWebhookDeadLetters handles retrieval of webhook deliveries that have
+// permanently failed.
+func (a *App) GetWebhookDeadLetters(c echo.Context) error {
+	var (
+		endpoint = c.FormValue("endpoint")
+		event    = c.FormValue("event")
+
+		pg = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	res, total, err := a.core.QueryWebhookDeadLetters(endpoint, event, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.WebhookDeadLetter{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetWebhookDeliveries handles retrieval of the delivery log of a webhook endpoint.
+func (a *App) GetWebhookDeliveries(c echo.Context) error {
+	var (
+		uuid   = c.Param("uuid")
+		event  = c.FormValue("event")
+		status = c.FormValue("status")
+
+		pg = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	if !reUUID.MatchString(uuid) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidUUID"))
+	}
+
+	switch status {
+	case "", "success", "failed":
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	res, total, err := a.core.QueryWebhookLog(uuid, event, status, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.WebhookLog{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetWebhookDeadLetter handles retrieval of a single failed webhook delivery
+// along with its payload.
+func (a *App) GetWebhookDeadLetter(c echo.Context) error {
+	out, err := a.core.GetWebhookDeadLetter(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// ReplayWebhookDeadLetters handles re-queuing of one or more failed webhook
+// deliveries. They're sent again with a fresh set of retries.
+func (a *App) ReplayWebhookDeadLetters(c echo.Context) error {
+	var ids []int
+	if c.Param("id") != "" {
+		ids = []int{getID(c)}
+	} else {
+		// There are multiple IDs in the query string.
+		res, err := parseStringIDs(c.Request().URL.Query()["id"])
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidID", "error", err.Error()))
+		}
+		if len(res) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidID"))
+		}
+
+		ids = res
+	}
+
+	n, err := a.core.ReplayWebhookDeadLetters(ids)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{n})
+}
+
+// DeleteWebhookDeadLetters handles deletion of one or more (or all) failed
+// webhook deliveries.
+func (a *App) DeleteWebhookDeadLetters(c echo.Context) error {
+	all, _ := strconv.ParseBool(c.QueryParam("all"))
+
+	var ids []int
+	if c.Param("id") != "" {
+		ids = []int{getID(c)}
+	} else if !all {
+		// There are multiple IDs in the query string.
+		res, err := parseStringIDs(c.Request().URL.Query()["id"])
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidID", "error", err.Error()))
+		}
+		if len(res) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidID"))
+		}
+
+		ids = res
+	}
+
+	if err := a.core.DeleteWebhookDeadLetters(ids, all); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/webhooks"
+	"github.com/knadh/listmonk/models"
+	"github.com/lib/pq"
+)
+
+// webhookStore implements webhooks.Store over the primary database.
+type webhookStore struct {
+	queries *models.Queries
+
+	// Record delivery attempts in the delivery log.
+	logEnabled bool
+}
+
+func newWebhookStore(q *models.Queries, logEnabled bool) *webhookStore {
+	return &webhookStore{queries: q, logEnabled: logEnabled}
+}
+
+// CreateDelivery persists a new pending webhook delivery.
+func (s *webhookStore) CreateDelivery(d webhooks.Delivery) (int64, error) {
+	var id int64
+	err := s.queries.CreateWebhookDelivery.Get(&id, d.UUID, d.EndpointUUID, d.Event, string(d.Payload), d.NextAttemptAt)
+	return id, err
+}
+
+// NextDeliveries retrieves and reserves pending deliveries that are due.
+func (s *webhookStore) NextDeliveries(endpointUUIDs []string, limit int, lease time.Duration) ([]webhooks.Delivery, error) {
+	var res []models.WebhookDelivery
+	if err := s.queries.NextWebhookDeliveries.Select(&res, pq.Array(endpointUUIDs), limit, lease.Seconds()); err != nil {
+		return nil, err
+	}
+
+	out := make([]webhooks.Delivery, 0, len(res))
+	for _, d := range res {
+		out = append(out, webhooks.Delivery{
+			ID:            d.ID,
+			UUID:          d.UUID,
+			EndpointUUID:  d.EndpointUUID,
+			Event:         d.Event,
+			Payload:       d.Payload,
+			Attempts:      d.Attempts,
+			LastError:     d.LastError,
+			NextAttemptAt: d.NextAttemptAt.Time,
+		})
+	}
+
+	return out, nil
+}
+
+// RetryDelivery records a failed attempt and the time of the next one.
+func (s *webhookStore) RetryDelivery(d webhooks.Delivery) error {
+	_, err := s.queries.RetryWebhookDelivery.Exec(d.ID, d.Attempts, d.LastError, d.NextAttemptAt)
+	return err
+}
+
+// CompleteDelivery deletes a successfully sent delivery.
+func (s *webhookStore) CompleteDelivery(id int64) error {
+	_, err := s.queries.DeleteWebhookDelivery.Exec(id)
+	return err
+}
+
+// FailDelivery moves a delivery to the dead-letter queue.
+func (s *webhookStore) FailDelivery(d webhooks.Delivery) error {
+	_, err := s.queries.FailWebhookDelivery.Exec(d.ID, d.Attempts, d.LastError)
+	return err
+}
+
+// LogAttempt records a delivery attempt and the endpoint's response in the delivery log.
+func (s *webhookStore) LogAttempt(a webhooks.Attempt) error {
+	if !s.logEnabled {
+		return nil
+	}
+
+	_, err := s.queries.InsertWebhookLog.Exec(a.EndpointUUID, a.DeliveryID, a.DeliveryUUID, a.Event, string(a.Payload),
+		a.Attempt, a.StatusCode, strings.ToValidUTF8(a.Response, ""), a.Error, a.Latency.Milliseconds())
+	return err
+}
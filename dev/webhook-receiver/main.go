@@ -12,6 +12,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,11 +20,11 @@ import (
 
 // WebhookEvent represents a received webhook event.
 type WebhookEvent struct {
-	Event         string    `json:"event"`
-	Timestamp     time.Time `json:"timestamp"`
-	Data          any       `json:"data"`
-	ReceivedAt    time.Time `json:"received_at"`
-	SignatureValid bool     `json:"signature_valid"`
+	Event          string    `json:"event"`
+	Timestamp      time.Time `json:"timestamp"`
+	Data           any       `json:"data"`
+	ReceivedAt     time.Time `json:"received_at"`
+	SignatureValid bool      `json:"signature_valid"`
 }
 
 // Server holds the webhook receiver state.
@@ -80,13 +81,16 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	// Verify signature if secret is configured.
 	signatureValid := true
 	if s.secret != "" {
-		sig := r.Header.Get("X-Webhook-Signature")
-		signatureValid = s.verifySignature(body, sig)
+		var (
+			ts  = r.Header.Get("X-Webhook-Timestamp")
+			sig = r.Header.Get("X-Webhook-Signature")
+		)
+		signatureValid = s.verifySignature(ts, body, sig)
 		if signatureValid {
 			log.Printf("signature: valid")
 		} else {
 			log.Printf("signature: INVALID (expected sha256=%s, got %s)",
-				computeHMAC(body, s.secret), sig)
+				computeHMAC(ts, body, s.secret), sig)
 		}
 	}
 
@@ -107,7 +111,7 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	s.mu.Unlock()
 
 	// Log the event.
-	log.Printf("Received event: %s", event.Event)
+	log.Printf("Received event: %s (%s)", event.Event, r.Header.Get("X-Webhook-ID"))
 	log.Printf("  Timestamp: %s", event.Timestamp.Format(time.RFC3339))
 	log.Printf("  Data: %v", event.Data)
 
@@ -171,21 +175,31 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, `{"status": "healthy", "events_received": %d}`, count)
 }
 
-// verifySignature verifies the HMAC-SHA256 signature.
-func (s *Server) verifySignature(payload []byte, signature string) bool {
-	if !strings.HasPrefix(signature, "sha256=") {
+// verifySignature verifies the HMAC-SHA256 signature(s) and rejects requests
+// older than 5 minutes.
+func (s *Server) verifySignature(ts string, payload []byte, signature string) bool {
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(t, 0)) > 5*time.Minute {
 		return false
 	}
 
-	sig := strings.TrimPrefix(signature, "sha256=")
-	expected := computeHMAC(payload, s.secret)
+	expected := computeHMAC(ts, payload, s.secret)
+	for _, sig := range strings.Split(signature, ",") {
+		if !strings.HasPrefix(sig, "sha256=") {
+			continue
+		}
+		if hmac.Equal([]byte(strings.TrimPrefix(sig, "sha256=")), []byte(expected)) {
+			return true
+		}
+	}
 
-	return hmac.Equal([]byte(sig), []byte(expected))
+	return false
 }
 
-// computeHMAC generates the HMAC-SHA256 signature.
-func computeHMAC(payload []byte, secret string) string {
+// computeHMAC generates the HMAC-SHA256 signature of "{timestamp}.{payload}".
+func computeHMAC(ts string, payload []byte, secret string) string {
 	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
 	mac.Write(payload)
 	return hex.EncodeToString(mac.Sum(nil))
 }
@@ -162,6 +162,34 @@ export const deleteLists = (params) => http.delete(
   { params, loading: models.lists },
 );
 
+// Segments.
+export const getSegments = () => http.get(
+  '/api/segments',
+  { loading: models.segments, store: models.segments },
+);
+
+export const getSegment = (id) => http.get(
+  `/api/segments/${id}`,
+  { loading: models.segments },
+);
+
+export const createSegment = (data) => http.post(
+  '/api/segments',
+  data,
+  { loading: models.segments },
+);
+
+export const updateSegment = (data) => http.put(
+  `/api/segments/${data.id}`,
+  data,
+  { loading: models.segments },
+);
+
+export const deleteSegment = (id) => http.delete(
+  `/api/segments/${id}`,
+  { loading: models.segments },
+);
+
 // Subscribers.
 export const getSubscribers = async (params) => http.get(
   '/api/subscribers',
@@ -208,6 +236,10 @@ export const blocklistBouncedSubscribers = async () => http.put(
   { loading: models.bounces },
 );
 
+export const getBounceMailboxes = async () => http.get('/api/bounces/mailboxes');
+
+export const scanBounceMailbox = async (uuid) => http.post(`/api/bounces/mailboxes/${uuid}/scan`);
+
 export const createSubscriber = (data) => http.post(
   '/api/subscribers',
   data,
@@ -326,6 +358,11 @@ export const getCampaignLinkCounts = async (params) => http.get(
   { params, loading: models.campaigns },
 );
 
+export const getCampaignVariantStats = async (params) => http.get(
+  '/api/campaigns/analytics/variants',
+  { params, loading: models.campaigns },
+);
+
 export const convertCampaignContent = async (data) => http.post(
   `/api/campaigns/${data.id}/content`,
   data,
@@ -357,6 +394,18 @@ export const updateCampaignArchive = async (id, data) => http.put(
   { loading: models.campaigns },
 );
 
+export const resendCampaign = async (id, data) => http.post(
+  `/api/campaigns/${id}/resend`,
+  data,
+  { loading: models.campaigns },
+);
+
+export const skipCampaignRun = async (id) => http.put(
+  `/api/campaigns/${id}/skip`,
+  {},
+  { loading: models.campaigns },
+);
+
 export const deleteCampaign = async (id) => http.delete(
   `/api/campaigns/${id}`,
   { loading: models.campaigns },
@@ -447,6 +496,12 @@ export const testSMTP = async (data) => http.post(
   { loading: models.settings, disableToast: true },
 );
 
+export const testWebhook = async (data) => http.post(
+  '/api/settings/webhooks/test',
+  data,
+  { loading: models.settings, disableToast: true },
+);
+
 export const getLogs = async () => http.get(
   '/api/logs',
   { loading: models.logs, camelCase: false },
@@ -53,6 +53,12 @@ const routes = [
     meta: { title: 'globals.terms.bounces', group: 'subscribers' },
     component: () => import('../views/Bounces.vue'),
   },
+  {
+    path: '/subscribers/segments',
+    name: 'segments',
+    meta: { title: 'globals.terms.segments', group: 'subscribers' },
+    component: () => import('../views/Segments.vue'),
+  },
   {
     path: '/subscribers/lists/:listID',
     name: 'subscribers_list',
@@ -0,0 +1,355 @@
+package automation
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/knadh/listmonk/internal/webhooks"
+	"github.com/knadh/listmonk/models"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// Max number of events queued for processing. Events are dropped
+	// when the queue is full.
+	queueSize = 10000
+
+	// TriggerAttribChange is the trigger for changes to a subscriber's
+	// attributes, optionally, a specific attribute.
+	TriggerAttribChange = "subscriber.attrib_changed"
+)
+
+// Triggers is the list of events that can trigger rules.
+var Triggers = []string{
+	webhooks.EventSubscriberCreated,
+	webhooks.EventSubscriberUpdated,
+	webhooks.EventSubscriberConfirmed,
+	webhooks.EventSubscriberUnsubscribed,
+	webhooks.EventSubscriberBlocklisted,
+	webhooks.EventLinkClick,
+	webhooks.EventEmailOpen,
+	webhooks.EventBounce,
+	TriggerAttribChange,
+}
+
+// Store represents functions for fetching rules and subscribers, running
+// rule actions, and recording rule runs.
+type Store interface {
+	// GetRules returns all enabled rules.
+	GetRules() ([]models.AutomationRule, error)
+
+	GetSubscriber(id int, uuid string) (models.Subscriber, error)
+	AddSubscriptions(subID int, listIDs []int, status string) error
+	DeleteSubscriptions(subID int, listIDs []int) error
+	SetAttribs(subID int, attribs map[string]any) error
+	SendTx(sub models.Subscriber, tplID int, data map[string]any) error
+	Blocklist(subID int) error
+
+	LogRun(l models.AutomationLog) error
+}
+
+// event represents an event queued for processing.
+type event struct {
+	name string
+	data any
+}
+
+// rule is an automation rule with its compiled condition.
+type rule struct {
+	models.AutomationRule
+	cond *Condition
+}
+
+// Manager runs automation rules on events.
+type Manager struct {
+	store Store
+	log   *log.Logger
+	queue chan event
+
+	// Enabled rules by their trigger.
+	rules   map[string][]rule
+	rulesMu sync.RWMutex
+
+	// IDs of subscribers whose rule actions are being run. Events raised
+	// by the actions (eg: blocklisting) are ignored so that rules don't
+	// trigger each other in a loop.
+	acting   map[int]struct{}
+	actingMu sync.Mutex
+}
+
+// New returns a new instance of the automation Manager. Events that are
+// received before the Manager is started are ignored.
+func New(lo *log.Logger) *Manager {
+	return &Manager{
+		log:    lo,
+		queue:  make(chan event, queueSize),
+		rules:  map[string][]rule{},
+		acting: map[int]struct{}{},
+	}
+}
+
+// Start loads the rules from the store and starts processing events.
+func (m *Manager) Start(st Store) error {
+	m.store = st
+	if err := m.Load(); err != nil {
+		return err
+	}
+
+	go m.worker()
+	return nil
+}
+
+// Load (re)loads the enabled rules from the store. Rules with invalid
+// conditions are skipped.
+func (m *Manager) Load() error {
+	rules, err := m.store.GetRules()
+	if err != nil {
+		return err
+	}
+
+	out := make(map[string][]rule)
+	for _, r := range rules {
+		cond, err := ParseCondition(r.Condition)
+		if err != nil {
+			m.log.Printf("automation: skipping rule '%s': invalid condition: %v", r.Name, err)
+			continue
+		}
+
+		// Attribute changes are detected on subscriber updates.
+		trigger := r.Trigger
+		if trigger == TriggerAttribChange {
+			trigger = webhooks.EventSubscriberUpdated
+		}
+		out[trigger] = append(out[trigger], rule{AutomationRule: r, cond: cond})
+	}
+
+	m.rulesMu.Lock()
+	m.rules = out
+	m.rulesMu.Unlock()
+
+	return nil
+}
+
+// Handle queues an event for processing if there are rules for it.
+// It doesn't block and can be used as an event hook.
+func (m *Manager) Handle(name string, data any) {
+	m.rulesMu.RLock()
+	n := len(m.rules[name])
+	m.rulesMu.RUnlock()
+	if n == 0 || m.isFromRule(data) {
+		return
+	}
+
+	select {
+	case m.queue <- event{name: name, data: data}:
+	default:
+		m.log.Printf("automation: event queue full, dropping event %s", name)
+	}
+}
+
+// worker processes queued events.
+func (m *Manager) worker() {
+	for ev := range m.queue {
+		m.process(ev)
+	}
+}
+
+// process runs the rules of an event on the subscribers in the event.
+func (m *Manager) process(ev event) {
+	m.rulesMu.RLock()
+	rules := m.rules[ev.name]
+	m.rulesMu.RUnlock()
+	if len(rules) == 0 {
+		return
+	}
+
+	data, err := toMap(ev.data)
+	if err != nil {
+		m.log.Printf("automation: error decoding event %s: %v", ev.name, err)
+		return
+	}
+
+	ids, uuids := subscriberRefs(data)
+	subs := make([]models.Subscriber, 0, len(ids)+len(uuids))
+	for _, id := range ids {
+		if sub, err := m.store.GetSubscriber(id, ""); err == nil {
+			subs = append(subs, sub)
+		}
+	}
+	for _, uu := range uuids {
+		if sub, err := m.store.GetSubscriber(0, uu); err == nil {
+			subs = append(subs, sub)
+		}
+	}
+
+	for _, sub := range subs {
+		s, err := toMap(sub)
+		if err != nil {
+			continue
+		}
+		env := map[string]any{
+			"subscriber": s,
+			"event":      data,
+		}
+
+		for _, r := range rules {
+			if r.Trigger == TriggerAttribChange && !attribChanged(r.TriggerAttrib, s, data) {
+				continue
+			}
+			if !r.cond.Match(env) {
+				continue
+			}
+
+			l := models.AutomationLog{
+				RuleID:       r.ID,
+				SubscriberID: null.IntFrom(sub.ID),
+				Event:        ev.name,
+				Status:       models.AutomationRunSuccess,
+			}
+			if err := m.run(r, sub); err != nil {
+				m.log.Printf("automation: error running rule '%s' on subscriber %d: %v", r.Name, sub.ID, err)
+				l.Status = models.AutomationRunFailed
+				l.Error = err.Error()
+			}
+
+			if err := m.store.LogRun(l); err != nil {
+				m.log.Printf("automation: error logging run of rule '%s': %v", r.Name, err)
+			}
+		}
+	}
+}
+
+// run runs a rule's actions on a subscriber in order. It stops at the
+// first action that fails.
+func (m *Manager) run(r rule, sub models.Subscriber) error {
+	m.setActing(sub.ID, true)
+	defer m.setActing(sub.ID, false)
+
+	for _, a := range r.Actions {
+		var err error
+		switch a.Type {
+		case models.AutomationActionAddLists:
+			err = m.store.AddSubscriptions(sub.ID, a.ListIDs, a.Status)
+		case models.AutomationActionRemoveLists:
+			err = m.store.DeleteSubscriptions(sub.ID, a.ListIDs)
+		case models.AutomationActionSetAttribs:
+			err = m.store.SetAttribs(sub.ID, a.Attribs)
+		case models.AutomationActionSendTx:
+			err = m.store.SendTx(sub, a.TemplateID, a.Data)
+		case models.AutomationActionBlocklist:
+			err = m.store.Blocklist(sub.ID)
+		default:
+			err = fmt.Errorf("unknown action")
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", a.Type, err)
+		}
+	}
+
+	return nil
+}
+
+// isFromRule checks whether an event is about a subscriber whose rule
+// actions are being run, that is, it has been raised by an action.
+func (m *Manager) isFromRule(data any) bool {
+	m.actingMu.Lock()
+	n := len(m.acting)
+	m.actingMu.Unlock()
+	if n == 0 {
+		return false
+	}
+
+	d, err := toMap(data)
+	if err != nil {
+		return false
+	}
+	ids, _ := subscriberRefs(d)
+
+	m.actingMu.Lock()
+	defer m.actingMu.Unlock()
+	for _, id := range ids {
+		if _, ok := m.acting[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) setActing(subID int, on bool) {
+	m.actingMu.Lock()
+	if on {
+		m.acting[subID] = struct{}{}
+	} else {
+		delete(m.acting, subID)
+	}
+	m.actingMu.Unlock()
+}
+
+// subscriberRefs returns the IDs and UUIDs of the subscribers in event data.
+func subscriberRefs(data map[string]any) ([]int, []string) {
+	var (
+		ids   []int
+		uuids []string
+	)
+
+	if s, ok := data["subscriber"].(map[string]any); ok {
+		if id, ok := s["id"].(float64); ok && id > 0 {
+			ids = append(ids, int(id))
+		}
+	}
+	if l, ok := data["subscriber_ids"].([]any); ok {
+		for _, v := range l {
+			if id, ok := v.(float64); ok {
+				ids = append(ids, int(id))
+			}
+		}
+	}
+
+	if uu, ok := data["subscriber_uuid"].(string); ok && uu != "" {
+		uuids = append(uuids, uu)
+	}
+	if b, ok := data["bounce"].(map[string]any); ok {
+		if uu, ok := b["subscriber_uuid"].(string); ok && uu != "" {
+			uuids = append(uuids, uu)
+		}
+	}
+
+	return ids, uuids
+}
+
+// attribChanged checks whether a subscriber's attribute (dot separated path),
+// or any attribute if the path is empty, differs from the previous attributes
+// in the event data.
+func attribChanged(attrib string, sub, data map[string]any) bool {
+	prev, ok := data["previous_attribs"].(map[string]any)
+	if !ok {
+		return false
+	}
+	cur, _ := sub["attribs"].(map[string]any)
+
+	if attrib == "" {
+		return !equal(cur, prev)
+	}
+
+	p := path{parts: strings.Split(attrib, ".")}
+	return !equal(p.eval(cur), p.eval(prev))
+}
+
+// toMap converts a value to a map via JSON so that its fields can be
+// accessed by their JSON names in conditions.
+func toMap(v any) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string]any{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
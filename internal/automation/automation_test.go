@@ -0,0 +1,320 @@
+package automation
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/internal/webhooks"
+	"github.com/knadh/listmonk/models"
+)
+
+// testLogger returns a logger for testing.
+func testLogger() *log.Logger {
+	return log.New(os.Stderr, "automation-test: ", log.LstdFlags)
+}
+
+// memStore is an in-memory Store that records the actions run on it.
+type memStore struct {
+	sync.Mutex
+
+	rules   []models.AutomationRule
+	subs    map[int]models.Subscriber
+	actions []string
+	logs    []models.AutomationLog
+
+	// Hook called on SetAttribs, for simulating the events raised by actions.
+	onSetAttribs func(subID int)
+}
+
+func newMemStore(rules ...models.AutomationRule) *memStore {
+	return &memStore{
+		rules: rules,
+		subs: map[int]models.Subscriber{
+			1: {Base: models.Base{ID: 1}, UUID: "sub-1", Email: "john@example.com", Attribs: models.JSON{"plan": "pro", "score": 12.0}},
+			2: {Base: models.Base{ID: 2}, UUID: "sub-2", Email: "jane@example.com", Attribs: models.JSON{"plan": "free"}},
+		},
+	}
+}
+
+func (s *memStore) GetRules() ([]models.AutomationRule, error) {
+	return s.rules, nil
+}
+
+func (s *memStore) GetSubscriber(id int, uuid string) (models.Subscriber, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, sub := range s.subs {
+		if (id != 0 && sub.ID == id) || (uuid != "" && sub.UUID == uuid) {
+			return sub, nil
+		}
+	}
+	return models.Subscriber{}, errors.New("not found")
+}
+
+func (s *memStore) AddSubscriptions(subID int, listIDs []int, status string) error {
+	s.record("add_lists")
+	return nil
+}
+
+func (s *memStore) DeleteSubscriptions(subID int, listIDs []int) error {
+	s.record("remove_lists")
+	return nil
+}
+
+func (s *memStore) SetAttribs(subID int, attribs map[string]any) error {
+	s.record("set_attribs")
+	if s.onSetAttribs != nil {
+		s.onSetAttribs(subID)
+	}
+	return nil
+}
+
+func (s *memStore) SendTx(sub models.Subscriber, tplID int, data map[string]any) error {
+	return errors.New("template not found")
+}
+
+func (s *memStore) Blocklist(subID int) error {
+	s.record("blocklist")
+	return nil
+}
+
+func (s *memStore) LogRun(l models.AutomationLog) error {
+	s.Lock()
+	s.logs = append(s.logs, l)
+	s.Unlock()
+	return nil
+}
+
+func (s *memStore) record(a string) {
+	s.Lock()
+	s.actions = append(s.actions, a)
+	s.Unlock()
+}
+
+// waitLogs waits for n rule runs to be logged.
+func (s *memStore) waitLogs(t *testing.T, n int) []models.AutomationLog {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		s.Lock()
+		if len(s.logs) >= n {
+			out := append([]models.AutomationLog{}, s.logs...)
+			s.Unlock()
+			return out
+		}
+		s.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected %d rule runs", n)
+	return nil
+}
+
+// TestCondition tests condition parsing and evaluation.
+func TestCondition(t *testing.T) {
+	var env map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"subscriber": {
+			"email": "john@example.com",
+			"status": "enabled",
+			"attribs": {"plan": "pro", "score": 12, "tags": ["vip", "beta"], "address": {"city": "Bengaluru"}}
+		},
+		"event": {"url": "https://example.com/pricing"}
+	}`), &env); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{``, true},
+		{`subscriber.attribs.plan == "pro"`, true},
+		{`subscriber.attribs.plan == 'free'`, false},
+		{`subscriber.attribs.plan != "free"`, true},
+		{`subscriber.attribs.score >= 10`, true},
+		{`subscriber.attribs.score < 10`, false},
+		{`subscriber.attribs.score > "10"`, false},
+		{`subscriber.email contains "@example.com"`, true},
+		{`subscriber.attribs.tags contains "vip"`, true},
+		{`subscriber.attribs contains "address"`, true},
+		{`"beta" in subscriber.attribs.tags`, true},
+		{`subscriber.attribs.plan in ["free", "basic"]`, false},
+		{`subscriber.attribs.address.city == "Bengaluru"`, true},
+		{`subscriber.attribs.missing == null`, true},
+		{`subscriber.attribs.missing.deep`, false},
+		{`subscriber.attribs.plan`, true},
+		{`not (event.url contains "unsubscribe")`, true},
+		{`!subscriber.attribs.tags`, false},
+		{`subscriber.attribs.plan == "free" or subscriber.attribs.score > 5`, true},
+		{`subscriber.attribs.plan == "pro" and subscriber.status == "blocklisted"`, false},
+		{`subscriber.attribs.plan == "pro" && (subscriber.attribs.score < 0 || event.url contains "pricing")`, true},
+		{`subscriber.attribs.score == 12 AND true`, true},
+		{`subscriber.attribs.score == -1`, false},
+	}
+
+	for _, c := range cases {
+		cond, err := ParseCondition(c.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.expr, err)
+			continue
+		}
+		if got := cond.Match(env); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+// TestConditionErrors tests that invalid conditions are rejected.
+func TestConditionErrors(t *testing.T) {
+	for _, expr := range []string{
+		`subscriber.attribs.plan ==`,
+		`subscriber.attribs.plan == "pro`,
+		`(subscriber.attribs.plan == "pro"`,
+		`subscriber.attribs.plan = "pro"`,
+		`subscriber..plan`,
+		`["a" "b"]`,
+		`a == b c`,
+		`and`,
+	} {
+		if _, err := ParseCondition(expr); err == nil {
+			t.Errorf("%s: expected error", expr)
+		}
+	}
+}
+
+// TestRuleRun tests that matching rules run their actions and are logged.
+func TestRuleRun(t *testing.T) {
+	st := newMemStore(
+		models.AutomationRule{
+			Base:      models.Base{ID: 1},
+			Name:      "pro confirmed",
+			Trigger:   webhooks.EventSubscriberConfirmed,
+			Condition: `subscriber.attribs.plan == "pro"`,
+			Actions: models.AutomationActions{
+				{Type: models.AutomationActionAddLists, ListIDs: []int{1}},
+				{Type: models.AutomationActionSetAttribs, Attribs: map[string]any{"onboarded": true}},
+			},
+		},
+		models.AutomationRule{
+			Base:    models.Base{ID: 2},
+			Name:    "welcome",
+			Trigger: webhooks.EventSubscriberConfirmed,
+			Actions: models.AutomationActions{
+				{Type: models.AutomationActionSendTx, TemplateID: 10},
+				{Type: models.AutomationActionBlocklist},
+			},
+		},
+	)
+
+	m := New(testLogger())
+	if err := m.Start(st); err != nil {
+		t.Fatal(err)
+	}
+
+	// Events without rules are ignored.
+	m.Handle(webhooks.EventSubscriberCreated, map[string]any{"subscriber": map[string]any{"id": 1}})
+
+	m.Handle(webhooks.EventSubscriberConfirmed, map[string]any{"subscriber_uuid": "sub-2"})
+	m.Handle(webhooks.EventSubscriberConfirmed, map[string]any{"subscriber_uuid": "sub-1"})
+
+	// sub-2 only matches the second rule, and sub-1 matches both.
+	logs := st.waitLogs(t, 3)
+	if len(logs) != 3 {
+		t.Fatalf("expected 3 runs, got %d", len(logs))
+	}
+
+	// The second rule stops at the failing send_tx action.
+	for _, l := range logs {
+		switch l.RuleID {
+		case 1:
+			if l.Status != models.AutomationRunSuccess || l.SubscriberID.Int != 1 {
+				t.Errorf("unexpected run of rule 1: %+v", l)
+			}
+		case 2:
+			if l.Status != models.AutomationRunFailed || l.Error == "" {
+				t.Errorf("expected failed run of rule 2: %+v", l)
+			}
+		}
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	if len(st.actions) != 2 || st.actions[0] != "add_lists" || st.actions[1] != "set_attribs" {
+		t.Errorf("unexpected actions: %v", st.actions)
+	}
+}
+
+// TestAttribChange tests attribute change triggers.
+func TestAttribChange(t *testing.T) {
+	st := newMemStore(models.AutomationRule{
+		Base:          models.Base{ID: 1},
+		Name:          "plan changed",
+		Trigger:       TriggerAttribChange,
+		TriggerAttrib: "plan",
+		Actions:       models.AutomationActions{{Type: models.AutomationActionRemoveLists, ListIDs: []int{2}}},
+	})
+
+	m := New(testLogger())
+	if err := m.Start(st); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other attributes changed.
+	m.Handle(webhooks.EventSubscriberUpdated, map[string]any{
+		"subscriber":       map[string]any{"id": 1},
+		"previous_attribs": map[string]any{"plan": "pro", "score": 1},
+	})
+
+	// The plan changed.
+	m.Handle(webhooks.EventSubscriberUpdated, map[string]any{
+		"subscriber":       map[string]any{"id": 2},
+		"previous_attribs": map[string]any{"plan": "pro"},
+	})
+
+	logs := st.waitLogs(t, 1)
+	time.Sleep(50 * time.Millisecond)
+
+	st.Lock()
+	defer st.Unlock()
+	if len(st.logs) != 1 || logs[0].SubscriberID.Int != 2 {
+		t.Errorf("expected a single run on subscriber 2, got %+v", st.logs)
+	}
+}
+
+// TestNoLoops tests that events raised by a rule's actions don't trigger rules.
+func TestNoLoops(t *testing.T) {
+	st := newMemStore(models.AutomationRule{
+		Base:    models.Base{ID: 1},
+		Name:    "on update",
+		Trigger: webhooks.EventSubscriberUpdated,
+		Actions: models.AutomationActions{{Type: models.AutomationActionSetAttribs, Attribs: map[string]any{"n": 1}}},
+	})
+
+	m := New(testLogger())
+
+	// Setting attributes raises a subscriber.updated event like the core does.
+	st.onSetAttribs = func(subID int) {
+		m.Handle(webhooks.EventSubscriberUpdated, map[string]any{"subscriber": map[string]any{"id": subID}})
+	}
+	if err := m.Start(st); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Handle(webhooks.EventSubscriberUpdated, map[string]any{"subscriber": map[string]any{"id": 1}})
+	st.waitLogs(t, 1)
+	time.Sleep(100 * time.Millisecond)
+
+	st.Lock()
+	defer st.Unlock()
+	if len(st.logs) != 1 {
+		t.Errorf("expected 1 run, got %d", len(st.logs))
+	}
+}
@@ -0,0 +1,490 @@
+package automation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition is a compiled rule condition. Conditions are expressions that
+// compare values in the data of a rule run (subscriber, event etc.) using
+// dot separated paths, eg:
+//
+//	subscriber.attribs.plan == "pro" and not (event.url contains "unsubscribe")
+//	subscriber.attribs.score >= 10 or subscriber.email in ["a@b.com", "c@d.com"]
+//
+// Operators: and, or, not, ==, !=, >, >=, <, <=, contains, in.
+// Literals: "strings" or 'strings', numbers, true, false, null, [lists].
+// Paths that don't exist in the data evaluate to null.
+type Condition struct {
+	src  string
+	root node
+}
+
+// node is a node in a condition's expression tree.
+type node interface {
+	eval(env map[string]any) any
+}
+
+type (
+	literal struct{ v any }
+	path    struct{ parts []string }
+	list    struct{ items []node }
+	not     struct{ n node }
+	binary  struct {
+		op          string
+		left, right node
+	}
+)
+
+// ParseCondition compiles a condition expression. An empty expression
+// always matches.
+func ParseCondition(src string) (*Condition, error) {
+	c := &Condition{src: src}
+	if strings.TrimSpace(src) == "" {
+		return c, nil
+	}
+
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != tokEOF {
+		return nil, fmt.Errorf("unexpected '%s' at %d", t.val, t.pos)
+	}
+
+	c.root = root
+	return c, nil
+}
+
+// Match evaluates the condition against data decoded from JSON.
+func (c *Condition) Match(env map[string]any) bool {
+	if c.root == nil {
+		return true
+	}
+	return truthy(c.root.eval(env))
+}
+
+// String returns the source expression of the condition.
+func (c *Condition) String() string {
+	return c.src
+}
+
+func (n literal) eval(map[string]any) any { return n.v }
+
+func (n path) eval(env map[string]any) any {
+	var v any = env
+	for _, p := range n.parts {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+func (n list) eval(env map[string]any) any {
+	out := make([]any, 0, len(n.items))
+	for _, i := range n.items {
+		out = append(out, i.eval(env))
+	}
+	return out
+}
+
+func (n not) eval(env map[string]any) any { return !truthy(n.n.eval(env)) }
+
+func (n binary) eval(env map[string]any) any {
+	// Logical operators short-circuit.
+	switch n.op {
+	case "and":
+		return truthy(n.left.eval(env)) && truthy(n.right.eval(env))
+	case "or":
+		return truthy(n.left.eval(env)) || truthy(n.right.eval(env))
+	}
+
+	a, b := n.left.eval(env), n.right.eval(env)
+	switch n.op {
+	case "==":
+		return equal(a, b)
+	case "!=":
+		return !equal(a, b)
+	case ">", ">=", "<", "<=":
+		return compare(n.op, a, b)
+	case "contains":
+		return contains(a, b)
+	case "in":
+		return contains(b, a)
+	}
+
+	return false
+}
+
+// truthy returns the boolean value of a value: false, null, 0, "", and
+// empty lists and maps are false.
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	case []any:
+		return len(t) > 0
+	case map[string]any:
+		return len(t) > 0
+	}
+	return true
+}
+
+// equal compares two values by their JSON representation.
+func equal(a, b any) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// compare compares two numbers or two strings.
+func compare(op string, a, b any) bool {
+	var c int
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(x, y)
+	default:
+		return false
+	}
+
+	switch op {
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
+
+// contains checks whether a string has a substring, a list has a value,
+// or a map has a key.
+func contains(a, b any) bool {
+	switch t := a.(type) {
+	case string:
+		s, ok := b.(string)
+		return ok && strings.Contains(t, s)
+	case []any:
+		for _, v := range t {
+			if equal(v, b) {
+				return true
+			}
+		}
+	case map[string]any:
+		s, ok := b.(string)
+		if !ok {
+			return false
+		}
+		_, ok = t[s]
+		return ok
+	}
+	return false
+}
+
+// Tokenizer.
+const (
+	tokEOF = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	typ int
+	val string
+	pos int
+}
+
+func tokenize(src string) ([]token, error) {
+	var (
+		out []token
+		rs  = []rune(src)
+	)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '"' || r == '\'':
+			var (
+				b   strings.Builder
+				end = -1
+			)
+			for j := i + 1; j < len(rs); j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+					b.WriteRune(rs[j])
+					continue
+				}
+				if rs[j] == r {
+					end = j
+					break
+				}
+				b.WriteRune(rs[j])
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			out = append(out, token{typ: tokString, val: b.String(), pos: i})
+			i = end + 1
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			j := i + 1
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			out = append(out, token{typ: tokNumber, val: string(rs[i:j]), pos: i})
+			i = j
+
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_' || rs[j] == '.') {
+				j++
+			}
+			out = append(out, token{typ: tokIdent, val: string(rs[i:j]), pos: i})
+			i = j
+
+		default:
+			// Two character operators first.
+			if i+1 < len(rs) {
+				switch op := string(rs[i : i+2]); op {
+				case "==", "!=", ">=", "<=", "&&", "||":
+					out = append(out, token{typ: tokOp, val: op, pos: i})
+					i += 2
+					continue
+				}
+			}
+
+			switch r {
+			case '>', '<', '(', ')', '[', ']', ',', '!':
+				out = append(out, token{typ: tokOp, val: string(r), pos: i})
+				i++
+			default:
+				return nil, fmt.Errorf("unexpected '%c' at %d", r, i)
+			}
+		}
+	}
+
+	return append(out, token{typ: tokEOF, pos: len(rs)}), nil
+}
+
+// parser is a recursive descent parser for condition expressions.
+//
+//	or      = and { "or" and }
+//	and     = unary { "and" unary }
+//	unary   = "not" unary | cmp
+//	cmp     = operand [ ( "==" | "!=" | ">" | ">=" | "<" | "<=" | "contains" | "in" ) operand ]
+//	operand = literal | path | "(" or ")" | "[" [ operand { "," operand } ] "]"
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.typ != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword checks whether the current token is one of the given keywords
+// or operators.
+func (p *parser) isKeyword(kw ...string) bool {
+	t := p.peek()
+	if t.typ != tokIdent && t.typ != tokOp {
+		return false
+	}
+	for _, k := range kw {
+		if strings.EqualFold(t.val, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("or", "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: "or", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("and", "&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: "and", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isKeyword("not", "!") {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{n}, nil
+	}
+
+	return p.parseCmp()
+}
+
+func (p *parser) parseCmp() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isKeyword("==", "!=", ">", ">=", "<", "<=", "contains", "in") {
+		return left, nil
+	}
+
+	op := strings.ToLower(p.next().val)
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return binary{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+	switch t.typ {
+	case tokString:
+		return literal{t.val}, nil
+
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at %d", t.val, t.pos)
+		}
+		return literal{f}, nil
+
+	case tokIdent:
+		switch strings.ToLower(t.val) {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		case "and", "or", "not", "contains", "in":
+			return nil, fmt.Errorf("unexpected '%s' at %d", t.val, t.pos)
+		}
+
+		parts := strings.Split(t.val, ".")
+		for _, s := range parts {
+			if s == "" {
+				return nil, fmt.Errorf("invalid path '%s' at %d", t.val, t.pos)
+			}
+		}
+		return path{parts}, nil
+
+	case tokOp:
+		switch t.val {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if c := p.next(); c.val != ")" || c.typ != tokOp {
+				return nil, fmt.Errorf("expected ')' at %d", c.pos)
+			}
+			return n, nil
+
+		case "[":
+			var l list
+			if p.peek().typ == tokOp && p.peek().val == "]" {
+				p.next()
+				return l, nil
+			}
+			for {
+				n, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				l.items = append(l.items, n)
+
+				c := p.next()
+				if c.typ == tokOp && c.val == "]" {
+					return l, nil
+				}
+				if c.typ != tokOp || c.val != "," {
+					return nil, fmt.Errorf("expected ',' or ']' at %d", c.pos)
+				}
+			}
+		}
+	}
+
+	if t.typ == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected '%s' at %d", t.val, t.pos)
+}
@@ -2,30 +2,70 @@ package bounce
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/knadh/listmonk/internal/bounce/mailbox"
 	"github.com/knadh/listmonk/internal/bounce/webhooks"
 	"github.com/knadh/listmonk/models"
+	null "gopkg.in/volatiletech/null.v6"
 )
 
+// Max number of messages downloaded in a single mailbox scan.
+const scanLimit = 1000
+
+// ErrMailboxNotFound is returned when scanning a mailbox that isn't configured.
+var ErrMailboxNotFound = errors.New("bounce mailbox not found")
+
 // Mailbox represents a POP/IMAP mailbox client that can scan messages and pass
 // them to a given channel.
 type Mailbox interface {
 	Scan(limit int, ch chan models.Bounce) error
 }
 
+// Waiter is an optional interface that's implemented by mailboxes that can wait
+// for new messages to arrive, eg: IMAP IDLE. Wait blocks until there are new
+// messages or the timeout elapses.
+type Waiter interface {
+	Wait(timeout time.Duration) error
+}
+
+// MailboxOpt represents a bounce mailbox and its type (pop, imap).
+type MailboxOpt struct {
+	UUID string `json:"uuid"`
+	Type string `json:"type"`
+	mailbox.Opt
+}
+
+// MailboxStatus is the scan status of a bounce mailbox.
+type MailboxStatus struct {
+	UUID     string `json:"uuid"`
+	Type     string `json:"type"`
+	Host     string `json:"host"`
+	Username string `json:"username"`
+
+	// Whether the mailbox is being scanned right now.
+	Scanning bool `json:"scanning"`
+
+	// Time of the last scan, the number of bounces found in it, and its error, if any.
+	ScannedAt null.Time `json:"scanned_at"`
+	Bounces   int       `json:"bounces"`
+	Error     string    `json:"error"`
+
+	// Time at which the next scan is due, unless there are new messages (IDLE).
+	NextScanAt null.Time `json:"next_scan_at"`
+}
+
 // Opt represents bounce processing options.
 type Opt struct {
-	MailboxEnabled  bool        `json:"mailbox_enabled"`
-	MailboxType     string      `json:"mailbox_type"`
-	Mailbox         mailbox.Opt `json:"mailbox"`
-	WebhooksEnabled bool        `json:"webhooks_enabled"`
-	SESEnabled      bool        `json:"ses_enabled"`
-	SendgridEnabled bool        `json:"sendgrid_enabled"`
-	SendgridKey     string      `json:"sendgrid_key"`
+	Mailboxes       []MailboxOpt `json:"mailboxes"`
+	WebhooksEnabled bool         `json:"webhooks_enabled"`
+	SESEnabled      bool         `json:"ses_enabled"`
+	SendgridEnabled bool         `json:"sendgrid_enabled"`
+	SendgridKey     string       `json:"sendgrid_key"`
 	Postmark        struct {
 		Enabled  bool
 		Username string
@@ -39,10 +79,22 @@ type Opt struct {
 	RecordBounceCB func(models.Bounce) error
 }
 
+// box is a bounce mailbox that's scanned independently of the others.
+type box struct {
+	opt     MailboxOpt
+	mailbox Mailbox
+
+	// Signals the scanner to scan the mailbox right away.
+	scanNow chan struct{}
+
+	status MailboxStatus
+	mu     sync.Mutex
+}
+
 // Manager handles e-mail bounces.
 type Manager struct {
 	queue        chan models.Bounce
-	mailbox      Mailbox
+	boxes        []*box
 	SES          *webhooks.SES
 	Sendgrid     *webhooks.Sendgrid
 	Postmark     *webhooks.Postmark
@@ -67,14 +119,29 @@ func New(opt Opt, q *Queries, lo *log.Logger) (*Manager, error) {
 		log:     lo,
 	}
 
-	// Is there a mailbox?
-	if opt.MailboxEnabled {
-		switch opt.MailboxType {
+	// Mailboxes.
+	for _, o := range opt.Mailboxes {
+		b := &box{
+			opt:     o,
+			scanNow: make(chan struct{}, 1),
+			status: MailboxStatus{
+				UUID:     o.UUID,
+				Type:     o.Type,
+				Host:     o.Host,
+				Username: o.Username,
+			},
+		}
+
+		switch o.Type {
 		case "pop":
-			m.mailbox = mailbox.NewPOP(opt.Mailbox)
+			b.mailbox = mailbox.NewPOP(o.Opt)
+		case "imap":
+			b.mailbox = mailbox.NewIMAP(o.Opt)
 		default:
-			return nil, errors.New("unknown bounce mailbox type")
+			return nil, fmt.Errorf("unknown bounce mailbox type: %s", o.Type)
 		}
+
+		m.boxes = append(m.boxes, b)
 	}
 
 	if opt.WebhooksEnabled {
@@ -107,8 +174,9 @@ func New(opt Opt, q *Queries, lo *log.Logger) (*Manager, error) {
 // Run is a blocking function that listens for bounce events from webhooks and or mailboxes
 // and executes them on the DB.
 func (m *Manager) Run() {
-	if m.opt.MailboxEnabled {
-		go m.runMailboxScanner()
+	// Scan each mailbox at its own interval.
+	for _, b := range m.boxes {
+		go m.runMailboxScanner(b)
 	}
 
 	for b := range m.queue {
@@ -122,16 +190,112 @@ func (m *Manager) Run() {
 	}
 }
 
-// runMailboxScanner runs a blocking loop that scans the mailbox at given intervals.
-func (m *Manager) runMailboxScanner() {
+// runMailboxScanner runs a blocking loop that scans a mailbox at its interval, or
+// when a scan is requested with ScanMailbox. With IDLE, the mailbox is also scanned
+// as soon as new messages arrive.
+func (m *Manager) runMailboxScanner(b *box) {
+	var (
+		w, idle = b.mailbox.(Waiter)
+
+		// Result of the wait for new messages that's in progress, if any.
+		waitDone chan error
+	)
+	idle = idle && b.opt.IDLE
+
 	for {
-		m.log.Printf("scanning bounce mailbox %s", m.opt.Mailbox.Host)
-		if err := m.mailbox.Scan(1000, m.queue); err != nil {
-			m.log.Printf("error scanning bounce mailbox: %v", err)
+		m.scanMailbox(b)
+
+		if idle && waitDone == nil {
+			waitDone = make(chan error, 1)
+			go func(ch chan error) {
+				ch <- w.Wait(b.opt.ScanInterval)
+			}(waitDone)
+		}
+
+		t := time.NewTimer(b.opt.ScanInterval)
+		select {
+		case err := <-waitDone:
+			waitDone = nil
+
+			// On error, fall back to waiting for the interval.
+			if err != nil {
+				m.log.Printf("error waiting for bounce mailbox (%s) messages: %v", b.opt.Host, err)
+				select {
+				case <-t.C:
+				case <-b.scanNow:
+				}
+			}
+
+		case <-t.C:
+		case <-b.scanNow:
+		}
+		t.Stop()
+	}
+}
+
+// scanMailbox scans a mailbox, queues the bounces found in it, and updates its status.
+func (m *Manager) scanMailbox(b *box) {
+	b.mu.Lock()
+	b.status.Scanning = true
+	b.mu.Unlock()
+
+	m.log.Printf("scanning bounce mailbox %s", b.opt.Host)
+
+	// Mailboxes drop the bounces that don't fit in the channel.
+	ch := make(chan models.Bounce, scanLimit)
+	err := b.mailbox.Scan(scanLimit, ch)
+	close(ch)
+	if err != nil {
+		m.log.Printf("error scanning bounce mailbox (%s): %v", b.opt.Host, err)
+	}
+
+	n := 0
+	for bn := range ch {
+		m.queue <- bn
+		n++
+	}
+
+	now := time.Now()
+	b.mu.Lock()
+	b.status.Scanning = false
+	b.status.ScannedAt = null.TimeFrom(now)
+	b.status.NextScanAt = null.TimeFrom(now.Add(b.opt.ScanInterval))
+	b.status.Bounces = n
+	b.status.Error = ""
+	if err != nil {
+		b.status.Error = err.Error()
+	}
+	b.mu.Unlock()
+}
+
+// MailboxStatus returns the scan status of the bounce mailboxes.
+func (m *Manager) MailboxStatus() []MailboxStatus {
+	out := make([]MailboxStatus, 0, len(m.boxes))
+	for _, b := range m.boxes {
+		b.mu.Lock()
+		out = append(out, b.status)
+		b.mu.Unlock()
+	}
+
+	return out
+}
+
+// ScanMailbox requests an immediate scan of a bounce mailbox by its UUID. If the
+// mailbox is being scanned, it's scanned again once the scan is over.
+func (m *Manager) ScanMailbox(uuid string) error {
+	for _, b := range m.boxes {
+		if b.opt.UUID != uuid {
+			continue
 		}
 
-		time.Sleep(m.opt.Mailbox.ScanInterval)
+		select {
+		case b.scanNow <- struct{}{}:
+		default:
+		}
+		return nil
 	}
+
+	return ErrMailboxNotFound
 }
 
 // Record records a new bounce event given the subscriber's email or UUID.
@@ -0,0 +1,94 @@
+package bounce
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+type fakeMailbox struct {
+	bounces []models.Bounce
+	err     error
+}
+
+func (f *fakeMailbox) Scan(limit int, ch chan models.Bounce) error {
+	for _, b := range f.bounces {
+		ch <- b
+	}
+	return f.err
+}
+
+func newTestManager(boxes ...*box) *Manager {
+	return &Manager{
+		queue: make(chan models.Bounce, 100),
+		boxes: boxes,
+		log:   log.New(io.Discard, "", 0),
+	}
+}
+
+func newTestBox(uuid string, mb Mailbox) *box {
+	return &box{
+		opt:     MailboxOpt{UUID: uuid, Type: "pop"},
+		mailbox: mb,
+		scanNow: make(chan struct{}, 1),
+		status:  MailboxStatus{UUID: uuid, Type: "pop"},
+	}
+}
+
+func TestScanMailboxStatus(t *testing.T) {
+	var (
+		ok  = newTestBox("a", &fakeMailbox{bounces: []models.Bounce{{Email: "a@x.com"}, {Email: "b@x.com"}}})
+		bad = newTestBox("b", &fakeMailbox{bounces: []models.Bounce{{Email: "c@x.com"}}, err: errors.New("parse error")})
+		m   = newTestManager(ok, bad)
+	)
+	ok.opt.ScanInterval = time.Minute
+
+	m.scanMailbox(ok)
+	m.scanMailbox(bad)
+
+	if n := len(m.queue); n != 3 {
+		t.Fatalf("expected 3 queued bounces, got %d", n)
+	}
+
+	st := m.MailboxStatus()
+	if len(st) != 2 {
+		t.Fatalf("expected 2 statuses, got %d", len(st))
+	}
+
+	if st[0].Scanning || !st[0].ScannedAt.Valid || st[0].Bounces != 2 || st[0].Error != "" {
+		t.Errorf("unexpected status: %+v", st[0])
+	}
+	if d := st[0].NextScanAt.Time.Sub(st[0].ScannedAt.Time); d != time.Minute {
+		t.Errorf("expected next scan a minute after the last, got %v", d)
+	}
+
+	// Bounces found before an error are still recorded.
+	if st[1].Bounces != 1 || st[1].Error != "parse error" {
+		t.Errorf("unexpected status: %+v", st[1])
+	}
+}
+
+func TestScanMailboxNow(t *testing.T) {
+	var (
+		b = newTestBox("a", &fakeMailbox{})
+		m = newTestManager(b)
+	)
+
+	if err := m.ScanMailbox("unknown"); err != ErrMailboxNotFound {
+		t.Fatalf("expected ErrMailboxNotFound, got %v", err)
+	}
+
+	// Repeated requests while a scan is pending don't block.
+	for i := 0; i < 3; i++ {
+		if err := m.ScanMailbox("a"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := len(b.scanNow); n != 1 {
+		t.Errorf("expected 1 pending scan, got %d", n)
+	}
+}
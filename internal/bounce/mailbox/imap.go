@@ -0,0 +1,275 @@
+package mailbox
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-sasl"
+	"github.com/knadh/listmonk/models"
+)
+
+// IMAP represents an IMAP mailbox.
+type IMAP struct {
+	opt Opt
+}
+
+// Timeout for connecting to the IMAP server.
+const imapDialTimeout = time.Second * 30
+
+// NewIMAP returns a new instance of the IMAP mailbox client.
+func NewIMAP(opt Opt) *IMAP {
+	if opt.Folder == "" {
+		opt.Folder = "INBOX"
+	}
+
+	return &IMAP{opt: opt}
+}
+
+// Scan scans the mailbox folder and pushes the downloaded messages into the given
+// channel. If UnseenOnly is set, only the messages that haven't been seen yet are
+// downloaded. The downloaded messages are moved to the MoveTo folder if it's set.
+// Otherwise, they're deleted, unless only unseen messages are scanned, in which
+// case, they're left in the folder, marked as seen. If limit > 0, only as many
+// messages are downloaded.
+func (m *IMAP) Scan(limit int, ch chan models.Bounce) error {
+	c, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	if _, err := c.Select(m.opt.Folder, false); err != nil {
+		return fmt.Errorf("error selecting folder %s: %v", m.opt.Folder, err)
+	}
+
+	crit := imap.NewSearchCriteria()
+	if m.opt.UnseenOnly {
+		crit.WithoutFlags = []string{imap.SeenFlag}
+	}
+	uids, err := c.UidSearch(crit)
+	if err != nil {
+		return err
+	}
+
+	// No messages.
+	if len(uids) == 0 {
+		return nil
+	}
+
+	if limit > 0 && len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	// Download the messages, which marks them as seen. The messages have to be
+	// read until the fetch is complete even if they can't be parsed.
+	var (
+		set     = new(imap.SeqSet)
+		section = &imap.BodySectionName{}
+		msgs    = make(chan *imap.Message, 10)
+		done    = make(chan error, 1)
+	)
+	set.AddNum(uids...)
+	go func() {
+		done <- c.UidFetch(set, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, msgs)
+	}()
+
+	var (
+		processed = new(imap.SeqSet)
+		parseErr  error
+	)
+	for msg := range msgs {
+		r := msg.GetBody(section)
+		if r == nil {
+			continue
+		}
+
+		b, err := io.ReadAll(r)
+		if err != nil {
+			parseErr = err
+			continue
+		}
+
+		bn, err := parseBounce(b, m.opt.Host)
+		if err != nil {
+			parseErr = err
+			continue
+		}
+
+		select {
+		case ch <- bn:
+		default:
+		}
+		processed.AddNum(msg.Uid)
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+
+	// Move or delete the downloaded messages. Messages that couldn't be parsed
+	// are left in the folder.
+	if !processed.Empty() {
+		switch {
+		case m.opt.MoveTo != "":
+			if err := m.move(c, processed); err != nil {
+				return err
+			}
+
+		case m.opt.UnseenOnly:
+			// Fetching marks the messages as seen on most servers, but not all.
+			if err := c.UidStore(processed, imap.FormatFlagsOp(imap.AddFlags, true), []any{imap.SeenFlag}, nil); err != nil {
+				return err
+			}
+
+		default:
+			if err := c.UidStore(processed, imap.FormatFlagsOp(imap.AddFlags, true), []any{imap.DeletedFlag}, nil); err != nil {
+				return err
+			}
+			if err := c.Expunge(nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	if parseErr != nil {
+		return fmt.Errorf("error parsing bounce message: %v", parseErr)
+	}
+
+	return nil
+}
+
+// Wait blocks until new messages arrive in the mailbox folder, or the timeout
+// elapses. It uses IMAP IDLE, or polls the folder if the server doesn't support it.
+func (m *IMAP) Wait(timeout time.Duration) error {
+	c, err := m.connect()
+	if err != nil {
+		return err
+	}
+
+	// The client blocks on sending updates. Drain them once done with them.
+	updates := make(chan client.Update, 10)
+	c.Updates = updates
+	defer func() {
+		go func() {
+			for {
+				select {
+				case <-updates:
+				case <-c.LoggedOut():
+					return
+				}
+			}
+		}()
+		c.Logout()
+	}()
+
+	box, err := c.Select(m.opt.Folder, true)
+	if err != nil {
+		return fmt.Errorf("error selecting folder %s: %v", m.opt.Folder, err)
+	}
+	num := box.Messages
+
+	var (
+		stop = make(chan struct{})
+		done = make(chan error, 1)
+		t    = time.NewTimer(timeout)
+	)
+	defer t.Stop()
+	go func() {
+		done <- c.Idle(stop, &client.IdleOptions{PollInterval: time.Minute})
+	}()
+
+	for {
+		select {
+		case u := <-updates:
+			// New messages have arrived.
+			if b, ok := u.(*client.MailboxUpdate); ok && b.Mailbox.Messages > num {
+				close(stop)
+				return <-done
+			}
+
+		case <-t.C:
+			close(stop)
+			return <-done
+
+		case err := <-done:
+			return err
+		}
+	}
+}
+
+// connect connects and logs in to the IMAP server.
+func (m *IMAP) connect() (*client.Client, error) {
+	var (
+		addr   = net.JoinHostPort(m.opt.Host, strconv.Itoa(m.opt.Port))
+		dialer = &net.Dialer{Timeout: imapDialTimeout}
+
+		c   *client.Client
+		err error
+	)
+	if m.opt.TLSEnabled {
+		c, err = client.DialWithDialerTLS(dialer, addr, &tls.Config{
+			ServerName:         m.opt.Host,
+			InsecureSkipVerify: m.opt.TLSSkipVerify,
+		})
+	} else {
+		c, err = client.DialWithDialer(dialer, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch m.opt.AuthProtocol {
+	case "none":
+		return c, nil
+	case "plain":
+		err = c.Authenticate(sasl.NewPlainClient("", m.opt.Username, m.opt.Password))
+	case "cram":
+		err = c.Authenticate(&cramMD5{username: m.opt.Username, password: m.opt.Password})
+	default:
+		err = c.Login(m.opt.Username, m.opt.Password)
+	}
+	if err != nil {
+		c.Logout()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// move moves messages to the MoveTo folder, creating it if it doesn't exist.
+func (m *IMAP) move(c *client.Client, set *imap.SeqSet) error {
+	boxes := make(chan *imap.MailboxInfo, 1)
+	if err := c.List("", m.opt.MoveTo, boxes); err != nil {
+		return err
+	}
+	if len(boxes) == 0 {
+		if err := c.Create(m.opt.MoveTo); err != nil {
+			return fmt.Errorf("error creating folder %s: %v", m.opt.MoveTo, err)
+		}
+	}
+
+	return c.UidMove(set, m.opt.MoveTo)
+}
+
+// cramMD5 is a sasl.Client for the CRAM-MD5 mechanism.
+type cramMD5 struct {
+	username, password string
+}
+
+func (a *cramMD5) Start() (string, []byte, error) {
+	return "CRAM-MD5", nil, nil
+}
+
+func (a *cramMD5) Next(challenge []byte) ([]byte, error) {
+	h := hmac.New(md5.New, []byte(a.password))
+	h.Write(challenge)
+	return []byte(a.username + " " + hex.EncodeToString(h.Sum(nil))), nil
+}
@@ -0,0 +1,230 @@
+package mailbox
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/knadh/listmonk/models"
+)
+
+const bounceMsg = "From: MAILER-DAEMON@example.com\r\n" +
+	"To: bounces@example.com\r\n" +
+	"Subject: Undelivered Mail Returned to Sender\r\n" +
+	"Date: Tue, 07 Jan 2025 10:00:00 +0000\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Status: 5.1.1\r\n" +
+	models.EmailHeaderCampaignUUID + ": %s\r\n" +
+	models.EmailHeaderSubscriberUUID + ": 00000000-0000-0000-0000-000000000000\r\n"
+
+// moveBackend adds MOVE support to the in-memory IMAP backend.
+type moveBackend struct {
+	*memory.Backend
+}
+
+type moveUser struct {
+	backend.User
+}
+
+type moveMailbox struct {
+	backend.Mailbox
+}
+
+func (b moveBackend) Login(c *imap.ConnInfo, username, password string) (backend.User, error) {
+	u, err := b.Backend.Login(c, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return moveUser{u}, nil
+}
+
+func (u moveUser) GetMailbox(name string) (backend.Mailbox, error) {
+	m, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	return moveMailbox{m}, nil
+}
+
+func (m moveMailbox) MoveMessages(uid bool, set *imap.SeqSet, dest string) error {
+	if err := m.CopyMessages(uid, set, dest); err != nil {
+		return err
+	}
+	if err := m.UpdateMessagesFlags(uid, set, imap.AddFlags, []string{imap.DeletedFlag}); err != nil {
+		return err
+	}
+	return m.Expunge()
+}
+
+// newIMAPServer starts an in-memory IMAP server with the given bounce messages
+// (with these campaign UUIDs) in the INBOX, in addition to a message that has
+// been seen, and returns its mailbox options.
+func newIMAPServer(t *testing.T, uuids ...string) (Opt, backend.User) {
+	be := moveBackend{memory.New()}
+	u, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box, _ := u.GetMailbox("INBOX")
+	for _, id := range uuids {
+		if err := box.CreateMessage(nil, time.Now(), bytes.NewBufferString(fmt.Sprintf(bounceMsg, id))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	addr := l.Addr().(*net.TCPAddr)
+	return Opt{
+		Host:         addr.IP.String(),
+		Port:         addr.Port,
+		AuthProtocol: "login",
+		Username:     "username",
+		Password:     "password",
+	}, u
+}
+
+// folderFlags returns the flags of the messages in a folder.
+func folderFlags(t *testing.T, u backend.User, name string) [][]string {
+	box, err := u.GetMailbox(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		set = new(imap.SeqSet)
+		ch  = make(chan *imap.Message, 10)
+		out [][]string
+	)
+	set.AddRange(1, 0)
+	go box.ListMessages(false, set, []imap.FetchItem{imap.FetchFlags}, ch)
+	for m := range ch {
+		out = append(out, m.Flags)
+	}
+
+	return out
+}
+
+func scanIMAP(t *testing.T, opt Opt) []models.Bounce {
+	ch := make(chan models.Bounce, 10)
+	if err := NewIMAP(opt).Scan(100, ch); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+
+	var out []models.Bounce
+	for b := range ch {
+		out = append(out, b)
+	}
+	return out
+}
+
+func hasFlag(flags []string, f string) bool {
+	for _, v := range flags {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIMAPScanDelete(t *testing.T) {
+	opt, u := newIMAPServer(t, "11111111-1111-1111-1111-111111111111")
+
+	out := scanIMAP(t, opt)
+	if len(out) != 2 {
+		t.Fatalf("got %d bounces, expected 2", len(out))
+	}
+	if out[1].CampaignUUID != "11111111-1111-1111-1111-111111111111" || out[1].Type != models.BounceTypeHard ||
+		out[1].Source != opt.Host {
+		t.Errorf("unexpected bounce: %+v", out[1])
+	}
+
+	if f := folderFlags(t, u, "INBOX"); len(f) != 0 {
+		t.Errorf("got %d messages in INBOX, expected them to be deleted", len(f))
+	}
+}
+
+func TestIMAPScanUnseenOnly(t *testing.T) {
+	opt, u := newIMAPServer(t, "11111111-1111-1111-1111-111111111111", "22222222-2222-2222-2222-222222222222")
+	opt.UnseenOnly = true
+
+	// The message that has been seen is skipped.
+	out := scanIMAP(t, opt)
+	if len(out) != 2 || out[0].CampaignUUID != "11111111-1111-1111-1111-111111111111" ||
+		out[1].CampaignUUID != "22222222-2222-2222-2222-222222222222" {
+		t.Fatalf("unexpected bounces: %+v", out)
+	}
+
+	// The messages are left in the folder, marked as seen.
+	flags := folderFlags(t, u, "INBOX")
+	if len(flags) != 3 {
+		t.Fatalf("got %d messages in INBOX, expected 3", len(flags))
+	}
+	for _, f := range flags {
+		if !hasFlag(f, imap.SeenFlag) || hasFlag(f, imap.DeletedFlag) {
+			t.Errorf("unexpected flags: %v", f)
+		}
+	}
+
+	if out := scanIMAP(t, opt); len(out) != 0 {
+		t.Errorf("got %d bounces on the second scan, expected none", len(out))
+	}
+}
+
+func TestIMAPScanMove(t *testing.T) {
+	opt, u := newIMAPServer(t, "11111111-1111-1111-1111-111111111111")
+	opt.UnseenOnly = true
+	opt.MoveTo = "Processed"
+
+	if out := scanIMAP(t, opt); len(out) != 1 {
+		t.Fatalf("got %d bounces, expected 1", len(out))
+	}
+
+	// The folder is created and the processed message is moved to it.
+	if f := folderFlags(t, u, "INBOX"); len(f) != 1 {
+		t.Errorf("got %d messages in INBOX, expected 1", len(f))
+	}
+	if f := folderFlags(t, u, "Processed"); len(f) != 1 {
+		t.Errorf("got %d messages in Processed, expected 1", len(f))
+	}
+
+	// The folder exists on the next scan.
+	box, _ := u.GetMailbox("INBOX")
+	if err := box.CreateMessage(nil, time.Now(), bytes.NewBufferString(fmt.Sprintf(bounceMsg, "x"))); err != nil {
+		t.Fatal(err)
+	}
+	if out := scanIMAP(t, opt); len(out) != 1 {
+		t.Fatalf("got %d bounces, expected 1", len(out))
+	}
+	if f := folderFlags(t, u, "Processed"); len(f) != 2 {
+		t.Errorf("got %d messages in Processed, expected 2", len(f))
+	}
+}
+
+func TestIMAPWait(t *testing.T) {
+	opt, _ := newIMAPServer(t)
+
+	start := time.Now()
+	if err := NewIMAP(opt).Wait(time.Millisecond * 200); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Millisecond*200 {
+		t.Errorf("Wait returned after %v, before the timeout", d)
+	}
+}
@@ -21,6 +21,17 @@ type Opt struct {
 	// Folder is the name of the IMAP folder to scan for e-mails.
 	Folder string `json:"folder"`
 
+	// MoveTo is the name of the IMAP folder to move the processed e-mails to
+	// instead of deleting them.
+	MoveTo string `json:"move_to"`
+
+	// UnseenOnly scans only the IMAP e-mails that haven't been seen.
+	UnseenOnly bool `json:"unseen_only"`
+
+	// IDLE waits for new IMAP e-mails with IDLE between scans
+	// instead of sleeping for the scan interval.
+	IDLE bool `json:"idle"`
+
 	// Optional TLS settings.
 	TLSEnabled    bool `json:"tls_enabled"`
 	TLSSkipVerify bool `json:"tls_skip_verify"`
@@ -1,6 +1,7 @@
 package mailbox
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -142,94 +143,99 @@ func (p *POP) Scan(limit int, ch chan models.Bounce) error {
 			return err
 		}
 
-		// Parse the message.
-		m, err := message.Read(b)
+		bn, err := parseBounce(b.Bytes(), p.opt.Host)
 		if err != nil {
 			return err
 		}
 
-		h := m
-
-		// If this is a multipart message, find the last part.
-		if mr := m.MultipartReader(); mr != nil {
-			for {
-				part, err := mr.NextPart()
-				if err == io.EOF {
-					break
-				} else if err != nil {
-					return err
-				}
-				h = part
-			}
+		select {
+		case ch <- bn:
+		default:
 		}
+	}
 
-		// Reset the "unread portion" pointer of the message buffer.
-		// If you don't do this, you can't read the entire body because the pointer will not point to the beginning.
-		b, _ = c.RetrRaw(id)
+	// Delete the downloaded messages.
+	for id := 1; id <= count; id++ {
+		if err := c.Dele(id); err != nil {
+			return err
+		}
+	}
 
-		// Lookup headers in the e-mail. If a header isn't found, fall back to regexp lookups.
-		hdr := make(map[string]string, 7)
-		for _, l := range headerLookups {
-			v := h.Header.Get(l.Header)
+	return nil
+}
 
-			// Not in the header. Try regexp.
-			if v == "" {
-				if m := l.Regexp.FindAllSubmatch(b.Bytes(), -1); m != nil {
-					v = string(m[len(m)-1][1])
-				}
-			}
+// parseBounce parses a raw bounce e-mail downloaded from a mailbox into a bounce.
+func parseBounce(b []byte, source string) (models.Bounce, error) {
+	// Parse the message.
+	m, err := message.Read(bytes.NewReader(b))
+	if err != nil {
+		return models.Bounce{}, err
+	}
 
-			hdr[l.Header] = strings.TrimSpace(v)
-		}
+	h := m
 
-		// Received is a []string header.
-		msgReceived := h.Header.Map()[models.EmailHeaderReceived]
-		if len(msgReceived) == 0 {
-			if u := reHdrReceived.FindAllSubmatch(b.Bytes(), -1); u != nil {
-				for i := 0; i < len(u); i++ {
-					msgReceived = append(msgReceived, string(u[i][1]))
-				}
+	// If this is a multipart message, find the last part.
+	if mr := m.MultipartReader(); mr != nil {
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return models.Bounce{}, err
 			}
+			h = part
 		}
+	}
 
-		date, _ := time.Parse("Mon, 02 Jan 2006 15:04:05 -0700", hdr[models.EmailHeaderDate])
-		if date.IsZero() {
-			date = time.Now()
-		}
+	// Lookup headers in the e-mail. If a header isn't found, fall back to regexp lookups.
+	hdr := make(map[string]string, 7)
+	for _, l := range headerLookups {
+		v := h.Header.Get(l.Header)
 
-		// Classify the bounce type based on message content.
-		bounceType, bounceReason := classifyBounce(b.Bytes())
+		// Not in the header. Try regexp.
+		if v == "" {
+			if m := l.Regexp.FindAllSubmatch(b, -1); m != nil {
+				v = string(m[len(m)-1][1])
+			}
+		}
 
-		// Additional bounce e-mail metadata.
-		fmt.Println(bounceReason)
-		meta, _ := json.Marshal(bounceMeta{
-			From:           hdr[models.EmailHeaderFrom],
-			Subject:        hdr[models.EmailHeaderSubject],
-			MessageID:      hdr[models.EmailHeaderMessageId],
-			DeliveredTo:    hdr[models.EmailHeaderDeliveredTo],
-			Received:       msgReceived,
-			ClassifyReason: bounceReason,
-		})
+		hdr[l.Header] = strings.TrimSpace(v)
+	}
 
-		select {
-		case ch <- models.Bounce{
-			Type:           bounceType,
-			CampaignUUID:   hdr[models.EmailHeaderCampaignUUID],
-			SubscriberUUID: hdr[models.EmailHeaderSubscriberUUID],
-			Source:         p.opt.Host,
-			CreatedAt:      date,
-			Meta:           meta,
-		}:
-		default:
+	// Received is a []string header.
+	msgReceived := h.Header.Map()[models.EmailHeaderReceived]
+	if len(msgReceived) == 0 {
+		if u := reHdrReceived.FindAllSubmatch(b, -1); u != nil {
+			for i := 0; i < len(u); i++ {
+				msgReceived = append(msgReceived, string(u[i][1]))
+			}
 		}
 	}
 
-	// Delete the downloaded messages.
-	for id := 1; id <= count; id++ {
-		if err := c.Dele(id); err != nil {
-			return err
-		}
+	date, _ := time.Parse("Mon, 02 Jan 2006 15:04:05 -0700", hdr[models.EmailHeaderDate])
+	if date.IsZero() {
+		date = time.Now()
 	}
 
-	return nil
+	// Classify the bounce type based on message content.
+	bounceType, bounceReason := classifyBounce(b)
+
+	// Additional bounce e-mail metadata.
+	meta, _ := json.Marshal(bounceMeta{
+		From:           hdr[models.EmailHeaderFrom],
+		Subject:        hdr[models.EmailHeaderSubject],
+		MessageID:      hdr[models.EmailHeaderMessageId],
+		DeliveredTo:    hdr[models.EmailHeaderDeliveredTo],
+		Received:       msgReceived,
+		ClassifyReason: bounceReason,
+	})
+
+	return models.Bounce{
+		Type:           bounceType,
+		CampaignUUID:   hdr[models.EmailHeaderCampaignUUID],
+		SubscriberUUID: hdr[models.EmailHeaderSubscriberUUID],
+		Source:         source,
+		CreatedAt:      date,
+		Meta:           meta,
+	}, nil
 }
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetAutomationRules retrieves all automation rules, or only the enabled ones.
+func (c *Core) GetAutomationRules(enabledOnly bool) ([]models.AutomationRule, error) {
+	out := []models.AutomationRule{}
+	if err := c.q.GetAutomationRules.Select(&out, 0, enabledOnly); err != nil {
+		c.log.Printf("error fetching automation rules: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{automation.rules}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetAutomationRule retrieves an automation rule.
+func (c *Core) GetAutomationRule(id int) (models.AutomationRule, error) {
+	var out []models.AutomationRule
+	if err := c.q.GetAutomationRules.Select(&out, id, false); err != nil {
+		c.log.Printf("error fetching automation rule: %v", err)
+		return models.AutomationRule{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{automation.rule}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.AutomationRule{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{automation.rule}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateAutomationRule creates a new automation rule.
+func (c *Core) CreateAutomationRule(r models.AutomationRule) (models.AutomationRule, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.AutomationRule{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var newID int
+	if err := c.q.CreateAutomationRule.Get(&newID, uu.String(), r.Name, r.Enabled, r.Trigger, r.TriggerAttrib, r.Condition, r.Actions); err != nil {
+		c.log.Printf("error creating automation rule: %v", err)
+		return models.AutomationRule{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{automation.rule}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetAutomationRule(newID)
+}
+
+// UpdateAutomationRule updates an automation rule.
+func (c *Core) UpdateAutomationRule(id int, r models.AutomationRule) (models.AutomationRule, error) {
+	res, err := c.q.UpdateAutomationRule.Exec(id, r.Name, r.Enabled, r.Trigger, r.TriggerAttrib, r.Condition, r.Actions)
+	if err != nil {
+		c.log.Printf("error updating automation rule: %v", err)
+		return models.AutomationRule{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{automation.rule}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.AutomationRule{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{automation.rule}"))
+	}
+
+	return c.GetAutomationRule(id)
+}
+
+// DeleteAutomationRule deletes an automation rule along with its run log.
+func (c *Core) DeleteAutomationRule(id int) error {
+	if _, err := c.q.DeleteAutomationRule.Exec(id); err != nil {
+		c.log.Printf("error deleting automation rule: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{automation.rule}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// InsertAutomationLog records a run of an automation rule.
+func (c *Core) InsertAutomationLog(l models.AutomationLog) error {
+	if _, err := c.q.InsertAutomationLog.Exec(l.RuleID, l.SubscriberID, l.Event, l.Status, l.Error); err != nil {
+		c.log.Printf("error inserting automation log: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{automation.logs}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// QueryAutomationLogs retrieves the run log of an automation rule, optionally
+// filtered by status (success|failed).
+func (c *Core) QueryAutomationLogs(ruleID int, status string, offset, limit int) ([]models.AutomationLog, int, error) {
+	out := []models.AutomationLog{}
+	if err := c.q.QueryAutomationLogs.Select(&out, ruleID, status, offset, limit); err != nil {
+		c.log.Printf("error fetching automation logs: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{automation.logs}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
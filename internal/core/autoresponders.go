@@ -1,10 +1,15 @@
 package core
 
 import (
+	"database/sql"
 	"net/http"
+	"time"
 
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 )
 
 // GetAutorespondersForList retrieves all active autoresponder campaigns for a given list.
@@ -39,3 +44,209 @@ func (c *Core) RecordAutoresponderSent(campaignID, subscriberID, listID int) err
 	}
 	return nil
 }
+
+// GetAutoresponder retrieves a running autoresponder campaign with its template body.
+func (c *Core) GetAutoresponder(campID int) (models.Campaign, error) {
+	var out models.Campaign
+	if err := c.q.GetAutoresponder.Get(&out, campID); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.campaign}"))
+		}
+
+		c.log.Printf("error fetching autoresponder %d: %v", campID, err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetAutoresponderSequences retrieves all autoresponder sequences.
+func (c *Core) GetAutoresponderSequences() ([]models.AutoresponderSequence, error) {
+	out := []models.AutoresponderSequence{}
+	if err := c.q.GetAutoresponderSequences.Select(&out, 0); err != nil {
+		c.log.Printf("error fetching autoresponder sequences: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{campaigns.sequences}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetAutoresponderSequence retrieves an autoresponder sequence.
+func (c *Core) GetAutoresponderSequence(id int) (models.AutoresponderSequence, error) {
+	var out []models.AutoresponderSequence
+	if err := c.q.GetAutoresponderSequences.Select(&out, id); err != nil {
+		c.log.Printf("error fetching autoresponder sequence: %v", err)
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{campaigns.sequence}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateAutoresponderSequence creates a new autoresponder sequence and its steps.
+func (c *Core) CreateAutoresponderSequence(s models.AutoresponderSequence) (models.AutoresponderSequence, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	// Insert the sequence and its steps in a single transaction.
+	tx, err := c.db.Beginx()
+	if err != nil {
+		c.log.Printf("error beginning transaction: %v", err)
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+	defer tx.Rollback()
+
+	var newID int
+	if err := tx.Stmtx(c.q.CreateAutoresponderSequence).Get(&newID, uu.String(), s.Name, s.ListID, s.TriggerOnConfirm, s.Enabled); err != nil {
+		c.log.Printf("error creating autoresponder sequence: %v", err)
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+
+	if err := c.upsertAutoresponderSteps(tx, newID, s.Steps); err != nil {
+		return models.AutoresponderSequence{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.log.Printf("error committing autoresponder sequence: %v", err)
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetAutoresponderSequence(newID)
+}
+
+// UpdateAutoresponderSequence updates an autoresponder sequence and replaces its steps.
+// Sends that have already been scheduled retain their original send times.
+func (c *Core) UpdateAutoresponderSequence(id int, s models.AutoresponderSequence) (models.AutoresponderSequence, error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		c.log.Printf("error beginning transaction: %v", err)
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Stmtx(c.q.UpdateAutoresponderSequence).Exec(id, s.Name, s.ListID, s.TriggerOnConfirm, s.Enabled)
+	if err != nil {
+		c.log.Printf("error updating autoresponder sequence: %v", err)
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{campaigns.sequence}"))
+	}
+
+	if err := c.upsertAutoresponderSteps(tx, id, s.Steps); err != nil {
+		return models.AutoresponderSequence{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.log.Printf("error committing autoresponder sequence: %v", err)
+		return models.AutoresponderSequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetAutoresponderSequence(id)
+}
+
+// DeleteAutoresponderSequence deletes an autoresponder sequence along with its
+// steps and pending scheduled sends.
+func (c *Core) DeleteAutoresponderSequence(id int) error {
+	if _, err := c.q.DeleteAutoresponderSequence.Exec(id); err != nil {
+		c.log.Printf("error deleting autoresponder sequence: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// ScheduleAutoresponderSequences schedules the steps of the enabled sequences on
+// the given lists for a subscriber. isConfirmation indicates whether the trigger
+// is an opt-in confirmation or a subscription.
+func (c *Core) ScheduleAutoresponderSequences(subID int, listIDs []int, isConfirmation bool) error {
+	if _, err := c.q.ScheduleAutoresponderSequences.Exec(subID, pq.Array(listIDs), isConfirmation); err != nil {
+		c.log.Printf("error scheduling autoresponder sequences for subscriber %d: %v", subID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetDueAutoresponders retrieves scheduled sends that are due and reserves them
+// for the lease duration. Sends that are no longer applicable (unsubscribed,
+// already sent etc.) are discarded first.
+func (c *Core) GetDueAutoresponders(limit int, lease time.Duration) ([]models.ScheduledAutoresponder, error) {
+	if _, err := c.q.DeleteStaleAutoresponderSchedule.Exec(); err != nil {
+		c.log.Printf("error deleting stale scheduled autoresponders: %v", err)
+	}
+
+	var out []models.ScheduledAutoresponder
+	if err := c.q.GetDueAutoresponders.Select(&out, limit, lease.Seconds()); err != nil {
+		c.log.Printf("error fetching due autoresponders: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "autoresponders", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// RetryScheduledAutoresponder reschedules a send that has failed attempts times.
+func (c *Core) RetryScheduledAutoresponder(id int64, attempts int, sendAt time.Time) error {
+	if _, err := c.q.RetryScheduledAutoresponder.Exec(id, attempts, sendAt); err != nil {
+		c.log.Printf("error rescheduling autoresponder: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "autoresponder", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// DeleteScheduledAutoresponder removes a scheduled send.
+func (c *Core) DeleteScheduledAutoresponder(id int64) error {
+	if _, err := c.q.DeleteScheduledAutoresponder.Exec(id); err != nil {
+		c.log.Printf("error deleting scheduled autoresponder: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "autoresponder", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// upsertAutoresponderSteps replaces the steps of a sequence with the given steps
+// in the given order.
+func (c *Core) upsertAutoresponderSteps(tx *sqlx.Tx, seqID int, steps models.AutoresponderSteps) error {
+	var (
+		campIDs = make([]int, 0, len(steps))
+		delays  = make([]string, 0, len(steps))
+	)
+	for _, s := range steps {
+		campIDs = append(campIDs, s.CampaignID)
+		delays = append(delays, s.Delay)
+	}
+
+	if _, err := tx.Stmtx(c.q.UpsertAutoresponderSteps).Exec(seqID, pq.Array(campIDs), pq.Array(delays)); err != nil {
+		c.log.Printf("error upserting autoresponder steps: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{campaigns.sequence}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
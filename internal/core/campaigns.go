@@ -7,9 +7,11 @@ import (
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
+	null "gopkg.in/volatiletech/null.v6"
 )
 
 const (
@@ -23,7 +25,7 @@ const (
 
 // QueryCampaigns retrieves paginated campaigns optionally filtering them by the given arbitrary
 // query expression. It also returns the total number of records in the DB.
-func (c *Core) QueryCampaigns(searchStr string, statuses, tags []string, orderBy, order string, getAll bool, permittedLists []int, offset, limit int) (models.Campaigns, int, error) {
+func (c *Core) QueryCampaigns(searchStr string, statuses, tags []string, parentID int, orderBy, order string, getAll bool, permittedLists []int, offset, limit int) (models.Campaigns, int, error) {
 	queryStr, stmt := makeSearchQuery(searchStr, orderBy, order, c.q.QueryCampaigns, campQuerySortFields)
 
 	if statuses == nil {
@@ -36,7 +38,7 @@ func (c *Core) QueryCampaigns(searchStr string, statuses, tags []string, orderBy
 
 	// Unsafe to ignore scanning fields not present in models.Campaigns.
 	var out models.Campaigns
-	if err := c.db.Select(&out, stmt, 0, pq.StringArray(statuses), pq.StringArray(tags), queryStr, getAll, pq.Array(permittedLists), offset, limit); err != nil {
+	if err := c.db.Select(&out, stmt, 0, pq.StringArray(statuses), pq.StringArray(tags), queryStr, getAll, pq.Array(permittedLists), offset, limit, parentID); err != nil {
 		c.log.Printf("error fetching campaigns: %v", err)
 		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
@@ -160,7 +162,7 @@ func (c *Core) GetArchivedCampaigns(offset, limit int) (models.Campaigns, int, e
 }
 
 // CreateCampaign creates a new campaign.
-func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int) (models.Campaign, error) {
+func (c *Core) CreateCampaign(o models.Campaign, listIDs, segmentIDs, mediaIDs []int) (models.Campaign, error) {
 	uu, err := uuid.NewV4()
 	if err != nil {
 		c.log.Printf("error generating UUID: %v", err)
@@ -169,7 +171,10 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 	}
 
 	// Insert and read ID.
-	var newID int
+	var (
+		newID                    int
+		labels, subjects, bodies = variantFields(o.Variants)
+	)
 	if err := c.q.CreateCampaign.Get(&newID,
 		uu,
 		o.Type,
@@ -192,6 +197,26 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 		pq.Array(mediaIDs),
 		o.BodySource,
 		o.ARTriggerOnConfirm,
+		o.ABPercent,
+		o.ABMetric,
+		o.ABWait,
+		pq.Array(labels),
+		pq.Array(subjects),
+		pq.Array(bodies),
+		o.LocalSend,
+		o.LocalTimezone,
+		o.Priority,
+		o.MessageRate,
+		o.SlidingWindowRate,
+		o.SlidingWindowDuration,
+		o.Recurrence,
+		o.FeedURL,
+		o.FeedInterval,
+		o.FeedMinItems,
+		o.QuietHours,
+		pq.Array(segmentIDs),
+		o.Exclusions,
+		o.FrequencyCapExempt,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return models.Campaign{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("campaigns.noSubs"))
@@ -210,8 +235,50 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 	return out, nil
 }
 
+// ResendCampaign clones a finished campaign into a draft campaign that's sent
+// to the given audience of the original campaign's recipients.
+func (c *Core) ResendCampaign(id int, name, audience string) (models.Campaign, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.Campaign{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var newID int
+	if err := c.q.ResendCampaign.Get(&newID, id, uu, name, audience); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Campaign{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("campaigns.cantResend"))
+		}
+
+		c.log.Printf("error resending campaign: %v", err)
+		return models.Campaign{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetCampaign(newID, "", "")
+}
+
+// UpdateCampaignRecurrence moves the next occurrence of a recurring campaign, eg: to skip one.
+func (c *Core) UpdateCampaignRecurrence(id int, cur null.Time, next time.Time) (models.Campaign, error) {
+	res, err := c.q.UpdateCampaignRecurrence.Exec(id, cur, next)
+	if err != nil {
+		c.log.Printf("error updating campaign recurrence: %v", err)
+		return models.Campaign{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	// The campaign isn't an active recurring campaign or its occurrence has just been run.
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Campaign{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("campaigns.cantSkipRun"))
+	}
+
+	return c.GetCampaign(id, "", "")
+}
+
 // UpdateCampaign updates a campaign.
-func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs []int) (models.Campaign, error) {
+func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs, segmentIDs, mediaIDs []int) (models.Campaign, error) {
+	labels, subjects, bodies := variantFields(o.Variants)
 	_, err := c.q.UpdateCampaign.Exec(id,
 		o.Name,
 		o.Subject,
@@ -231,7 +298,27 @@ func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs
 		o.ArchiveMeta,
 		pq.Array(mediaIDs),
 		o.BodySource,
-		o.ARTriggerOnConfirm)
+		o.ARTriggerOnConfirm,
+		o.ABPercent,
+		o.ABMetric,
+		o.ABWait,
+		pq.Array(labels),
+		pq.Array(subjects),
+		pq.Array(bodies),
+		o.LocalSend,
+		o.LocalTimezone,
+		o.Priority,
+		o.MessageRate,
+		o.SlidingWindowRate,
+		o.SlidingWindowDuration,
+		o.Recurrence,
+		o.FeedURL,
+		o.FeedInterval,
+		o.FeedMinItems,
+		o.QuietHours,
+		pq.Array(segmentIDs),
+		o.Exclusions,
+		o.FrequencyCapExempt)
 	if err != nil {
 		c.log.Printf("error updating campaign: %v", err)
 		return models.Campaign{}, echo.NewHTTPError(http.StatusInternalServerError,
@@ -299,6 +386,34 @@ func (c *Core) UpdateCampaignStatus(id int, status string) (models.Campaign, err
 	}
 
 	cm.Status = status
+
+	// Dispatch webhook event for the status change. Campaigns that are started
+	// or finished are dispatched by the campaign manager.
+	if c.h.DispatchWebhook != nil {
+		var ev string
+		switch status {
+		case models.CampaignStatusPaused:
+			ev = webhooks.EventCampaignPaused
+		case models.CampaignStatusCancelled:
+			ev = webhooks.EventCampaignCancelled
+		case models.CampaignStatusScheduled:
+			ev = webhooks.EventCampaignScheduled
+		}
+
+		if ev != "" {
+			c.h.DispatchWebhook(ev, map[string]any{
+				"campaign": map[string]any{
+					"id":      cm.ID,
+					"uuid":    cm.UUID,
+					"name":    cm.Name,
+					"type":    cm.Type,
+					"tags":    cm.Tags,
+					"send_at": cm.SendAt,
+				},
+			})
+		}
+	}
+
 	return cm, nil
 }
 
@@ -411,6 +526,18 @@ func (c *Core) GetCampaignAnalyticsCounts(campIDs []int, typ, fromDate, toDate s
 	return out, nil
 }
 
+// GetCampaignAnalyticsVariants returns the stats of the A/B test variants of the given campaign IDs.
+func (c *Core) GetCampaignAnalyticsVariants(campIDs []int, fromDate, toDate string) ([]models.CampaignAnalyticsVariant, error) {
+	out := []models.CampaignAnalyticsVariant{}
+	if err := c.q.GetCampaignVariantStats.Select(&out, pq.Array(campIDs), fromDate, toDate); err != nil {
+		c.log.Printf("error fetching campaign variant stats: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.analytics}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
 // GetCampaignAnalyticsLinks returns link click analytics for the given campaign IDs.
 func (c *Core) GetCampaignAnalyticsLinks(campIDs []int, typ, fromDate, toDate string) ([]models.CampaignAnalyticsLink, error) {
 	out := []models.CampaignAnalyticsLink{}
@@ -423,33 +550,39 @@ func (c *Core) GetCampaignAnalyticsLinks(campIDs []int, typ, fromDate, toDate st
 	return out, nil
 }
 
-// RegisterCampaignView registers a subscriber's view on a campaign.
-func (c *Core) RegisterCampaignView(campUUID, subUUID string) error {
-	if _, err := c.q.RegisterCampaignView.Exec(campUUID, subUUID); err != nil {
+// RegisterCampaignView registers a subscriber's view on a campaign and
+// returns the campaign's tags.
+func (c *Core) RegisterCampaignView(campUUID, subUUID string) ([]string, error) {
+	var tags pq.StringArray
+	if err := c.q.RegisterCampaignView.Get(&tags, campUUID, subUUID); err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Column == "campaign_id" {
-			return nil
+			return nil, nil
 		}
 
 		c.log.Printf("error registering campaign view: %s", err)
-		return echo.NewHTTPError(http.StatusInternalServerError,
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
 	}
-	return nil
+	return tags, nil
 }
 
-// RegisterCampaignLinkClick registers a subscriber's link click on a campaign.
-func (c *Core) RegisterCampaignLinkClick(linkUUID, campUUID, subUUID string) (string, error) {
-	var url string
-	if err := c.q.RegisterLinkClick.Get(&url, linkUUID, campUUID, subUUID); err != nil {
+// RegisterCampaignLinkClick registers a subscriber's link click on a campaign
+// and returns the link's URL and the campaign's tags.
+func (c *Core) RegisterCampaignLinkClick(linkUUID, campUUID, subUUID string) (string, []string, error) {
+	var (
+		url  string
+		tags pq.StringArray
+	)
+	if err := c.q.RegisterLinkClick.QueryRow(linkUUID, campUUID, subUUID).Scan(&url, &tags); err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Column == "link_id" {
-			return "", echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("public.invalidLink"))
+			return "", nil, echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("public.invalidLink"))
 		}
 
 		c.log.Printf("error registering link click: %s", err)
-		return "", echo.NewHTTPError(http.StatusInternalServerError, c.i18n.Ts("public.errorProcessingRequest"))
+		return "", nil, echo.NewHTTPError(http.StatusInternalServerError, c.i18n.Ts("public.errorProcessingRequest"))
 	}
 
-	return url, nil
+	return url, tags, nil
 }
 
 // DeleteCampaignViews deletes campaign views older than a given date.
@@ -471,3 +604,50 @@ func (c *Core) DeleteCampaignLinkClicks(before time.Time) error {
 
 	return nil
 }
+
+// QueryCampaignSends retrieves the send log of a campaign and/or a subscriber,
+// optionally filtered by status (sent|failed).
+func (c *Core) QueryCampaignSends(campID, subID int, status string, offset, limit int) ([]models.CampaignSend, int, error) {
+	out := []models.CampaignSend{}
+	if err := c.q.QueryCampaignSends.Select(&out, campID, subID, status, offset, limit); err != nil {
+		c.log.Printf("error fetching campaign send log: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{campaigns.sendLog}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// DeleteCampaignSends deletes campaign send log entries older than the given number of days.
+func (c *Core) DeleteCampaignSends(days int) (int, error) {
+	var n int
+	if err := c.q.DeleteCampaignSends.Get(&n, days); err != nil {
+		c.log.Printf("error deleting campaign send log: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{campaigns.sendLog}", "error", pqErrMsg(err)))
+	}
+
+	return n, nil
+}
+
+// variantFields returns the labels, subjects, and bodies of A/B test variants
+// as separate slices for inserting into the DB.
+func variantFields(vars models.CampaignVariants) ([]string, []string, []string) {
+	var (
+		labels   = make([]string, len(vars))
+		subjects = make([]string, len(vars))
+		bodies   = make([]string, len(vars))
+	)
+	for i, v := range vars {
+		labels[i] = v.Label
+		subjects[i] = v.Subject
+		bodies[i] = v.Body
+	}
+
+	return labels, subjects, bodies
+}
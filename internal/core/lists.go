@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
@@ -185,7 +186,19 @@ func (c *Core) CreateList(l models.List) (models.List, error) {
 			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.list}", "error", pqErrMsg(err)))
 	}
 
-	return c.GetList(newID, "")
+	out, err := c.GetList(newID, "")
+	if err != nil {
+		return models.List{}, err
+	}
+
+	// Dispatch webhook event.
+	if c.h.DispatchWebhook != nil {
+		c.h.DispatchWebhook(webhooks.EventListCreated, map[string]any{
+			"list": out,
+		})
+	}
+
+	return out, nil
 }
 
 // UpdateList updates a given list.
@@ -202,7 +215,19 @@ func (c *Core) UpdateList(id int, l models.List) (models.List, error) {
 			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.list}"))
 	}
 
-	return c.GetList(id, "")
+	out, err := c.GetList(id, "")
+	if err != nil {
+		return models.List{}, err
+	}
+
+	// Dispatch webhook event.
+	if c.h.DispatchWebhook != nil {
+		c.h.DispatchWebhook(webhooks.EventListUpdated, map[string]any{
+			"list": out,
+		})
+	}
+
+	return out, nil
 }
 
 // DeleteList deletes a list.
@@ -222,10 +247,28 @@ func (c *Core) DeleteLists(ids []int, query string, getAll bool, permittedIDs []
 		return echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("globals.messages.invalidData"))
 	}
 
-	if _, err := c.q.DeleteLists.Exec(pq.Array(ids), queryStr, getAll, pq.Array(permittedIDs)); err != nil {
+	var deleted []models.List
+	if err := c.q.DeleteLists.Select(&deleted, pq.Array(ids), queryStr, getAll, pq.Array(permittedIDs)); err != nil {
 		c.log.Printf("error deleting lists: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.lists}", "error", pqErrMsg(err)))
 	}
+
+	// Dispatch webhook event.
+	if c.h.DispatchWebhook != nil && len(deleted) > 0 {
+		lists := make([]map[string]any, 0, len(deleted))
+		for _, l := range deleted {
+			lists = append(lists, map[string]any{
+				"id":   l.ID,
+				"uuid": l.UUID,
+				"name": l.Name,
+			})
+		}
+
+		c.h.DispatchWebhook(webhooks.EventListDeleted, map[string]any{
+			"lists": lists,
+		})
+	}
+
 	return nil
 }
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSegments returns all segments with their live subscriber counts.
+func (c *Core) GetSegments() ([]models.Segment, error) {
+	out := []models.Segment{}
+	if err := c.q.GetSegments.Select(&out, 0); err != nil {
+		c.log.Printf("error fetching segments: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.segments}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return out, nil
+	}
+
+	// Count all the segments in a single query.
+	counts, err := c.countSegments(out)
+	if err == nil {
+		for i, n := range counts {
+			out[i].SubscriberCount = int(n)
+		}
+		return out, nil
+	}
+
+	// A segment whose query has gone bad (eg: a dropped attribute cast) shouldn't
+	// break the listing. It's reported when the segment is edited. Count the segments
+	// one by one to find it.
+	for i, s := range out {
+		n, err := c.countSegment(s.Query)
+		if err != nil {
+			c.log.Printf("error counting subscribers in segment (%s): %v", s.Name, err)
+			continue
+		}
+		out[i].SubscriberCount = n
+	}
+
+	return out, nil
+}
+
+// GetSegment returns a segment with its live subscriber count.
+func (c *Core) GetSegment(id int) (models.Segment, error) {
+	var out []models.Segment
+	if err := c.q.GetSegments.Select(&out, id); err != nil {
+		c.log.Printf("error fetching segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+	}
+
+	s := out[0]
+	if n, err := c.countSegment(s.Query); err != nil {
+		c.log.Printf("error counting subscribers in segment (%s): %v", s.Name, err)
+	} else {
+		s.SubscriberCount = n
+	}
+
+	return s, nil
+}
+
+// CreateSegment creates a new segment after validating its query expression.
+func (c *Core) CreateSegment(s models.Segment) (models.Segment, error) {
+	if err := c.validateSegmentQuery(s.Query); err != nil {
+		return models.Segment{}, err
+	}
+
+	var newID int
+	if err := c.q.CreateSegment.Get(&newID, s.Name, s.Description, s.Query); err != nil {
+		c.log.Printf("error creating segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetSegment(newID)
+}
+
+// UpdateSegment updates a segment after validating its query expression.
+func (c *Core) UpdateSegment(id int, s models.Segment) (models.Segment, error) {
+	if err := c.validateSegmentQuery(s.Query); err != nil {
+		return models.Segment{}, err
+	}
+
+	var updatedID int
+	if err := c.q.UpdateSegment.Get(&updatedID, id, s.Name, s.Description, s.Query); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+		}
+
+		c.log.Printf("error updating segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetSegment(id)
+}
+
+// DeleteSegment deletes a segment. Campaigns that target it retain its name
+// but are no longer sent to its subscribers.
+func (c *Core) DeleteSegment(id int) error {
+	res, err := c.q.DeleteSegment.Exec(id)
+	if err != nil {
+		c.log.Printf("error deleting segment: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+	}
+
+	return nil
+}
+
+// validateSegmentQuery checks that a segment's query expression accesses only the
+// tables that are allowed in subscriber queries and that it runs read-only.
+func (c *Core) validateSegmentQuery(exp string) error {
+	stmt := strings.ReplaceAll(c.q.QuerySubscribers, "%query%", exp)
+	stmt = strings.ReplaceAll(stmt, "%order%", "subscribers.id")
+
+	if err := validateQueryTables(c.db, stmt, allowedSubQueryTables); err != nil {
+		c.log.Printf("error validating segment query: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("subscribers.errorPreparingQuery", "error", err.Error()))
+	}
+
+	if _, err := c.countSegment(exp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// countSegments counts the subscribers that the query expressions of the given
+// segments match in a read-only transaction.
+func (c *Core) countSegments(segs []models.Segment) (pq.Int64Array, error) {
+	tx, err := c.db.BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exps := make([]string, len(segs))
+	for i, s := range segs {
+		exps[i] = "COUNT(*) FILTER (WHERE (" + s.Query + "))"
+	}
+
+	var out pq.Int64Array
+	if err := tx.Get(&out, strings.ReplaceAll(c.q.CountSegmentsSubscribers, "%counts%", strings.Join(exps, ", "))); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// countSegment counts the subscribers that a segment's query expression matches
+// in a read-only transaction.
+func (c *Core) countSegment(exp string) (int, error) {
+	tx, err := c.db.BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		c.log.Printf("error preparing segment query: %v", err)
+		return 0, echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("subscribers.errorPreparingQuery", "error", pqErrMsg(err)))
+	}
+	defer tx.Rollback()
+
+	n := 0
+	if err := tx.Get(&n, strings.ReplaceAll(c.q.CountSegmentSubscribers, "%query%", exp)); err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("subscribers.errorPreparingQuery", "error", pqErrMsg(err)))
+	}
+
+	return n, nil
+}
@@ -366,6 +366,8 @@ func (c *Core) InsertSubscriber(sub models.Subscriber, listIDs []int, listUUIDs
 
 // UpdateSubscriber updates a subscriber's properties.
 func (c *Core) UpdateSubscriber(id int, sub models.Subscriber) (models.Subscriber, error) {
+	prevAttribs := c.getPrevAttribs(id)
+
 	// Format raw JSON attributes.
 	attribs := []byte("{}")
 	if len(sub.Attribs) > 0 {
@@ -395,6 +397,14 @@ func (c *Core) UpdateSubscriber(id int, sub models.Subscriber) (models.Subscribe
 		return models.Subscriber{}, err
 	}
 
+	// Dispatch webhook event.
+	if c.h.DispatchWebhook != nil {
+		c.h.DispatchWebhook(webhooks.EventSubscriberUpdated, map[string]any{
+			"subscriber":       out,
+			"previous_attribs": prevAttribs,
+		})
+	}
+
 	return out, nil
 }
 
@@ -407,6 +417,8 @@ func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs
 		subStatus = models.SubscriptionStatusConfirmed
 	}
 
+	prevAttribs := c.getPrevAttribs(id)
+
 	// Format raw JSON attributes.
 	attribs := []byte("{}")
 	if len(sub.Attribs) > 0 {
@@ -449,6 +461,15 @@ func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs
 		hasOptin = num > 0
 	}
 
+	// Dispatch webhook event.
+	if c.h.DispatchWebhook != nil {
+		c.h.DispatchWebhook(webhooks.EventSubscriberUpdated, map[string]any{
+			"subscriber":       out,
+			"list_ids":         listIDs,
+			"previous_attribs": prevAttribs,
+		})
+	}
+
 	// Trigger autoresponders for subscriptions.
 	// For campaigns with ar_trigger_on_confirm=false, they fire immediately on subscription.
 	// For campaigns with ar_trigger_on_confirm=true, they fire on confirmation (handled separately).
@@ -459,6 +480,20 @@ func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs
 	return out, hasOptin, nil
 }
 
+// getPrevAttribs returns a subscriber's attributes before an update, for
+// the subscriber.updated event to carry the changes.
+func (c *Core) getPrevAttribs(id int) models.JSON {
+	if c.h.DispatchWebhook == nil {
+		return models.JSON{}
+	}
+
+	sub, err := c.GetSubscriber(id, "", "")
+	if err != nil || sub.Attribs == nil {
+		return models.JSON{}
+	}
+	return sub.Attribs
+}
+
 // BlocklistSubscribers blocklists the given list of subscribers.
 func (c *Core) BlocklistSubscribers(subIDs []int) error {
 	if _, err := c.q.BlocklistSubscribers.Exec(pq.Array(subIDs)); err != nil {
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// QueryWebhookDeadLetters retrieves permanently failed webhook deliveries,
+// optionally filtered by endpoint UUID and event.
+func (c *Core) QueryWebhookDeadLetters(endpointUUID, event string, offset, limit int) ([]models.WebhookDeadLetter, int, error) {
+	out := []models.WebhookDeadLetter{}
+	if err := c.q.QueryWebhookDeadLetters.Select(&out, 0, endpointUUID, event, offset, limit); err != nil {
+		c.log.Printf("error fetching failed webhook deliveries: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{webhooks.deliveries}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetWebhookDeadLetter retrieves a permanently failed webhook delivery.
+func (c *Core) GetWebhookDeadLetter(id int) (models.WebhookDeadLetter, error) {
+	var out []models.WebhookDeadLetter
+	if err := c.q.QueryWebhookDeadLetters.Select(&out, id, "", "", 0, 1); err != nil {
+		c.log.Printf("error fetching failed webhook delivery: %v", err)
+		return models.WebhookDeadLetter{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{webhooks.delivery}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.WebhookDeadLetter{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{webhooks.delivery}"))
+	}
+
+	return out[0], nil
+}
+
+// ReplayWebhookDeadLetters moves permanently failed webhook deliveries back
+// to the delivery queue from where they're picked up and sent again.
+func (c *Core) ReplayWebhookDeadLetters(ids []int) (int, error) {
+	res, err := c.q.ReplayWebhookDeadLetters.Exec(pq.Array(ids))
+	if err != nil {
+		c.log.Printf("error replaying failed webhook deliveries: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{webhooks.deliveries}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// DeleteWebhookDeadLetters deletes one or more (or all) permanently failed webhook deliveries.
+func (c *Core) DeleteWebhookDeadLetters(ids []int, all bool) error {
+	if _, err := c.q.DeleteWebhookDeadLetters.Exec(pq.Array(ids), all); err != nil {
+		c.log.Printf("error deleting failed webhook deliveries: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{webhooks.deliveries}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// QueryWebhookLog retrieves the delivery log of a webhook endpoint, optionally
+// filtered by event and status (success|failed).
+func (c *Core) QueryWebhookLog(endpointUUID, event, status string, offset, limit int) ([]models.WebhookLog, int, error) {
+	out := []models.WebhookLog{}
+	if err := c.q.QueryWebhookLog.Select(&out, endpointUUID, event, status, offset, limit); err != nil {
+		c.log.Printf("error fetching webhook delivery log: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{webhooks.deliveries}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// DeleteWebhookLog deletes webhook delivery log entries older than the given number of days.
+func (c *Core) DeleteWebhookLog(days int) (int, error) {
+	var n int
+	if err := c.q.DeleteWebhookLog.Get(&n, days); err != nil {
+		c.log.Printf("error deleting webhook delivery log: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{webhooks.deliveries}", "error", pqErrMsg(err)))
+	}
+
+	return n, nil
+}
@@ -0,0 +1,335 @@
+// Package feed fetches and parses RSS and Atom feeds for feed campaigns.
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// Max size of a feed document.
+	maxFeedSize = 10 << 20
+
+	fetchTimeout = 30 * time.Second
+)
+
+var client = &http.Client{Timeout: fetchTimeout}
+
+// Layouts of the dates in feeds. RSS uses RFC 822 dates, often with
+// variations, and Atom, RFC 3339.
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	time.RFC3339Nano,
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// doc is the union of the RSS 2.0, RSS 1.0 (RDF), and Atom document structures.
+type doc struct {
+	XMLName xml.Name
+
+	// RSS. In RSS 1.0, items are outside the channel.
+	Channel struct {
+		Title string    `xml:"title"`
+		Links []string  `xml:"link"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items []rssItem `xml:"item"`
+
+	// Atom.
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	GUID        string   `xml:"guid"`
+	Title       string   `xml:"title"`
+	Links       []string `xml:"link"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	PubDate     string   `xml:"pubDate"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     atomText   `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Summary   atomText   `xml:"summary"`
+	Content   atomText   `xml:"content"`
+	Authors   []string   `xml:"author>name"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+// Fetch fetches and parses the feed at the given URL.
+func Fetch(url string) (models.Feed, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return models.Feed{}, err
+	}
+	req.Header.Set("User-Agent", "listmonk")
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, text/xml;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return models.Feed{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return models.Feed{}, fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return models.Feed{}, err
+	}
+
+	f, err := Parse(b)
+	if err != nil {
+		return f, err
+	}
+	if f.URL == "" {
+		f.URL = url
+	}
+
+	return f, nil
+}
+
+// Parse parses an RSS 2.0, RSS 1.0, or Atom feed. The items are ordered
+// newest first.
+func Parse(b []byte) (models.Feed, error) {
+	var d doc
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	dec.CharsetReader = charsetReader
+	if err := dec.Decode(&d); err != nil {
+		return models.Feed{}, fmt.Errorf("error parsing feed: %v", err)
+	}
+
+	var out models.Feed
+	switch strings.ToLower(d.XMLName.Local) {
+	case "rss", "rdf":
+		out.Title = strings.TrimSpace(d.Channel.Title)
+		out.URL = first(d.Channel.Links)
+
+		for _, it := range append(d.Channel.Items, d.Items...) {
+			out.Items = append(out.Items, it.item())
+		}
+
+	case "feed":
+		out.Title = strings.TrimSpace(d.Title)
+		out.URL = atomHref(d.Links)
+
+		for _, e := range d.Entries {
+			out.Items = append(out.Items, e.item())
+		}
+
+	default:
+		return models.Feed{}, errors.New("unknown feed format: " + d.XMLName.Local)
+	}
+
+	sortItems(out.Items)
+	return out, nil
+}
+
+// NewItems returns the items that are newer than (precede) the last seen item
+// with the given GUID. If the item is no longer in the feed, eg: it's been deleted
+// or has dropped off the end of the feed, the items published after it (lastPublished)
+// are new. If its date isn't known either, none of the items are.
+func NewItems(items []models.FeedItem, lastGUID string, lastPublished null.Time) []models.FeedItem {
+	if i := indexOf(items, lastGUID); i >= 0 {
+		return items[:i]
+	}
+	if !lastPublished.Valid {
+		return nil
+	}
+
+	var out []models.FeedItem
+	for _, it := range items {
+		if it.PublishedAt.Valid && it.PublishedAt.Time.After(lastPublished.Time) {
+			out = append(out, it)
+		}
+	}
+
+	return out
+}
+
+// Has checks whether the item with the given GUID is in the feed.
+func Has(items []models.FeedItem, guid string) bool {
+	return indexOf(items, guid) >= 0
+}
+
+func indexOf(items []models.FeedItem, guid string) int {
+	for i, it := range items {
+		if it.GUID == guid {
+			return i
+		}
+	}
+	return -1
+}
+
+func (it rssItem) item() models.FeedItem {
+	out := models.FeedItem{
+		Title:       strings.TrimSpace(it.Title),
+		URL:         first(it.Links),
+		Description: strings.TrimSpace(it.Description),
+		Content:     strings.TrimSpace(it.Content),
+		Author:      strings.TrimSpace(it.Author),
+		PublishedAt: parseDate(it.PubDate, it.Date),
+	}
+	if out.Author == "" {
+		out.Author = strings.TrimSpace(it.Creator)
+	}
+	if out.URL == "" {
+		out.URL = it.About
+	}
+
+	out.GUID = strings.TrimSpace(it.GUID)
+	if out.GUID == "" {
+		out.GUID = itemID(out)
+	}
+
+	return out
+}
+
+func (e atomEntry) item() models.FeedItem {
+	out := models.FeedItem{
+		GUID:        strings.TrimSpace(e.ID),
+		Title:       strings.TrimSpace(e.Title.Text),
+		URL:         atomHref(e.Links),
+		Description: e.Summary.html(),
+		Content:     e.Content.html(),
+		Author:      first(e.Authors),
+		PublishedAt: parseDate(e.Published, e.Updated),
+	}
+	if out.GUID == "" {
+		out.GUID = itemID(out)
+	}
+
+	return out
+}
+
+// html returns the HTML of Atom text. XHTML is markup inside the element
+// while text and (escaped) HTML are character data.
+func (t atomText) html() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// itemID returns an ID for items that don't have one.
+func itemID(it models.FeedItem) string {
+	if it.URL != "" {
+		return it.URL
+	}
+	return it.Title
+}
+
+// atomHref returns the URL of the alternate (HTML) link.
+func atomHref(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	return ""
+}
+
+// sortItems orders items newest first if all of them have dates. Otherwise,
+// the feed's order, which is usually newest first, is retained.
+func sortItems(items []models.FeedItem) {
+	for _, it := range items {
+		if !it.PublishedAt.Valid {
+			return
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].PublishedAt.Time.After(items[j].PublishedAt.Time)
+	})
+}
+
+// parseDate parses the first valid date of the given ones.
+func parseDate(dates ...string) null.Time {
+	for _, d := range dates {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+
+		for _, l := range dateLayouts {
+			if t, err := time.Parse(l, d); err == nil {
+				return null.TimeFrom(t)
+			}
+		}
+	}
+
+	return null.Time{}
+}
+
+// first returns the first non-empty string.
+func first(s []string) string {
+	for _, v := range s {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// charsetReader decodes the ISO-8859-1 and Windows-1252 (as ISO-8859-1)
+// feeds that encoding/xml doesn't support.
+func charsetReader(label string, in io.Reader) (io.Reader, error) {
+	switch strings.ToLower(label) {
+	case "iso-8859-1", "latin1", "windows-1252", "us-ascii":
+		b, err := io.ReadAll(in)
+		if err != nil {
+			return nil, err
+		}
+
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return strings.NewReader(string(r)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported feed charset: %s", label)
+}
@@ -0,0 +1,126 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+const rss = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+	<title>Blog</title>
+	<atom:link href="https://example.com/feed.xml" rel="self" />
+	<link>https://example.com</link>
+	<item>
+		<title>Older post</title>
+		<link>https://example.com/older</link>
+		<pubDate>Mon, 06 Jan 2025 10:00:00 +0000</pubDate>
+	</item>
+	<item>
+		<title><![CDATA[Newer post]]></title>
+		<link>https://example.com/newer</link>
+		<guid isPermaLink="false">post-2</guid>
+		<description>&lt;p&gt;Summary&lt;/p&gt;</description>
+		<content:encoded><![CDATA[<p>Full text</p>]]></content:encoded>
+		<dc:creator>Jane</dc:creator>
+		<pubDate>Tue, 7 Jan 2025 10:00:00 GMT</pubDate>
+	</item>
+</channel>
+</rss>`
+
+const atom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>Blog</title>
+	<link href="https://example.com/atom.xml" rel="self" />
+	<link href="https://example.com" />
+	<entry>
+		<id>urn:post-2</id>
+		<title>Newer post</title>
+		<link href="https://example.com/newer" rel="alternate" />
+		<summary type="html">&lt;p&gt;Summary&lt;/p&gt;</summary>
+		<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Full text</p></div></content>
+		<author><name>Jane</name></author>
+		<updated>2025-01-07T10:00:00Z</updated>
+	</entry>
+	<entry>
+		<id>urn:post-1</id>
+		<title>Older post</title>
+		<link href="https://example.com/older" />
+		<published>2025-01-06T10:00:00Z</published>
+	</entry>
+</feed>`
+
+// TestParse tests parsing RSS and Atom feeds into the same items.
+func TestParse(t *testing.T) {
+	for name, src := range map[string]string{"rss": rss, "atom": atom} {
+		f, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if f.Title != "Blog" || f.URL != "https://example.com" {
+			t.Errorf("%s: unexpected feed: %s %s", name, f.Title, f.URL)
+		}
+		if len(f.Items) != 2 {
+			t.Fatalf("%s: expected 2 items, got %d", name, len(f.Items))
+		}
+
+		// Items are sorted newest first.
+		it := f.Items[0]
+		if it.Title != "Newer post" || it.URL != "https://example.com/newer" || it.Author != "Jane" ||
+			it.Description != "<p>Summary</p>" || !it.PublishedAt.Valid {
+			t.Errorf("%s: unexpected item: %+v", name, it)
+		}
+		if name == "rss" && (it.GUID != "post-2" || it.Content != "<p>Full text</p>") {
+			t.Errorf("%s: unexpected item: %+v", name, it)
+		}
+
+		// Items without IDs are identified by their links.
+		if name == "rss" && f.Items[1].GUID != "https://example.com/older" {
+			t.Errorf("%s: unexpected GUID: %s", name, f.Items[1].GUID)
+		}
+	}
+
+	if _, err := Parse([]byte(`<html><body></body></html>`)); err == nil {
+		t.Error("expected error for non-feed document")
+	}
+}
+
+// TestNewItems tests picking the items that are newer than the last seen one.
+func TestNewItems(t *testing.T) {
+	f, err := Parse([]byte(rss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(NewItems(f.Items, "post-2", null.Time{})); n != 0 {
+		t.Errorf("expected no new items, got %d", n)
+	}
+	if n := len(NewItems(f.Items, "https://example.com/older", null.Time{})); n != 1 {
+		t.Errorf("expected 1 new item, got %d", n)
+	}
+
+	// The last seen item is gone from the feed. The items published after it are new.
+	cases := []struct {
+		published null.Time
+		exp       int
+	}{
+		{null.TimeFrom(time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)), 1},
+		{null.TimeFrom(time.Date(2025, 1, 5, 10, 0, 0, 0, time.UTC)), 2},
+		{null.TimeFrom(time.Date(2025, 1, 7, 10, 0, 0, 0, time.UTC)), 0},
+
+		// Without its date, none of the items are known to be new.
+		{null.Time{}, 0},
+	}
+	for _, c := range cases {
+		if n := len(NewItems(f.Items, "removed", c.published)); n != c.exp {
+			t.Errorf("published %v: expected %d new items, got %d", c.published.Time, c.exp, n)
+		}
+	}
+
+	if !Has(f.Items, "post-2") || Has(f.Items, "removed") {
+		t.Error("unexpected result looking up items")
+	}
+}
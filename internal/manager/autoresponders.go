@@ -0,0 +1,150 @@
+package manager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	// Interval at which the schedule is looked up for due autoresponder sends.
+	autoresponderScanInterval = time.Second * 30
+
+	// Max number of due autoresponder sends to fetch in one go.
+	autoresponderBatchSize = 1000
+
+	// Due sends are reserved for this long while they're being sent so that
+	// they aren't picked up by other instances. Sends that are neither sent nor
+	// rescheduled (eg: on a crash) are picked up again after the lease.
+	autoresponderLease = time.Minute * 10
+
+	// Failed sends are retried with an exponential backoff and are dropped
+	// from the schedule after autoresponderMaxAttempts.
+	autoresponderRetryDelay    = time.Minute
+	autoresponderMaxRetryDelay = time.Hour * 6
+	autoresponderMaxAttempts   = 5
+)
+
+// AutoresponderStore represents the DB operations for sending the scheduled
+// steps of autoresponder sequences.
+type AutoresponderStore interface {
+	GetDueAutoresponders(limit int, lease time.Duration) ([]models.ScheduledAutoresponder, error)
+	GetAutoresponder(campID int) (models.Campaign, error)
+	GetSubscriber(id int, uuid, email string) (models.Subscriber, error)
+	RecordAutoresponderSent(campaignID, subscriberID, listID int) error
+	RetryScheduledAutoresponder(id int64, attempts int, sendAt time.Time) error
+	DeleteScheduledAutoresponder(id int64) error
+}
+
+// RunAutoresponders is a blocking function (that should be invoked as a goroutine)
+// that sends the due steps of autoresponder sequences at regular intervals until
+// the manager is closed. Pending sends are persisted in the DB and survive restarts.
+func (m *Manager) RunAutoresponders(st AutoresponderStore) {
+	t := time.NewTicker(autoresponderScanInterval)
+	defer t.Stop()
+
+	for {
+		m.SendDueAutoresponders(st)
+
+		select {
+		case <-t.C:
+		case <-m.closeCh:
+			return
+		}
+	}
+}
+
+// SendDueAutoresponders sends all scheduled autoresponders that are due.
+// Successful sends are recorded in the autoresponder history and removed from
+// the schedule. Failed sends are rescheduled with a backoff.
+func (m *Manager) SendDueAutoresponders(st AutoresponderStore) {
+	m.sendDueAutoresponders(st, m.SendAutoresponder)
+}
+
+func (m *Manager) sendDueAutoresponders(st AutoresponderStore, send func(*models.Campaign, models.Subscriber) error) {
+	// Campaigns are fetched and their templates compiled once per run.
+	camps := map[int]*models.Campaign{}
+
+	for {
+		due, err := st.GetDueAutoresponders(autoresponderBatchSize, autoresponderLease)
+		if err != nil || len(due) == 0 {
+			return
+		}
+
+		for _, d := range due {
+			camp, ok := camps[d.CampaignID]
+			if !ok {
+				if c, err := st.GetAutoresponder(d.CampaignID); err != nil {
+					m.log.Printf("error fetching autoresponder campaign %d: %v", d.CampaignID, err)
+				} else {
+					camp = &c
+				}
+				camps[d.CampaignID] = camp
+			}
+
+			if err := sendScheduledAutoresponder(st, send, camp, d); err != nil {
+				m.log.Printf("error sending autoresponder %d to subscriber %d (attempt %d): %v",
+					d.CampaignID, d.SubscriberID, d.Attempts+1, err)
+				m.retryScheduledAutoresponder(st, d)
+				continue
+			}
+
+			if err := st.RecordAutoresponderSent(d.CampaignID, d.SubscriberID, d.ListID); err != nil {
+				m.log.Printf("error recording autoresponder sent: %v", err)
+			}
+
+			// Stop if the schedule can't be updated. The send is picked up
+			// again after the lease.
+			if err := st.DeleteScheduledAutoresponder(d.ID); err != nil {
+				return
+			}
+		}
+
+		if len(due) < autoresponderBatchSize {
+			return
+		}
+	}
+}
+
+// retryScheduledAutoresponder reschedules a failed send with a backoff, or
+// drops it from the schedule if it has run out of attempts.
+func (m *Manager) retryScheduledAutoresponder(st AutoresponderStore, d models.ScheduledAutoresponder) {
+	attempts := d.Attempts + 1
+	if attempts >= autoresponderMaxAttempts {
+		m.log.Printf("dropping autoresponder %d to subscriber %d after %d attempts", d.CampaignID, d.SubscriberID, attempts)
+		_ = st.DeleteScheduledAutoresponder(d.ID)
+		return
+	}
+
+	_ = st.RetryScheduledAutoresponder(d.ID, attempts, time.Now().Add(autoresponderBackoff(attempts)))
+}
+
+// sendScheduledAutoresponder sends a scheduled autoresponder to its subscriber.
+func sendScheduledAutoresponder(st AutoresponderStore, send func(*models.Campaign, models.Subscriber) error,
+	camp *models.Campaign, d models.ScheduledAutoresponder) error {
+	if camp == nil {
+		return errors.New("campaign not found")
+	}
+
+	sub, err := st.GetSubscriber(d.SubscriberID, "", "")
+	if err != nil {
+		return err
+	}
+
+	return send(camp, sub)
+}
+
+// autoresponderBackoff returns the delay before retrying a send that has
+// failed n times.
+func autoresponderBackoff(n int) time.Duration {
+	d := autoresponderRetryDelay
+	for i := 1; i < n; i++ {
+		d *= 2
+		if d >= autoresponderMaxRetryDelay {
+			return autoresponderMaxRetryDelay
+		}
+	}
+
+	return d
+}
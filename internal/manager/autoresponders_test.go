@@ -0,0 +1,131 @@
+package manager
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+type fakeAutoresponderStore struct {
+	due     []models.ScheduledAutoresponder
+	sent    []int
+	retried map[int64]int
+	deleted []int64
+}
+
+func (s *fakeAutoresponderStore) GetDueAutoresponders(limit int, lease time.Duration) ([]models.ScheduledAutoresponder, error) {
+	out := s.due
+	s.due = nil
+	return out, nil
+}
+
+func (s *fakeAutoresponderStore) GetAutoresponder(campID int) (models.Campaign, error) {
+	if campID == 0 {
+		return models.Campaign{}, errors.New("not found")
+	}
+
+	var c models.Campaign
+	c.ID = campID
+	return c, nil
+}
+
+func (s *fakeAutoresponderStore) GetSubscriber(id int, uuid, email string) (models.Subscriber, error) {
+	return sub(id), nil
+}
+
+func (s *fakeAutoresponderStore) RecordAutoresponderSent(campaignID, subscriberID, listID int) error {
+	s.sent = append(s.sent, subscriberID)
+	return nil
+}
+
+func (s *fakeAutoresponderStore) RetryScheduledAutoresponder(id int64, attempts int, sendAt time.Time) error {
+	s.retried[id] = attempts
+	return nil
+}
+
+func (s *fakeAutoresponderStore) DeleteScheduledAutoresponder(id int64) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+func TestSendDueAutoresponders(t *testing.T) {
+	var (
+		m  = &Manager{log: log.New(io.Discard, "", 0)}
+		st = &fakeAutoresponderStore{
+			retried: map[int64]int{},
+			due: []models.ScheduledAutoresponder{
+				{ID: 1, CampaignID: 1, SubscriberID: 1},
+				{ID: 2, CampaignID: 1, SubscriberID: 2},
+				{ID: 3, CampaignID: 1, SubscriberID: 3, Attempts: 2},
+				{ID: 4, CampaignID: 1, SubscriberID: 4, Attempts: autoresponderMaxAttempts - 1},
+				{ID: 5, CampaignID: 0, SubscriberID: 5},
+			},
+		}
+	)
+
+	// Only the send to subscriber 1 succeeds.
+	m.sendDueAutoresponders(st, func(c *models.Campaign, s models.Subscriber) error {
+		if s.ID != 1 {
+			return errors.New("send error")
+		}
+		return nil
+	})
+
+	if len(st.sent) != 1 || st.sent[0] != 1 {
+		t.Errorf("expected subscriber 1 to be recorded as sent, got %v", st.sent)
+	}
+
+	// Only the successful send and the send that has run out of attempts are removed.
+	if len(st.deleted) != 2 || st.deleted[0] != 1 || st.deleted[1] != 4 {
+		t.Errorf("expected sends 1 and 4 to be deleted, got %v", st.deleted)
+	}
+
+	exp := map[int64]int{2: 1, 3: 3, 5: 1}
+	if len(st.retried) != len(exp) {
+		t.Fatalf("expected retries %v, got %v", exp, st.retried)
+	}
+	for id, n := range exp {
+		if st.retried[id] != n {
+			t.Errorf("send %d: expected attempt %d, got %d", id, n, st.retried[id])
+		}
+	}
+}
+
+func TestAutoresponderBackoff(t *testing.T) {
+	cases := []struct {
+		n   int
+		exp time.Duration
+	}{
+		{1, time.Minute},
+		{2, time.Minute * 2},
+		{4, time.Minute * 8},
+		{20, autoresponderMaxRetryDelay},
+	}
+
+	for _, c := range cases {
+		if got := autoresponderBackoff(c.n); got != c.exp {
+			t.Errorf("%d: expected %v, got %v", c.n, c.exp, got)
+		}
+	}
+}
+
+func TestRunAutorespondersStopsOnClose(t *testing.T) {
+	m := New(Config{}, &fakeStore{}, nil, log.New(io.Discard, "", 0))
+
+	done := make(chan struct{})
+	go func() {
+		m.RunAutoresponders(&fakeAutoresponderStore{retried: map[int64]int{}})
+		close(done)
+	}()
+
+	m.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the autoresponder scheduler didn't stop on close")
+	}
+}
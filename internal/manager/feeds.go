@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/knadh/listmonk/internal/feed"
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	// Interval at which active feed campaigns are looked up.
+	feedScanInterval = time.Minute
+
+	// Interval at which the feed of a campaign is fetched, unless the campaign's
+	// feed interval is shorter.
+	feedPollInterval = time.Minute * 15
+)
+
+// scanFeeds is a blocking function that periodically polls the feeds of active
+// feed campaigns and creates runs of the campaigns with the new items.
+func (m *Manager) scanFeeds() {
+	// Time at which the feed of each campaign was last fetched.
+	polls := map[int]time.Time{}
+
+	t := time.NewTicker(feedScanInterval)
+	defer t.Stop()
+
+	for ; ; <-t.C {
+		camps, err := m.store.GetFeedCampaigns()
+		if err != nil {
+			m.log.Printf("error fetching feed campaigns: %v", err)
+			continue
+		}
+
+		now := time.Now()
+		active := make(map[int]time.Time, len(camps))
+		for _, c := range camps {
+			if last, ok := polls[c.ID]; ok && now.Sub(last) < feedPollEvery(c) {
+				active[c.ID] = last
+				continue
+			}
+
+			active[c.ID] = now
+			m.pollFeed(c, now)
+		}
+		polls = active
+	}
+}
+
+// feedPollEvery returns the interval at which the feed of a campaign is fetched,
+// which is never longer than the minimum interval between its runs so that the
+// runs aren't held back by the polls.
+func feedPollEvery(c models.Campaign) time.Duration {
+	if d, err := time.ParseDuration(c.FeedInterval); err == nil && d < feedPollInterval {
+		return d
+	}
+	return feedPollInterval
+}
+
+// pollFeed fetches the feed of a campaign and creates a run of the campaign if
+// there are enough new items and the minimum interval since the last run has passed.
+// New items that aren't sent yet are picked up by the next poll.
+func (m *Manager) pollFeed(c models.Campaign, now time.Time) {
+	f, err := feed.Fetch(c.FeedURL)
+	if err != nil {
+		m.log.Printf("error fetching feed of campaign (%s): %v", c.Name, err)
+		return
+	}
+	if len(f.Items) == 0 {
+		return
+	}
+
+	// The campaign has just been scheduled. Record the latest item so that
+	// the items published before it aren't sent. Likewise, if the last seen item
+	// is gone from the feed and there's no date to tell the new items by, start
+	// afresh from the latest item instead of sending all of them again.
+	if c.FeedLastGUID == "" || (!c.FeedLastPublished.Valid && !feed.Has(f.Items, c.FeedLastGUID)) {
+		if c.FeedLastGUID != "" {
+			m.log.Printf("last seen item of feed campaign (%s) is gone from the feed. watching from the latest item", c.Name)
+		}
+		if err := m.store.UpdateFeedGUID(c.ID, c.FeedLastGUID, f.Items[0].GUID, f.Items[0].PublishedAt); err != nil {
+			m.log.Printf("error updating feed of campaign (%s): %v", c.Name, err)
+		}
+		return
+	}
+
+	items := feed.NewItems(f.Items, c.FeedLastGUID, c.FeedLastPublished)
+	if len(items) == 0 || len(items) < c.FeedMinItems {
+		return
+	}
+	if c.FeedLastRun.Valid {
+		if d, err := time.ParseDuration(c.FeedInterval); err == nil && now.Sub(c.FeedLastRun.Time) < d {
+			return
+		}
+	}
+
+	f.Items = items
+	name := fmt.Sprintf("%s / %s", c.Name, now.Format("2006-01-02 15:04"))
+	id, err := m.store.CreateFeedRun(c.ID, name, c.FeedLastGUID, f)
+	if err != nil {
+		m.log.Printf("error creating run of feed campaign (%s): %v", c.Name, err)
+		return
+	}
+	if id > 0 {
+		m.log.Printf("created run (%s) of feed campaign (%s) with %d new items", name, c.Name, len(items))
+	}
+}
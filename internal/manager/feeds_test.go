@@ -0,0 +1,26 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+func TestFeedPollEvery(t *testing.T) {
+	cases := []struct {
+		interval string
+		exp      time.Duration
+	}{
+		{"1h", feedPollInterval},
+		{"15m", feedPollInterval},
+		{"5m", time.Minute * 5},
+		{"0s", 0},
+		{"", feedPollInterval},
+	}
+	for _, c := range cases {
+		if got := feedPollEvery(models.Campaign{FeedInterval: c.interval}); got != c.exp {
+			t.Errorf("%q: got %v, expected %v", c.interval, got, c.exp)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// Interval at which the messages that no longer count towards the frequency
+// cap are deleted from the store.
+const freqCleanInterval = time.Hour
+
+// Number of times the store's counts are read without holding the lock before
+// they're read holding it, when flushes keep overlapping with the reads.
+const freqCountAttempts = 3
+
+// freqCap enforces the global per-subscriber frequency cap: at most max campaign
+// messages to a subscriber in every rolling window. A nil freqCap has no cap.
+//
+// Subscribers are counted when their messages are queued (reserved) so that
+// concurrently running campaigns can't exceed the cap together. Reservations are
+// released when the messages fail or are discarded, and once the sent messages
+// have been written to the store, where they're counted from.
+type freqCap struct {
+	max    int
+	window time.Duration
+
+	// Guards reserved, unsaved and flushes.
+	mu sync.Mutex
+
+	// Number of flushes. The store's counts are read without holding the lock,
+	// and are read again if a flush has released reservations meanwhile so that
+	// a subscriber is never counted twice, or missed.
+	flushes int
+
+	// Number of messages reserved per subscriber that aren't in the store yet.
+	reserved map[int]int
+
+	// Messages pending to be written to the store, and the subscribers
+	// of the reservations to be released once they're written.
+	unsaved    []models.FrequencySend
+	unsavedRes []int
+}
+
+// ValidateFrequencyCap checks whether a frequency cap is valid.
+func ValidateFrequencyCap(f models.FrequencyCap) error {
+	_, err := newFreqCap(f)
+	return err
+}
+
+// newFreqCap parses a frequency cap. It returns nil if it's disabled.
+func newFreqCap(f models.FrequencyCap) (*freqCap, error) {
+	if !f.Enabled {
+		return nil, nil
+	}
+
+	if f.Max < 1 {
+		return nil, errors.New("frequency cap should be at least one message")
+	}
+
+	win, err := time.ParseDuration(f.Window)
+	if err != nil {
+		return nil, err
+	}
+	if win < time.Minute {
+		return nil, errors.New("frequency cap window should be at least a minute")
+	}
+
+	return &freqCap{
+		max:      f.Max,
+		window:   win,
+		reserved: make(map[int]int),
+	}, nil
+}
+
+// filter reserves a message for every subscriber that's below the cap and returns
+// them. The others are capped and recorded as such.
+func (f *freqCap) filter(store Store, campID int, subs []models.Subscriber, now time.Time) ([]models.Subscriber, []models.Subscriber, error) {
+	ids := make([]int, len(subs))
+	for i, s := range subs {
+		ids[i] = s.ID
+	}
+
+	counts, err := f.counts(store, ids, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.mu.Unlock()
+
+	var (
+		out    = make([]models.Subscriber, 0, len(subs))
+		capped []models.Subscriber
+	)
+	for _, s := range subs {
+		if counts[s.ID]+f.reserved[s.ID] >= f.max {
+			capped = append(capped, s)
+			f.unsaved = append(f.unsaved, models.FrequencySend{
+				CampaignID:   campID,
+				SubscriberID: s.ID,
+				Capped:       true,
+				CreatedAt:    now,
+			})
+			continue
+		}
+
+		f.reserved[s.ID]++
+		out = append(out, s)
+	}
+
+	return out, capped, nil
+}
+
+// counts returns the store's counts of the given subscribers, and returns
+// holding the lock unless there's an error.
+func (f *freqCap) counts(store Store, ids []int, now time.Time) (map[int]int, error) {
+	for i := 1; i < freqCountAttempts; i++ {
+		f.mu.Lock()
+		n := f.flushes
+		f.mu.Unlock()
+
+		counts, err := store.GetFrequencyCounts(ids, now.Add(-f.window))
+		if err != nil {
+			return nil, err
+		}
+
+		f.mu.Lock()
+		if f.flushes == n {
+			return counts, nil
+		}
+		f.mu.Unlock()
+	}
+
+	f.mu.Lock()
+	counts, err := store.GetFrequencyCounts(ids, now.Add(-f.window))
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// release releases the reservation of a message that wasn't sent.
+func (f *freqCap) release(subID int) {
+	f.mu.Lock()
+	f.unreserve(subID)
+	f.mu.Unlock()
+}
+
+// sent records a campaign message that has been sent, and whether
+// it was reserved (capped campaigns) or not (exempt campaigns).
+func (f *freqCap) sent(campID, subID int, reserved bool) {
+	f.mu.Lock()
+	f.unsaved = append(f.unsaved, models.FrequencySend{
+		CampaignID:   campID,
+		SubscriberID: subID,
+		CreatedAt:    time.Now(),
+	})
+	if reserved {
+		f.unsavedRes = append(f.unsavedRes, subID)
+	}
+	f.mu.Unlock()
+}
+
+// flush writes the pending messages to the store and releases their reservations.
+// On error, the messages are discarded like the send log's.
+func (f *freqCap) flush(store Store) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.unsaved) == 0 {
+		return nil
+	}
+
+	err := store.RecordFrequencySends(f.unsaved)
+	for _, id := range f.unsavedRes {
+		f.unreserve(id)
+	}
+	f.unsaved = f.unsaved[:0]
+	f.unsavedRes = f.unsavedRes[:0]
+	f.flushes++
+
+	return err
+}
+
+func (f *freqCap) unreserve(subID int) {
+	if n := f.reserved[subID]; n > 1 {
+		f.reserved[subID] = n - 1
+	} else {
+		delete(f.reserved, subID)
+	}
+}
+
+// skipCapped skips the messages of a campaign to subscribers who have reached
+// the frequency cap by recording them in the send log.
+func (m *Manager) skipCapped(c *models.Campaign, subs []models.Subscriber) {
+	if len(subs) == 0 {
+		return
+	}
+
+	m.log.Printf("skipping %d subscribers of campaign (%s) who have reached the frequency cap", len(subs), c.Name)
+	if m.sendLogQ == nil {
+		return
+	}
+
+	now := null.TimeFrom(time.Now())
+	for _, s := range subs {
+		m.queueSendLog(models.CampaignSend{
+			CampaignID:   c.ID,
+			SubscriberID: s.ID,
+			Messenger:    c.Messenger,
+			Status:       models.CampaignSendStatusCapped,
+			CreatedAt:    now,
+		})
+	}
+}
+
+// freqWriter is a blocking function that periodically writes the messages counted
+// towards the frequency cap to the store and deletes the ones that no longer count.
+func (m *Manager) freqWriter() {
+	var (
+		t     = time.NewTicker(sendLogInterval)
+		clean = time.NewTicker(freqCleanInterval)
+	)
+	defer t.Stop()
+	defer clean.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := m.freq.flush(m.store); err != nil {
+				m.log.Printf("error recording frequency capped messages: %v", err)
+			}
+
+		case now := <-clean.C:
+			if _, err := m.store.DeleteFrequencySends(now.Add(-m.freq.window)); err != nil {
+				m.log.Printf("error deleting old frequency capped messages: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+func TestNewFreqCap(t *testing.T) {
+	cases := []struct {
+		name string
+		cap  models.FrequencyCap
+		nil  bool
+		err  bool
+	}{
+		{"disabled", models.FrequencyCap{Enabled: false, Max: 0, Window: "bad"}, true, false},
+		{"valid", models.FrequencyCap{Enabled: true, Max: 3, Window: "24h"}, false, false},
+		{"zero max", models.FrequencyCap{Enabled: true, Max: 0, Window: "24h"}, true, true},
+		{"bad window", models.FrequencyCap{Enabled: true, Max: 3, Window: "1 day"}, true, true},
+		{"short window", models.FrequencyCap{Enabled: true, Max: 3, Window: "30s"}, true, true},
+	}
+
+	for _, c := range cases {
+		f, err := newFreqCap(c.cap)
+		if (err != nil) != c.err {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+		if (f == nil) != c.nil {
+			t.Errorf("%s: got cap %v", c.name, f)
+		}
+	}
+
+	f, _ := newFreqCap(models.FrequencyCap{Enabled: true, Max: 3, Window: "24h"})
+	if f.max != 3 || f.window != 24*time.Hour {
+		t.Errorf("got max %d and window %v", f.max, f.window)
+	}
+}
+
+func sub(id int) models.Subscriber {
+	var s models.Subscriber
+	s.ID = id
+	return s
+}
+
+func subIDs(subs []models.Subscriber) []int {
+	out := make([]int, len(subs))
+	for i, s := range subs {
+		out[i] = s.ID
+	}
+	return out
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestFreqCap tests that subscribers are capped by their sent messages in the store
+// and the messages reserved by running campaigns, and that reservations are released.
+func TestFreqCap(t *testing.T) {
+	var (
+		st   = &fakeStore{freqCounts: map[int]int{1: 1, 2: 2}}
+		f, _ = newFreqCap(models.FrequencyCap{Enabled: true, Max: 2, Window: "24h"})
+		subs = []models.Subscriber{sub(1), sub(2), sub(3)}
+		now  = time.Now()
+	)
+
+	// Subscriber 2 has been sent the max.
+	out, capped, err := f.filter(st, 10, subs, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(subIDs(out), []int{1, 3}) || !equalIDs(subIDs(capped), []int{2}) {
+		t.Fatalf("got %v, capped %v", subIDs(out), subIDs(capped))
+	}
+
+	// Another campaign running at the same time. Subscriber 1's reserved message
+	// counts towards the cap.
+	out, capped, _ = f.filter(st, 11, subs, now)
+	if !equalIDs(subIDs(out), []int{3}) || !equalIDs(subIDs(capped), []int{1, 2}) {
+		t.Fatalf("got %v, capped %v", subIDs(out), subIDs(capped))
+	}
+
+	// Campaign 10's message to subscriber 1 fails and campaign 11 is sent.
+	f.release(1)
+	f.sent(10, 3, true)
+	f.sent(11, 3, true)
+	if f.reserved[1] != 0 || f.reserved[3] != 2 {
+		t.Fatalf("got reservations %v", f.reserved)
+	}
+
+	// The sent messages are written and their reservations released.
+	if err := f.flush(st); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.reserved) != 0 || len(f.unsaved) != 0 {
+		t.Fatalf("got reservations %v and unsaved %v", f.reserved, f.unsaved)
+	}
+	if len(st.freqSends) != 5 || st.freqCounts[3] != 2 {
+		t.Fatalf("got sends %v and counts %v", st.freqSends, st.freqCounts)
+	}
+
+	nCapped := 0
+	for _, s := range st.freqSends {
+		if s.Capped {
+			nCapped++
+		}
+	}
+	if nCapped != 3 {
+		t.Errorf("got %d capped messages, expected 3", nCapped)
+	}
+
+	// Exempt campaigns' messages count towards the cap without reservations.
+	f.sent(12, 1, false)
+	if err := f.flush(st); err != nil {
+		t.Fatal(err)
+	}
+	out, _, _ = f.filter(st, 13, subs, now)
+	if len(out) != 0 {
+		t.Errorf("got %v, expected all to be capped", subIDs(out))
+	}
+}
+
+// flushingStore writes a frequency cap's messages after reading the counts, like
+// the writer running while the counts are being read.
+type flushingStore struct {
+	*fakeStore
+	f       *freqCap
+	flushes int
+	locked  bool
+}
+
+func (s *flushingStore) GetFrequencyCounts(subIDs []int, since time.Time) (map[int]int, error) {
+	out, err := s.fakeStore.GetFrequencyCounts(subIDs, since)
+
+	// Whether the counts are read holding the lock.
+	if s.locked = !s.f.mu.TryLock(); !s.locked {
+		s.f.mu.Unlock()
+	}
+
+	if s.flushes > 0 {
+		s.flushes--
+		s.f.sent(1, 2, false)
+		if err := s.f.flush(s.fakeStore); err != nil {
+			return nil, err
+		}
+	}
+	return out, err
+}
+
+func TestFreqCapFlushWhileCounting(t *testing.T) {
+	var (
+		f, _ = newFreqCap(models.FrequencyCap{Enabled: true, Max: 2, Window: "24h"})
+		st   = &flushingStore{fakeStore: &fakeStore{freqCounts: map[int]int{1: 1}}, f: f}
+		subs = []models.Subscriber{sub(1)}
+		now  = time.Now()
+	)
+
+	out, _, err := f.filter(st, 10, subs, now)
+	if err != nil || len(out) != 1 || st.locked {
+		t.Fatalf("got %v, %v, locked %v", subIDs(out), err, st.locked)
+	}
+	f.sent(10, 1, true)
+
+	// The message is written and its reservation released after the counts are
+	// read, which are read again instead of missing it.
+	st.flushes = 1
+	out, capped, err := f.filter(st, 11, subs, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 0 || !equalIDs(subIDs(capped), []int{1}) || st.locked {
+		t.Fatalf("got %v, capped %v, locked %v", subIDs(out), subIDs(capped), st.locked)
+	}
+
+	// Flushes that keep overlapping with the reads end up with the counts
+	// being read holding the lock.
+	st.freqCounts = map[int]int{}
+	st.flushes = freqCountAttempts - 1
+	if out, _, err = f.filter(st, 12, subs, now); err != nil || len(out) != 1 || !st.locked {
+		t.Fatalf("got %v, %v, locked %v", subIDs(out), err, st.locked)
+	}
+}
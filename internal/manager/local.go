@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// Campaigns sent in subscribers' local time are sent in waves from the time the
+// campaign's local time arrives in the earliest timezone, UTC+14 (Etc/GMT-14),
+// until it arrives in the latest, UTC-12 (Etc/GMT+12). The campaign is picked
+// up for the first wave at the start in next-campaigns.
+var (
+	localFirstZone = time.FixedZone("Etc/GMT-14", 14*60*60)
+	localLastZone  = time.FixedZone("Etc/GMT+12", -12*60*60)
+)
+
+// localSendWindow returns the times at which the local time of a campaign, send_at's
+// time of the day in its timezone, arrives in the earliest and the latest timezones.
+// An invalid timezone (it's validated when the campaign is saved) is treated as UTC.
+func localSendWindow(c *models.Campaign) (time.Time, time.Time) {
+	loc, err := time.LoadLocation(c.LocalTimezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	var (
+		t  = c.SendAt.Time.In(loc)
+		at = func(zone *time.Location) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
+		}
+	)
+
+	return at(localFirstZone), at(localLastZone)
+}
+
+// finishLocalWave marks the wave of a local time campaign that has been sent as
+// sent. It returns true if the campaign's local time has arrived in all timezones
+// by the end of the wave and there are no more waves to be sent.
+func (p *pipe) finishLocalWave() (bool, error) {
+	sentUntil, err := p.m.store.FinishLocalWave(p.camp.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if !p.camp.SendAt.Valid {
+		return true, nil
+	}
+
+	_, end := localSendWindow(p.camp)
+	return !sentUntil.Before(end), nil
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+func mustLoc(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s isn't available: %v", name, err)
+	}
+	return loc
+}
+
+func newLocalCampaign(sendAt time.Time, tz string) *models.Campaign {
+	c := &models.Campaign{Name: "local", LocalSend: true, LocalTimezone: tz}
+	c.ID = 1
+	c.SendAt = null.TimeFrom(sendAt)
+	return c
+}
+
+func TestLocalSendWindow(t *testing.T) {
+	var (
+		ny  = mustLoc(t, "America/New_York")
+		kol = mustLoc(t, "Asia/Kolkata")
+	)
+
+	cases := []struct {
+		name   string
+		sendAt time.Time
+		tz     string
+		start  time.Time
+		end    time.Time
+	}{
+		// 09:00 in UTC+14 and in UTC-12.
+		{"new york", time.Date(2024, 1, 15, 9, 0, 0, 0, ny), "America/New_York",
+			time.Date(2024, 1, 14, 19, 0, 0, 0, time.UTC), time.Date(2024, 1, 15, 21, 0, 0, 0, time.UTC)},
+
+		// Only the local time of the day matters, not the timezone it's set in.
+		{"kolkata", time.Date(2024, 1, 15, 9, 0, 0, 0, kol), "Asia/Kolkata",
+			time.Date(2024, 1, 14, 19, 0, 0, 0, time.UTC), time.Date(2024, 1, 15, 21, 0, 0, 0, time.UTC)},
+
+		// send_at is stored in UTC and is converted to the campaign's timezone.
+		{"converted", time.Date(2024, 1, 15, 3, 30, 0, 0, time.UTC), "Asia/Kolkata",
+			time.Date(2024, 1, 14, 19, 0, 0, 0, time.UTC), time.Date(2024, 1, 15, 21, 0, 0, 0, time.UTC)},
+		{"utc", time.Date(2024, 1, 15, 0, 30, 0, 0, time.UTC), "UTC",
+			time.Date(2024, 1, 14, 10, 30, 0, 0, time.UTC), time.Date(2024, 1, 15, 12, 30, 0, 0, time.UTC)},
+		{"invalid timezone", time.Date(2024, 1, 15, 0, 30, 0, 0, time.UTC), "Mars/Olympus",
+			time.Date(2024, 1, 14, 10, 30, 0, 0, time.UTC), time.Date(2024, 1, 15, 12, 30, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		start, end := localSendWindow(newLocalCampaign(c.sendAt, c.tz))
+		if !start.Equal(c.start) || !end.Equal(c.end) {
+			t.Errorf("%s: expected (%s, %s), got (%s, %s)", c.name, c.start, c.end, start.UTC(), end.UTC())
+		}
+		if d := end.Sub(start); d != 26*time.Hour {
+			t.Errorf("%s: expected a 26 hour window, got %v", c.name, d)
+		}
+	}
+}
+
+// The campaign's local time in every timezone falls within the window.
+func TestLocalSendWindowZones(t *testing.T) {
+	var (
+		ny         = mustLoc(t, "America/New_York")
+		c          = newLocalCampaign(time.Date(2024, 1, 15, 9, 0, 0, 0, ny), "America/New_York")
+		start, end = localSendWindow(c)
+	)
+
+	zones := []string{"Pacific/Kiritimati", "Pacific/Chatham", "Asia/Kathmandu", "Pacific/Pago_Pago"}
+	for off := -14; off <= 12; off++ {
+		zones = append(zones, fmt.Sprintf("Etc/GMT%+d", off))
+	}
+
+	for _, z := range zones {
+		t0 := time.Date(2024, 1, 15, 9, 0, 0, 0, mustLoc(t, z))
+		if t0.Before(start) || t0.After(end) {
+			t.Errorf("%s: local time %s is outside the window (%s, %s)", z, t0.UTC(), start.UTC(), end.UTC())
+		}
+	}
+
+	// The window's bounds are the local time in the first and the last timezones.
+	if first := time.Date(2024, 1, 15, 9, 0, 0, 0, mustLoc(t, "Etc/GMT-14")); !first.Equal(start) {
+		t.Errorf("expected the window to start at %s, got %s", first.UTC(), start.UTC())
+	}
+	if last := time.Date(2024, 1, 15, 9, 0, 0, 0, mustLoc(t, "Etc/GMT+12")); !last.Equal(end) {
+		t.Errorf("expected the window to end at %s, got %s", last.UTC(), end.UTC())
+	}
+}
+
+func TestFinishLocalWave(t *testing.T) {
+	var (
+		ny     = mustLoc(t, "America/New_York")
+		st     = &fakeStore{}
+		m      = New(Config{}, st, nil, log.New(io.Discard, "", 0))
+		sendAt = time.Date(2024, 1, 15, 9, 0, 0, 0, ny)
+		_, end = localSendWindow(newLocalCampaign(sendAt, "America/New_York"))
+	)
+
+	cases := []struct {
+		name      string
+		sendAt    null.Time
+		sentUntil time.Time
+		done      bool
+	}{
+		{"first wave", null.TimeFrom(sendAt), end.Add(-26 * time.Hour).Add(time.Minute * 15), false},
+		{"before the last timezone", null.TimeFrom(sendAt), end.Add(-time.Second), false},
+		{"last timezone", null.TimeFrom(sendAt), end, true},
+		{"after the last timezone", null.TimeFrom(sendAt), end.Add(time.Minute * 15), true},
+		{"no send_at", null.Time{}, time.Time{}, true},
+	}
+
+	for n, c := range cases {
+		p := newTestPipe(m, 0)
+		p.camp.LocalSend = true
+		p.camp.LocalTimezone = "America/New_York"
+		p.camp.SendAt = c.sendAt
+		st.localSentUntil = c.sentUntil
+
+		done, err := p.finishLocalWave()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done != c.done {
+			t.Errorf("%s: expected done = %v, got %v", c.name, c.done, done)
+		}
+		if st.localWaves != n+1 {
+			t.Errorf("%s: expected the wave to be recorded", c.name)
+		}
+	}
+}
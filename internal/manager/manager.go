@@ -15,9 +15,11 @@ import (
 	"github.com/Masterminds/sprig/v3"
 	"github.com/knadh/listmonk/internal/i18n"
 	"github.com/knadh/listmonk/internal/notifs"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+	null "gopkg.in/volatiletech/null.v6"
 )
 
 const (
@@ -28,6 +30,13 @@ const (
 	ContentTpl = "content"
 
 	dummyUUID = "00000000-0000-0000-0000-000000000000"
+
+	// Interval at which pending send log entries are written to the store.
+	sendLogInterval = time.Second
+
+	// Max time for which a worker waits for room in the full send log queue
+	// before writing its entry to the store itself.
+	sendLogWait = time.Second
 )
 
 // Store represents a data backend, such as a database,
@@ -42,6 +51,21 @@ type Store interface {
 	CreateLink(url string) (string, error)
 	BlocklistSubscriber(id int64) error
 	DeleteSubscriber(id int64) error
+	RecordSends(sends []models.CampaignSend) error
+	UpdateVariantCounts(ids []int, counts []int) error
+	FinishABTest(campID int) error
+	GetABTestResults(campID int) ([]models.CampaignAnalyticsVariant, error)
+	SetABWinner(campID, variantID int) error
+	FinishLocalWave(campID int) (time.Time, error)
+	GetRecurringCampaigns() ([]models.Campaign, error)
+	UpdateRecurrence(campID int, cur null.Time, next time.Time) error
+	CreateCampaignRun(campID int, name string, at, next time.Time) (int, error)
+	GetFeedCampaigns() ([]models.Campaign, error)
+	UpdateFeedGUID(campID int, cur, guid string, published null.Time) error
+	CreateFeedRun(campID int, name, lastGUID string, f models.Feed) (int, error)
+	GetFrequencyCounts(subIDs []int, since time.Time) (map[int]int, error)
+	RecordFrequencySends(sends []models.FrequencySend) error
+	DeleteFrequencySends(before time.Time) (int, error)
 }
 
 // Messenger is an interface for a generic messaging backend,
@@ -53,9 +77,24 @@ type Messenger interface {
 	Close() error
 }
 
+// Throttler is an optional interface that's implemented by messengers that can
+// stop accepting campaign messages for a while, eg: when SMTP servers have sent
+// their daily warm-up volumes. Campaigns on a messenger that isn't ready are held
+// back. Messages that are pushed anyway are retried later if the messenger returns
+// an error that has a Throttled() method that returns true.
+type Throttler interface {
+	Ready() bool
+}
+
 // CampStats contains campaign stats like per minute send rate.
 type CampStats struct {
 	SendRate int
+
+	// Messages sent to and deferred for throttled domains.
+	Domains []models.CampaignDomainStats
+
+	// Time at which the campaign resumes if it's suspended for quiet hours.
+	SuspendedUntil time.Time
 }
 
 // Manager handles the scheduling, processing, and queuing of campaigns
@@ -85,11 +124,29 @@ type Manager struct {
 	campMsgQ  chan CampaignMessage
 	msgQ      chan models.Message
 
-	// Sliding window keeps track of the total number of messages sent in a period
-	// and on reaching the specified limit, waits until the window is over before
-	// sending further messages.
-	slidingCount int
-	slidingStart time.Time
+	// Closed on Close() to stop the background schedulers.
+	closeCh chan struct{}
+
+	// Campaign sends that are pending to be written to the send log.
+	// This is nil if the send log is disabled.
+	sendLogQ chan models.CampaignSend
+
+	// Global sliding window and per-messenger rate limits of campaign messages,
+	// enforced by the scheduler, which is notified of new messages on schedQ.
+	limiter      *limiter
+	msgrLimiters map[string]*limiter
+	schedQ       chan struct{}
+
+	// Per minute rate limits of recipient domains, shared by all campaigns.
+	domainLimiters map[string]*limiter
+
+	// Global quiet hours, and the running campaigns that are suspended during
+	// their quiet hours along with the time at which they resume (guarded by pipesMut).
+	quiet     *quietHours
+	suspended map[int]time.Time
+
+	// Global per-subscriber frequency cap. This is nil if it's disabled.
+	freq *freqCap
 
 	tplFuncs template.FuncMap
 }
@@ -107,6 +164,9 @@ type CampaignMessage struct {
 	altBody  []byte
 	unsubURL string
 
+	// Whether the message has been counted towards the frequency cap.
+	freqReserved bool
+
 	pipe *pipe
 }
 
@@ -120,6 +180,10 @@ type Config struct {
 	SlidingWindow         bool
 	SlidingWindowDuration time.Duration
 	SlidingWindowRate     int
+	MessengerLimits       map[string]RateLimit
+	DomainLimits          map[string]int
+	QuietHours            models.QuietHours
+	FrequencyCap          models.FrequencyCap
 	RequeueOnError        bool
 	FromEmail             string
 	IndividualTracking    bool
@@ -142,6 +206,9 @@ type Config struct {
 	// processing while the others handle other kinds of traffic.
 	ScanCampaigns bool
 
+	// SendLog enables the per-recipient log of campaign messages.
+	SendLog bool
+
 	// DispatchWebhook is an optional callback for dispatching webhook events.
 	DispatchWebhook func(event string, data any)
 }
@@ -173,12 +240,55 @@ func New(cfg Config, store Store, i *i18n.I18n, l *log.Logger) *Manager {
 		tpls:         make(map[int]*models.Template),
 		links:        make(map[string]string),
 		nextPipes:    make(chan *pipe, 1000),
+		closeCh:      make(chan struct{}),
 		campMsgQ:     make(chan CampaignMessage, cfg.Concurrency*cfg.MessageRate*2),
 		msgQ:         make(chan models.Message, cfg.Concurrency*cfg.MessageRate*2),
-		slidingStart: time.Now(),
+		msgrLimiters: make(map[string]*limiter),
+		schedQ:       make(chan struct{}, 1),
+
+		domainLimiters: make(map[string]*limiter),
+		suspended:      make(map[int]time.Time),
 	}
 	m.tplFuncs = m.makeGnericFuncMap()
 
+	// The message rate is per worker, and is enforced along with the global
+	// sliding window by the scheduler.
+	gl := RateLimit{MessageRate: cfg.Concurrency * cfg.MessageRate}
+	if cfg.SlidingWindow {
+		gl.SlidingWindowRate = cfg.SlidingWindowRate
+		gl.SlidingWindowDuration = cfg.SlidingWindowDuration
+	}
+	m.limiter = newLimiter("global", gl)
+	for name, l := range cfg.MessengerLimits {
+		if lim := newLimiter("messenger "+name, l); lim != nil {
+			m.msgrLimiters[name] = lim
+		}
+	}
+	for domain, rate := range cfg.DomainLimits {
+		if lim := newLimiter("domain "+domain, RateLimit{
+			SlidingWindowRate:     rate,
+			SlidingWindowDuration: time.Minute,
+		}); lim != nil {
+			m.domainLimiters[strings.ToLower(domain)] = lim
+		}
+	}
+
+	q, err := newQuietHours(cfg.QuietHours)
+	if err != nil {
+		l.Printf("ignoring invalid quiet hours: %v", err)
+	}
+	m.quiet = q
+
+	f, err := newFreqCap(cfg.FrequencyCap)
+	if err != nil {
+		l.Printf("ignoring invalid frequency cap: %v", err)
+	}
+	m.freq = f
+
+	if cfg.SendLog {
+		m.sendLogQ = make(chan models.CampaignSend, cfg.BatchSize*2)
+	}
+
 	return m
 }
 
@@ -203,7 +313,10 @@ func (m *Manager) PushMessage(msg models.Message) error {
 	case m.msgQ <- msg:
 	case <-t.C:
 		m.log.Printf("message push timed out: '%s'", msg.Subject)
-		return errors.New("message push timed out")
+
+		err := errors.New("message push timed out")
+		m.dispatchTxEvent(msg, err)
+		return err
 	}
 
 	return nil
@@ -286,15 +399,19 @@ func (m *Manager) HasRunningCampaigns() bool {
 
 // GetCampaignStats returns campaign statistics.
 func (m *Manager) GetCampaignStats(id int) CampStats {
-	n := 0
+	var out CampStats
 
 	m.pipesMut.Lock()
 	if c, ok := m.pipes[id]; ok {
-		n = int(c.rate.Rate())
+		out.SendRate = int(c.rate.Rate())
+		out.Domains = c.getDomainStats()
+	}
+	if until, ok := m.suspended[id]; ok {
+		out.SuspendedUntil = until
 	}
 	m.pipesMut.Unlock()
 
-	return CampStats{SendRate: n}
+	return out
 }
 
 // Run is a blocking function (that should be invoked as a goroutine)
@@ -308,6 +425,9 @@ func (m *Manager) Run() {
 		// Periodically scan campaigns and push running campaigns to nextPipes
 		// to fetch subscribers from the campaign.
 		go m.scanCampaigns(m.cfg.ScanInterval)
+
+		// Poll the feeds of feed campaigns and create their runs.
+		go m.scanFeeds()
 	}
 
 	// Spawn N message workers.
@@ -315,33 +435,21 @@ func (m *Manager) Run() {
 		go m.worker()
 	}
 
-	// Indefinitely wait on the pipe queue to fetch the next set of subscribers
-	// for any active campaigns.
-	for p := range m.nextPipes {
-		has, err := p.NextSubscribers()
-		if err != nil {
-			m.log.Printf("error processing campaign batch (%s): %v", p.camp.Name, err)
-			continue
-		}
+	if m.sendLogQ != nil {
+		go m.sendLogWriter()
+	}
+	if m.freq != nil {
+		go m.freqWriter()
+	}
 
-		if has {
-			// There are more subscribers to fetch. Queue again.
-			select {
-			case m.nextPipes <- p:
-			default:
-			}
-		} else {
-			// The pipe is created with a +1 on the waitgroup pseudo counter
-			// so that it immediately waits. Subsequently, every message created
-			// is incremented in the counter in pipe.newMessage(), and when it's'
-			// processed (or ignored when a campaign is paused or cancelled),
-			// the count is's reduced in worker().
-			//
-			// This marks down the original non-message +1, causing the waitgroup
-			// to be released and the pipe to end, triggering the pg.Wait()
-			// in newPipe() that calls pipe.cleanup().
-			p.wg.Done()
-		}
+	// Move the messages queued by the campaigns to the workers.
+	go m.scheduler()
+
+	// Indefinitely wait on the pipe queue and fetch the subscribers of every
+	// active campaign concurrently. Each campaign queues its messages separately
+	// so that a campaign with a large backlog doesn't hold up the others.
+	for p := range m.nextPipes {
+		go p.run()
 	}
 }
 
@@ -435,6 +543,7 @@ func (m *Manager) StopCampaign(id int) {
 
 // Close closes and exits the campaign manager.
 func (m *Manager) Close() {
+	close(m.closeCh)
 	close(m.nextPipes)
 	close(m.msgQ)
 }
@@ -448,6 +557,15 @@ func (m *Manager) scanCampaigns(tick time.Duration) {
 
 	// Periodically scan the data source for campaigns to process.
 	for range t.C {
+		// Create the runs of recurring campaigns that are due so that
+		// they're picked up right away.
+		m.scheduleRecurring()
+
+		// Suspend running campaigns whose quiet hours have begun. The suspended
+		// campaigns are skipped until their quiet hours are over.
+		now := time.Now()
+		m.suspendQuiet(now)
+
 		ids, counts := m.getCurrentCampaigns()
 		campaigns, err := m.store.NextCampaigns(ids, counts)
 		if err != nil {
@@ -456,6 +574,10 @@ func (m *Manager) scanCampaigns(tick time.Duration) {
 		}
 
 		for _, c := range campaigns {
+			if m.suspendIfQuiet(c, now) {
+				continue
+			}
+
 			// Create a new pipe that'll handle this campaign's states.
 			p, err := m.newPipe(c)
 			if err != nil {
@@ -478,8 +600,6 @@ func (m *Manager) scanCampaigns(tick time.Duration) {
 // worker is a blocking function that perpetually listents to events (message) on different
 // queues and processes them.
 func (m *Manager) worker() {
-	// Counter to keep track of the message / sec rate limit.
-	numMsg := 0
 	for {
 		select {
 		// Campaign message.
@@ -490,18 +610,16 @@ func (m *Manager) worker() {
 
 			// If the campaign has ended or stopped, ignore the message.
 			if msg.pipe != nil && msg.pipe.stopped.Load() {
+				if msg.freqReserved {
+					m.freq.release(msg.Subscriber.ID)
+				}
+				msg.pipe.markUnsent(msg.Subscriber.ID)
+
 				// Reduce the message counter on the pipe.
 				msg.pipe.wg.Done()
 				continue
 			}
 
-			// Pause on hitting the message rate.
-			if numMsg >= m.cfg.MessageRate {
-				time.Sleep(time.Second)
-				numMsg = 0
-			}
-			numMsg++
-
 			// Outgoing message.
 			out := models.Message{
 				From:        msg.from,
@@ -539,39 +657,192 @@ func (m *Manager) worker() {
 
 			// Push the message to the messenger.
 			err := m.messengers[msg.Campaign.Messenger].Push(out)
+			if isThrottled(err) && msg.pipe != nil {
+				// The messenger can't take the message right now. Hold it back
+				// in the campaign to be retried.
+				msg.pipe.requeue(msg)
+				continue
+			}
 			if err != nil {
 				m.log.Printf("error sending message in campaign %s: subscriber %d: %v", msg.Campaign.Name, msg.Subscriber.ID, err)
+
+				if m.cfg.DispatchWebhook != nil {
+					m.cfg.DispatchWebhook(webhooks.EventCampaignMessageFailed, map[string]any{
+						"campaign": map[string]any{
+							"id":   msg.Campaign.ID,
+							"uuid": msg.Campaign.UUID,
+							"name": msg.Campaign.Name,
+							"tags": msg.Campaign.Tags,
+						},
+						"subscriber": map[string]any{
+							"id":    msg.Subscriber.ID,
+							"uuid":  msg.Subscriber.UUID,
+							"email": msg.Subscriber.Email,
+						},
+						"messenger": msg.Campaign.Messenger,
+						"error":     err.Error(),
+					})
+				}
+			}
+
+			m.logSend(msg, err)
+
+			// Count the message towards the subscriber's frequency cap.
+			if m.freq != nil {
+				if err == nil {
+					m.freq.sent(msg.Campaign.ID, msg.Subscriber.ID, msg.freqReserved)
+				} else if msg.freqReserved {
+					m.freq.release(msg.Subscriber.ID)
+				}
 			}
 
 			// Increment the send rate or the error counter if there was an error.
 			if msg.pipe != nil {
-				// Mark the message as done.
-				msg.pipe.wg.Done()
-
 				if err != nil {
 					// Call the error callback, which keeps track of the error count
 					// and stops the campaign if the error count exceeds the threshold.
 					msg.pipe.OnError()
 				} else {
-					id := uint64(msg.Subscriber.ID)
-					if id > msg.pipe.lastID.Load() {
-						msg.pipe.lastID.Store(uint64(msg.Subscriber.ID))
-					}
+					msg.pipe.markSent(msg.Subscriber.ID)
 					msg.pipe.rate.Incr(1)
 					msg.pipe.sent.Add(1)
+
+					if n := len(msg.pipe.variants); n > 0 {
+						msg.pipe.variantSent[msg.Subscriber.ID%n].Add(1)
+					}
 				}
+
+				// Mark the message as done once it's been counted, as the pipe's
+				// cleanup() saves the counts when all the messages are done.
+				msg.pipe.wg.Done()
 			}
 
-		// Arbitrary message.
+		// Arbitrary (transactional) message.
 		case msg, ok := <-m.msgQ:
 			if !ok {
 				return
 			}
 
 			// Push the message to the messenger.
-			if err := m.messengers[msg.Messenger].Push(msg); err != nil {
+			err := m.messengers[msg.Messenger].Push(msg)
+			if err != nil {
 				m.log.Printf("error sending message '%s': %v", msg.Subject, err)
 			}
+			m.dispatchTxEvent(msg, err)
+		}
+	}
+}
+
+// dispatchTxEvent dispatches the webhook event for a transactional message
+// that has been sent, or has failed with err.
+func (m *Manager) dispatchTxEvent(msg models.Message, err error) {
+	if m.cfg.DispatchWebhook == nil {
+		return
+	}
+
+	data := map[string]any{
+		"subscriber": map[string]any{
+			"id":    msg.Subscriber.ID,
+			"uuid":  msg.Subscriber.UUID,
+			"email": msg.Subscriber.Email,
+		},
+		"to":        msg.To,
+		"subject":   msg.Subject,
+		"messenger": msg.Messenger,
+	}
+
+	if err != nil {
+		data["error"] = err.Error()
+		m.cfg.DispatchWebhook(webhooks.EventTxFailed, data)
+		return
+	}
+
+	m.cfg.DispatchWebhook(webhooks.EventTxSent, data)
+}
+
+// logSend queues a campaign message that has been sent, or has failed with err,
+// for the send log.
+func (m *Manager) logSend(msg CampaignMessage, err error) {
+	if m.sendLogQ == nil {
+		return
+	}
+
+	s := models.CampaignSend{
+		CampaignID:   msg.Campaign.ID,
+		SubscriberID: msg.Subscriber.ID,
+		Messenger:    msg.Campaign.Messenger,
+		Status:       models.CampaignSendStatusSent,
+		CreatedAt:    null.TimeFrom(time.Now()),
+	}
+	if err != nil {
+		s.Status = models.CampaignSendStatusFailed
+		s.Error = err.Error()
+	}
+
+	m.queueSendLog(s)
+}
+
+// queueSendLog queues an entry to be written to the send log. If the queue is
+// full, eg: when the DB is slow, it waits for room for up to sendLogWait and
+// then writes the entry to the store itself so that entries aren't lost.
+func (m *Manager) queueSendLog(s models.CampaignSend) {
+	select {
+	case m.sendLogQ <- s:
+		return
+	default:
+	}
+
+	t := time.NewTimer(sendLogWait)
+	defer t.Stop()
+
+	select {
+	case m.sendLogQ <- s:
+	case <-t.C:
+		if err := m.store.RecordSends([]models.CampaignSend{s}); err != nil {
+			m.log.Printf("error writing to the send log: %v", err)
+		}
+	}
+}
+
+// sendLogWriter is a blocking function that writes queued campaign sends
+// to the store in batches.
+func (m *Manager) sendLogWriter() {
+	var (
+		batch = make([]models.CampaignSend, 0, m.cfg.BatchSize)
+		t     = time.NewTicker(sendLogInterval)
+	)
+	defer t.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		// On error, the batch is retried on the next tick.
+		if err := m.store.RecordSends(batch); err != nil {
+			m.log.Printf("error writing %d entries to the send log: %v", len(batch), err)
+			return
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		// Stop reading the queue while a full batch is pending so that the
+		// workers that feed it are held up until it's written.
+		q := m.sendLogQ
+		if len(batch) >= m.cfg.BatchSize {
+			q = nil
+		}
+
+		select {
+		case s := <-q:
+			batch = append(batch, s)
+			if len(batch) >= m.cfg.BatchSize {
+				flush()
+			}
+
+		case <-t.C:
+			flush()
 		}
 	}
 }
@@ -596,6 +867,14 @@ func (m *Manager) getCurrentCampaigns() ([]int64, []int64) {
 		p.sent.Store(0)
 	}
 
+	// Campaigns suspended for quiet hours whose pipes have ended.
+	for id := range m.suspended {
+		if _, ok := m.pipes[id]; !ok {
+			ids = append(ids, int64(id))
+			counts = append(counts, 0)
+		}
+	}
+
 	return ids, counts
 }
 
@@ -706,3 +985,10 @@ func MakeAttachmentHeader(filename, encoding, contentType string) textproto.MIME
 	h.Set("Content-Transfer-Encoding", encoding)
 	return h
 }
+
+// isThrottled checks whether a messenger's error is temporary and the message
+// can be retried later. See Throttler.
+func isThrottled(err error) bool {
+	var t interface{ Throttled() bool }
+	return errors.As(err, &t) && t.Throttled()
+}
@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// fakeStore is an in-memory Store. The methods that aren't implemented
+// panic on the embedded nil Store.
+type fakeStore struct {
+	Store
+
+	mu sync.Mutex
+
+	// Number of messages sent to subscribers within the frequency cap window,
+	// and the messages recorded for the frequency cap.
+	freqCounts map[int]int
+	freqSends  []models.FrequencySend
+
+	// Results of A/B tests and the recorded winners by campaign ID.
+	abResults []models.CampaignAnalyticsVariant
+	abWinners map[int]int
+
+	// The end of the last sent local time wave and the number of waves sent.
+	localSentUntil time.Time
+	localWaves     int
+
+	// Entries written to the send log.
+	sends []models.CampaignSend
+}
+
+func (s *fakeStore) RecordSends(sends []models.CampaignSend) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sends = append(s.sends, sends...)
+	return nil
+}
+
+func (s *fakeStore) FinishLocalWave(campID int) (time.Time, error) {
+	s.localWaves++
+	return s.localSentUntil, nil
+}
+
+func (s *fakeStore) GetABTestResults(campID int) ([]models.CampaignAnalyticsVariant, error) {
+	return s.abResults, nil
+}
+
+func (s *fakeStore) SetABWinner(campID, variantID int) error {
+	if s.abWinners == nil {
+		s.abWinners = make(map[int]int)
+	}
+	s.abWinners[campID] = variantID
+	return nil
+}
+
+func (s *fakeStore) GetFrequencyCounts(subIDs []int, since time.Time) (map[int]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[int]int)
+	for _, id := range subIDs {
+		if n, ok := s.freqCounts[id]; ok {
+			out[id] = n
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeStore) RecordFrequencySends(sends []models.FrequencySend) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.freqCounts == nil {
+		s.freqCounts = make(map[int]int)
+	}
+	for _, f := range sends {
+		s.freqSends = append(s.freqSends, f)
+		if !f.Capped {
+			s.freqCounts[f.SubscriberID]++
+		}
+	}
+	return nil
+}
+
+func TestQueueSendLog(t *testing.T) {
+	st := &fakeStore{}
+	m := &Manager{store: st, sendLogQ: make(chan models.CampaignSend, 2)}
+
+	// The queue isn't drained. The entries that don't fit in it are written to
+	// the store once the wait for room is over.
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		m.queueSendLog(models.CampaignSend{SubscriberID: i})
+	}
+	if d := time.Since(start); d < sendLogWait {
+		t.Errorf("expected to wait for %v for room in the queue, waited %v", sendLogWait, d)
+	}
+
+	if n := len(m.sendLogQ); n != 2 {
+		t.Errorf("expected 2 queued entries, got %d", n)
+	}
+	if len(st.sends) != 1 || st.sends[0].SubscriberID != 2 {
+		t.Errorf("expected entry 2 to be written to the store, got %v", st.sends)
+	}
+
+	// Entries that are waiting are queued as soon as there's room.
+	go func() {
+		time.Sleep(sendLogWait / 4)
+		<-m.sendLogQ
+	}()
+	m.queueSendLog(models.CampaignSend{SubscriberID: 3})
+	if n := len(m.sendLogQ); n != 2 || len(st.sends) != 1 {
+		t.Errorf("expected entry 3 to be queued, got %d queued and %v written", n, st.sends)
+	}
+}
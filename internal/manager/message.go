@@ -64,6 +64,12 @@ func (m *CampaignMessage) render() error {
 	return nil
 }
 
+// Feed returns the feed with the new items that a run of a feed campaign was
+// created for. It's accessed in templates as {{ .Feed.Items }}.
+func (m *CampaignMessage) Feed() models.Feed {
+	return m.Campaign.Feed
+}
+
 // Subject returns a copy of the message subject
 func (m *CampaignMessage) Subject() string {
 	return m.subject
@@ -2,6 +2,7 @@ package manager
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/paulbellamy/ratecounter"
+	null "gopkg.in/volatiletech/null.v6"
 )
 
 type pipe struct {
@@ -21,6 +23,39 @@ type pipe struct {
 	stopped    atomic.Bool
 	withErrors atomic.Bool
 
+	// Lowest subscriber ID of the messages that were discarded after the pipe was
+	// stopped (0 if none). Messages aren't sent in the order of the subscriber IDs
+	// (eg: when domains are throttled) and the campaign has to be resumed from
+	// before the first subscriber who wasn't sent the message.
+	unsentID atomic.Uint64
+
+	// Quiet hours of the campaign, and whether the pipe has been stopped
+	// to suspend the campaign during the (global or campaign's) quiet hours.
+	quiet     *quietHours
+	suspended atomic.Bool
+
+	// Messages of the campaign waiting to be moved to the workers by the scheduler,
+	// and the campaign's own rate limits.
+	msgQ    chan CampaignMessage
+	limiter *limiter
+
+	// Messages to throttled domains that are held back by the scheduler until
+	// the domains' limits reset (only accessed by the scheduler), and the number
+	// of messages sent to and held back for each throttled domain.
+	deferred     map[string][]CampaignMessage
+	numDeferred  int
+	domainStats  map[string]*models.CampaignDomainStats
+	domainStatMu sync.Mutex
+
+	// Messages that the messenger couldn't take (see Throttler), to be retried.
+	requeued  []CampaignMessage
+	requeueMu sync.Mutex
+
+	// Compiled A/B test variants of the campaign (in the order of camp.Variants)
+	// and the number of messages sent with each, while the variants are being tested.
+	variants    []*models.Campaign
+	variantSent []atomic.Int64
+
 	m *Manager
 }
 
@@ -29,6 +64,20 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 	// Validate messenger.
 	if _, ok := m.messengers[c.Messenger]; !ok {
 		m.store.UpdateCampaignStatus(c.ID, models.CampaignStatusCancelled)
+
+		if m.cfg.DispatchWebhook != nil {
+			m.cfg.DispatchWebhook(webhooks.EventCampaignCancelled, map[string]any{
+				"campaign": map[string]any{
+					"id":   c.ID,
+					"uuid": c.UUID,
+					"name": c.Name,
+					"type": c.Type,
+					"tags": c.Tags,
+				},
+				"reason": "unknown messenger " + c.Messenger,
+			})
+		}
+
 		return nil, fmt.Errorf("unknown messenger %s on campaign %s", c.Messenger, c.Name)
 	}
 
@@ -42,14 +91,43 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 		return nil, err
 	}
 
+	// Prepare the variants of A/B tested campaigns.
+	variants, err := m.prepareVariants(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// The campaign's own rate limits.
+	winDur, _ := time.ParseDuration(c.SlidingWindowDuration)
+	lim := newLimiter("campaign "+c.Name, RateLimit{
+		MessageRate:           c.MessageRate,
+		SlidingWindowRate:     c.SlidingWindowRate,
+		SlidingWindowDuration: winDur,
+	})
+
+	quiet, err := newQuietHours(c.QuietHours)
+	if err != nil {
+		m.log.Printf("ignoring invalid quiet hours of campaign (%s): %v", c.Name, err)
+	}
+
 	// Add the campaign to the active map.
 	p := &pipe{
-		camp: c,
-		rate: ratecounter.NewRateCounter(time.Minute),
-		wg:   &sync.WaitGroup{},
-		m:    m,
+		camp:        c,
+		rate:        ratecounter.NewRateCounter(time.Minute),
+		wg:          &sync.WaitGroup{},
+		msgQ:        make(chan CampaignMessage, m.cfg.BatchSize),
+		limiter:     lim,
+		deferred:    make(map[string][]CampaignMessage),
+		domainStats: make(map[string]*models.CampaignDomainStats),
+		variants:    variants,
+		variantSent: make([]atomic.Int64, len(variants)),
+		quiet:       quiet,
+		m:           m,
 	}
 
+	// Resume from the checkpoint if nothing is sent before the pipe is stopped.
+	p.lastID.Store(uint64(c.LastSubscriberID))
+
 	// Increment the waitgroup so that Wait() blocks immediately. This is necessary
 	// as a campaign pipe is created first and subscribers/messages under it are
 	// fetched asynchronolusly later. The messages each add to the wg and that
@@ -68,14 +146,23 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 	m.pipes[c.ID] = p
 	m.pipesMut.Unlock()
 
-	// Dispatch webhook event for campaign started.
-	if m.cfg.DispatchWebhook != nil {
+	// Dispatch webhook event for campaign started. Campaigns that are resumed from a
+	// checkpoint (paused, suspended for quiet hours), and the later phases of A/B tests
+	// and local time waves, which start afresh, have already started.
+	started := c.LastSubscriberID > 0 || c.ABTestedAt.Valid || c.LocalSentUntil.Valid
+	if c.LocalSend && !started {
+		from, until := localSendWindow(c)
+		m.log.Printf("sending campaign (%s) in subscribers' local time from %s to %s", c.Name,
+			from.UTC().Format(time.RFC822Z), until.UTC().Format(time.RFC822Z))
+	}
+	if m.cfg.DispatchWebhook != nil && !started {
 		m.cfg.DispatchWebhook(webhooks.EventCampaignStarted, map[string]any{
 			"campaign": map[string]any{
 				"id":   c.ID,
 				"uuid": c.UUID,
 				"name": c.Name,
 				"type": c.Type,
+				"tags": c.Tags,
 			},
 		})
 	}
@@ -83,6 +170,78 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 	return p, nil
 }
 
+// prepareVariants returns the compiled variants of an A/B tested campaign that
+// are being tested. Once the test's wait window is over (next-campaigns doesn't return
+// campaigns until then), the winning variant is picked and the campaign is compiled
+// with it to be sent to the rest of the subscribers.
+func (m *Manager) prepareVariants(c *models.Campaign) ([]*models.Campaign, error) {
+	if c.ABPercent == 0 || len(c.Variants) == 0 {
+		return nil, nil
+	}
+
+	if c.ABTestedAt.Valid && !c.ABWinnerID.Valid {
+		res, err := m.store.GetABTestResults(c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching A/B test results (%s): %v", c.Name, err)
+		}
+
+		id := pickABWinner(res, c.ABMetric)
+		if id == 0 {
+			return nil, fmt.Errorf("no A/B test results (%s)", c.Name)
+		}
+		if err := m.store.SetABWinner(c.ID, id); err != nil {
+			return nil, fmt.Errorf("error recording A/B test winner (%s): %v", c.Name, err)
+		}
+		c.ABWinnerID = null.IntFrom(id)
+		m.log.Printf("picked A/B test variant %d of campaign (%s) by %s", id, c.Name, c.ABMetric)
+	}
+
+	// The test is over. Send the winner.
+	if c.ABWinnerID.Valid {
+		for _, v := range c.Variants {
+			if v.ID == c.ABWinnerID.Int {
+				*c = *c.WithVariant(v)
+				return nil, c.CompileTemplate(m.TemplateFuncs(c))
+			}
+		}
+		return nil, nil
+	}
+
+	out := make([]*models.Campaign, 0, len(c.Variants))
+	for _, v := range c.Variants {
+		vc := c.WithVariant(v)
+		if err := vc.CompileTemplate(m.TemplateFuncs(vc)); err != nil {
+			return nil, fmt.Errorf("error compiling variant %s: %v", v.Label, err)
+		}
+		out = append(out, vc)
+	}
+
+	return out, nil
+}
+
+// pickABWinner returns the ID of the A/B test variant with the best unique
+// open or click (metric) rate among the subscribers it was sent to. Ties go
+// to the variant with the lowest ID. It returns 0 if there are no variants.
+func pickABWinner(res []models.CampaignAnalyticsVariant, metric string) int {
+	var (
+		id   = 0
+		best = -1.0
+	)
+	for _, v := range res {
+		n := v.Views
+		if metric == models.CampaignABMetricClicks {
+			n = v.Clicks
+		}
+
+		rate := float64(n) / float64(max(v.Sent, 1))
+		if rate > best || (rate == best && v.ID < id) {
+			id, best = v.ID, rate
+		}
+	}
+
+	return id
+}
+
 // NextSubscribers processes the next batch of subscribers in a given campaign.
 // It returns a bool indicating whether any subscribers were processed
 // in the current batch or not. A false indicates that all subscribers
@@ -100,52 +259,122 @@ func (p *pipe) NextSubscribers() (bool, error) {
 		return false, nil
 	}
 
-	// Is there a sliding window limit configured?
-	hasSliding := p.m.cfg.SlidingWindow &&
-		p.m.cfg.SlidingWindowRate > 0 &&
-		p.m.cfg.SlidingWindowDuration.Seconds() > 1
+	// Skip the subscribers who have reached the frequency cap. Exempt campaigns
+	// are sent regardless (but still count towards the cap).
+	reserved := false
+	if p.m.freq != nil && !p.camp.FrequencyCapExempt {
+		out, capped, err := p.m.freq.filter(p.m.store, p.camp.ID, subs, time.Now())
+		if err != nil {
+			return false, fmt.Errorf("error fetching frequency cap counts (%s): %v", p.camp.Name, err)
+		}
+		p.m.skipCapped(p.camp, capped)
+
+		subs = out
+		reserved = true
+	}
 
 	// Push messages.
 	for _, s := range subs {
 		msg, err := p.newMessage(s)
 		if err != nil {
 			p.m.log.Printf("error rendering message (%s) (%s): %v", p.camp.Name, s.Email, err)
+			if reserved {
+				p.m.freq.release(s.ID)
+			}
 			continue
 		}
+		msg.freqReserved = reserved
 
-		// Push the message to the queue while blocking and waiting until
-		// the queue is drained.
-		p.m.campMsgQ <- msg
-
-		// Check if the sliding window is active.
-		if hasSliding {
-			diff := time.Since(p.m.slidingStart)
+		// Push the message to the campaign's queue while blocking and waiting
+		// until the scheduler drains it.
+		p.msgQ <- msg
+		p.m.notifySched()
+	}
 
-			// Window has expired. Reset the clock.
-			if diff >= p.m.cfg.SlidingWindowDuration {
-				p.m.slidingStart = time.Now()
-				p.m.slidingCount = 0
-				continue
-			}
+	return true, nil
+}
 
-			// Have the messages exceeded the limit?
-			p.m.slidingCount++
-			if p.m.slidingCount >= p.m.cfg.SlidingWindowRate {
-				wait := p.m.cfg.SlidingWindowDuration - diff
+// run fetches and queues batches of subscribers until they're exhausted.
+func (p *pipe) run() {
+	for {
+		// A campaign suspended for quiet hours is still running. Stop fetching its subscribers.
+		if p.suspended.Load() {
+			p.wg.Done()
+			return
+		}
 
-				p.m.log.Printf("messages exceeded (%d) for the window (%v since %s). Sleeping for %s.",
-					p.m.slidingCount,
-					p.m.cfg.SlidingWindowDuration,
-					p.m.slidingStart.Format(time.RFC822Z),
-					wait.Round(time.Second)*1)
+		has, err := p.NextSubscribers()
+		if err != nil {
+			p.m.log.Printf("error processing campaign batch (%s): %v", p.camp.Name, err)
+			return
+		}
 
-				p.m.slidingCount = 0
-				time.Sleep(wait)
-			}
+		if !has {
+			// The pipe is created with a +1 on the waitgroup pseudo counter
+			// so that it immediately waits. Subsequently, every message created
+			// is incremented in the counter in pipe.newMessage(), and when it's'
+			// processed (or ignored when a campaign is paused or cancelled),
+			// the count is's reduced in worker().
+			//
+			// This marks down the original non-message +1, causing the waitgroup
+			// to be released and the pipe to end, triggering the pg.Wait()
+			// in newPipe() that calls pipe.cleanup().
+			p.wg.Done()
+			return
 		}
 	}
+}
 
-	return true, nil
+// requeue holds back a message to be retried by the scheduler.
+func (p *pipe) requeue(msg CampaignMessage) {
+	p.requeueMu.Lock()
+	p.requeued = append(p.requeued, msg)
+	p.requeueMu.Unlock()
+}
+
+// popRequeued removes and returns the oldest held back message.
+func (p *pipe) popRequeued() (CampaignMessage, bool) {
+	p.requeueMu.Lock()
+	defer p.requeueMu.Unlock()
+
+	if len(p.requeued) == 0 {
+		return CampaignMessage{}, false
+	}
+
+	msg := p.requeued[0]
+	p.requeued = p.requeued[1:]
+	return msg, true
+}
+
+// countDomain updates the number of messages sent to (sent=1) and held
+// back for (deferred=+1/-1) a throttled domain.
+func (p *pipe) countDomain(domain string, sent, deferred int) {
+	p.domainStatMu.Lock()
+	defer p.domainStatMu.Unlock()
+
+	s, ok := p.domainStats[domain]
+	if !ok {
+		s = &models.CampaignDomainStats{Domain: domain}
+		p.domainStats[domain] = s
+	}
+	s.Sent += sent
+	s.Deferred += deferred
+}
+
+// getDomainStats returns the message counts of throttled domains ordered by domain.
+func (p *pipe) getDomainStats() []models.CampaignDomainStats {
+	p.domainStatMu.Lock()
+	out := make([]models.CampaignDomainStats, 0, len(p.domainStats))
+	for _, s := range p.domainStats {
+		out = append(out, *s)
+	}
+	p.domainStatMu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Domain < out[j].Domain
+	})
+
+	return out
 }
 
 // OnError keeps track of the number of errors that occur while sending messages
@@ -185,7 +414,13 @@ func (p *pipe) Stop(withErrors bool) {
 // number of messages in the pipe wait group so that the status of every
 // message can be atomically tracked.
 func (p *pipe) newMessage(s models.Subscriber) (CampaignMessage, error) {
-	msg, err := p.m.NewCampaignMessage(p.camp, s)
+	// In A/B tests, the variant is picked by the subscriber ID.
+	camp := p.camp
+	if n := len(p.variants); n > 0 {
+		camp = p.variants[s.ID%n]
+	}
+
+	msg, err := p.m.NewCampaignMessage(camp, s)
 	if err != nil {
 		return msg, err
 	}
@@ -196,6 +431,40 @@ func (p *pipe) newMessage(s models.Subscriber) (CampaignMessage, error) {
 	return msg, nil
 }
 
+// markSent records a message that has been sent to a subscriber.
+func (p *pipe) markSent(subID int) {
+	id := uint64(subID)
+	for {
+		last := p.lastID.Load()
+		if id <= last || p.lastID.CompareAndSwap(last, id) {
+			return
+		}
+	}
+}
+
+// markUnsent records a message that was discarded without being sent.
+func (p *pipe) markUnsent(subID int) {
+	id := uint64(subID)
+	for {
+		first := p.unsentID.Load()
+		if (first != 0 && id >= first) || p.unsentID.CompareAndSwap(first, id) {
+			return
+		}
+	}
+}
+
+// checkpoint returns the subscriber ID to resume the campaign from (last_subscriber_id),
+// which is the last subscriber who was sent the message, or the one before the first
+// subscriber whose message was discarded, whichever is lower.
+func (p *pipe) checkpoint() int {
+	last := p.lastID.Load()
+	if first := p.unsentID.Load(); first != 0 && first-1 < last {
+		last = first - 1
+	}
+
+	return int(last)
+}
+
 // cleanup finishes the campaign and updates the campaign status in the DB
 // and also triggers a notification to the admin. This only triggers once
 // a pipe's wg counter is fully exhausted, draining all messages in its queue.
@@ -207,28 +476,88 @@ func (p *pipe) cleanup() {
 	}()
 
 	// Update campaign's 'sent count.
-	if err := p.m.store.UpdateCampaignCounts(p.camp.ID, 0, int(p.sent.Load()), int(p.lastID.Load())); err != nil {
+	if err := p.m.store.UpdateCampaignCounts(p.camp.ID, 0, int(p.sent.Load()), p.checkpoint()); err != nil {
 		p.m.log.Printf("error updating campaign counts (%s): %v", p.camp.Name, err)
 	}
 
+	// Update the A/B test variants' sent counts.
+	if len(p.variants) > 0 {
+		var (
+			ids    = make([]int, len(p.variants))
+			counts = make([]int, len(p.variants))
+		)
+		for i, v := range p.camp.Variants {
+			ids[i] = v.ID
+			counts[i] = int(p.variantSent[i].Load())
+		}
+		if err := p.m.store.UpdateVariantCounts(ids, counts); err != nil {
+			p.m.log.Printf("error updating campaign variant counts (%s): %v", p.camp.Name, err)
+		}
+	}
+
 	// The campaign was auto-paused due to errors.
 	if p.withErrors.Load() {
 		if err := p.m.store.UpdateCampaignStatus(p.camp.ID, models.CampaignStatusPaused); err != nil {
 			p.m.log.Printf("error updating campaign (%s) status to %s: %v", p.camp.Name, models.CampaignStatusPaused, err)
 		} else {
 			p.m.log.Printf("set campaign (%s) to %s", p.camp.Name, models.CampaignStatusPaused)
+
+			// Dispatch webhook event for campaign paused.
+			if p.m.cfg.DispatchWebhook != nil {
+				p.m.cfg.DispatchWebhook(webhooks.EventCampaignPaused, map[string]any{
+					"campaign": map[string]any{
+						"id":   p.camp.ID,
+						"uuid": p.camp.UUID,
+						"name": p.camp.Name,
+						"type": p.camp.Type,
+						"tags": p.camp.Tags,
+						"sent": p.sent.Load(),
+					},
+					"reason": "too many errors",
+				})
+			}
 		}
 
 		_ = p.m.sendNotif(p.camp, models.CampaignStatusPaused, "Too many errors")
 		return
 	}
 
+	// The campaign was suspended for quiet hours. It's resumed later.
+	if p.suspended.Load() {
+		p.m.log.Printf("suspended campaign (%s)", p.camp.Name)
+		return
+	}
+
 	// The campaign was manually stopped (pause, cancel).
 	if p.stopped.Load() {
 		p.m.log.Printf("stop processing campaign (%s)", p.camp.Name)
 		return
 	}
 
+	// A wave of a campaign sent in subscribers' local time has been sent. The campaign
+	// stays running until its local time has passed in all timezones.
+	if p.camp.LocalSend {
+		done, err := p.finishLocalWave()
+		if err != nil {
+			p.m.log.Printf("error finishing local time wave of campaign (%s): %v", p.camp.Name, err)
+			return
+		}
+		if !done {
+			return
+		}
+	}
+
+	// The A/B test has been sent. The campaign stays running and the winning variant
+	// is sent to the rest of the subscribers after the test's wait window.
+	if len(p.variants) > 0 {
+		if err := p.m.store.FinishABTest(p.camp.ID); err != nil {
+			p.m.log.Printf("error finishing A/B test of campaign (%s): %v", p.camp.Name, err)
+		} else {
+			p.m.log.Printf("A/B test of campaign (%s) sent. picking the winner in %d minutes", p.camp.Name, p.camp.ABWait)
+		}
+		return
+	}
+
 	// Campaign wasn't manually stopped and subscribers were naturally exhausted.
 	// Fetch the up-to-date campaign status from the DB.
 	c, err := p.m.store.GetCampaign(p.camp.ID)
@@ -253,6 +582,7 @@ func (p *pipe) cleanup() {
 						"uuid": c.UUID,
 						"name": c.Name,
 						"type": c.Type,
+						"tags": c.Tags,
 						"sent": p.sent.Load(),
 					},
 				})
@@ -0,0 +1,281 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/paulbellamy/ratecounter"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+type fakeMessenger struct {
+	mu   sync.Mutex
+	sent []int
+}
+
+func (f *fakeMessenger) Name() string { return "email" }
+func (f *fakeMessenger) Flush() error { return nil }
+func (f *fakeMessenger) Close() error { return nil }
+
+func (f *fakeMessenger) Push(m models.Message) error {
+	f.mu.Lock()
+	f.sent = append(f.sent, m.Subscriber.ID)
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeMessenger) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sent)
+}
+
+func newTestPipe(m *Manager, lastID int) *pipe {
+	c := &models.Campaign{Name: "test", Messenger: "email", Priority: 1}
+	c.ID = 1
+	c.LastSubscriberID = lastID
+
+	p := &pipe{
+		camp:        c,
+		rate:        ratecounter.NewRateCounter(time.Minute),
+		wg:          &sync.WaitGroup{},
+		msgQ:        make(chan CampaignMessage, 10),
+		deferred:    make(map[string][]CampaignMessage),
+		domainStats: make(map[string]*models.CampaignDomainStats),
+		m:           m,
+	}
+	p.lastID.Store(uint64(lastID))
+
+	return p
+}
+
+func TestPipeCheckpoint(t *testing.T) {
+	cases := []struct {
+		name   string
+		lastID int
+		sent   []int
+		unsent []int
+		exp    int
+	}{
+		{"nothing sent", 10, nil, nil, 10},
+		{"all sent", 10, []int{13, 11, 12}, nil, 13},
+		{"unsent in between", 10, []int{11, 14, 12}, []int{15, 13}, 12},
+		{"first unsent", 10, []int{12, 13}, []int{11}, 10},
+		{"unsent after the last sent", 10, []int{11, 12}, []int{14}, 12},
+		{"nothing sent from the start", 0, nil, []int{1, 2}, 0},
+	}
+
+	for _, c := range cases {
+		p := newTestPipe(nil, c.lastID)
+		for _, id := range c.sent {
+			p.markSent(id)
+		}
+		for _, id := range c.unsent {
+			p.markUnsent(id)
+		}
+
+		if got := p.checkpoint(); got != c.exp {
+			t.Errorf("%s: expected checkpoint %d, got %d", c.name, c.exp, got)
+		}
+	}
+}
+
+// Messages to throttled domains are held back and sent after the messages of
+// subscribers with higher IDs. When the campaign is stopped, the held back
+// messages are discarded and the campaign is resumed from before them.
+func TestPipeCheckpointDeferred(t *testing.T) {
+	m := New(Config{
+		Concurrency:  1,
+		MessageRate:  1000,
+		DomainLimits: map[string]int{"slow.com": 1},
+	}, &fakeStore{}, nil, log.New(io.Discard, "", 0))
+
+	msgr := &fakeMessenger{}
+	if err := m.AddMessenger(msgr); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestPipe(m, 10)
+	for i, email := range []string{"a@slow.com", "b@slow.com", "c@fast.com", "d@fast.com"} {
+		s := sub(11 + i)
+		s.Email = email
+
+		p.wg.Add(1)
+		p.msgQ <- CampaignMessage{Campaign: p.camp, Subscriber: s, pipe: p}
+	}
+
+	go m.worker()
+	defer close(m.campMsgQ)
+
+	// 11 is sent, 12 is held back as slow.com's limit has been reached, 13 and 14 are sent.
+	for m.dispatch(p) {
+	}
+	if p.numDeferred != 1 {
+		t.Fatalf("expected 1 deferred message, got %d", p.numDeferred)
+	}
+	for deadline := time.Now().Add(time.Second); msgr.count() < 3; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 3 sent messages, got %d", msgr.count())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Stop the campaign. The held back message is discarded.
+	p.Stop(false)
+	for m.dispatch(p) {
+	}
+	p.wg.Wait()
+
+	if n := msgr.count(); n != 3 {
+		t.Fatalf("expected 3 sent messages, got %d", n)
+	}
+	if got := p.checkpoint(); got != 11 {
+		t.Errorf("expected checkpoint 11, got %d", got)
+	}
+}
+
+func newABCampaign() *models.Campaign {
+	c := &models.Campaign{
+		Name:        "ab",
+		Subject:     "default",
+		Body:        "body",
+		ContentType: models.CampaignContentTypeHTML,
+		ABPercent:   20,
+		ABMetric:    models.CampaignABMetricOpens,
+		Variants: models.CampaignVariants{
+			{ID: 5, Label: "A", Subject: "a"},
+			{ID: 6, Label: "B", Subject: "b"},
+			{ID: 7, Label: "C", Subject: "c"},
+		},
+	}
+	c.ID = 1
+	return c
+}
+
+func TestPickABWinner(t *testing.T) {
+	res := []models.CampaignAnalyticsVariant{
+		{ID: 5, Sent: 100, Views: 30, Clicks: 5},
+		{ID: 6, Sent: 50, Views: 20, Clicks: 5},
+		{ID: 7, Sent: 100, Views: 45, Clicks: 2},
+	}
+
+	cases := []struct {
+		name   string
+		res    []models.CampaignAnalyticsVariant
+		metric string
+		exp    int
+	}{
+		{"opens", res, models.CampaignABMetricOpens, 7},
+		{"clicks", res, models.CampaignABMetricClicks, 6},
+		{"tie", []models.CampaignAnalyticsVariant{{ID: 6, Sent: 10, Views: 1}, {ID: 5, Sent: 20, Views: 2}}, models.CampaignABMetricOpens, 5},
+		{"nothing sent", []models.CampaignAnalyticsVariant{{ID: 5}, {ID: 6}}, models.CampaignABMetricOpens, 5},
+		{"no variants", nil, models.CampaignABMetricOpens, 0},
+	}
+
+	for _, c := range cases {
+		if got := pickABWinner(c.res, c.metric); got != c.exp {
+			t.Errorf("%s: expected variant %d, got %d", c.name, c.exp, got)
+		}
+	}
+}
+
+func TestPrepareVariants(t *testing.T) {
+	st := &fakeStore{abResults: []models.CampaignAnalyticsVariant{
+		{ID: 5, Sent: 10, Views: 1},
+		{ID: 6, Sent: 10, Views: 4},
+		{ID: 7, Sent: 10, Views: 2},
+	}}
+	m := New(Config{}, st, nil, log.New(io.Discard, "", 0))
+
+	// While the test is being sent, all the variants are compiled in order.
+	c := newABCampaign()
+	vars, err := m.prepareVariants(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != 3 || vars[0].Subject != "a" || vars[1].Subject != "b" || vars[2].Subject != "c" {
+		t.Fatalf("unexpected variants: %v", vars)
+	}
+	for _, v := range vars {
+		if v.Tpl == nil {
+			t.Errorf("variant %s isn't compiled", v.Subject)
+		}
+	}
+	if len(st.abWinners) != 0 {
+		t.Errorf("expected no winner while testing, got %v", st.abWinners)
+	}
+
+	// Once the test has been sent, the winner is picked and recorded, and the
+	// campaign is sent with it.
+	c.ABTestedAt = null.TimeFrom(time.Now())
+	vars, err = m.prepareVariants(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars != nil {
+		t.Errorf("expected no variants after the test, got %v", vars)
+	}
+	if st.abWinners[1] != 6 || c.ABWinnerID.Int != 6 || c.Subject != "b" || c.Tpl == nil {
+		t.Errorf("expected variant 6 to be recorded and sent, got %v, %d, %s", st.abWinners, c.ABWinnerID.Int, c.Subject)
+	}
+
+	// A recorded winner isn't picked again.
+	st.abWinners = nil
+	c = newABCampaign()
+	c.ABTestedAt = null.TimeFrom(time.Now())
+	c.ABWinnerID = null.IntFrom(7)
+	if _, err := m.prepareVariants(c); err != nil {
+		t.Fatal(err)
+	}
+	if st.abWinners != nil || c.Subject != "c" {
+		t.Errorf("expected the recorded winner to be sent, got %v, %s", st.abWinners, c.Subject)
+	}
+}
+
+// In A/B tests, subscribers are split between the variants by their IDs.
+func TestPipeVariantSplit(t *testing.T) {
+	m := New(Config{Concurrency: 1, MessageRate: 1000}, &fakeStore{}, nil, log.New(io.Discard, "", 0))
+	msgr := &fakeMessenger{}
+	if err := m.AddMessenger(msgr); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newABCampaign()
+	c.Messenger = "email"
+	vars, err := m.prepareVariants(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestPipe(m, 0)
+	p.camp = c
+	p.variants = vars
+	p.variantSent = make([]atomic.Int64, len(vars))
+
+	go m.worker()
+	defer close(m.campMsgQ)
+
+	for id := 1; id <= 10; id++ {
+		msg, err := p.newMessage(sub(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := c.Variants[id%3].Subject; msg.Subject() != exp {
+			t.Errorf("subscriber %d: expected variant %s, got %s", id, exp, msg.Subject())
+		}
+		m.campMsgQ <- msg
+	}
+	p.wg.Wait()
+
+	// 3, 6, 9 get A, 1, 4, 7, 10 get B and 2, 5, 8 get C.
+	for i, exp := range []int64{3, 4, 3} {
+		if n := p.variantSent[i].Load(); n != exp {
+			t.Errorf("variant %s: expected %d sent, got %d", c.Variants[i].Label, exp, n)
+		}
+	}
+}
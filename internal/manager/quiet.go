@@ -0,0 +1,188 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// Max number of quiet periods (hours and days) looked ahead to find the end of
+// contiguous quiet hours, eg: Friday night through the weekend to Monday morning.
+const maxQuietSteps = 64
+
+// quietHours are parsed models.QuietHours. A nil quietHours is never quiet.
+type quietHours struct {
+	// Start and end of the quiet hours in minutes since midnight,
+	// or -1 if there are only quiet days.
+	start, end int
+	days       [7]bool
+	loc        *time.Location
+}
+
+// ValidateQuietHours checks whether quiet hours are valid.
+func ValidateQuietHours(q models.QuietHours) error {
+	_, err := newQuietHours(q)
+	return err
+}
+
+// newQuietHours parses quiet hours. It returns nil if they're disabled.
+func newQuietHours(q models.QuietHours) (*quietHours, error) {
+	if !q.Enabled {
+		return nil, nil
+	}
+
+	out := &quietHours{start: -1, end: -1, loc: time.Local}
+	if q.Start != "" || q.End != "" {
+		var err error
+		if out.start, err = parseClock(q.Start); err != nil {
+			return nil, err
+		}
+		if out.end, err = parseClock(q.End); err != nil {
+			return nil, err
+		}
+		if out.start == out.end {
+			return nil, errors.New("quiet hours start and end are the same")
+		}
+	}
+
+	for _, d := range q.Days {
+		if d < 0 || d > 6 {
+			return nil, fmt.Errorf("invalid day of the week: %d", d)
+		}
+		out.days[d] = true
+	}
+	if out.start < 0 && len(q.Days) == 0 {
+		return nil, errors.New("quiet hours have neither hours nor days")
+	}
+
+	if q.Timezone != "" {
+		loc, err := time.LoadLocation(q.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		out.loc = loc
+	}
+
+	return out, nil
+}
+
+// quietAt checks whether t falls in the quiet hours.
+func (q *quietHours) quietAt(t time.Time) bool {
+	if q == nil {
+		return false
+	}
+
+	t = t.In(q.loc)
+	if q.days[t.Weekday()] {
+		return true
+	}
+	if q.start < 0 {
+		return false
+	}
+
+	mins := t.Hour()*60 + t.Minute()
+	if q.start < q.end {
+		return mins >= q.start && mins < q.end
+	}
+
+	// The hours span midnight, eg: 22:00 to 07:00.
+	return mins >= q.start || mins < q.end
+}
+
+// next returns the first boundary (start or end of the quiet hours, or midnight) after t.
+func (q *quietHours) next(t time.Time) time.Time {
+	t = t.In(q.loc)
+	y, m, d := t.Date()
+
+	out := time.Date(y, m, d+1, 0, 0, 0, 0, q.loc)
+	if q.start >= 0 {
+		for _, mins := range []int{q.start, q.end} {
+			b := time.Date(y, m, d, mins/60, mins%60, 0, 0, q.loc)
+			if b.After(t) && b.Before(out) {
+				out = b
+			}
+		}
+	}
+
+	return out
+}
+
+// quietUntil checks whether t falls in any of the given quiet hours and returns
+// the time at which all of them are over.
+func quietUntil(t time.Time, qs ...*quietHours) (time.Time, bool) {
+	end := t
+	for range maxQuietSteps {
+		quiet := false
+		for _, q := range qs {
+			if q.quietAt(end) {
+				end = q.next(end)
+				quiet = true
+			}
+		}
+		if !quiet {
+			break
+		}
+	}
+
+	return end, end.After(t)
+}
+
+// parseClock parses a HH:MM time of the day into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of the day: %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// suspendQuiet suspends the running campaigns whose quiet hours have begun. Their
+// pipes are stopped like paused campaigns' but the campaigns remain running, and
+// once the quiet hours are over, scanCampaigns picks them up again and they resume
+// from their checkpoints (last_subscriber_id).
+func (m *Manager) suspendQuiet(now time.Time) {
+	m.pipesMut.Lock()
+	defer m.pipesMut.Unlock()
+
+	for id, until := range m.suspended {
+		if !now.Before(until) {
+			delete(m.suspended, id)
+		}
+	}
+
+	for id, p := range m.pipes {
+		if p.stopped.Load() {
+			continue
+		}
+
+		if until, ok := quietUntil(now, m.quiet, p.quiet); ok {
+			p.suspended.Store(true)
+			p.Stop(false)
+			m.suspended[id] = until
+			m.log.Printf("suspending campaign (%s) for quiet hours until %s", p.camp.Name, until.Format(time.RFC822Z))
+		}
+	}
+}
+
+// suspendIfQuiet suspends a campaign that's due to be started if it's in
+// quiet hours. It returns true if the campaign has been suspended.
+func (m *Manager) suspendIfQuiet(c *models.Campaign, now time.Time) bool {
+	q, err := newQuietHours(c.QuietHours)
+	if err != nil {
+		m.log.Printf("ignoring invalid quiet hours of campaign (%s): %v", c.Name, err)
+	}
+
+	until, ok := quietUntil(now, m.quiet, q)
+	if !ok {
+		return false
+	}
+
+	m.pipesMut.Lock()
+	m.suspended[c.ID] = until
+	m.pipesMut.Unlock()
+
+	m.log.Printf("campaign (%s) is in quiet hours. starting at %s", c.Name, until.Format(time.RFC822Z))
+	return true
+}
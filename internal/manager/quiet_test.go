@@ -0,0 +1,230 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const quietTZ = "America/New_York"
+
+func mustQuiet(t *testing.T, start, end string, days ...int) *quietHours {
+	t.Helper()
+
+	q, err := newQuietHours(models.QuietHours{Enabled: true, Start: start, End: end, Days: days, Timezone: quietTZ})
+	if err != nil {
+		t.Fatalf("error parsing quiet hours %s-%s: %v", start, end, err)
+	}
+	return q
+}
+
+func quietLoc(t *testing.T) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(quietTZ)
+	if err != nil {
+		t.Skipf("timezone %s isn't available: %v", quietTZ, err)
+	}
+	return loc
+}
+
+func TestParseClock(t *testing.T) {
+	cases := []struct {
+		in   string
+		mins int
+		err  bool
+	}{
+		{"00:00", 0, false},
+		{"07:30", 450, false},
+		{"22:00", 1320, false},
+		{"23:59", 1439, false},
+		{"24:00", 0, true},
+		{"12:60", 0, true},
+		{"", 0, true},
+		{"noon", 0, true},
+	}
+
+	for _, c := range cases {
+		mins, err := parseClock(c.in)
+		if (err != nil) != c.err {
+			t.Errorf("%q: unexpected error: %v", c.in, err)
+			continue
+		}
+		if mins != c.mins {
+			t.Errorf("%q: expected %d, got %d", c.in, c.mins, mins)
+		}
+	}
+}
+
+func TestNewQuietHours(t *testing.T) {
+	quietLoc(t)
+
+	cases := []struct {
+		name string
+		q    models.QuietHours
+		nil  bool
+		err  bool
+	}{
+		{"disabled", models.QuietHours{Start: "bad"}, true, false},
+		{"hours", models.QuietHours{Enabled: true, Start: "22:00", End: "07:00"}, false, false},
+		{"days", models.QuietHours{Enabled: true, Days: []int{0, 6}}, false, false},
+		{"same start and end", models.QuietHours{Enabled: true, Start: "22:00", End: "22:00"}, true, true},
+		{"no end", models.QuietHours{Enabled: true, Start: "22:00"}, true, true},
+		{"invalid day", models.QuietHours{Enabled: true, Days: []int{7}}, true, true},
+		{"nothing", models.QuietHours{Enabled: true}, true, true},
+		{"invalid timezone", models.QuietHours{Enabled: true, Days: []int{0}, Timezone: "Mars/Olympus"}, true, true},
+	}
+
+	for _, c := range cases {
+		q, err := newQuietHours(c.q)
+		if (err != nil) != c.err {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+		if (q == nil) != c.nil {
+			t.Errorf("%s: got quiet hours %v", c.name, q)
+		}
+	}
+}
+
+func TestQuietAt(t *testing.T) {
+	var (
+		loc       = quietLoc(t)
+		overnight = mustQuiet(t, "22:00", "07:00")
+		daytime   = mustQuiet(t, "09:00", "17:00")
+		weekend   = mustQuiet(t, "", "", 0, 6)
+	)
+
+	// 2024-01-15 is a Monday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 1, day, hour, min, 0, 0, loc)
+	}
+
+	cases := []struct {
+		name  string
+		q     *quietHours
+		t     time.Time
+		quiet bool
+	}{
+		{"no quiet hours", nil, at(15, 23, 0), false},
+		{"before overnight", overnight, at(15, 21, 59), false},
+		{"overnight start", overnight, at(15, 22, 0), true},
+		{"after midnight", overnight, at(16, 3, 0), true},
+		{"before overnight end", overnight, at(16, 6, 59), true},
+		{"overnight end", overnight, at(16, 7, 0), false},
+		{"midday", overnight, at(16, 12, 0), false},
+		{"before daytime", daytime, at(15, 8, 59), false},
+		{"daytime start", daytime, at(15, 9, 0), true},
+		{"daytime end", daytime, at(15, 17, 0), false},
+		{"saturday", weekend, at(20, 12, 0), true},
+		{"sunday", weekend, at(21, 23, 59), true},
+		{"monday", weekend, at(22, 0, 0), false},
+
+		// 03:30 UTC is 22:30 in New York.
+		{"other timezone", overnight, time.Date(2024, 1, 16, 3, 30, 0, 0, time.UTC), true},
+	}
+
+	for _, c := range cases {
+		if got := c.q.quietAt(c.t); got != c.quiet {
+			t.Errorf("%s: expected %v at %s, got %v", c.name, c.quiet, c.t, got)
+		}
+	}
+}
+
+func TestQuietNext(t *testing.T) {
+	var (
+		loc       = quietLoc(t)
+		overnight = mustQuiet(t, "22:00", "07:00")
+		weekend   = mustQuiet(t, "", "", 0, 6)
+	)
+
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 1, day, hour, min, 0, 0, loc)
+	}
+
+	cases := []struct {
+		name string
+		q    *quietHours
+		t    time.Time
+		exp  time.Time
+	}{
+		{"start", overnight, at(15, 12, 0), at(15, 22, 0)},
+		{"at the start", overnight, at(15, 22, 0), at(16, 0, 0)},
+		{"midnight", overnight, at(15, 23, 0), at(16, 0, 0)},
+		{"end", overnight, at(16, 0, 0), at(16, 7, 0)},
+		{"days only", weekend, at(20, 12, 0), at(21, 0, 0)},
+	}
+
+	for _, c := range cases {
+		if got := c.q.next(c.t); !got.Equal(c.exp) {
+			t.Errorf("%s: expected %s, got %s", c.name, c.exp, got)
+		}
+	}
+}
+
+func TestQuietUntil(t *testing.T) {
+	var (
+		loc       = quietLoc(t)
+		overnight = mustQuiet(t, "22:00", "07:00")
+		morning   = mustQuiet(t, "05:00", "08:00")
+		weekend   = mustQuiet(t, "22:00", "07:00", 0, 6)
+	)
+
+	cases := []struct {
+		name  string
+		qs    []*quietHours
+		t     time.Time
+		exp   time.Time
+		quiet bool
+	}{
+		{"no quiet hours", nil,
+			time.Date(2024, 1, 15, 23, 0, 0, 0, loc), time.Date(2024, 1, 15, 23, 0, 0, 0, loc), false},
+		{"not quiet", []*quietHours{overnight, nil},
+			time.Date(2024, 1, 15, 12, 0, 0, 0, loc), time.Date(2024, 1, 15, 12, 0, 0, 0, loc), false},
+		{"overnight", []*quietHours{overnight},
+			time.Date(2024, 1, 15, 23, 0, 0, 0, loc), time.Date(2024, 1, 16, 7, 0, 0, 0, loc), true},
+		{"after midnight", []*quietHours{overnight},
+			time.Date(2024, 1, 16, 2, 0, 0, 0, loc), time.Date(2024, 1, 16, 7, 0, 0, 0, loc), true},
+
+		// Friday night through the weekend to Monday morning.
+		{"weekend", []*quietHours{weekend},
+			time.Date(2024, 1, 19, 23, 0, 0, 0, loc), time.Date(2024, 1, 22, 7, 0, 0, 0, loc), true},
+
+		// The global and the campaign's quiet hours overlap.
+		{"overlapping", []*quietHours{overnight, morning},
+			time.Date(2024, 1, 15, 23, 0, 0, 0, loc), time.Date(2024, 1, 16, 8, 0, 0, 0, loc), true},
+		{"overlapping reversed", []*quietHours{morning, overnight},
+			time.Date(2024, 1, 15, 23, 0, 0, 0, loc), time.Date(2024, 1, 16, 8, 0, 0, 0, loc), true},
+
+		// DST starts (02:00 EST -> 03:00 EDT) and ends (02:00 EDT -> 01:00 EST) during the night.
+		{"dst start", []*quietHours{overnight},
+			time.Date(2024, 3, 9, 23, 0, 0, 0, loc), time.Date(2024, 3, 10, 11, 0, 0, 0, time.UTC), true},
+		{"dst end", []*quietHours{overnight},
+			time.Date(2024, 11, 2, 23, 0, 0, 0, loc), time.Date(2024, 11, 3, 12, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, c := range cases {
+		end, quiet := quietUntil(c.t, c.qs...)
+		if quiet != c.quiet || !end.Equal(c.exp) {
+			t.Errorf("%s: expected (%s, %v), got (%s, %v)", c.name, c.exp, c.quiet, end, quiet)
+		}
+	}
+}
+
+func TestQuietUntilMaxSteps(t *testing.T) {
+	var (
+		loc    = quietLoc(t)
+		always = mustQuiet(t, "", "", 0, 1, 2, 3, 4, 5, 6)
+		now    = time.Date(2024, 1, 15, 12, 0, 0, 0, loc)
+	)
+
+	// Quiet hours that never end are looked ahead to the next midnight
+	// maxQuietSteps times, and are still quiet.
+	end, quiet := quietUntil(now, always)
+	if !quiet {
+		t.Fatal("expected the quiet hours to never end")
+	}
+	if exp := time.Date(2024, 1, 15+maxQuietSteps, 0, 0, 0, 0, loc); !end.Equal(exp) {
+		t.Errorf("expected %s, got %s", exp, end)
+	}
+}
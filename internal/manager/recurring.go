@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdgvda/cron"
+	"github.com/knadh/listmonk/models"
+)
+
+// NextRecurrence returns the next occurrence of a recurring campaign after t.
+// Occurrences start at the campaign's send_at.
+func NextRecurrence(c *models.Campaign, t time.Time) (time.Time, error) {
+	sch, err := cron.ParseStandard(c.Recurrence)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if c.SendAt.Valid && c.SendAt.Time.After(t) {
+		t = c.SendAt.Time.Add(-time.Second)
+	}
+
+	return sch.Next(t), nil
+}
+
+// SkipRecurrence returns the occurrence of a recurring campaign that follows its
+// next occurrence, which is skipped. If the next occurrence hasn't been recorded
+// yet, the first one after t is skipped.
+func SkipRecurrence(c *models.Campaign, t time.Time) (time.Time, error) {
+	at := c.RecurrenceNext.Time
+	if !c.RecurrenceNext.Valid {
+		var err error
+		if at, err = NextRecurrence(c, t); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return NextRecurrence(c, at)
+}
+
+// scheduleRecurring creates the runs of recurring campaigns whose next occurrence
+// is due. Occurrences that were missed, eg: while the app was down, are run once.
+func (m *Manager) scheduleRecurring() {
+	camps, err := m.store.GetRecurringCampaigns()
+	if err != nil {
+		m.log.Printf("error fetching recurring campaigns: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, c := range camps {
+		if c.RecurrenceNext.Valid && c.RecurrenceNext.Time.After(now) {
+			continue
+		}
+
+		next, err := NextRecurrence(&c, now)
+		if err != nil {
+			m.log.Printf("error parsing recurrence of campaign (%s): %v", c.Name, err)
+			continue
+		}
+
+		// The campaign has just been scheduled. Record its first occurrence.
+		if !c.RecurrenceNext.Valid {
+			if err := m.store.UpdateRecurrence(c.ID, c.RecurrenceNext, next); err != nil {
+				m.log.Printf("error updating recurrence of campaign (%s): %v", c.Name, err)
+			}
+			continue
+		}
+
+		at := c.RecurrenceNext.Time
+		name := fmt.Sprintf("%s / %s", c.Name, at.Local().Format("2006-01-02 15:04"))
+		id, err := m.store.CreateCampaignRun(c.ID, name, at, next)
+		if err != nil {
+			m.log.Printf("error creating run of recurring campaign (%s): %v", c.Name, err)
+			continue
+		}
+		if id > 0 {
+			m.log.Printf("created run (%s) of recurring campaign (%s). next run at %s", name, c.Name, next.Format(time.RFC822Z))
+		}
+	}
+}
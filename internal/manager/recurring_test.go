@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// recurringStore is a Store with recurring campaigns that records their
+// occurrences and runs.
+type recurringStore struct {
+	fakeStore
+
+	camps []models.Campaign
+	next  map[int]time.Time
+	runs  map[int][]time.Time
+}
+
+func (s *recurringStore) GetRecurringCampaigns() ([]models.Campaign, error) {
+	return s.camps, nil
+}
+
+func (s *recurringStore) UpdateRecurrence(campID int, cur null.Time, next time.Time) error {
+	s.next[campID] = next
+	return nil
+}
+
+func (s *recurringStore) CreateCampaignRun(campID int, name string, at, next time.Time) (int, error) {
+	s.runs[campID] = append(s.runs[campID], at)
+	s.next[campID] = next
+	return campID + 100, nil
+}
+
+func newRecurring(id int, rec string, sendAt, next null.Time) models.Campaign {
+	c := models.Campaign{Name: "recurring", Recurrence: rec, SendAt: sendAt, RecurrenceNext: next}
+	c.ID = id
+	return c
+}
+
+func utc(month time.Month, day, hour, min int) time.Time {
+	return time.Date(2024, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestNextRecurrence(t *testing.T) {
+	cases := []struct {
+		name   string
+		rec    string
+		sendAt null.Time
+		t      time.Time
+		exp    time.Time
+		err    bool
+	}{
+		{"daily", "0 9 * * *", null.Time{}, utc(1, 15, 10, 0), utc(1, 16, 9, 0), false},
+		{"later today", "0 9 * * *", null.Time{}, utc(1, 15, 8, 0), utc(1, 15, 9, 0), false},
+		{"at an occurrence", "0 9 * * *", null.Time{}, utc(1, 15, 9, 0), utc(1, 16, 9, 0), false},
+		{"weekly", "0 9 * * 1", null.Time{}, utc(1, 15, 10, 0), utc(1, 22, 9, 0), false},
+		{"descriptor", "@daily", null.Time{}, utc(1, 15, 10, 0), utc(1, 16, 0, 0), false},
+
+		// Occurrences start at send_at, which may be an occurrence itself.
+		{"send_at", "0 9 * * *", null.TimeFrom(utc(2, 1, 9, 0)), utc(1, 15, 10, 0), utc(2, 1, 9, 0), false},
+		{"after send_at", "0 9 * * *", null.TimeFrom(utc(2, 1, 10, 0)), utc(1, 15, 10, 0), utc(2, 2, 9, 0), false},
+		{"past send_at", "0 9 * * *", null.TimeFrom(utc(1, 1, 9, 0)), utc(1, 15, 10, 0), utc(1, 16, 9, 0), false},
+
+		{"invalid", "every day", null.Time{}, utc(1, 15, 10, 0), time.Time{}, true},
+	}
+
+	for _, c := range cases {
+		camp := newRecurring(1, c.rec, c.sendAt, null.Time{})
+		got, err := NextRecurrence(&camp, c.t)
+		if (err != nil) != c.err {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if !got.Equal(c.exp) {
+			t.Errorf("%s: expected %s, got %s", c.name, c.exp, got)
+		}
+	}
+}
+
+func TestSkipRecurrence(t *testing.T) {
+	cases := []struct {
+		name   string
+		sendAt null.Time
+		next   null.Time
+		exp    time.Time
+	}{
+		{"recorded", null.Time{}, null.TimeFrom(utc(1, 16, 9, 0)), utc(1, 17, 9, 0)},
+		{"not recorded", null.Time{}, null.Time{}, utc(1, 17, 9, 0)},
+		{"first at send_at", null.TimeFrom(utc(2, 1, 9, 0)), null.Time{}, utc(2, 2, 9, 0)},
+	}
+
+	for _, c := range cases {
+		camp := newRecurring(1, "0 9 * * *", c.sendAt, c.next)
+		got, err := SkipRecurrence(&camp, utc(1, 15, 10, 0))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !got.Equal(c.exp) {
+			t.Errorf("%s: expected %s, got %s", c.name, c.exp, got)
+		}
+	}
+
+	camp := newRecurring(1, "every day", null.Time{}, null.Time{})
+	if _, err := SkipRecurrence(&camp, utc(1, 15, 10, 0)); err == nil {
+		t.Error("expected an error for an invalid recurrence")
+	}
+}
+
+func TestScheduleRecurring(t *testing.T) {
+	// Occurrences are every 15 minutes, which are the same in all timezones.
+	const every = "*/15 * * * *"
+	var (
+		q     = 15 * time.Minute
+		now   = time.Now()
+		start = now.Truncate(q)
+		st    = &recurringStore{next: map[int]time.Time{}, runs: map[int][]time.Time{}}
+		m     = New(Config{}, st, nil, log.New(io.Discard, "", 0))
+	)
+
+	// The occurrence of a campaign at the start of this quarter of an hour is skipped.
+	skipped := newRecurring(5, every, null.Time{}, null.TimeFrom(start))
+	next, err := SkipRecurrence(&skipped, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped.RecurrenceNext = null.TimeFrom(next)
+
+	st.camps = []models.Campaign{
+		// Just scheduled.
+		newRecurring(1, every, null.Time{}, null.Time{}),
+
+		// Missed occurrences are run once.
+		newRecurring(2, every, null.Time{}, null.TimeFrom(start.Add(-3*q))),
+
+		// Not due yet.
+		newRecurring(3, every, null.Time{}, null.TimeFrom(start.Add(q))),
+
+		newRecurring(4, "every hour", null.Time{}, null.TimeFrom(start)),
+		skipped,
+	}
+	m.scheduleRecurring()
+
+	if n, ok := st.next[1]; !ok || !n.Equal(start.Add(q)) || len(st.runs[1]) != 0 {
+		t.Errorf("expected the first occurrence to be recorded without a run, got %s, %v", n, st.runs[1])
+	}
+	if r := st.runs[2]; len(r) != 1 || !r[0].Equal(start.Add(-3*q)) || !st.next[2].Equal(start.Add(q)) {
+		t.Errorf("expected a single run of the missed occurrences, got %v, next %s", r, st.next[2])
+	}
+	for _, id := range []int{3, 4, 5} {
+		if _, ok := st.next[id]; ok || len(st.runs[id]) != 0 {
+			t.Errorf("campaign %d: expected no runs, got %v", id, st.runs[id])
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package manager
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Interval at which the scheduler retries when there are no messages to send,
+// or when the rate limits of all campaigns with messages have been reached.
+const schedInterval = time.Millisecond * 100
+
+// RateLimit is a limit on the rate of messages: MessageRate messages per
+// second, and SlidingWindowRate messages in every SlidingWindowDuration.
+// Zero values are no limit.
+type RateLimit struct {
+	MessageRate           int
+	SlidingWindowRate     int
+	SlidingWindowDuration time.Duration
+}
+
+// limiter enforces a RateLimit. It's only used by the scheduler goroutine and
+// isn't safe for concurrent use. A nil limiter has no limits.
+type limiter struct {
+	RateLimit
+	name string
+
+	// Messages in the current second.
+	count int
+	start time.Time
+
+	// Messages in the current sliding window.
+	winCount int
+	winStart time.Time
+}
+
+// newLimiter returns a limiter for the given limit, or nil if there are no limits.
+func newLimiter(name string, l RateLimit) *limiter {
+	// Windows of a second or less are ignored.
+	if l.SlidingWindowRate < 1 || l.SlidingWindowDuration <= time.Second {
+		l.SlidingWindowRate = 0
+	}
+	if l.MessageRate < 1 && l.SlidingWindowRate == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	return &limiter{RateLimit: l, name: name, start: now, winStart: now}
+}
+
+// ready checks whether a message can be sent without exceeding the limits.
+func (l *limiter) ready(now time.Time) bool {
+	if l == nil {
+		return true
+	}
+
+	if l.MessageRate > 0 {
+		if now.Sub(l.start) >= time.Second {
+			l.start = now
+			l.count = 0
+		}
+		if l.count >= l.MessageRate {
+			return false
+		}
+	}
+
+	if l.SlidingWindowRate > 0 {
+		if now.Sub(l.winStart) >= l.SlidingWindowDuration {
+			l.winStart = now
+			l.winCount = 0
+		}
+		if l.winCount >= l.SlidingWindowRate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// take records a message that's been sent. It returns true if the message
+// has filled up the sliding window.
+func (l *limiter) take() bool {
+	if l == nil {
+		return false
+	}
+
+	l.count++
+	l.winCount++
+	return l.SlidingWindowRate > 0 && l.winCount == l.SlidingWindowRate
+}
+
+// scheduler is a blocking function that perpetually moves the messages queued by running
+// campaigns (pipes) to the workers. In every round, each campaign can send as many messages
+// as its priority (weighted round robin), unless the global limits, its messenger's limits,
+// or its own limits have been reached, in which case, it's skipped.
+func (m *Manager) scheduler() {
+	for {
+		if m.schedule() > 0 {
+			continue
+		}
+
+		// There's nothing to send, or all limits have been reached. Wait for new
+		// messages or for the limits to be reset.
+		select {
+		case <-m.schedQ:
+		case <-time.After(schedInterval):
+		}
+	}
+}
+
+// schedule runs a round of scheduling and returns the number of messages
+// moved to the workers.
+func (m *Manager) schedule() int {
+	n := 0
+	for _, p := range m.activePipes() {
+		for i := 0; i < max(p.camp.Priority, 1); i++ {
+			if !m.dispatch(p) {
+				break
+			}
+			n++
+		}
+	}
+
+	return n
+}
+
+// dispatch moves the next queued message of a pipe to the workers if the limits
+// allow it. Messages to domains that have reached their limits are held back in
+// the pipe, up to a batch of them, while the other messages continue to be sent.
+// It returns false if there are no messages or a limit has been reached.
+func (m *Manager) dispatch(p *pipe) bool {
+	var (
+		now     = time.Now()
+		msgrLim = m.msgrLimiters[p.camp.Messenger]
+
+		// Messages of stopped campaigns are discarded by the workers
+		// and don't count towards the limits.
+		stopped = p.stopped.Load()
+	)
+	if !stopped && (!m.limiter.ready(now) || !msgrLim.ready(now) || !p.limiter.ready(now) ||
+		!m.messengerReady(p.camp.Messenger)) {
+		return false
+	}
+
+	// Messages that the messenger couldn't take earlier go first, followed by
+	// held back messages whose domains are ready, and then new messages.
+	msg, ok := p.popRequeued()
+	if !ok {
+		msg, ok = m.nextDeferred(p, now, stopped)
+	}
+	if !ok {
+		if p.numDeferred >= m.cfg.BatchSize {
+			return false
+		}
+
+		select {
+		case msg = <-p.msgQ:
+		default:
+			return false
+		}
+
+		if d := msgDomain(msg); !stopped && !m.domainLimiters[d].ready(now) {
+			p.deferred[d] = append(p.deferred[d], msg)
+			p.numDeferred++
+			p.countDomain(d, 0, 1)
+			return true
+		}
+	}
+
+	if !stopped {
+		for _, l := range []*limiter{m.limiter, msgrLim, p.limiter} {
+			if l.take() {
+				m.log.Printf("messages exceeded (%d) for the %s window (%v since %s). waiting for %s.",
+					l.winCount, l.name, l.SlidingWindowDuration, l.winStart.Format(time.RFC822Z),
+					(l.SlidingWindowDuration - now.Sub(l.winStart)).Round(time.Second))
+			}
+		}
+
+		d := msgDomain(msg)
+		if dl, has := m.domainLimiters[d]; has {
+			dl.take()
+			p.countDomain(d, 1, 0)
+		}
+	}
+
+	m.campMsgQ <- msg
+	return true
+}
+
+// messengerReady checks whether a messenger can take campaign messages.
+func (m *Manager) messengerReady(name string) bool {
+	if t, ok := m.messengers[name].(Throttler); ok {
+		return t.Ready()
+	}
+	return true
+}
+
+// nextDeferred removes and returns the first held back message of a pipe
+// whose domain is below its limit, or any held back message if the pipe
+// has been stopped.
+func (m *Manager) nextDeferred(p *pipe, now time.Time, stopped bool) (CampaignMessage, bool) {
+	if p.numDeferred == 0 {
+		return CampaignMessage{}, false
+	}
+
+	for domain, msgs := range p.deferred {
+		if !stopped && !m.domainLimiters[domain].ready(now) {
+			continue
+		}
+
+		msg := msgs[0]
+		if len(msgs) == 1 {
+			delete(p.deferred, domain)
+		} else {
+			p.deferred[domain] = msgs[1:]
+		}
+		p.numDeferred--
+		p.countDomain(domain, 0, -1)
+
+		return msg, true
+	}
+
+	return CampaignMessage{}, false
+}
+
+// msgDomain returns the lowercased domain of a message's recipient.
+func msgDomain(msg CampaignMessage) string {
+	e := msg.Subscriber.Email
+	return strings.ToLower(e[strings.LastIndexByte(e, '@')+1:])
+}
+
+// activePipes returns the running campaigns ordered by their priority.
+func (m *Manager) activePipes() []*pipe {
+	m.pipesMut.RLock()
+	out := make([]*pipe, 0, len(m.pipes))
+	for _, p := range m.pipes {
+		out = append(out, p)
+	}
+	m.pipesMut.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].camp.Priority != out[j].camp.Priority {
+			return out[i].camp.Priority > out[j].camp.Priority
+		}
+		return out[i].camp.ID < out[j].camp.ID
+	})
+
+	return out
+}
+
+// notifySched notifies the scheduler of new messages.
+func (m *Manager) notifySched() {
+	select {
+	case m.schedQ <- struct{}{}:
+	default:
+	}
+}
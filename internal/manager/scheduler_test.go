@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestNewLimiter(t *testing.T) {
+	cases := []struct {
+		name string
+		l    RateLimit
+		nil  bool
+		win  int
+	}{
+		{"no limits", RateLimit{}, true, 0},
+		{"message rate", RateLimit{MessageRate: 10}, false, 0},
+		{"sliding window", RateLimit{SlidingWindowRate: 100, SlidingWindowDuration: time.Hour}, false, 100},
+		{"window of a second", RateLimit{SlidingWindowRate: 100, SlidingWindowDuration: time.Second}, true, 0},
+		{"window without a duration", RateLimit{MessageRate: 10, SlidingWindowRate: 100}, false, 0},
+	}
+
+	for _, c := range cases {
+		l := newLimiter(c.name, c.l)
+		if (l == nil) != c.nil {
+			t.Errorf("%s: got limiter %v", c.name, l)
+			continue
+		}
+		if l != nil && l.SlidingWindowRate != c.win {
+			t.Errorf("%s: expected window rate %d, got %d", c.name, c.win, l.SlidingWindowRate)
+		}
+	}
+}
+
+func TestLimiterMessageRate(t *testing.T) {
+	var (
+		l   = newLimiter("test", RateLimit{MessageRate: 2})
+		now = l.start
+	)
+
+	for i := 0; i < 2; i++ {
+		if !l.ready(now) {
+			t.Fatalf("expected message %d to be ready", i)
+		}
+		l.take()
+	}
+	if l.ready(now.Add(time.Millisecond * 999)) {
+		t.Fatal("expected the message rate to be reached")
+	}
+
+	// The count is reset every second.
+	if !l.ready(now.Add(time.Second)) {
+		t.Fatal("expected the message rate to be reset")
+	}
+}
+
+func TestLimiterSlidingWindow(t *testing.T) {
+	var (
+		l   = newLimiter("test", RateLimit{MessageRate: 10, SlidingWindowRate: 3, SlidingWindowDuration: time.Minute})
+		now = l.start
+	)
+
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		if !l.ready(now) {
+			t.Fatalf("expected message %d to be ready", i)
+		}
+
+		// The message that fills up the window is reported.
+		if full := l.take(); full != (i == 2) {
+			t.Errorf("message %d: expected full = %v, got %v", i, i == 2, full)
+		}
+	}
+
+	if l.ready(now.Add(time.Second * 10)) {
+		t.Fatal("expected the sliding window to be full")
+	}
+	if !l.ready(l.winStart.Add(time.Minute)) {
+		t.Fatal("expected the sliding window to be reset")
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *limiter
+	if !l.ready(time.Now()) || l.take() {
+		t.Error("expected a nil limiter to have no limits")
+	}
+}
+
+func newTestScheduler(cfg Config) *Manager {
+	cfg.Concurrency = 1
+	return New(cfg, &fakeStore{}, nil, log.New(io.Discard, "", 0))
+}
+
+// queueTestMessages queues n messages on a pipe for the scheduler.
+func queueTestMessages(p *pipe, n int) {
+	for i := 0; i < n; i++ {
+		s := sub(i + 1)
+		s.Email = "a@b.com"
+
+		p.wg.Add(1)
+		p.msgQ <- CampaignMessage{Campaign: p.camp, Subscriber: s, pipe: p}
+	}
+}
+
+func TestScheduleWeightedRoundRobin(t *testing.T) {
+	var (
+		m    = newTestScheduler(Config{MessageRate: 1000})
+		high = newTestPipe(m, 0)
+		low  = newTestPipe(m, 0)
+	)
+	high.camp.Priority = 3
+	low.camp.ID, low.camp.Priority = 2, 1
+	m.pipes = map[int]*pipe{1: high, 2: low}
+
+	queueTestMessages(high, 5)
+	queueTestMessages(low, 5)
+
+	// In every round, each campaign sends as many messages as its priority,
+	// the higher priorities first.
+	for i, exp := range [][]int{{1, 1, 1, 2}, {1, 1, 2}, {2}, {2}, {2}} {
+		if n := m.schedule(); n != len(exp) {
+			t.Fatalf("round %d: expected %d messages, got %d", i, len(exp), n)
+		}
+		for _, id := range exp {
+			if msg := <-m.campMsgQ; msg.Campaign.ID != id {
+				t.Fatalf("round %d: expected a message of campaign %d, got %d", i, id, msg.Campaign.ID)
+			}
+		}
+	}
+
+	if n := m.schedule(); n != 0 {
+		t.Errorf("expected no messages, got %d", n)
+	}
+}
+
+func TestScheduleRateLimits(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  Config
+		camp RateLimit
+		exp  int
+	}{
+		{"global message rate", Config{MessageRate: 3}, RateLimit{}, 3},
+		{"global sliding window", Config{MessageRate: 100, SlidingWindow: true,
+			SlidingWindowRate: 4, SlidingWindowDuration: time.Hour}, RateLimit{}, 4},
+		{"messenger limit", Config{MessageRate: 100, MessengerLimits: map[string]RateLimit{
+			"email": {MessageRate: 2}}}, RateLimit{}, 2},
+		{"campaign limit", Config{MessageRate: 100}, RateLimit{MessageRate: 5}, 5},
+	}
+
+	for _, c := range cases {
+		var (
+			m = newTestScheduler(c.cfg)
+			p = newTestPipe(m, 0)
+		)
+		p.camp.Priority = 10
+		p.limiter = newLimiter("campaign", c.camp)
+		m.pipes = map[int]*pipe{1: p}
+		queueTestMessages(p, 10)
+
+		n := 0
+		for r := m.schedule(); r > 0; r = m.schedule() {
+			n += r
+		}
+		if n != c.exp {
+			t.Errorf("%s: expected %d messages within the limits, got %d", c.name, c.exp, n)
+		}
+	}
+}
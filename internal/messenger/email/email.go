@@ -7,6 +7,7 @@ import (
 	"net/smtp"
 	"net/textproto"
 	"strings"
+	"time"
 
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/smtppool/v2"
@@ -24,6 +25,7 @@ const (
 type Server struct {
 	// Name is a unique identifier for the server.
 	Name          string            `json:"name"`
+	UUID          string            `json:"uuid"`
 	Username      string            `json:"username"`
 	Password      string            `json:"password"`
 	AuthProtocol  string            `json:"auth_protocol"`
@@ -36,6 +38,15 @@ type Server struct {
 	//lint:ignore SA5008 ,squash is needed by koanf/mapstructure config unmarshal.
 	smtppool.Opt `json:",squash"`
 
+	// Warm-up plan: the number of messages the server can send on each day
+	// starting from WarmupStart (YYYY-MM-DD), eg: "500, 1000, 2000".
+	WarmupEnabled bool   `json:"warmup_enabled"`
+	WarmupStart   string `json:"warmup_start"`
+	WarmupVolumes string `json:"warmup_volumes"`
+
+	warmupStart   time.Time
+	warmupVolumes []int
+
 	pool *smtppool.Pool
 }
 
@@ -43,20 +54,36 @@ type Server struct {
 type Emailer struct {
 	servers []*Server
 	name    string
+	warmup  *Warmup
 }
 
 // New returns an SMTP e-mail Messenger backend with the given SMTP servers.
 // Group indicates whether the messenger represents a group of SMTP servers (1 or more)
-// that are used as a round-robin pool, or a single server.
-func New(name string, servers ...Server) (*Emailer, error) {
+// that are used as a round-robin pool, or a single server. The daily volumes of servers
+// that are being warmed up are counted in w, which is required if there are any.
+func New(name string, w *Warmup, servers ...Server) (*Emailer, error) {
 	e := &Emailer{
 		servers: make([]*Server, 0, len(servers)),
 		name:    name,
+		warmup:  w,
 	}
 
 	for _, srv := range servers {
 		s := srv
 
+		if s.WarmupEnabled && w != nil {
+			vols, err := ParseWarmupVolumes(s.WarmupVolumes)
+			if err != nil {
+				return nil, err
+			}
+			start, err := time.ParseInLocation("2006-01-02", s.WarmupStart, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SMTP warm-up start date '%s'", s.WarmupStart)
+			}
+			s.warmupVolumes = vols
+			s.warmupStart = start
+		}
+
 		var auth smtp.Auth
 		switch s.AuthProtocol {
 		case "cram":
@@ -107,18 +134,28 @@ func (e *Emailer) Name() string {
 	return e.name
 }
 
+// Ready checks whether any of the servers can send campaign messages, that is,
+// all of them haven't sent their warm-up volumes for the day.
+func (e *Emailer) Ready() bool {
+	if e.warmup == nil {
+		return true
+	}
+
+	now := time.Now()
+	for _, s := range e.servers {
+		if e.warmup.available(s, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Push pushes a message to the server.
 func (e *Emailer) Push(m models.Message) error {
-	// If there are more than one SMTP servers, send to a random
-	// one from the list.
-	var (
-		ln  = len(e.servers)
-		srv *Server
-	)
-	if ln > 1 {
-		srv = e.servers[rand.Intn(ln)]
-	} else {
-		srv = e.servers[0]
+	srv := e.pick(m.Campaign != nil)
+	if srv == nil {
+		return warmupErr{}
 	}
 
 	// Are there attachments?
@@ -189,7 +226,47 @@ func (e *Emailer) Push(m models.Message) error {
 		}
 	}
 
-	return srv.pool.Send(em)
+	// Messages that weren't sent don't count towards the server's warm-up volume.
+	if err := srv.pool.Send(em); err != nil {
+		if e.warmup != nil {
+			e.warmup.refund(srv, time.Now())
+		}
+		return err
+	}
+
+	return nil
+}
+
+// pick returns the server to send a message with. If there are more than one SMTP
+// servers, it's a random one from the list, skipping the servers that have sent their
+// warm-up volumes for the day. If all of them have, campaign messages (isCamp) are held
+// back (nil is returned) while other messages, eg: transactional ones, are sent anyway.
+func (e *Emailer) pick(isCamp bool) *Server {
+	ln := len(e.servers)
+	if e.warmup == nil {
+		if ln > 1 {
+			return e.servers[rand.Intn(ln)]
+		}
+		return e.servers[0]
+	}
+
+	var (
+		now = time.Now()
+		off = rand.Intn(ln)
+	)
+	for i := range ln {
+		if s := e.servers[(off+i)%ln]; e.warmup.take(s, now) {
+			return s
+		}
+	}
+
+	if isCamp {
+		return nil
+	}
+
+	s := e.servers[off]
+	e.warmup.force(s, now)
+	return s
 }
 
 // Flush flushes the message queue to the server.
@@ -202,5 +279,8 @@ func (e *Emailer) Close() error {
 	for _, s := range e.servers {
 		s.pool.Close()
 	}
+	if e.warmup != nil {
+		e.warmup.Save()
+	}
 	return nil
 }
@@ -0,0 +1,214 @@
+package email
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interval at which the warm-up counts are saved.
+const warmupSaveInterval = time.Second * 10
+
+// WarmupStore persists the number of messages sent in a day by the SMTP
+// servers that are being warmed up.
+type WarmupStore interface {
+	GetWarmupCounts(day time.Time) (map[string]int, error)
+	AddWarmupCounts(day time.Time, counts map[string]int) error
+}
+
+// Warmup keeps count of the messages sent today by the SMTP servers that are
+// being warmed up. It's shared by all e-mail messengers so that a server that's
+// a part of multiple messengers (eg: "email" and "email-primary") is counted once.
+type Warmup struct {
+	store WarmupStore
+	log   *log.Logger
+
+	// Today's counts by server UUID, and the counts that are yet to be saved.
+	day   time.Time
+	sent  map[string]int
+	dirty map[string]int
+	mu    sync.Mutex
+}
+
+// warmupErr is returned by Push when all the servers of a messenger have sent
+// their warm-up volumes for the day. It's a temporary error and the campaign
+// manager holds back the message and retries it later.
+type warmupErr struct{}
+
+func (warmupErr) Error() string {
+	return "all SMTP servers have reached their daily warm-up volumes"
+}
+
+// Throttled indicates that the message can be retried later.
+func (warmupErr) Throttled() bool {
+	return true
+}
+
+// NewWarmup returns a Warmup that loads today's counts from the store and
+// saves them periodically.
+func NewWarmup(st WarmupStore, lo *log.Logger) *Warmup {
+	w := &Warmup{store: st, log: lo}
+	w.reset(today(time.Now()))
+
+	go func() {
+		for range time.Tick(warmupSaveInterval) {
+			w.Save()
+		}
+	}()
+
+	return w
+}
+
+// ParseWarmupVolumes parses a comma separated list of daily message volumes,
+// eg: "500, 1000, 2000".
+func ParseWarmupVolumes(s string) ([]int, error) {
+	var out []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 1 {
+			return nil, errors.New("invalid warm-up volume: " + v)
+		}
+		out = append(out, n)
+	}
+
+	return out, nil
+}
+
+// Save saves the counts that haven't been saved yet.
+func (w *Warmup) Save() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.save()
+}
+
+// take counts a message sent by a server if it hasn't sent its warm-up volume
+// for the day. It returns false if it has.
+func (w *Warmup) take(s *Server, now time.Time) bool {
+	limit := s.warmupLimit(now)
+	if limit < 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.checkDay(now)
+	if w.sent[s.UUID] >= limit {
+		return false
+	}
+	w.sent[s.UUID]++
+	w.dirty[s.UUID]++
+
+	return true
+}
+
+// refund uncounts a message that a server counted with take or force
+// but couldn't send.
+func (w *Warmup) refund(s *Server, now time.Time) {
+	if s.warmupLimit(now) < 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// The message was counted on the previous day, whose counts are gone.
+	if !today(now).Equal(w.day) || w.sent[s.UUID] < 1 {
+		return
+	}
+
+	w.sent[s.UUID]--
+	if n := w.dirty[s.UUID] - 1; n != 0 {
+		w.dirty[s.UUID] = n
+	} else {
+		delete(w.dirty, s.UUID)
+	}
+}
+
+// force counts a message sent by a server regardless of its warm-up volume.
+func (w *Warmup) force(s *Server, now time.Time) {
+	if s.warmupLimit(now) < 0 {
+		return
+	}
+
+	w.mu.Lock()
+	w.checkDay(now)
+	w.sent[s.UUID]++
+	w.dirty[s.UUID]++
+	w.mu.Unlock()
+}
+
+// available checks whether a server can send more messages today.
+func (w *Warmup) available(s *Server, now time.Time) bool {
+	limit := s.warmupLimit(now)
+	if limit < 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.checkDay(now)
+	return w.sent[s.UUID] < limit
+}
+
+// checkDay saves the counts of the previous day and starts
+// counting afresh when the day changes.
+func (w *Warmup) checkDay(now time.Time) {
+	if d := today(now); !d.Equal(w.day) {
+		w.save()
+		w.reset(d)
+	}
+}
+
+func (w *Warmup) reset(day time.Time) {
+	w.day = day
+	w.dirty = map[string]int{}
+
+	counts, err := w.store.GetWarmupCounts(day)
+	if err != nil {
+		w.log.Printf("error loading SMTP warm-up counts: %v", err)
+		counts = map[string]int{}
+	}
+	w.sent = counts
+}
+
+func (w *Warmup) save() {
+	if len(w.dirty) == 0 {
+		return
+	}
+
+	if err := w.store.AddWarmupCounts(w.day, w.dirty); err != nil {
+		w.log.Printf("error saving SMTP warm-up counts: %v", err)
+		return
+	}
+	w.dirty = map[string]int{}
+}
+
+// warmupLimit returns the number of messages the server can send on the day,
+// or -1 if there's no limit, that is, the server isn't being warmed up or its
+// warm-up is over.
+func (s *Server) warmupLimit(now time.Time) int {
+	if len(s.warmupVolumes) == 0 {
+		return -1
+	}
+
+	// Days before the start are considered the first day.
+	day := max(int(math.Round(today(now).Sub(s.warmupStart).Hours()/24)), 0)
+	if day >= len(s.warmupVolumes) {
+		return -1
+	}
+
+	return s.warmupVolumes[day]
+}
+
+// today returns the start of the (local) day.
+func today(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+}
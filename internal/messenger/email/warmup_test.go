@@ -0,0 +1,62 @@
+package email
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+type fakeWarmupStore struct {
+	added map[string]int
+}
+
+func (s *fakeWarmupStore) GetWarmupCounts(day time.Time) (map[string]int, error) {
+	return map[string]int{}, nil
+}
+
+func (s *fakeWarmupStore) AddWarmupCounts(day time.Time, counts map[string]int) error {
+	for k, v := range counts {
+		s.added[k] += v
+	}
+	return nil
+}
+
+func TestWarmupRefund(t *testing.T) {
+	var (
+		now = time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+		st  = &fakeWarmupStore{added: map[string]int{}}
+		w   = &Warmup{store: st, log: log.New(io.Discard, "", 0)}
+		s   = &Server{UUID: "a", warmupVolumes: []int{2, 2}, warmupStart: today(now)}
+	)
+	w.reset(today(now))
+
+	if !w.take(s, now) || !w.take(s, now) {
+		t.Fatal("expected the warm-up volume to be available")
+	}
+	if w.take(s, now) {
+		t.Fatal("expected the warm-up volume to be exhausted")
+	}
+
+	// A message that failed is uncounted and another one can be sent.
+	w.refund(s, now)
+	if !w.available(s, now) || !w.take(s, now) {
+		t.Fatal("expected the refunded message to be available")
+	}
+
+	w.refund(s, now)
+	w.Save()
+	if n := st.added["a"]; n != 1 {
+		t.Errorf("expected 1 saved message, got %d", n)
+	}
+
+	// A message counted on the previous day isn't refunded from the next day's count.
+	next := now.Add(24 * time.Hour)
+	if !w.take(s, next) {
+		t.Fatal("expected the next day's warm-up volume to be available")
+	}
+	w.refund(s, now)
+	if n := w.sent["a"]; n != 1 {
+		t.Errorf("expected 1 message on the next day, got %d", n)
+	}
+}
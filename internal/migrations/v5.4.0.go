@@ -0,0 +1,343 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/koanf/v2"
+	"github.com/knadh/stuffbin"
+)
+
+// V5_4_0 adds autoresponder drip sequences, durable webhook deliveries,
+// the webhook delivery log, automation rules, the campaign send log,
+// campaign resends, A/B testing of campaigns, sending campaigns in
+// subscribers' local time, campaign priorities and rate limits, per-domain
+// rate limits, SMTP server warm-up, recurring campaigns, RSS/Atom feed
+// campaigns, quiet hours, subscriber segments, campaign exclusions, and
+// frequency capping.
+func V5_4_0(db *sqlx.DB, fs stuffbin.FileSystem, ko *koanf.Koanf, lo *log.Logger) error {
+	// Sequences and their ordered, delayed steps.
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS autoresponder_sequences (
+			id SERIAL PRIMARY KEY,
+			uuid uuid NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			trigger_on_confirm BOOLEAN NOT NULL DEFAULT true,
+			enabled BOOLEAN NOT NULL DEFAULT true,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_ar_seqs_list_id ON autoresponder_sequences(list_id);
+
+		CREATE TABLE IF NOT EXISTS autoresponder_steps (
+			id SERIAL PRIMARY KEY,
+			sequence_id INTEGER NOT NULL REFERENCES autoresponder_sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			position INTEGER NOT NULL DEFAULT 0,
+			delay INTERVAL NOT NULL DEFAULT '0',
+			UNIQUE(sequence_id, campaign_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_ar_steps_camp_id ON autoresponder_steps(campaign_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Pending sends of sequence steps that are picked up by the scheduler.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS autoresponder_schedule (
+			id BIGSERIAL PRIMARY KEY,
+			step_id INTEGER NOT NULL REFERENCES autoresponder_steps(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			send_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			UNIQUE(campaign_id, subscriber_id, list_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_ar_schedule_send_at ON autoresponder_schedule(send_at);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Pending webhook deliveries and the dead-letter queue of failed deliveries.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			uuid uuid NOT NULL UNIQUE,
+			endpoint_uuid TEXT NOT NULL,
+			event TEXT NOT NULL,
+			payload JSONB NOT NULL DEFAULT '{}',
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next ON webhook_deliveries(endpoint_uuid, next_attempt_at);
+
+		CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+			id BIGSERIAL PRIMARY KEY,
+			uuid uuid NOT NULL UNIQUE,
+			endpoint_uuid TEXT NOT NULL,
+			event TEXT NOT NULL,
+			payload JSONB NOT NULL DEFAULT '{}',
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			failed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_dead_letters_endpoint ON webhook_dead_letters(endpoint_uuid);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Log of webhook delivery attempts and its retention setting.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_delivery_log (
+			id BIGSERIAL PRIMARY KEY,
+			endpoint_uuid TEXT NOT NULL,
+			delivery_id BIGINT NULL,
+			delivery_uuid uuid NOT NULL,
+			event TEXT NOT NULL,
+			payload JSONB NOT NULL DEFAULT '{}',
+			attempt INT NOT NULL DEFAULT 1,
+			status INT NOT NULL DEFAULT 0,
+			response TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			latency_ms INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_delivery_log_endpoint ON webhook_delivery_log(endpoint_uuid, created_at);
+		CREATE INDEX IF NOT EXISTS idx_webhook_delivery_log_date ON webhook_delivery_log(created_at);
+
+		INSERT INTO settings (key, value, updated_at)
+			VALUES ('maintenance.webhook_log', '{"enabled": true, "retention_days": 30}', NOW())
+			ON CONFLICT (key) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Automation rules and the log of their runs.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS automation_rules (
+			id SERIAL PRIMARY KEY,
+			uuid uuid NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT true,
+			trigger TEXT NOT NULL,
+			trigger_attrib TEXT NOT NULL DEFAULT '',
+			condition TEXT NOT NULL DEFAULT '',
+			actions JSONB NOT NULL DEFAULT '[]',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS automation_logs (
+			id BIGSERIAL PRIMARY KEY,
+			rule_id INTEGER NOT NULL REFERENCES automation_rules(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			event TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_automation_logs_rule ON automation_logs(rule_id, created_at);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Per-recipient log of campaign messages and its setting.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS campaign_sends (
+			id BIGSERIAL PRIMARY KEY,
+			campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			messenger TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_campaign_sends_camp ON campaign_sends(campaign_id, subscriber_id);
+		CREATE INDEX IF NOT EXISTS idx_campaign_sends_sub ON campaign_sends(subscriber_id);
+		CREATE INDEX IF NOT EXISTS idx_campaign_sends_date ON campaign_sends(created_at);
+
+		INSERT INTO settings (key, value, updated_at)
+			VALUES ('maintenance.send_log', '{"enabled": false, "retention_days": 90}', NOW())
+			ON CONFLICT (key) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Resends of finished campaigns to a subset of their recipients.
+	_, err = db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS resend_of INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS resend_audience TEXT NULL;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// A/B test settings and variants of campaigns.
+	_, err = db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_percent INT NOT NULL DEFAULT 0;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_metric TEXT NOT NULL DEFAULT 'opens';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_wait INT NOT NULL DEFAULT 240;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_tested_at TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_winner_id INTEGER NULL;
+
+		CREATE TABLE IF NOT EXISTS campaign_variants (
+			id SERIAL PRIMARY KEY,
+			campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			label TEXT NOT NULL,
+			subject TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL DEFAULT '',
+			sent INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_camp_variants_camp_id ON campaign_variants(campaign_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Local time sending of campaigns.
+	_, err = db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS local_send BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS local_timezone TEXT NOT NULL DEFAULT 'UTC';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS local_wave_until TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS local_sent_until TIMESTAMP WITH TIME ZONE NULL;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Campaign priorities, campaign, messenger, and recipient domain rate limits.
+	_, err = db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS priority INT NOT NULL DEFAULT 5;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS message_rate INT NOT NULL DEFAULT 0;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS sliding_window_rate INT NOT NULL DEFAULT 0;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS sliding_window_duration TEXT NOT NULL DEFAULT '1h';
+
+		INSERT INTO settings (key, value, updated_at)
+			VALUES ('app.messenger_limits', '[]', NOW()), ('app.domain_limits', '[]', NOW())
+			ON CONFLICT (key) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Recurring campaigns and their runs.
+	_, err = db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS recurrence TEXT NOT NULL DEFAULT '';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS recurrence_next TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS parent_id INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE;
+		CREATE INDEX IF NOT EXISTS idx_camps_parent_id ON campaigns(parent_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// RSS/Atom feed campaigns.
+	_, err = db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS feed_url TEXT NOT NULL DEFAULT '';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS feed_interval TEXT NOT NULL DEFAULT '1h';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS feed_min_items INT NOT NULL DEFAULT 1;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS feed_last_guid TEXT NOT NULL DEFAULT '';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS feed_last_published TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS feed_last_run TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS feed JSONB NOT NULL DEFAULT '{}';
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Global and per-campaign quiet hours.
+	_, err = db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS quiet_hours JSONB NOT NULL DEFAULT '{}';
+
+		INSERT INTO settings (key, value, updated_at)
+			VALUES ('app.quiet_hours', '{"enabled": false, "start": "22:00", "end": "07:00", "days": [], "timezone": ""}', NOW())
+			ON CONFLICT (key) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Saved subscriber segments and the segments of campaigns.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS segments (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			query TEXT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS campaign_segments (
+			id BIGSERIAL PRIMARY KEY,
+			campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			segment_id INTEGER NULL REFERENCES segments(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			segment_name TEXT NOT NULL DEFAULT ''
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_camp_segments_id ON campaign_segments (campaign_id, segment_id);
+		CREATE INDEX IF NOT EXISTS idx_camp_segments_camp_id ON campaign_segments(campaign_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Subscribers excluded from campaigns.
+	_, err = db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS exclusions JSONB NOT NULL
+			DEFAULT '{"lists": [], "segments": [], "sent_within_days": 0}';
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Global frequency capping of campaign messages per subscriber.
+	_, err = db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS frequency_cap_exempt BOOLEAN NOT NULL DEFAULT false;
+
+		CREATE TABLE IF NOT EXISTS frequency_sends (
+			id BIGSERIAL PRIMARY KEY,
+			campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			capped BOOLEAN NOT NULL DEFAULT false,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_frequency_sends_sub ON frequency_sends(subscriber_id, created_at);
+		CREATE INDEX IF NOT EXISTS idx_frequency_sends_camp ON frequency_sends(campaign_id) WHERE capped;
+
+		INSERT INTO settings (key, value, updated_at)
+			VALUES ('app.frequency_cap', '{"enabled": false, "max": 3, "window": "24h"}', NOW())
+			ON CONFLICT (key) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Daily counts of SMTP servers being warmed up.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS smtp_warmup (
+			server_uuid      TEXT NOT NULL,
+			day              DATE NOT NULL,
+			sent             INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (server_uuid, day)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/knadh/listmonk/internal/i18n"
+	"github.com/knadh/listmonk/internal/webhooks"
 	"github.com/knadh/listmonk/models"
 	"github.com/lib/pq"
 	"golang.org/x/text/cases"
@@ -73,6 +74,9 @@ type Options struct {
 	UpdateListDateStmt *sql.Stmt
 	PostCB             func(subject string, data any) error
 
+	// DispatchWebhook is an optional callback for dispatching webhook events.
+	DispatchWebhook func(event string, data any)
+
 	DomainBlocklist []string
 	DomainAllowlist []string
 }
@@ -181,6 +185,19 @@ func (im *Importer) NewSession(opt SessionOpt) (*Session, error) {
 	}
 
 	s.log.Printf("processing '%s'", opt.Filename)
+
+	if im.opt.DispatchWebhook != nil {
+		im.opt.DispatchWebhook(webhooks.EventImportStarted, map[string]any{
+			"import": map[string]any{
+				"name":                opt.Filename,
+				"mode":                opt.Mode,
+				"subscription_status": opt.SubStatus,
+				"overwrite":           opt.Overwrite,
+				"list_ids":            opt.ListIDs,
+			},
+		})
+	}
+
 	return s, nil
 }
 
@@ -243,7 +260,8 @@ func (im *Importer) incrementImportCount(n int) {
 	im.Unlock()
 }
 
-// sendNotif sends admin notifications for import completions.
+// sendNotif sends admin notifications and dispatches the webhook event
+// for import completions.
 func (im *Importer) sendNotif(status string) error {
 	var (
 		s   = im.GetStats()
@@ -255,6 +273,18 @@ func (im *Importer) sendNotif(status string) error {
 		}
 		subject = fmt.Sprintf("%s: %s import", cases.Title(language.Und).String(status), s.Name)
 	)
+
+	if im.opt.DispatchWebhook != nil {
+		im.opt.DispatchWebhook(webhooks.EventImportFinished, map[string]any{
+			"import": map[string]any{
+				"name":     s.Name,
+				"status":   status,
+				"imported": s.Imported,
+				"total":    s.Total,
+			},
+		})
+	}
+
 	return im.opt.PostCB(subject, out)
 }
 
@@ -0,0 +1,193 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Filter restricts the events that are delivered to an endpoint based on the
+// contents of the event data. All the conditions that are set have to match.
+// Events that don't carry the data a condition checks (eg: list IDs in a campaign
+// event) don't match it.
+type Filter struct {
+	// At least one of the tags should be on the event's campaign.
+	// Matched against campaign.tags or campaign_tags.
+	CampaignTags []string
+
+	// At least one of the lists should be in the event's lists.
+	// Matched against list_ids or subscriber.lists[].id.
+	ListIDs []int
+
+	// All the attributes should be equal to the ones of the event's subscriber.
+	// Keys can be dot separated paths to nested attributes, eg: address.city.
+	// Matched against subscriber.attribs.
+	Attribs map[string]any
+}
+
+// isEmpty returns true if the filter has no conditions.
+func (f Filter) isEmpty() bool {
+	return len(f.CampaignTags) == 0 && len(f.ListIDs) == 0 && len(f.Attribs) == 0
+}
+
+// match checks whether event data (unmarshalled from JSON) matches the filter.
+func (f Filter) match(data map[string]any) bool {
+	if len(f.CampaignTags) > 0 {
+		tags, ok := lookup(data, "campaign.tags")
+		if !ok {
+			tags, ok = lookup(data, "campaign_tags")
+		}
+		if !ok || !containsAny(tags, f.CampaignTags) {
+			return false
+		}
+	}
+
+	if len(f.ListIDs) > 0 {
+		want := make([]string, 0, len(f.ListIDs))
+		for _, id := range f.ListIDs {
+			want = append(want, toJSON(id))
+		}
+
+		ids, ok := lookup(data, "list_ids")
+		if !ok {
+			ids, ok = listIDs(data)
+		}
+		if !ok || !containsAny(ids, want) {
+			return false
+		}
+	}
+
+	if len(f.Attribs) > 0 {
+		attribs, ok := lookup(data, "subscriber.attribs")
+		if !ok {
+			return false
+		}
+		m, _ := attribs.(map[string]any)
+
+		for k, v := range flatten("", f.Attribs) {
+			got, ok := lookup(m, k)
+			if !ok || toJSON(got) != toJSON(v) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// project returns a copy of the data with only the given dot separated field
+// paths, eg: subscriber.email. Fields that don't exist in the data are ignored.
+func project(data map[string]any, fields []string) map[string]any {
+	out := make(map[string]any, len(fields))
+	for _, f := range fields {
+		v, ok := lookup(data, f)
+		if !ok {
+			continue
+		}
+
+		// Create the parent maps of the field in the output.
+		var (
+			parts = strings.Split(f, ".")
+			m     = out
+		)
+		for _, p := range parts[:len(parts)-1] {
+			child, ok := m[p].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				m[p] = child
+			}
+			m = child
+		}
+		m[parts[len(parts)-1]] = v
+	}
+
+	return out
+}
+
+// lookup returns the value at a dot separated path in a map.
+func lookup(m map[string]any, path string) (any, bool) {
+	var v any = m
+	for _, p := range strings.Split(path, ".") {
+		mp, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = mp[p]; !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// listIDs returns the IDs of subscriber.lists[] in event data.
+func listIDs(data map[string]any) (any, bool) {
+	v, ok := lookup(data, "subscriber.lists")
+	if !ok {
+		return nil, false
+	}
+	lists, ok := v.([]any)
+	if !ok {
+		return nil, false
+	}
+
+	ids := make([]any, 0, len(lists))
+	for _, l := range lists {
+		if m, ok := l.(map[string]any); ok {
+			ids = append(ids, m["id"])
+		}
+	}
+
+	return ids, true
+}
+
+// containsAny checks whether a JSON array value has any of the given values.
+func containsAny(v any, want []string) bool {
+	items, ok := v.([]any)
+	if !ok {
+		return false
+	}
+
+	for _, i := range items {
+		var s string
+		if str, ok := i.(string); ok {
+			s = str
+		} else {
+			s = toJSON(i)
+		}
+
+		for _, w := range want {
+			if s == w {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// flatten flattens nested maps into a map with dot separated keys.
+func flatten(prefix string, m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+
+		if child, ok := v.(map[string]any); ok {
+			for ck, cv := range flatten(k, child) {
+				out[ck] = cv
+			}
+			continue
+		}
+		out[k] = v
+	}
+
+	return out
+}
+
+// toJSON returns the JSON representation of a value so that values of different
+// Go types (eg: int and float64 numbers) can be compared.
+func toJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
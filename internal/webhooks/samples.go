@@ -0,0 +1,196 @@
+package webhooks
+
+import (
+	"fmt"
+	"time"
+)
+
+// Sample identifiers used in test payloads.
+const (
+	sampleSubUUID  = "e44b4135-1e1d-40c5-8a30-0f9a886c2884"
+	sampleListUUID = "a7d4c5e2-3f1b-4d8e-9c6a-2b5f8e1d4c7a"
+	sampleCampUUID = "57702beb-6fae-4355-a324-c2fd5b59a549"
+	sampleLinkUUID = "3b8f1c2d-7e4a-4f6b-9d1c-5a2e8b7f0c3d"
+)
+
+// SamplePayload returns a payload for the given event with realistic sample
+// data in the same shape as the data of real events. It's used for test-firing
+// events to endpoints.
+func SamplePayload(event string) (Payload, error) {
+	var (
+		now  = time.Now().UTC()
+		camp = map[string]any{
+			"id":   1,
+			"uuid": sampleCampUUID,
+			"name": "Welcome newsletter",
+			"type": "regular",
+			"tags": []string{"newsletter"},
+		}
+	)
+
+	var data any
+	switch event {
+	case EventSubscriberCreated, EventSubscriberUpdated:
+		d := map[string]any{
+			"subscriber": map[string]any{
+				"id":         1,
+				"uuid":       sampleSubUUID,
+				"email":      "john@example.com",
+				"name":       "John Doe",
+				"attribs":    map[string]any{"city": "Bengaluru"},
+				"status":     "enabled",
+				"created_at": now,
+				"updated_at": now,
+			},
+			"list_ids": []int{1},
+		}
+		if event == EventSubscriberUpdated {
+			d["previous_attribs"] = map[string]any{"city": "Mumbai"}
+		}
+		data = d
+
+	case EventSubscriberUnsubscribed:
+		data = map[string]any{
+			"subscriber_ids": []int{1},
+			"list_ids":       []int{1},
+			"list_uuids":     []string{sampleListUUID},
+		}
+
+	case EventSubscriberConfirmed:
+		data = map[string]any{
+			"subscriber_uuid": sampleSubUUID,
+			"list_uuids":      []string{sampleListUUID},
+		}
+
+	case EventSubscriberBlocklisted:
+		data = map[string]any{
+			"subscriber_ids": []int{1},
+		}
+
+	case EventSubscriberDeleted:
+		data = map[string]any{
+			"subscriber_ids":   []int{1},
+			"subscriber_uuids": []string{sampleSubUUID},
+		}
+
+	case EventCampaignStarted:
+		data = map[string]any{"campaign": camp}
+
+	case EventCampaignFinished:
+		camp["sent"] = 1000
+		data = map[string]any{"campaign": camp}
+
+	case EventCampaignPaused, EventCampaignCancelled, EventCampaignScheduled:
+		camp["send_at"] = now.Add(time.Hour)
+		data = map[string]any{"campaign": camp}
+
+	case EventCampaignMessageFailed:
+		delete(camp, "type")
+		data = map[string]any{
+			"campaign": camp,
+			"subscriber": map[string]any{
+				"id":    1,
+				"uuid":  sampleSubUUID,
+				"email": "john@example.com",
+			},
+			"messenger": "email",
+			"error":     "554 5.7.1 message rejected",
+		}
+
+	case EventListCreated, EventListUpdated:
+		data = map[string]any{
+			"list": map[string]any{
+				"id":          1,
+				"uuid":        sampleListUUID,
+				"name":        "Newsletter",
+				"type":        "public",
+				"optin":       "double",
+				"status":      "active",
+				"tags":        []string{"newsletter"},
+				"description": "Weekly newsletter",
+				"created_at":  now,
+				"updated_at":  now,
+			},
+		}
+
+	case EventListDeleted:
+		data = map[string]any{
+			"lists": []map[string]any{
+				{"id": 1, "uuid": sampleListUUID, "name": "Newsletter"},
+			},
+		}
+
+	case EventImportStarted:
+		data = map[string]any{
+			"import": map[string]any{
+				"name":                "subscribers.csv",
+				"mode":                "subscribe",
+				"subscription_status": "confirmed",
+				"overwrite":           true,
+				"list_ids":            []int{1},
+			},
+		}
+
+	case EventImportFinished:
+		data = map[string]any{
+			"import": map[string]any{
+				"name":     "subscribers.csv",
+				"status":   "finished",
+				"imported": 1000,
+				"total":    1000,
+			},
+		}
+
+	case EventTxSent, EventTxFailed:
+		d := map[string]any{
+			"subscriber": map[string]any{
+				"id":    1,
+				"uuid":  sampleSubUUID,
+				"email": "john@example.com",
+			},
+			"to":        []string{"john@example.com"},
+			"subject":   "Your order has shipped",
+			"messenger": "email",
+		}
+		if event == EventTxFailed {
+			d["error"] = "554 5.7.1 message rejected"
+		}
+		data = d
+
+	case EventLinkClick:
+		data = map[string]any{
+			"link_uuid":       sampleLinkUUID,
+			"campaign_uuid":   sampleCampUUID,
+			"subscriber_uuid": sampleSubUUID,
+			"url":             "https://example.com",
+			"campaign_tags":   []string{"newsletter"},
+		}
+
+	case EventEmailOpen:
+		data = map[string]any{
+			"campaign_uuid":   sampleCampUUID,
+			"subscriber_uuid": sampleSubUUID,
+			"campaign_tags":   []string{"newsletter"},
+		}
+
+	case EventBounce:
+		data = map[string]any{
+			"bounce": map[string]any{
+				"type":            "hard",
+				"source":          "api",
+				"email":           "john@example.com",
+				"subscriber_uuid": sampleSubUUID,
+				"campaign_uuid":   sampleCampUUID,
+			},
+		}
+
+	default:
+		return Payload{}, fmt.Errorf("unknown event: %s", event)
+	}
+
+	return Payload{
+		Event:     event,
+		Timestamp: now,
+		Data:      data,
+	}, nil
+}
@@ -3,17 +3,84 @@ package webhooks
 import (
 	"bytes"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+const (
+	// Default number of times a failed delivery is retried before it's
+	// moved to the dead-letter queue.
+	defaultMaxRetries = 8
+
+	// Retry backoff: retryBaseDelay * 2^(attempt-1), capped at retryMaxDelay.
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = 6 * time.Hour
+
+	// Interval at which the store is polled for pending and due deliveries.
+	pollInterval = 5 * time.Second
+
+	// Max number of deliveries fetched from the store in one poll.
+	pollBatchSize = 500
+
+	// Duration for which a delivery fetched from the store is reserved
+	// so that it isn't picked up again while it's being sent.
+	deliveryLease = 5 * time.Minute
+
+	// Max number of bytes of an endpoint's response body that's recorded
+	// in the delivery log.
+	maxResponseSnippet = 1024
+
+	// Max number of jobs queued for an endpoint. Events for an endpoint whose
+	// queue is full are deferred (persisted) or dropped.
+	queueSize = 1000
+
+	// Max number of dispatched events waiting to be persisted in the store.
+	// When it's full, Dispatch waits for up to persistWait for room, after
+	// which it persists the events itself.
+	persistQueueSize = 1000
+	persistWait      = 5 * time.Second
+
+	// Failed persists are retried with an exponential backoff starting at
+	// persistRetryDelay, capped at persistMaxRetryDelay. Dispatch gives up
+	// on persisting an event itself after persistAttempts.
+	persistRetryDelay    = time.Second
+	persistMaxRetryDelay = time.Minute
+	persistAttempts      = 3
+
+	// Default number of concurrent requests (and workers) per endpoint.
+	defaultMaxConns = 5
+
+	// Default interval at which batched events are sent if the batch
+	// isn't full.
+	defaultBatchInterval = 5 * time.Second
+)
+
+// Headers sent with every webhook request.
+const (
+	// Unique ID of a delivery. It's the same across retries of a delivery,
+	// which receivers can use to discard duplicates.
+	HeaderID = "X-Webhook-ID"
+
+	// Unix timestamp (seconds) of the request. It's part of the signed content
+	// so that receivers can reject stale, replayed requests.
+	HeaderTimestamp = "X-Webhook-Timestamp"
+
+	// HMAC-SHA256 signature(s) of the timestamp and the body.
+	HeaderSignature = "X-Webhook-Signature"
+)
+
 // Event type constants.
 const (
 	EventSubscriberCreated      = "subscriber.created"
@@ -23,8 +90,22 @@ const (
 	EventSubscriberBlocklisted  = "subscriber.blocklisted"
 	EventSubscriberDeleted      = "subscriber.deleted"
 
-	EventCampaignStarted  = "campaign.started"
-	EventCampaignFinished = "campaign.finished"
+	EventCampaignStarted       = "campaign.started"
+	EventCampaignFinished      = "campaign.finished"
+	EventCampaignPaused        = "campaign.paused"
+	EventCampaignCancelled     = "campaign.cancelled"
+	EventCampaignScheduled     = "campaign.scheduled"
+	EventCampaignMessageFailed = "campaign.message_failed"
+
+	EventListCreated = "list.created"
+	EventListUpdated = "list.updated"
+	EventListDeleted = "list.deleted"
+
+	EventImportStarted  = "import.started"
+	EventImportFinished = "import.finished"
+
+	EventTxSent   = "tx.sent"
+	EventTxFailed = "tx.failed"
 
 	EventLinkClick = "tracking.link_click"
 	EventEmailOpen = "tracking.email_open"
@@ -41,6 +122,17 @@ var AllEvents = []string{
 	EventSubscriberDeleted,
 	EventCampaignStarted,
 	EventCampaignFinished,
+	EventCampaignPaused,
+	EventCampaignCancelled,
+	EventCampaignScheduled,
+	EventCampaignMessageFailed,
+	EventListCreated,
+	EventListUpdated,
+	EventListDeleted,
+	EventImportStarted,
+	EventImportFinished,
+	EventTxSent,
+	EventTxFailed,
 	EventLinkClick,
 	EventEmailOpen,
 	EventBounce,
@@ -55,13 +147,111 @@ type Payload struct {
 
 // Opt represents configuration for a single webhook endpoint.
 type Opt struct {
-	UUID     string
-	Name     string
-	URL      string
-	Secret   string
-	Events   []string
+	UUID    string
+	Name    string
+	URL     string
+	Secret  string
+	Events  []string
+	Timeout time.Duration
+
+	// MaxRetries is the number of times a failed delivery is retried before
+	// it's moved to the dead-letter queue. 0 disables retries and nil uses
+	// the default.
+	MaxRetries *int
+
+	// MaxConns is the number of workers that deliver events to the endpoint
+	// concurrently, and the max number of connections to it.
 	MaxConns int
-	Timeout  time.Duration
+
+	// BatchSize, if > 1, enables batching. Events are collected and sent
+	// in a single request as a JSON array when BatchSize events have been
+	// collected or every BatchInterval, whichever is earlier.
+	BatchSize     int
+	BatchInterval time.Duration
+
+	// Filter restricts the events delivered to the endpoint by their data.
+	Filter Filter
+
+	// Fields are dot separated paths of the fields in the event data that are
+	// sent to the endpoint, eg: subscriber.email. If empty, all fields are sent.
+	Fields []string
+
+	// PreviousSecret is a secret that has been rotated out. Requests are
+	// signed with both secrets until PreviousSecretExpiry so that receivers
+	// can switch to the new secret without rejecting any requests.
+	PreviousSecret       string
+	PreviousSecretExpiry time.Time
+}
+
+// Delivery represents a persisted delivery of an event to an endpoint.
+type Delivery struct {
+	ID            int64
+	UUID          string
+	EndpointUUID  string
+	Event         string
+	Payload       []byte
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+}
+
+// Attempt represents a single attempt at delivering an event to an endpoint.
+// DeliveryID is 0 for deliveries that aren't persisted.
+type Attempt struct {
+	EndpointUUID string
+	DeliveryID   int64
+	DeliveryUUID string
+	Event        string
+	Payload      []byte
+	Attempt      int
+	StatusCode   int
+	Response     string
+	Error        string
+	Latency      time.Duration
+}
+
+// Store persists webhook deliveries so that they survive restarts and
+// can be retried. Deliveries that fail permanently are moved to a
+// dead-letter queue.
+type Store interface {
+	// CreateDelivery persists a new pending delivery and returns its ID.
+	CreateDelivery(d Delivery) (int64, error)
+
+	// NextDeliveries returns up to limit pending deliveries of the given endpoints
+	// that are due, reserving them for the lease duration.
+	NextDeliveries(endpointUUIDs []string, limit int, lease time.Duration) ([]Delivery, error)
+
+	// RetryDelivery records a failed attempt and schedules the next one.
+	RetryDelivery(d Delivery) error
+
+	// CompleteDelivery removes a successfully sent delivery.
+	CompleteDelivery(id int64) error
+
+	// FailDelivery moves a delivery to the dead-letter queue.
+	FailDelivery(d Delivery) error
+
+	// LogAttempt records a delivery attempt in the delivery log.
+	LogAttempt(a Attempt) error
+}
+
+// BatchItem is an event in the JSON array body of a batched request.
+// ID is the event's delivery ID which, as the X-Webhook-ID header of
+// non-batched requests, is the same across retries.
+type BatchItem struct {
+	ID        string          `json:"id"`
+	Event     string          `json:"event"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// TestResult represents the response of an endpoint to a test event.
+type TestResult struct {
+	Payload    json.RawMessage `json:"payload"`
+	StatusCode int             `json:"status_code"`
+	Status     string          `json:"status"`
+	Headers    http.Header     `json:"headers"`
+	Body       string          `json:"body"`
+	LatencyMS  int64           `json:"latency_ms"`
 }
 
 // EndpointStats holds metrics for a single endpoint.
@@ -74,16 +264,36 @@ type EndpointStats struct {
 	LastDispatch    time.Time `json:"last_dispatch,omitempty"`
 	LastError       string    `json:"last_error,omitempty"`
 	LastErrorTime   time.Time `json:"last_error_time,omitempty"`
+
+	// Number of jobs waiting in the endpoint's queue and the queue's capacity.
+	QueueDepth int `json:"queue_depth"`
+	QueueSize  int `json:"queue_size"`
+	Workers    int `json:"workers"`
 }
 
 // endpoint represents a configured webhook endpoint.
 type endpoint struct {
-	uuid   string
-	name   string
-	url    string
-	secret string
-	events map[string]bool
-	client *http.Client
+	uuid       string
+	name       string
+	url        string
+	secret     string
+	prevSecret string
+	prevExpiry time.Time
+	events     map[string]bool
+	filter     Filter
+	fields     []string
+	maxRetries int
+	maxConns   int
+	client     *http.Client
+
+	// Batching is enabled if batchSize > 1. Jobs from the queue are
+	// collected into batches that are sent by the endpoint's workers.
+	batchSize     int
+	batchInterval time.Duration
+	batches       chan []dispatchJob
+
+	// Jobs to be delivered to the endpoint by its workers.
+	queue chan dispatchJob
 
 	// Stats tracking.
 	totalDispatched atomic.Int64
@@ -95,82 +305,455 @@ type endpoint struct {
 	mu              sync.RWMutex
 }
 
-// dispatchJob represents a job to dispatch a webhook.
+// dispatchJob represents a job to dispatch a webhook. delivery is
+// set if the job is persisted in the store.
 type dispatchJob struct {
-	ep      *endpoint
-	payload []byte
+	ep       *endpoint
+	id       string
+	event    string
+	payload  []byte
+	delivery *Delivery
+}
+
+// sendResult holds the response of an endpoint to a request.
+type sendResult struct {
+	statusCode int
+	body       string
+	latency    time.Duration
+}
+
+// errPermanent wraps delivery errors that should not be retried.
+type errPermanent struct {
+	err error
+}
+
+func (e errPermanent) Error() string {
+	return e.err.Error()
 }
 
 // Manager handles webhook dispatch.
 type Manager struct {
 	endpoints []*endpoint
+	epMap     map[string]*endpoint
+	store     Store
 	log       *log.Logger
-	ch        chan dispatchJob
 	closeCh   chan struct{}
+
+	// Dispatched jobs to be persisted in the store before they're queued
+	// for their endpoints. persistDone is closed when the persister exits.
+	persistQ    chan dispatchJob
+	persistDone chan struct{}
+
+	// IDs of persisted deliveries that are queued or being sent.
+	inFlight   map[int64]struct{}
+	inFlightMu sync.Mutex
 }
 
-// New creates a new webhook Manager.
-func New(opts []Opt, lo *log.Logger) (*Manager, error) {
+// New creates a new webhook Manager. If st is not nil, deliveries are
+// persisted in it and failed deliveries are retried with an exponential
+// backoff. Otherwise, every event is delivered once on a best-effort basis.
+func New(opts []Opt, st Store, lo *log.Logger) (*Manager, error) {
 	m := &Manager{
 		endpoints: make([]*endpoint, 0, len(opts)),
+		epMap:     make(map[string]*endpoint, len(opts)),
+		store:     st,
 		log:       lo,
-		ch:        make(chan dispatchJob, 1000),
 		closeCh:   make(chan struct{}),
+		inFlight:  make(map[int64]struct{}),
 	}
 
 	for _, o := range opts {
-		events := make(map[string]bool, len(o.Events))
-		for _, e := range o.Events {
-			events[e] = true
+		ep := newEndpoint(o)
+		m.endpoints = append(m.endpoints, ep)
+		m.epMap[ep.uuid] = ep
+
+		// Start the endpoint's workers. Each endpoint has its own queue and
+		// workers so that a slow endpoint doesn't hold up deliveries to others.
+		if ep.batchSize > 1 {
+			go m.batcher(ep)
+		}
+		for i := 0; i < ep.maxConns; i++ {
+			if ep.batchSize > 1 {
+				go m.batchWorker(ep)
+			} else {
+				go m.worker(ep)
+			}
+		}
+	}
+
+	// Start persisting dispatched events and polling the store for pending
+	// deliveries and retries.
+	if m.store != nil {
+		m.persistQ = make(chan dispatchJob, persistQueueSize)
+		m.persistDone = make(chan struct{})
+		go m.persister()
+		go m.poll()
+	}
+
+	return m, nil
+}
+
+// newEndpoint creates an endpoint from its configuration, applying defaults.
+func newEndpoint(o Opt) *endpoint {
+	events := make(map[string]bool, len(o.Events))
+	for _, e := range o.Events {
+		events[e] = true
+	}
+
+	timeout := o.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	maxConns := o.MaxConns
+	if maxConns <= 0 {
+		maxConns = defaultMaxConns
+	}
+
+	maxRetries := defaultMaxRetries
+	if o.MaxRetries != nil {
+		maxRetries = max(*o.MaxRetries, 0)
+	}
+
+	batchInterval := o.BatchInterval
+	if batchInterval <= 0 {
+		batchInterval = defaultBatchInterval
+	}
+
+	return &endpoint{
+		uuid:       o.UUID,
+		name:       o.Name,
+		url:        o.URL,
+		secret:     o.Secret,
+		prevSecret: o.PreviousSecret,
+		prevExpiry: o.PreviousSecretExpiry,
+		events:     events,
+		filter:     o.Filter,
+		fields:     o.Fields,
+		maxRetries: maxRetries,
+		maxConns:   maxConns,
+		queue:      make(chan dispatchJob, queueSize),
+
+		batchSize:     o.BatchSize,
+		batchInterval: batchInterval,
+		batches:       make(chan []dispatchJob),
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost:   maxConns,
+				MaxConnsPerHost:       maxConns,
+				ResponseHeaderTimeout: timeout,
+				IdleConnTimeout:       timeout,
+			},
+		},
+	}
+}
+
+// Test sends a sample payload of the given event to an endpoint synchronously,
+// signed with the endpoint's secret, and returns the endpoint's response.
+// A non-2xx response is not an error. The endpoint doesn't have to be
+// subscribed to the event.
+func Test(o Opt, event string) (TestResult, error) {
+	p, err := SamplePayload(event)
+	if err != nil {
+		return TestResult{}, err
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return TestResult{}, err
+	}
+
+	// Send the event as a batch of one to batched endpoints.
+	ep := newEndpoint(o)
+	if ep.batchSize > 1 {
+		b, err = makeBatch([]dispatchJob{{id: newID(), payload: b}})
+		if err != nil {
+			return TestResult{}, err
 		}
+	}
 
-		timeout := o.Timeout
-		if timeout == 0 {
-			timeout = 5 * time.Second
+	req, err := ep.newRequest(newID(), b)
+	if err != nil {
+		return TestResult{}, err
+	}
+
+	start := time.Now()
+	resp, err := ep.client.Do(req)
+	if err != nil {
+		return TestResult{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSnippet))
+	if err != nil {
+		return TestResult{}, err
+	}
+
+	return TestResult{
+		Payload:    b,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Headers:    resp.Header,
+		Body:       string(body),
+		LatencyMS:  time.Since(start).Milliseconds(),
+	}, nil
+}
+
+// worker processes dispatch jobs from an endpoint's queue.
+func (m *Manager) worker(ep *endpoint) {
+	for {
+		select {
+		case job := <-ep.queue:
+			res, err := m.send(job.ep, job.id, job.payload)
+			if m.store != nil {
+				m.logAttempt(job, res, err)
+			}
+			if job.delivery != nil {
+				m.complete(job, err)
+			}
+		case <-m.closeCh:
+			return
 		}
+	}
+}
 
-		maxConns := o.MaxConns
-		if maxConns == 0 {
-			maxConns = 5
+// batcher collects dispatch jobs from an endpoint's queue into batches and
+// hands them over to the endpoint's workers when a batch is full or on every
+// batch interval. If all the workers are busy, it blocks, and the queue fills up.
+func (m *Manager) batcher(ep *endpoint) {
+	t := time.NewTicker(ep.batchInterval)
+	defer t.Stop()
+
+	batch := make([]dispatchJob, 0, ep.batchSize)
+	for {
+		select {
+		case job := <-ep.queue:
+			batch = append(batch, job)
+			if len(batch) < ep.batchSize {
+				continue
+			}
+		case <-t.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-m.closeCh:
+			return
 		}
 
-		ep := &endpoint{
-			uuid:   o.UUID,
-			name:   o.Name,
-			url:    o.URL,
-			secret: o.Secret,
-			events: events,
-			client: &http.Client{
-				Timeout: timeout,
-				Transport: &http.Transport{
-					MaxIdleConnsPerHost:   maxConns,
-					MaxConnsPerHost:       maxConns,
-					ResponseHeaderTimeout: timeout,
-					IdleConnTimeout:       timeout,
-				},
-			},
+		select {
+		case ep.batches <- batch:
+		case <-m.closeCh:
+			return
+		}
+		batch = make([]dispatchJob, 0, ep.batchSize)
+	}
+}
+
+// batchWorker sends batches of dispatch jobs collected by an endpoint's batcher.
+func (m *Manager) batchWorker(ep *endpoint) {
+	for {
+		select {
+		case batch := <-ep.batches:
+			m.sendBatch(ep, batch)
+		case <-m.closeCh:
+			return
 		}
-		m.endpoints = append(m.endpoints, ep)
 	}
+}
 
-	// Start worker goroutine.
-	go m.worker()
+// sendBatch sends a batch of jobs to an endpoint in a single request. The
+// outcome of the request is recorded for every job in the batch individually,
+// so failed events are retried (and possibly batched differently) independently.
+func (m *Manager) sendBatch(ep *endpoint, batch []dispatchJob) {
+	b, err := makeBatch(batch)
 
-	return m, nil
+	var res sendResult
+	if err != nil {
+		m.log.Printf("webhook: error creating batch for %s: %v", ep.name, err)
+		ep.recordError(err.Error())
+		err = errPermanent{err}
+	} else {
+		res, err = m.send(ep, newID(), b)
+	}
+
+	for _, job := range batch {
+		if m.store != nil {
+			m.logAttempt(job, res, err)
+		}
+		if job.delivery != nil {
+			m.complete(job, err)
+		}
+	}
 }
 
-// worker processes dispatch jobs from the channel.
-func (m *Manager) worker() {
+// makeBatch returns the JSON array body of a batched request with the
+// payloads of the given jobs.
+func makeBatch(jobs []dispatchJob) ([]byte, error) {
+	items := make([]BatchItem, 0, len(jobs))
+	for _, j := range jobs {
+		var it BatchItem
+		if err := json.Unmarshal(j.payload, &it); err != nil {
+			return nil, err
+		}
+		it.ID = j.id
+
+		items = append(items, it)
+	}
+
+	return json.Marshal(items)
+}
+
+// poll periodically fetches pending deliveries that are due from the store
+// and queues them. These are deliveries that are due for a retry, replayed
+// ones, or ones that were left over by a restart or a full queue.
+func (m *Manager) poll() {
+	uuids := make([]string, 0, len(m.endpoints))
+	for _, ep := range m.endpoints {
+		uuids = append(uuids, ep.uuid)
+	}
+
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+
 	for {
 		select {
-		case job := <-m.ch:
-			m.send(job.ep, job.payload)
+		case <-t.C:
 		case <-m.closeCh:
 			return
 		}
+
+		dels, err := m.store.NextDeliveries(uuids, pollBatchSize, deliveryLease)
+		if err != nil {
+			m.log.Printf("webhook: error fetching pending deliveries: %v", err)
+			continue
+		}
+
+		for _, d := range dels {
+			ep, ok := m.epMap[d.EndpointUUID]
+			if !ok || !m.track(d.ID) {
+				continue
+			}
+
+			// A full queue means that the endpoint is slow. Don't wait on it
+			// and hold up other endpoints' deliveries. The delivery is picked
+			// up again once its lease expires.
+			if !ep.enqueue(dispatchJob{ep: ep, id: d.UUID, event: d.Event, payload: d.Payload, delivery: &d}) {
+				m.untrack(d.ID)
+			}
+		}
+	}
+}
+
+// complete records the outcome of a persisted delivery attempt in the store.
+// Failed deliveries are retried with an exponential backoff until the endpoint's
+// max retries are exhausted, after which they're moved to the dead-letter queue.
+func (m *Manager) complete(job dispatchJob, sendErr error) {
+	d := job.delivery
+	defer m.untrack(d.ID)
+
+	d.Attempts++
+	if sendErr == nil {
+		if err := m.store.CompleteDelivery(d.ID); err != nil {
+			m.log.Printf("webhook: error completing delivery %d: %v", d.ID, err)
+		}
+		return
+	}
+
+	d.LastError = sendErr.Error()
+
+	var perm errPermanent
+	if errors.As(sendErr, &perm) || d.Attempts > job.ep.maxRetries {
+		m.log.Printf("webhook: delivery %d to %s failed after %d attempt(s), moving to dead-letter queue", d.ID, job.ep.name, d.Attempts)
+		if err := m.store.FailDelivery(*d); err != nil {
+			m.log.Printf("webhook: error moving delivery %d to dead-letter queue: %v", d.ID, err)
+		}
+		return
+	}
+
+	d.NextAttemptAt = time.Now().Add(retryBackoff(d.Attempts))
+	if err := m.store.RetryDelivery(*d); err != nil {
+		m.log.Printf("webhook: error scheduling retry for delivery %d: %v", d.ID, err)
+	}
+}
+
+// logAttempt records the outcome of a delivery attempt in the store's delivery log.
+func (m *Manager) logAttempt(job dispatchJob, res sendResult, sendErr error) {
+	a := Attempt{
+		EndpointUUID: job.ep.uuid,
+		DeliveryUUID: job.id,
+		Event:        job.event,
+		Payload:      job.payload,
+		Attempt:      1,
+		StatusCode:   res.statusCode,
+		Response:     res.body,
+		Latency:      res.latency,
+	}
+	if job.delivery != nil {
+		a.DeliveryID = job.delivery.ID
+		a.Attempt = job.delivery.Attempts + 1
+	}
+	if sendErr != nil {
+		a.Error = sendErr.Error()
+	}
+
+	if err := m.store.LogAttempt(a); err != nil {
+		m.log.Printf("webhook: error logging delivery attempt for %s: %v", job.ep.name, err)
 	}
 }
 
+// track marks a persisted delivery as in-flight. It returns false if
+// the delivery is already in-flight.
+func (m *Manager) track(id int64) bool {
+	m.inFlightMu.Lock()
+	defer m.inFlightMu.Unlock()
+
+	if _, ok := m.inFlight[id]; ok {
+		return false
+	}
+	m.inFlight[id] = struct{}{}
+	return true
+}
+
+// untrack removes a persisted delivery from the in-flight set.
+func (m *Manager) untrack(id int64) {
+	m.inFlightMu.Lock()
+	delete(m.inFlight, id)
+	m.inFlightMu.Unlock()
+}
+
+// decodeData decodes the data of a marshalled payload into a map. Non-object
+// data results in an empty map.
+func decodeData(b []byte) map[string]any {
+	var p struct {
+		Data map[string]any `json:"data"`
+	}
+	_ = json.Unmarshal(b, &p)
+
+	if p.Data == nil {
+		return map[string]any{}
+	}
+	return p.Data
+}
+
+// retryBackoff returns the delay before the next attempt of a delivery
+// that has failed n times.
+func retryBackoff(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+
+	d := retryBaseDelay
+	for i := 1; i < n; i++ {
+		d *= 2
+		if d >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+
+	return d
+}
+
 // Dispatch sends an event to all subscribed endpoints.
 func (m *Manager) Dispatch(event string, data any) {
 	if len(m.endpoints) == 0 {
@@ -189,46 +772,179 @@ func (m *Manager) Dispatch(event string, data any) {
 		return
 	}
 
+	// Event data decoded into a map for evaluating endpoint filters and field
+	// projections. It's decoded only if an endpoint has either.
+	var fields map[string]any
+
 	for _, ep := range m.endpoints {
-		if ep.events[event] {
+		if !ep.events[event] {
+			continue
+		}
+
+		body := b
+		if !ep.filter.isEmpty() || len(ep.fields) > 0 {
+			if fields == nil {
+				fields = decodeData(b)
+			}
+
+			if !ep.filter.match(fields) {
+				continue
+			}
+
+			if len(ep.fields) > 0 {
+				pb, err := json.Marshal(Payload{
+					Event:     payload.Event,
+					Timestamp: payload.Timestamp,
+					Data:      project(fields, ep.fields),
+				})
+				if err != nil {
+					m.log.Printf("webhook: error marshalling payload for %s: %v", ep.name, err)
+					continue
+				}
+				body = pb
+			}
+		}
+
+		job := dispatchJob{ep: ep, id: newID(), event: event, payload: body}
+
+		// Persisting the delivery is left to the persister so that the caller
+		// isn't held up by the DB. If the persister is backed up, the caller waits
+		// for a while and then persists the delivery itself.
+		if m.store != nil {
 			select {
-			case m.ch <- dispatchJob{ep: ep, payload: b}:
-			default:
-				m.log.Printf("webhook: dispatch queue full, dropping event %s for %s", event, ep.name)
+			case m.persistQ <- job:
+				continue
+			case <-time.After(persistWait):
+				m.log.Printf("webhook: persist queue full, persisting event %s for %s in the dispatch", event, ep.name)
+			case <-m.closeCh:
+			}
+
+			if !m.persist(&job, deliveryLease, persistAttempts) {
+				continue
 			}
 		}
+
+		m.queue(job)
 	}
 }
 
-// send performs the actual HTTP POST to the endpoint.
-func (m *Manager) send(ep *endpoint, payload []byte) {
+// persister persists the dispatched jobs in the store and queues them for
+// their endpoints. On close, the jobs that are still waiting are persisted
+// to be delivered by the poller (after a restart) and it exits.
+func (m *Manager) persister() {
+	defer close(m.persistDone)
+
+	for {
+		select {
+		case job := <-m.persistQ:
+			if m.persist(&job, deliveryLease, 0) {
+				m.queue(job)
+			}
+
+		case <-m.closeCh:
+			for {
+				select {
+				case job := <-m.persistQ:
+					m.persist(&job, 0, 1)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// persist creates a pending delivery for a job in the store. The delivery is
+// reserved for the lease duration so that the poller doesn't pick it up while
+// it's in the queue. Failed attempts are retried with a backoff until the given
+// number of attempts (0 for no limit) are exhausted or the manager is closed.
+// It returns false if the delivery couldn't be persisted.
+func (m *Manager) persist(job *dispatchJob, lease time.Duration, attempts int) bool {
+	d := Delivery{
+		UUID:         job.id,
+		EndpointUUID: job.ep.uuid,
+		Event:        job.event,
+		Payload:      job.payload,
+	}
+
+	wait := persistRetryDelay
+	for n := 1; ; n++ {
+		d.NextAttemptAt = time.Now().Add(lease)
+		id, err := m.store.CreateDelivery(d)
+		if err == nil {
+			d.ID = id
+			job.delivery = &d
+			return true
+		}
+
+		if n == attempts {
+			m.log.Printf("webhook: error persisting delivery of %s for %s, dropping it after %d attempts: %v", job.event, job.ep.name, n, err)
+			return false
+		}
+		m.log.Printf("webhook: error persisting delivery of %s for %s (attempt %d): %v", job.event, job.ep.name, n, err)
+
+		select {
+		case <-time.After(wait):
+		case <-m.closeCh:
+			m.log.Printf("webhook: dropping delivery of %s for %s that couldn't be persisted before closing", job.event, job.ep.name)
+			return false
+		}
+		wait = min(wait*2, persistMaxRetryDelay)
+	}
+}
+
+// queue adds a dispatched job to its endpoint's queue.
+func (m *Manager) queue(job dispatchJob) {
+	if job.delivery != nil {
+		m.track(job.delivery.ID)
+	}
+
+	if ep := job.ep; !ep.enqueue(job) {
+		if job.delivery != nil {
+			// The persisted delivery will be picked up by the poller once its lease expires.
+			m.untrack(job.delivery.ID)
+			m.log.Printf("webhook: dispatch queue full, deferring event %s for %s", job.event, ep.name)
+		} else {
+			m.log.Printf("webhook: dispatch queue full, dropping event %s for %s", job.event, ep.name)
+		}
+	}
+}
+
+// enqueue adds a job to the endpoint's queue. It returns false if the queue is full.
+func (ep *endpoint) enqueue(job dispatchJob) bool {
+	select {
+	case ep.queue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// send performs the actual HTTP POST to the endpoint and returns its response.
+// Errors that should not be retried are wrapped in errPermanent.
+func (m *Manager) send(ep *endpoint, id string, payload []byte) (sendResult, error) {
+	var res sendResult
+
 	// Track dispatch attempt.
 	ep.totalDispatched.Add(1)
 	ep.mu.Lock()
 	ep.lastDispatch = time.Now()
 	ep.mu.Unlock()
 
-	req, err := http.NewRequest(http.MethodPost, ep.url, bytes.NewReader(payload))
+	req, err := ep.newRequest(id, payload)
 	if err != nil {
 		m.log.Printf("webhook: error creating request for %s: %v", ep.name, err)
 		ep.recordError(err.Error())
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "listmonk")
-
-	// Add HMAC signature if secret is configured.
-	if ep.secret != "" {
-		sig := computeHMAC(payload, ep.secret)
-		req.Header.Set("X-Webhook-Signature", "sha256="+sig)
+		return res, errPermanent{err}
 	}
 
+	start := time.Now()
 	resp, err := ep.client.Do(req)
+	res.latency = time.Since(start)
 	if err != nil {
 		m.log.Printf("webhook: error sending to %s: %v", ep.name, err)
 		ep.recordError(err.Error())
-		return
+		return res, err
 	}
 	defer func() {
 		// Drain and close the body to let the Transport reuse the connection.
@@ -236,14 +952,29 @@ func (m *Manager) send(ep *endpoint, payload []byte) {
 		resp.Body.Close()
 	}()
 
+	res.statusCode = resp.StatusCode
+	if b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSnippet)); err == nil {
+		res.body = string(b)
+	}
+
 	if resp.StatusCode >= 400 {
 		m.log.Printf("webhook: non-OK response from %s: %d", ep.name, resp.StatusCode)
 		ep.recordError("HTTP " + http.StatusText(resp.StatusCode))
-		return
+
+		err := fmt.Errorf("HTTP %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+
+		// Server errors, timeouts, and rate limits are retried. Other client
+		// errors are not as they're unlikely to succeed on a retry.
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout ||
+			resp.StatusCode == http.StatusTooManyRequests {
+			return res, err
+		}
+		return res, errPermanent{err}
 	}
 
 	// Success.
 	ep.totalSuccess.Add(1)
+	return res, nil
 }
 
 // recordError records a failure and the error message.
@@ -255,16 +986,71 @@ func (ep *endpoint) recordError(errMsg string) {
 	ep.mu.Unlock()
 }
 
-// computeHMAC generates the HMAC-SHA256 signature.
-func computeHMAC(payload []byte, secret string) string {
+// newRequest creates a signed POST request with the payload to the endpoint.
+func (ep *endpoint) newRequest(id string, payload []byte) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, ep.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "listmonk")
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderTimestamp, ts)
+
+	// Add HMAC signature(s) if secret is configured.
+	if sig := ep.sign(ts, payload); sig != "" {
+		req.Header.Set(HeaderSignature, sig)
+	}
+
+	return req, nil
+}
+
+// sign returns the signature header value for a request with the given timestamp
+// and payload. While a rotated out secret is valid, the header has one signature
+// per secret separated by a comma, eg: sha256=abc,sha256=def
+func (ep *endpoint) sign(ts string, payload []byte) string {
+	if ep.secret == "" {
+		return ""
+	}
+
+	sigs := []string{"sha256=" + computeHMAC(ts, payload, ep.secret)}
+	if ep.prevSecret != "" && time.Now().Before(ep.prevExpiry) {
+		sigs = append(sigs, "sha256="+computeHMAC(ts, payload, ep.prevSecret))
+	}
+
+	return strings.Join(sigs, ",")
+}
+
+// computeHMAC generates the HMAC-SHA256 signature of "{timestamp}.{payload}".
+func computeHMAC(ts string, payload []byte, secret string) string {
 	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
 	mac.Write(payload)
 	return hex.EncodeToString(mac.Sum(nil))
 }
 
-// Close shuts down the webhook manager.
+// newID generates a random (v4) UUID for a delivery.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Close shuts down the webhook manager. It waits for the dispatched events
+// to be persisted, and so, has to be called before the store is closed.
 func (m *Manager) Close() {
 	close(m.closeCh)
+
+	if m.persistDone != nil {
+		<-m.persistDone
+	}
 }
 
 // HasEndpoints returns true if there are any configured endpoints.
@@ -286,6 +1072,9 @@ func (m *Manager) GetStats() []EndpointStats {
 			LastDispatch:    ep.lastDispatch,
 			LastError:       ep.lastError,
 			LastErrorTime:   ep.lastErrorTime,
+			QueueDepth:      len(ep.queue),
+			QueueSize:       cap(ep.queue),
+			Workers:         ep.maxConns,
 		}
 		ep.mu.RUnlock()
 	}
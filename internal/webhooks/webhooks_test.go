@@ -5,11 +5,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -25,12 +28,13 @@ func testLogger() *log.Logger {
 func TestComputeHMAC(t *testing.T) {
 	payload := []byte(`{"event":"test","data":{}}`)
 	secret := "my-secret-key"
+	ts := "1700000000"
 
-	sig := computeHMAC(payload, secret)
+	sig := computeHMAC(ts, payload, secret)
 
 	// Verify the signature manually.
 	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write(payload)
+	mac.Write([]byte(ts + "." + string(payload)))
 	expected := hex.EncodeToString(mac.Sum(nil))
 
 	if sig != expected {
@@ -38,16 +42,22 @@ func TestComputeHMAC(t *testing.T) {
 	}
 
 	// Verify that different secrets produce different signatures.
-	sig2 := computeHMAC(payload, "different-secret")
+	sig2 := computeHMAC(ts, payload, "different-secret")
 	if sig == sig2 {
 		t.Error("Different secrets should produce different signatures")
 	}
 
 	// Verify that different payloads produce different signatures.
-	sig3 := computeHMAC([]byte(`{"event":"other"}`), secret)
+	sig3 := computeHMAC(ts, []byte(`{"event":"other"}`), secret)
 	if sig == sig3 {
 		t.Error("Different payloads should produce different signatures")
 	}
+
+	// Verify that different timestamps produce different signatures.
+	sig4 := computeHMAC("1700000001", payload, secret)
+	if sig == sig4 {
+		t.Error("Different timestamps should produce different signatures")
+	}
 }
 
 // TestPayloadFormat tests that the payload is correctly formatted.
@@ -71,7 +81,7 @@ func TestPayloadFormat(t *testing.T) {
 		Timeout: 5 * time.Second,
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -136,7 +146,7 @@ func TestEventFiltering(t *testing.T) {
 		Timeout: 5 * time.Second,
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -180,7 +190,7 @@ func TestMultipleEndpoints(t *testing.T) {
 		{Name: "ep2", URL: server2.URL, Events: []string{EventSubscriberCreated}, Timeout: 5 * time.Second},
 	}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -215,7 +225,7 @@ func TestAsyncDispatch(t *testing.T) {
 		Timeout: 2 * time.Second,
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -231,15 +241,76 @@ func TestAsyncDispatch(t *testing.T) {
 	}
 }
 
+// TestSlowEndpointIsolation tests that a slow endpoint doesn't hold up
+// deliveries to other endpoints and that its queue depth is reported.
+func TestSlowEndpointIsolation(t *testing.T) {
+	var slowCount atomic.Int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowCount.Add(1)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	var fastCount atomic.Int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastCount.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+
+	opts := []Opt{
+		{Name: "slow", URL: slow.URL, Events: []string{EventSubscriberCreated}, MaxConns: 1, Timeout: 5 * time.Second},
+		{Name: "fast", URL: fast.URL, Events: []string{EventSubscriberCreated}, MaxConns: 2, Timeout: 5 * time.Second},
+	}
+
+	m, err := New(opts, nil, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	for i := 0; i < 5; i++ {
+		m.Dispatch(EventSubscriberCreated, map[string]any{"id": i})
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for (fastCount.Load() < 5 || slowCount.Load() < 1) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := fastCount.Load(); n != 5 {
+		t.Fatalf("Expected 5 requests to the fast endpoint, got %d", n)
+	}
+
+	stats := m.GetStats()
+	if stats[0].Workers != 1 || stats[1].Workers != 2 {
+		t.Errorf("Unexpected workers: %d, %d", stats[0].Workers, stats[1].Workers)
+	}
+	if stats[0].QueueSize != queueSize {
+		t.Errorf("Expected queue size %d, got %d", queueSize, stats[0].QueueSize)
+	}
+
+	// One job is being sent by the slow endpoint's only worker, the rest are queued.
+	if stats[0].QueueDepth != 4 {
+		t.Errorf("Expected slow endpoint queue depth 4, got %d", stats[0].QueueDepth)
+	}
+	if stats[1].QueueDepth != 0 {
+		t.Errorf("Expected fast endpoint queue depth 0, got %d", stats[1].QueueDepth)
+	}
+}
+
 // TestSignatureHeader tests that HMAC signature is included when secret is set.
 func TestSignatureHeader(t *testing.T) {
-	var receivedSig string
+	var receivedSig, receivedTS string
 	var receivedBody []byte
 	var mu sync.Mutex
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		mu.Lock()
 		receivedSig = r.Header.Get("X-Webhook-Signature")
+		receivedTS = r.Header.Get("X-Webhook-Timestamp")
 		receivedBody, _ = io.ReadAll(r.Body)
 		mu.Unlock()
 		w.WriteHeader(http.StatusOK)
@@ -255,7 +326,7 @@ func TestSignatureHeader(t *testing.T) {
 		Timeout: 5 * time.Second,
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -278,7 +349,7 @@ func TestSignatureHeader(t *testing.T) {
 	}
 
 	// Verify the signature is valid.
-	expectedSig := "sha256=" + computeHMAC(receivedBody, secret)
+	expectedSig := "sha256=" + computeHMAC(receivedTS, receivedBody, secret)
 	if receivedSig != expectedSig {
 		t.Errorf("Signature mismatch: got %s, want %s", receivedSig, expectedSig)
 	}
@@ -305,7 +376,7 @@ func TestNoSignatureWhenNoSecret(t *testing.T) {
 		Timeout: 5 * time.Second,
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -343,7 +414,7 @@ func TestContentTypeHeader(t *testing.T) {
 		Timeout: 5 * time.Second,
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -381,7 +452,7 @@ func TestUserAgentHeader(t *testing.T) {
 		Timeout: 5 * time.Second,
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -415,7 +486,7 @@ func TestTimeout(t *testing.T) {
 		Timeout: 100 * time.Millisecond, // Short timeout.
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -445,7 +516,7 @@ func TestErrorResponse(t *testing.T) {
 		Timeout: 5 * time.Second,
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -464,7 +535,7 @@ func TestErrorResponse(t *testing.T) {
 
 // TestNoEndpoints tests that dispatch with no endpoints is a no-op.
 func TestNoEndpoints(t *testing.T) {
-	m, err := New([]Opt{}, testLogger())
+	m, err := New([]Opt{}, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -481,7 +552,7 @@ func TestNoEndpoints(t *testing.T) {
 // TestHasEndpoints tests the HasEndpoints method.
 func TestHasEndpoints(t *testing.T) {
 	// Without endpoints.
-	m1, _ := New([]Opt{}, testLogger())
+	m1, _ := New([]Opt{}, nil, testLogger())
 	defer m1.Close()
 
 	if m1.HasEndpoints() {
@@ -494,7 +565,7 @@ func TestHasEndpoints(t *testing.T) {
 		URL:     "http://example.com",
 		Events:  []string{EventSubscriberCreated},
 		Timeout: 5 * time.Second,
-	}}, testLogger())
+	}}, nil, testLogger())
 	defer m2.Close()
 
 	if !m2.HasEndpoints() {
@@ -511,14 +582,14 @@ func TestDefaultValues(t *testing.T) {
 
 	// Create with zero values for timeout and maxconns.
 	opts := []Opt{{
-		Name:    "defaults",
-		URL:     server.URL,
-		Events:  []string{EventSubscriberCreated},
-		Timeout: 0, // Should default to 5s.
+		Name:     "defaults",
+		URL:      server.URL,
+		Events:   []string{EventSubscriberCreated},
+		Timeout:  0, // Should default to 5s.
 		MaxConns: 0, // Should default to 5.
 	}}
 
-	m, err := New(opts, testLogger())
+	m, err := New(opts, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -540,6 +611,17 @@ func TestAllEventConstants(t *testing.T) {
 		EventSubscriberDeleted:      true,
 		EventCampaignStarted:        true,
 		EventCampaignFinished:       true,
+		EventCampaignPaused:         true,
+		EventCampaignCancelled:      true,
+		EventCampaignScheduled:      true,
+		EventCampaignMessageFailed:  true,
+		EventListCreated:            true,
+		EventListUpdated:            true,
+		EventListDeleted:            true,
+		EventImportStarted:          true,
+		EventImportFinished:         true,
+		EventTxSent:                 true,
+		EventTxFailed:               true,
 		EventLinkClick:              true,
 		EventEmailOpen:              true,
 		EventBounce:                 true,
@@ -558,7 +640,7 @@ func TestAllEventConstants(t *testing.T) {
 
 // TestClose tests that Close stops the worker.
 func TestClose(t *testing.T) {
-	m, err := New([]Opt{}, testLogger())
+	m, err := New([]Opt{}, nil, testLogger())
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
@@ -569,3 +651,801 @@ func TestClose(t *testing.T) {
 	// Multiple close calls should not panic (though not recommended).
 	// This is just to ensure robustness.
 }
+
+// memStore is an in-memory Store for testing.
+type memStore struct {
+	mu        sync.Mutex
+	lastID    int64
+	pending   map[int64]Delivery
+	completed []int64
+	retried   []Delivery
+	failed    []Delivery
+	attempts  []Attempt
+}
+
+func newMemStore() *memStore {
+	return &memStore{pending: make(map[int64]Delivery)}
+}
+
+func (s *memStore) CreateDelivery(d Delivery) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	d.ID = s.lastID
+	s.pending[d.ID] = d
+	return d.ID, nil
+}
+
+func (s *memStore) NextDeliveries(uuids []string, limit int, lease time.Duration) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	eps := make(map[string]bool, len(uuids))
+	for _, u := range uuids {
+		eps[u] = true
+	}
+
+	var out []Delivery
+	for id, d := range s.pending {
+		if !eps[d.EndpointUUID] || d.NextAttemptAt.After(time.Now()) || len(out) >= limit {
+			continue
+		}
+		d.NextAttemptAt = time.Now().Add(lease)
+		s.pending[id] = d
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+func (s *memStore) RetryDelivery(d Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending[d.ID] = d
+	s.retried = append(s.retried, d)
+	return nil
+}
+
+func (s *memStore) CompleteDelivery(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, id)
+	s.completed = append(s.completed, id)
+	return nil
+}
+
+func (s *memStore) FailDelivery(d Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, d.ID)
+	s.failed = append(s.failed, d)
+	return nil
+}
+
+func (s *memStore) LogAttempt(a Attempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts = append(s.attempts, a)
+	return nil
+}
+
+// TestDurableDelivery tests that deliveries are persisted and completed on success.
+func TestDurableDelivery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	st := newMemStore()
+	m, err := New([]Opt{{
+		UUID:   "ep-1",
+		Name:   "durable",
+		URL:    server.URL,
+		Events: []string{EventSubscriberCreated},
+	}}, st, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	m.Dispatch(EventSubscriberCreated, map[string]any{"id": 1})
+	time.Sleep(200 * time.Millisecond)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.completed) != 1 || st.completed[0] != 1 {
+		t.Errorf("Expected delivery 1 to be completed, got %v", st.completed)
+	}
+	if len(st.pending) != 0 {
+		t.Errorf("Expected no pending deliveries, got %d", len(st.pending))
+	}
+}
+
+// TestDurableRetry tests that retryable failures are scheduled for a retry with a backoff.
+func TestDurableRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	st := newMemStore()
+	m, err := New([]Opt{{
+		UUID:   "ep-1",
+		Name:   "retry",
+		URL:    server.URL,
+		Events: []string{EventSubscriberCreated},
+	}}, st, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	start := time.Now()
+	m.Dispatch(EventSubscriberCreated, map[string]any{"id": 1})
+	time.Sleep(200 * time.Millisecond)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.retried) != 1 {
+		t.Fatalf("Expected 1 retry, got %d", len(st.retried))
+	}
+	d := st.retried[0]
+	if d.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", d.Attempts)
+	}
+	if d.LastError == "" {
+		t.Error("Expected last error to be recorded")
+	}
+	if d.NextAttemptAt.Before(start.Add(retryBaseDelay)) {
+		t.Errorf("Expected next attempt after %v, got %v", retryBaseDelay, d.NextAttemptAt.Sub(start))
+	}
+	if len(st.failed) != 0 {
+		t.Errorf("Expected no dead-lettered deliveries, got %d", len(st.failed))
+	}
+}
+
+// blockingStore is a memStore whose CreateDelivery blocks until it's released.
+type blockingStore struct {
+	*memStore
+	release chan struct{}
+}
+
+func (s *blockingStore) CreateDelivery(d Delivery) (int64, error) {
+	<-s.release
+	return s.memStore.CreateDelivery(d)
+}
+
+// TestDispatchDoesNotBlockOnStore tests that Dispatch doesn't wait for
+// deliveries to be persisted, and that pending deliveries are persisted on Close.
+func TestDispatchDoesNotBlockOnStore(t *testing.T) {
+	st := &blockingStore{memStore: newMemStore(), release: make(chan struct{})}
+	m, err := New([]Opt{{
+		UUID:   "ep-1",
+		Name:   "slow-store",
+		URL:    "http://127.0.0.1:1",
+		Events: []string{EventSubscriberCreated},
+	}}, st, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			m.Dispatch(EventSubscriberCreated, map[string]any{"id": i})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Dispatch blocked on the store")
+	}
+
+	// Deliveries that are still waiting are persisted on Close.
+	close(st.release)
+	m.Close()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.lastID != 3 {
+		t.Errorf("Expected 3 persisted deliveries, got %d", st.lastID)
+	}
+}
+
+// failingStore is a memStore whose CreateDelivery fails a number of times.
+type failingStore struct {
+	*memStore
+	fails atomic.Int32
+}
+
+func (s *failingStore) CreateDelivery(d Delivery) (int64, error) {
+	if s.fails.Add(-1) >= 0 {
+		return 0, errors.New("db error")
+	}
+	return s.memStore.CreateDelivery(d)
+}
+
+// TestPersistRetry tests that deliveries that fail to be persisted are retried
+// and sent once they're persisted.
+func TestPersistRetry(t *testing.T) {
+	var requestCount atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	st := &failingStore{memStore: newMemStore()}
+	st.fails.Store(1)
+	m, err := New([]Opt{{
+		UUID:   "ep-1",
+		Name:   "flaky-store",
+		URL:    server.URL,
+		Events: []string{EventSubscriberCreated},
+	}}, st, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	m.Dispatch(EventSubscriberCreated, map[string]any{"id": 1})
+
+	// The first attempt fails and the next one is after persistRetryDelay.
+	time.Sleep(persistRetryDelay / 2)
+	if n := requestCount.Load(); n != 0 {
+		t.Fatalf("Expected no requests before the delivery is persisted, got %d", n)
+	}
+
+	time.Sleep(persistRetryDelay)
+	if n := requestCount.Load(); n != 1 {
+		t.Errorf("Expected 1 request after the delivery is persisted, got %d", n)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.completed) != 1 {
+		t.Errorf("Expected 1 completed delivery, got %v", st.completed)
+	}
+}
+
+// TestBatchDelivery tests that events are sent in batches on size and interval,
+// signed over the whole batch.
+func TestBatchDelivery(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches [][]BatchItem
+	)
+	secret := "batch-secret"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if want := "sha256=" + computeHMAC(r.Header.Get(HeaderTimestamp), body, secret); r.Header.Get(HeaderSignature) != want {
+			t.Errorf("Invalid batch signature: %s", r.Header.Get(HeaderSignature))
+		}
+
+		var items []BatchItem
+		if err := json.Unmarshal(body, &items); err != nil {
+			t.Errorf("Failed to unmarshal batch: %v", err)
+		}
+
+		mu.Lock()
+		batches = append(batches, items)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	m, err := New([]Opt{{
+		Name:          "batched",
+		URL:           server.URL,
+		Secret:        secret,
+		Events:        []string{EventEmailOpen},
+		BatchSize:     3,
+		BatchInterval: 200 * time.Millisecond,
+	}}, nil, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	for i := 0; i < 5; i++ {
+		m.Dispatch(EventEmailOpen, map[string]any{"id": i})
+	}
+
+	// The first 3 events are sent right away as the batch is full.
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Errorf("Expected 1 batch of 3 events before the interval, got %v", batches)
+	}
+	mu.Unlock()
+
+	// The remaining 2 are sent on the interval.
+	time.Sleep(300 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(batches) != 2 || len(batches[1]) != 2 {
+		t.Fatalf("Expected a second batch of 2 events, got %v", batches)
+	}
+
+	ids := map[string]bool{}
+	for _, b := range batches {
+		for _, it := range b {
+			if it.Event != EventEmailOpen || it.ID == "" || len(it.Data) == 0 {
+				t.Errorf("Unexpected batch item: %+v", it)
+			}
+			ids[it.ID] = true
+		}
+	}
+	if len(ids) != 5 {
+		t.Errorf("Expected 5 unique event IDs, got %d", len(ids))
+	}
+}
+
+// TestBatchRetry tests that every event in a failed batch is retried individually.
+func TestBatchRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	st := newMemStore()
+	m, err := New([]Opt{{
+		UUID:      "ep-1",
+		Name:      "batched",
+		URL:       server.URL,
+		Events:    []string{EventLinkClick},
+		BatchSize: 2,
+	}}, st, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	m.Dispatch(EventLinkClick, map[string]any{"id": 1})
+	m.Dispatch(EventLinkClick, map[string]any{"id": 2})
+	time.Sleep(200 * time.Millisecond)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.retried) != 2 {
+		t.Fatalf("Expected 2 retries, got %d", len(st.retried))
+	}
+	if st.retried[0].ID == st.retried[1].ID {
+		t.Error("Expected the deliveries of both events to be retried")
+	}
+	if len(st.attempts) != 2 {
+		t.Errorf("Expected 2 logged attempts, got %d", len(st.attempts))
+	}
+}
+
+// TestDeadLetter tests that permanent failures and exhausted retries are dead-lettered.
+func TestDeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	st := newMemStore()
+	retries := 2
+	m, err := New([]Opt{{
+		UUID:       "ep-1",
+		Name:       "dead",
+		URL:        server.URL,
+		Events:     []string{EventSubscriberCreated},
+		MaxRetries: &retries,
+	}}, st, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	// 4xx responses are not retried.
+	m.Dispatch(EventSubscriberCreated, map[string]any{"id": 1})
+	time.Sleep(200 * time.Millisecond)
+
+	st.mu.Lock()
+	if len(st.failed) != 1 || st.failed[0].Attempts != 1 {
+		t.Errorf("Expected 1 dead-lettered delivery after 1 attempt, got %+v", st.failed)
+	}
+	st.mu.Unlock()
+
+	// Retryable errors are dead-lettered once the retries are exhausted.
+	d := &Delivery{ID: 100, EndpointUUID: "ep-1", Attempts: 2}
+	m.complete(dispatchJob{ep: m.endpoints[0], delivery: d}, errors.New("HTTP 500"))
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.failed) != 2 || st.failed[1].ID != 100 || st.failed[1].Attempts != 3 {
+		t.Errorf("Expected delivery 100 to be dead-lettered after 3 attempts, got %+v", st.failed)
+	}
+}
+
+// TestMaxRetries tests that the default max retries apply only if it isn't set.
+func TestMaxRetries(t *testing.T) {
+	zero, three := 0, 3
+	cases := []struct {
+		n   *int
+		exp int
+	}{
+		{nil, defaultMaxRetries},
+		{&zero, 0},
+		{&three, 3},
+	}
+
+	for _, c := range cases {
+		if got := newEndpoint(Opt{MaxRetries: c.n}).maxRetries; got != c.exp {
+			t.Errorf("Expected %d max retries, got %d", c.exp, got)
+		}
+	}
+}
+
+// TestPollPendingDeliveries tests that pending deliveries in the store are picked up.
+func TestPollPendingDeliveries(t *testing.T) {
+	var requestCount atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// A delivery left over from a previous run, and one for an unknown endpoint.
+	st := newMemStore()
+	st.CreateDelivery(Delivery{EndpointUUID: "ep-1", Event: EventSubscriberCreated, Payload: []byte(`{}`)})
+	st.CreateDelivery(Delivery{EndpointUUID: "ep-unknown", Event: EventSubscriberCreated, Payload: []byte(`{}`)})
+
+	m, err := New([]Opt{{
+		UUID:   "ep-1",
+		Name:   "poll",
+		URL:    server.URL,
+		Events: []string{EventSubscriberCreated},
+	}}, st, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	time.Sleep(pollInterval + 500*time.Millisecond)
+
+	if requestCount.Load() != 1 {
+		t.Errorf("Expected 1 request, got %d", requestCount.Load())
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.completed) != 1 || st.completed[0] != 1 {
+		t.Errorf("Expected delivery 1 to be completed, got %v", st.completed)
+	}
+}
+
+// TestRetryBackoff tests the exponential retry backoff.
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, retryBaseDelay},
+		{1, retryBaseDelay},
+		{2, 2 * retryBaseDelay},
+		{3, 4 * retryBaseDelay},
+		{100, retryMaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := retryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// TestLogAttempt tests that delivery attempts are recorded with the endpoint's response.
+func TestLogAttempt(t *testing.T) {
+	body := strings.Repeat("x", maxResponseSnippet+100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	st := newMemStore()
+	m, err := New([]Opt{{
+		UUID:   "ep-1",
+		Name:   "log",
+		URL:    server.URL,
+		Events: []string{EventSubscriberCreated},
+	}}, st, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	m.Dispatch(EventSubscriberCreated, map[string]any{"id": 1})
+	time.Sleep(200 * time.Millisecond)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.attempts) != 1 {
+		t.Fatalf("Expected 1 logged attempt, got %d", len(st.attempts))
+	}
+	a := st.attempts[0]
+	if a.EndpointUUID != "ep-1" || a.DeliveryID != 1 || a.Event != EventSubscriberCreated {
+		t.Errorf("Unexpected attempt: %+v", a)
+	}
+	if a.Attempt != 1 {
+		t.Errorf("Expected attempt 1, got %d", a.Attempt)
+	}
+	if a.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, a.StatusCode)
+	}
+	if len(a.Response) != maxResponseSnippet {
+		t.Errorf("Expected response snippet of %d bytes, got %d", maxResponseSnippet, len(a.Response))
+	}
+	if a.Error == "" {
+		t.Error("Expected error to be recorded")
+	}
+	if len(a.Payload) == 0 {
+		t.Error("Expected payload to be recorded")
+	}
+}
+
+// TestSamplePayload tests that every event has a sample payload.
+func TestSamplePayload(t *testing.T) {
+	for _, e := range AllEvents {
+		p, err := SamplePayload(e)
+		if err != nil {
+			t.Errorf("SamplePayload(%s): %v", e, err)
+			continue
+		}
+		if p.Event != e || p.Data == nil {
+			t.Errorf("SamplePayload(%s): unexpected payload %+v", e, p)
+		}
+	}
+
+	if _, err := SamplePayload("unknown.event"); err == nil {
+		t.Error("Expected error for unknown event")
+	}
+}
+
+// TestTestEndpoint tests synchronous test-firing of a signed sample payload.
+func TestTestEndpoint(t *testing.T) {
+	var (
+		receivedSig  string
+		receivedTS   string
+		receivedBody []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedSig = r.Header.Get("X-Webhook-Signature")
+		receivedTS = r.Header.Get("X-Webhook-Timestamp")
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("X-Receiver", "test")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	secret := "test-secret-123"
+	res, err := Test(Opt{
+		Name:   "test",
+		URL:    server.URL,
+		Secret: secret,
+	}, EventCampaignFinished)
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+
+	if res.StatusCode != http.StatusAccepted || res.Body != "ok" || res.Headers.Get("X-Receiver") != "test" {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+	if string(res.Payload) != string(receivedBody) {
+		t.Errorf("Expected payload %s, got %s", receivedBody, res.Payload)
+	}
+	if receivedSig != "sha256="+computeHMAC(receivedTS, receivedBody, secret) {
+		t.Errorf("Invalid signature: %s", receivedSig)
+	}
+
+	var p Payload
+	if err := json.Unmarshal(receivedBody, &p); err != nil {
+		t.Fatalf("Failed to unmarshal payload: %v", err)
+	}
+	if p.Event != EventCampaignFinished {
+		t.Errorf("Expected event %s, got %s", EventCampaignFinished, p.Event)
+	}
+
+	if _, err := Test(Opt{URL: server.URL}, "unknown.event"); err == nil {
+		t.Error("Expected error for unknown event")
+	}
+}
+
+// TestDeliveryHeaders tests that the delivery ID is retained across retries
+// and that the timestamp header is set.
+func TestDeliveryHeaders(t *testing.T) {
+	var (
+		ids []string
+		mu  sync.Mutex
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get(HeaderID))
+		mu.Unlock()
+
+		ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+			t.Errorf("Invalid timestamp header: %s", r.Header.Get(HeaderTimestamp))
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	st := newMemStore()
+	m, err := New([]Opt{{
+		UUID:   "ep-1",
+		Name:   "ids",
+		URL:    server.URL,
+		Events: []string{EventSubscriberCreated},
+	}}, st, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	m.Dispatch(EventSubscriberCreated, map[string]any{"id": 1})
+	m.Dispatch(EventSubscriberCreated, map[string]any{"id": 2})
+	time.Sleep(200 * time.Millisecond)
+
+	// Make the first delivery due again and wait for the poller to retry it.
+	st.mu.Lock()
+	d := st.pending[1]
+	d.NextAttemptAt = time.Now()
+	st.pending[1] = d
+	st.mu.Unlock()
+	time.Sleep(pollInterval + 500*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(ids) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(ids))
+	}
+	if ids[0] == "" || ids[0] == ids[1] {
+		t.Errorf("Expected unique delivery IDs, got %v", ids)
+	}
+	if ids[2] != d.UUID {
+		t.Errorf("Expected retry to carry delivery ID %s, got %s", d.UUID, ids[2])
+	}
+}
+
+// TestSecretRotation tests that requests are signed with both secrets while
+// the previous secret is valid.
+func TestSecretRotation(t *testing.T) {
+	ep := newEndpoint(Opt{
+		Secret:               "new",
+		PreviousSecret:       "old",
+		PreviousSecretExpiry: time.Now().Add(time.Hour),
+	})
+
+	payload := []byte(`{"event":"test"}`)
+	want := "sha256=" + computeHMAC("1", payload, "new") + ",sha256=" + computeHMAC("1", payload, "old")
+	if got := ep.sign("1", payload); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// Expired previous secret.
+	ep.prevExpiry = time.Now().Add(-time.Second)
+	want = "sha256=" + computeHMAC("1", payload, "new")
+	if got := ep.sign("1", payload); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// TestFilterMatch tests matching of endpoint filters against event data.
+func TestFilterMatch(t *testing.T) {
+	data := decodeData([]byte(`{"data": {
+		"campaign": {"id": 1, "tags": ["product", "news"]},
+		"subscriber": {"attribs": {"plan": "pro", "seats": 5, "address": {"city": "Pune"}}, "lists": [{"id": 3}]},
+		"list_ids": [1, 2]
+	}}`))
+
+	tests := []struct {
+		name   string
+		filter Filter
+		data   map[string]any
+		want   bool
+	}{
+		{"empty", Filter{}, data, true},
+		{"tag", Filter{CampaignTags: []string{"other", "product"}}, data, true},
+		{"tag mismatch", Filter{CampaignTags: []string{"other"}}, data, false},
+		{"tracking tags", Filter{CampaignTags: []string{"product"}},
+			decodeData([]byte(`{"data": {"campaign_tags": ["product"]}}`)), true},
+		{"list", Filter{ListIDs: []int{2}}, data, true},
+		{"list mismatch", Filter{ListIDs: []int{5}}, data, false},
+		{"subscriber lists", Filter{ListIDs: []int{3}},
+			decodeData([]byte(`{"data": {"subscriber": {"lists": [{"id": 3}]}}}`)), true},
+		{"attribs", Filter{Attribs: map[string]any{"plan": "pro", "seats": 5}}, data, true},
+		{"nested attrib", Filter{Attribs: map[string]any{"address": map[string]any{"city": "Pune"}}}, data, true},
+		{"dotted attrib", Filter{Attribs: map[string]any{"address.city": "Pune"}}, data, true},
+		{"attrib mismatch", Filter{Attribs: map[string]any{"plan": "free"}}, data, false},
+		{"all", Filter{CampaignTags: []string{"news"}, ListIDs: []int{1}, Attribs: map[string]any{"plan": "pro"}}, data, true},
+		{"missing data", Filter{ListIDs: []int{1}}, decodeData([]byte(`{"data": {"campaign": {}}}`)), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.match(tt.data); got != tt.want {
+			t.Errorf("%s: match() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestProject tests projection of event data fields.
+func TestProject(t *testing.T) {
+	data := decodeData([]byte(`{"data": {"subscriber": {"email": "a@b.com", "name": "A", "attribs": {}}, "list_ids": [1]}}`))
+
+	got := toJSON(project(data, []string{"subscriber.email", "list_ids", "missing.field"}))
+	want := `{"list_ids":[1],"subscriber":{"email":"a@b.com"}}`
+	if got != want {
+		t.Errorf("project() = %s, want %s", got, want)
+	}
+}
+
+// TestDispatchFilter tests that filters and field projections are applied per endpoint.
+func TestDispatchFilter(t *testing.T) {
+	var (
+		bodies = make(map[string][]byte)
+		mu     sync.Mutex
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path] = b
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	m, err := New([]Opt{
+		{Name: "all", URL: server.URL + "/all", Events: []string{EventLinkClick}},
+		{Name: "product", URL: server.URL + "/product", Events: []string{EventLinkClick},
+			Filter: Filter{CampaignTags: []string{"product"}}, Fields: []string{"url"}},
+		{Name: "other", URL: server.URL + "/other", Events: []string{EventLinkClick},
+			Filter: Filter{CampaignTags: []string{"other"}}},
+	}, nil, testLogger())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer m.Close()
+
+	m.Dispatch(EventLinkClick, map[string]any{
+		"url":           "https://example.com",
+		"campaign_uuid": "abc",
+		"campaign_tags": []string{"product"},
+	})
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(bodies) != 2 || bodies["/all"] == nil || bodies["/product"] == nil {
+		t.Fatalf("Expected deliveries to /all and /product, got %v", bodies)
+	}
+
+	var p struct {
+		Event string         `json:"event"`
+		Data  map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(bodies["/product"], &p); err != nil {
+		t.Fatalf("Failed to unmarshal payload: %v", err)
+	}
+	if p.Event != EventLinkClick || len(p.Data) != 1 || p.Data["url"] != "https://example.com" {
+		t.Errorf("Expected projected payload, got %s", bodies["/product"])
+	}
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// Automation rule actions.
+const (
+	AutomationActionAddLists    = "add_lists"
+	AutomationActionRemoveLists = "remove_lists"
+	AutomationActionSetAttribs  = "set_attribs"
+	AutomationActionSendTx      = "send_tx"
+	AutomationActionBlocklist   = "blocklist"
+)
+
+// Automation rule run statuses.
+const (
+	AutomationRunSuccess = "success"
+	AutomationRunFailed  = "failed"
+)
+
+// AutomationRule represents a rule that runs actions on a subscriber when
+// an event (trigger) occurs and the rule's condition matches.
+type AutomationRule struct {
+	Base
+
+	UUID    string `db:"uuid" json:"uuid"`
+	Name    string `db:"name" json:"name"`
+	Enabled bool   `db:"enabled" json:"enabled"`
+
+	// Trigger is an event name, eg: subscriber.confirmed. For attribute change
+	// triggers, TriggerAttrib is the (optional) dot separated attribute path
+	// whose change triggers the rule.
+	Trigger       string `db:"trigger" json:"trigger"`
+	TriggerAttrib string `db:"trigger_attrib" json:"trigger_attrib"`
+
+	Condition string            `db:"condition" json:"condition"`
+	Actions   AutomationActions `db:"actions" json:"actions"`
+}
+
+// AutomationAction represents an action of an automation rule. The fields
+// that apply depend on the type of the action.
+type AutomationAction struct {
+	Type string `json:"type"`
+
+	// add_lists, remove_lists.
+	ListIDs []int `json:"list_ids,omitempty"`
+
+	// Subscription status for add_lists.
+	Status string `json:"status,omitempty"`
+
+	// set_attribs. Attributes are merged into the subscriber's attributes.
+	Attribs map[string]any `json:"attribs,omitempty"`
+
+	// send_tx.
+	TemplateID int            `json:"template_id,omitempty"`
+	Data       map[string]any `json:"data,omitempty"`
+}
+
+// AutomationActions is used to define DB Scan()s.
+type AutomationActions []AutomationAction
+
+// AutomationLog represents a run of an automation rule.
+type AutomationLog struct {
+	ID           int64     `db:"id" json:"id"`
+	RuleID       int       `db:"rule_id" json:"rule_id"`
+	SubscriberID null.Int  `db:"subscriber_id" json:"subscriber_id"`
+	Event        string    `db:"event" json:"event"`
+	Status       string    `db:"status" json:"status"`
+	Error        string    `db:"error" json:"error"`
+	CreatedAt    null.Time `db:"created_at" json:"created_at"`
+
+	// Pseudofield for getting the total number of rows
+	// in batch queries.
+	Total int `db:"total" json:"-"`
+}
+
+// Value implements the driver.Valuer interface.
+func (a AutomationActions) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan unmarshals JSONB from the DB.
+func (a *AutomationActions) Scan(src any) error {
+	if src == nil {
+		*a = AutomationActions{}
+		return nil
+	}
+
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, a)
+	}
+	return fmt.Errorf("could not decode type %T -> %T", src, a)
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// AutoresponderSequence represents a drip sequence: an ordered set of
+// autoresponder campaigns that are sent to the subscribers of a list,
+// each after a delay since the subscription (or opt-in confirmation).
+type AutoresponderSequence struct {
+	Base
+
+	UUID             string             `db:"uuid" json:"uuid"`
+	Name             string             `db:"name" json:"name"`
+	ListID           int                `db:"list_id" json:"list_id"`
+	ListName         string             `db:"list_name" json:"list_name"`
+	TriggerOnConfirm bool               `db:"trigger_on_confirm" json:"trigger_on_confirm"`
+	Enabled          bool               `db:"enabled" json:"enabled"`
+	Steps            AutoresponderSteps `db:"steps" json:"steps"`
+}
+
+// AutoresponderStep represents a single step in an autoresponder sequence.
+// Delay is a Postgres interval string, eg: "3 days" or "12 hours".
+type AutoresponderStep struct {
+	ID             int    `json:"id"`
+	CampaignID     int    `json:"campaign_id"`
+	CampaignName   string `json:"campaign_name"`
+	CampaignStatus string `json:"campaign_status"`
+	Position       int    `json:"position"`
+	Delay          string `json:"delay"`
+}
+
+// AutoresponderSteps is used to define DB Scan()s.
+type AutoresponderSteps []AutoresponderStep
+
+// ScheduledAutoresponder represents a pending send of a sequence step
+// to a subscriber.
+type ScheduledAutoresponder struct {
+	ID           int64     `db:"id" json:"id"`
+	StepID       int       `db:"step_id" json:"step_id"`
+	CampaignID   int       `db:"campaign_id" json:"campaign_id"`
+	SubscriberID int       `db:"subscriber_id" json:"subscriber_id"`
+	ListID       int       `db:"list_id" json:"list_id"`
+	SendAt       null.Time `db:"send_at" json:"send_at"`
+	Attempts     int       `db:"attempts" json:"attempts"`
+	CreatedAt    null.Time `db:"created_at" json:"created_at"`
+}
+
+// Scan unmarshals JSONB from the DB.
+func (s *AutoresponderSteps) Scan(src any) error {
+	if src == nil {
+		*s = AutoresponderSteps{}
+		return nil
+	}
+
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, s)
+	}
+	return fmt.Errorf("could not decode type %T -> %T", src, s)
+}
@@ -2,12 +2,14 @@ package models
 
 import (
 	"bytes"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"strings"
 	txttpl "text/template"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/jmoiron/sqlx/types"
@@ -40,27 +42,88 @@ type Campaign struct {
 	Base
 	CampaignMeta
 
-	UUID              string          `db:"uuid" json:"uuid"`
-	Type              string          `db:"type" json:"type"`
-	Name              string          `db:"name" json:"name"`
-	Subject           string          `db:"subject" json:"subject"`
-	FromEmail         string          `db:"from_email" json:"from_email"`
-	Body              string          `db:"body" json:"body"`
-	BodySource        null.String     `db:"body_source" json:"body_source"`
-	AltBody           null.String     `db:"altbody" json:"altbody"`
-	SendAt            null.Time       `db:"send_at" json:"send_at"`
-	Status            string          `db:"status" json:"status"`
-	ContentType       string          `db:"content_type" json:"content_type"`
-	Tags              pq.StringArray  `db:"tags" json:"tags"`
-	Headers           Headers         `db:"headers" json:"headers"`
-	TemplateID        null.Int        `db:"template_id" json:"template_id"`
-	Messenger         string          `db:"messenger" json:"messenger"`
-	Archive           bool            `db:"archive" json:"archive"`
-	ArchiveSlug       null.String     `db:"archive_slug" json:"archive_slug"`
+	UUID               string          `db:"uuid" json:"uuid"`
+	Type               string          `db:"type" json:"type"`
+	Name               string          `db:"name" json:"name"`
+	Subject            string          `db:"subject" json:"subject"`
+	FromEmail          string          `db:"from_email" json:"from_email"`
+	Body               string          `db:"body" json:"body"`
+	BodySource         null.String     `db:"body_source" json:"body_source"`
+	AltBody            null.String     `db:"altbody" json:"altbody"`
+	SendAt             null.Time       `db:"send_at" json:"send_at"`
+	Status             string          `db:"status" json:"status"`
+	ContentType        string          `db:"content_type" json:"content_type"`
+	Tags               pq.StringArray  `db:"tags" json:"tags"`
+	Headers            Headers         `db:"headers" json:"headers"`
+	TemplateID         null.Int        `db:"template_id" json:"template_id"`
+	Messenger          string          `db:"messenger" json:"messenger"`
+	Archive            bool            `db:"archive" json:"archive"`
+	ArchiveSlug        null.String     `db:"archive_slug" json:"archive_slug"`
 	ArchiveTemplateID  null.Int        `db:"archive_template_id" json:"archive_template_id"`
 	ArchiveMeta        json.RawMessage `db:"archive_meta" json:"archive_meta"`
 	ARTriggerOnConfirm bool            `db:"ar_trigger_on_confirm" json:"ar_trigger_on_confirm"`
 
+	// For resends, the campaign that's resent and the audience of its recipients.
+	ResendOf       null.Int    `db:"resend_of" json:"resend_of"`
+	ResendAudience null.String `db:"resend_audience" json:"resend_audience"`
+
+	// A/B testing. The variants are sent to ABPercent % of the subscribers and
+	// ABWait minutes after the test is sent (ABTestedAt), the variant with the
+	// best ABMetric (opens|clicks) rate, ABWinnerID, is sent to the rest.
+	ABPercent  int              `db:"ab_percent" json:"ab_percent"`
+	ABMetric   string           `db:"ab_metric" json:"ab_metric"`
+	ABWait     int              `db:"ab_wait" json:"ab_wait"`
+	ABTestedAt null.Time        `db:"ab_tested_at" json:"ab_tested_at"`
+	ABWinnerID null.Int         `db:"ab_winner_id" json:"ab_winner_id"`
+	Variants   CampaignVariants `db:"variants" json:"variants"`
+
+	// Local time sending. SendAt's time in LocalTimezone is the time at which the
+	// campaign is sent to each subscriber in their timezone (attribs.timezone).
+	// Subscribers are sent to in waves, LocalWaveUntil being the end of the wave
+	// being sent and LocalSentUntil, the end of the last sent wave.
+	LocalSend      bool      `db:"local_send" json:"local_send"`
+	LocalTimezone  string    `db:"local_timezone" json:"local_timezone"`
+	LocalWaveUntil null.Time `db:"local_wave_until" json:"local_wave_until"`
+	LocalSentUntil null.Time `db:"local_sent_until" json:"local_sent_until"`
+
+	// Priority (1-10) of the campaign when it's sent along with other campaigns, and
+	// its optional rate limits (0 is no limit): messages per second and messages per
+	// sliding window duration, eg: 1h.
+	Priority              int    `db:"priority" json:"priority"`
+	MessageRate           int    `db:"message_rate" json:"message_rate"`
+	SlidingWindowRate     int    `db:"sliding_window_rate" json:"sliding_window_rate"`
+	SlidingWindowDuration string `db:"sliding_window_duration" json:"sliding_window_duration"`
+
+	// Recurrence is the cron expression of a recurring campaign, which isn't sent
+	// itself. Instead, every occurrence (RecurrenceNext) creates a run, a copy of the
+	// campaign whose ParentID is the recurring campaign.
+	Recurrence     string    `db:"recurrence" json:"recurrence"`
+	RecurrenceNext null.Time `db:"recurrence_next" json:"recurrence_next"`
+	ParentID       null.Int  `db:"parent_id" json:"parent_id"`
+
+	// An RSS/Atom feed campaign isn't sent itself either. When FeedMinItems or more
+	// items appear in the feed after the last seen one (FeedLastGUID, or if it's gone
+	// from the feed, FeedLastPublished), a run is created with the new items in Feed,
+	// at most once every FeedInterval.
+	FeedURL           string    `db:"feed_url" json:"feed_url"`
+	FeedInterval      string    `db:"feed_interval" json:"feed_interval"`
+	FeedMinItems      int       `db:"feed_min_items" json:"feed_min_items"`
+	FeedLastGUID      string    `db:"feed_last_guid" json:"feed_last_guid"`
+	FeedLastPublished null.Time `db:"feed_last_published" json:"feed_last_published"`
+	FeedLastRun       null.Time `db:"feed_last_run" json:"feed_last_run"`
+	Feed              Feed      `db:"feed" json:"feed"`
+
+	// Quiet hours of the campaign during which it's suspended, in addition
+	// to the global quiet hours.
+	QuietHours QuietHours `db:"quiet_hours" json:"quiet_hours"`
+
+	// Subscribers who are excluded from the campaign's audience.
+	Exclusions CampaignExclusions `db:"exclusions" json:"exclusions"`
+
+	// Exempt campaigns (eg: security notices) are sent regardless of the
+	// global frequency cap on the messages a subscriber receives.
+	FrequencyCapExempt bool `db:"frequency_cap_exempt" json:"frequency_cap_exempt"`
+
 	// TemplateBody is joined in from templates by the next-campaigns query.
 	TemplateBody        string             `db:"template_body" json:"-"`
 	ArchiveTemplateBody string             `db:"archive_template_body" json:"-"`
@@ -72,9 +135,18 @@ type Campaign struct {
 	// while sending a campaign.
 	MediaIDs pq.Int64Array `json:"-" db:"media_id"`
 
+	// Query expressions of the segments and excluded segments obtained from the
+	// next-campaign query, which the campaign is counted with when it starts.
+	SegmentQueries        pq.StringArray `json:"-" db:"segment_queries"`
+	ExcludeSegmentQueries pq.StringArray `json:"-" db:"exclude_segment_queries"`
+
 	// Fetched bodies of the attachments.
 	Attachments []Attachment `json:"-" db:"-"`
 
+	// Checkpoint of the subscribers processed, obtained from the next-campaign query
+	// when a running campaign is picked up.
+	LastSubscriberID int `json:"-" db:"last_subscriber_id"`
+
 	// Pseudofield for getting the total number of subscribers
 	// in searches and queries.
 	Total int `db:"total" json:"-"`
@@ -95,11 +167,122 @@ type CampaignMeta struct {
 	Lists types.JSONText `db:"lists" json:"lists"`
 	Media types.JSONText `db:"media" json:"media"`
 
+	// {id, name} pairs of the segments the campaign is sent to,
+	// maintained in campaign_segments like lists.
+	Segments types.JSONText `db:"segments" json:"segments"`
+
+	// Number of subscribers skipped for having reached the frequency cap.
+	Capped int `db:"capped" json:"capped"`
+
 	StartedAt null.Time `db:"started_at" json:"started_at"`
 	ToSend    int       `db:"to_send" json:"to_send"`
 	Sent      int       `db:"sent" json:"sent"`
 }
 
+// A/B test metrics for picking the winning variant.
+const (
+	CampaignABMetricOpens  = "opens"
+	CampaignABMetricClicks = "clicks"
+)
+
+// CampaignVariant represents an A/B test variant of a campaign's subject and body.
+// Empty fields fall back to the campaign's.
+type CampaignVariant struct {
+	ID      int    `json:"id"`
+	Label   string `json:"label"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+
+	// Number of test messages sent with the variant.
+	Sent int `json:"sent"`
+}
+
+// CampaignVariants is used to define DB Scan()s.
+type CampaignVariants []CampaignVariant
+
+// QuietHours are the hours of the day, eg: 22:00 to 07:00, and the days of the
+// week (0 = Sunday) during which campaigns aren't sent, in a timezone. The hours
+// may span midnight and the server's timezone is used if there's none.
+type QuietHours struct {
+	Enabled  bool   `json:"enabled"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Days     []int  `json:"days"`
+	Timezone string `json:"timezone"`
+}
+
+// CampaignExclusions are the subscribers excluded from a campaign even if they
+// are in its lists or segments: the subscribers of the (non-unsubscribed) Lists,
+// the subscribers in the Segments, and the subscribers who were sent any other
+// campaign in the last SentWithinDays days (as recorded in the send log).
+type CampaignExclusions struct {
+	Lists          []int `json:"lists"`
+	Segments       []int `json:"segments"`
+	SentWithinDays int   `json:"sent_within_days"`
+}
+
+// Feed is an RSS/Atom feed. The runs of feed campaigns have the new items they
+// were created for, which are available in templates as {{ .Feed.Items }}.
+type Feed struct {
+	Title string     `json:"title"`
+	URL   string     `json:"url"`
+	Items []FeedItem `json:"items"`
+}
+
+// FeedItem is an item (RSS) or an entry (Atom) of a feed. Description and
+// Content are HTML.
+type FeedItem struct {
+	GUID        string    `json:"guid"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Content     string    `json:"content"`
+	Author      string    `json:"author"`
+	PublishedAt null.Time `json:"published_at"`
+}
+
+// Audiences of campaign resends.
+const (
+	CampaignResendFailed     = "failed"
+	CampaignResendNotOpened  = "not_opened"
+	CampaignResendNotClicked = "not_clicked"
+)
+
+// Campaign send log statuses.
+const (
+	CampaignSendStatusSent   = "sent"
+	CampaignSendStatusFailed = "failed"
+	CampaignSendStatusCapped = "capped"
+)
+
+// CampaignSend represents an entry in the campaign send log, a campaign
+// message sent (or attempted) to a subscriber.
+type CampaignSend struct {
+	ID           int64     `db:"id" json:"id"`
+	CampaignID   int       `db:"campaign_id" json:"campaign_id"`
+	SubscriberID int       `db:"subscriber_id" json:"subscriber_id"`
+	Messenger    string    `db:"messenger" json:"messenger"`
+	Status       string    `db:"status" json:"status"`
+	Error        string    `db:"error" json:"error"`
+	CreatedAt    null.Time `db:"created_at" json:"created_at"`
+
+	CampaignName string `db:"campaign_name" json:"campaign_name"`
+	Email        string `db:"email" json:"email"`
+
+	// Pseudofield for getting the total number of rows
+	// in batch queries.
+	Total int `db:"total" json:"-"`
+}
+
+// FrequencySend is a campaign message sent to a subscriber, or skipped (Capped)
+// as the subscriber had reached the frequency cap, that's counted towards the cap.
+type FrequencySend struct {
+	CampaignID   int
+	SubscriberID int
+	Capped       bool
+	CreatedAt    time.Time
+}
+
 // GetIDs returns the list of campaign IDs.
 func (camps Campaigns) GetIDs() []int {
 	IDs := make([]int, len(camps))
@@ -124,6 +307,8 @@ func (camps Campaigns) LoadStats(stmt *sqlx.Stmt) error {
 	for i, c := range meta {
 		if c.CampaignID == camps[i].ID {
 			camps[i].Lists = c.Lists
+			camps[i].Segments = c.Segments
+			camps[i].Capped = c.Capped
 			camps[i].Views = c.Views
 			camps[i].Clicks = c.Clicks
 			camps[i].Bounces = c.Bounces
@@ -210,6 +395,94 @@ func (c *Campaign) CompileTemplate(f template.FuncMap) error {
 	return nil
 }
 
+// WithVariant returns a copy of the campaign with the subject and body of the
+// given A/B test variant. The copy's templates have to be compiled again.
+func (c *Campaign) WithVariant(v CampaignVariant) *Campaign {
+	out := *c
+	out.Tpl, out.SubjectTpl, out.AltBodyTpl = nil, nil, nil
+	if v.Subject != "" {
+		out.Subject = v.Subject
+	}
+	if v.Body != "" {
+		out.Body = v.Body
+	}
+
+	return &out
+}
+
+// Scan unmarshals JSON from the DB.
+func (v *CampaignVariants) Scan(src any) error {
+	if src == nil {
+		*v = CampaignVariants{}
+		return nil
+	}
+
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, v)
+	}
+	return fmt.Errorf("could not decode type %T -> %T", src, v)
+}
+
+// Value returns the JSON value of a feed for storing in the DB.
+func (f Feed) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+// Scan unmarshals JSONB from the DB.
+func (f *Feed) Scan(src any) error {
+	if src == nil {
+		*f = Feed{}
+		return nil
+	}
+
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, f)
+	}
+	return fmt.Errorf("could not decode type %T -> %T", src, f)
+}
+
+// Value returns the JSON value of quiet hours for storing in the DB.
+func (q QuietHours) Value() (driver.Value, error) {
+	return json.Marshal(q)
+}
+
+// Scan unmarshals JSONB from the DB.
+func (q *QuietHours) Scan(src any) error {
+	if src == nil {
+		*q = QuietHours{}
+		return nil
+	}
+
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, q)
+	}
+	return fmt.Errorf("could not decode type %T -> %T", src, q)
+}
+
+// Value returns the JSON value of exclusions for storing in the DB.
+func (e CampaignExclusions) Value() (driver.Value, error) {
+	if e.Lists == nil {
+		e.Lists = []int{}
+	}
+	if e.Segments == nil {
+		e.Segments = []int{}
+	}
+	return json.Marshal(e)
+}
+
+// Scan unmarshals JSONB from the DB.
+func (e *CampaignExclusions) Scan(src any) error {
+	if src == nil {
+		*e = CampaignExclusions{}
+		return nil
+	}
+
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, e)
+	}
+	return fmt.Errorf("could not decode type %T -> %T", src, e)
+}
+
 // ConvertContent converts a campaign's body from one format to another,
 // for example, Markdown to HTML.
 func (c *Campaign) ConvertContent(from, to string) (string, error) {
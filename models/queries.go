@@ -59,7 +59,17 @@ type Queries struct {
 	UpdateListsDate *sqlx.Stmt `query:"update-lists-date"`
 	DeleteLists     *sqlx.Stmt `query:"delete-lists"`
 
+	GetSegments                  *sqlx.Stmt `query:"get-segments"`
+	CreateSegment                *sqlx.Stmt `query:"create-segment"`
+	UpdateSegment                *sqlx.Stmt `query:"update-segment"`
+	DeleteSegment                *sqlx.Stmt `query:"delete-segment"`
+	CountSegmentSubscribers      string     `query:"count-segment-subscribers"`
+	CountSegmentsSubscribers     string     `query:"count-segments-subscribers"`
+	GetCampaignSegments          *sqlx.Stmt `query:"get-campaign-segments"`
+	GetCampaignExclusionSegments *sqlx.Stmt `query:"get-campaign-exclusion-segments"`
+
 	CreateCampaign        *sqlx.Stmt `query:"create-campaign"`
+	ResendCampaign        *sqlx.Stmt `query:"resend-campaign"`
 	QueryCampaigns        string     `query:"query-campaigns"`
 	GetCampaign           *sqlx.Stmt `query:"get-campaign"`
 	GetCampaignForPreview *sqlx.Stmt `query:"get-campaign-for-preview"`
@@ -75,12 +85,12 @@ type Queries struct {
 	GetCampaignClickCounts     *sqlx.Stmt `query:"get-campaign-click-counts"`
 	GetCampaignLinkCounts      *sqlx.Stmt `query:"get-campaign-link-counts"`
 	GetCampaignBounceCounts    *sqlx.Stmt `query:"get-campaign-bounce-counts"`
+	GetCampaignVariantStats    *sqlx.Stmt `query:"get-campaign-variant-stats"`
 	DeleteCampaignViews        *sqlx.Stmt `query:"delete-campaign-views"`
 	DeleteCampaignLinkClicks   *sqlx.Stmt `query:"delete-campaign-link-clicks"`
 
 	NextCampaigns            *sqlx.Stmt `query:"next-campaigns"`
 	GetRunningCampaign       *sqlx.Stmt `query:"get-running-campaign"`
-	NextCampaignSubscribers  *sqlx.Stmt `query:"next-campaign-subscribers"`
 	GetOneCampaignSubscriber *sqlx.Stmt `query:"get-one-campaign-subscriber"`
 	UpdateCampaign           *sqlx.Stmt `query:"update-campaign"`
 	UpdateCampaignStatus     *sqlx.Stmt `query:"update-campaign-status"`
@@ -90,6 +100,23 @@ type Queries struct {
 	DeleteCampaign           *sqlx.Stmt `query:"delete-campaign"`
 	DeleteCampaigns          *sqlx.Stmt `query:"delete-campaigns"`
 
+	// Non-prepared as the query expressions of the campaign's segments are
+	// interpolated into them.
+	NextCampaignSubscribers         string `query:"next-campaign-subscribers"`
+	CountCampaignSegmentSubscribers string `query:"count-campaign-segment-subscribers"`
+
+	UpdateCampaignSegmentCounts *sqlx.Stmt `query:"update-campaign-segment-counts"`
+	UpdateCampaignVariantCounts *sqlx.Stmt `query:"update-campaign-variant-counts"`
+	FinishCampaignABTest        *sqlx.Stmt `query:"finish-campaign-ab-test"`
+	UpdateCampaignABWinner      *sqlx.Stmt `query:"update-campaign-ab-winner"`
+	FinishCampaignLocalWave     *sqlx.Stmt `query:"finish-campaign-local-wave"`
+	GetRecurringCampaigns       *sqlx.Stmt `query:"get-recurring-campaigns"`
+	UpdateCampaignRecurrence    *sqlx.Stmt `query:"update-campaign-recurrence"`
+	CreateCampaignRun           *sqlx.Stmt `query:"create-campaign-run"`
+	GetFeedCampaigns            *sqlx.Stmt `query:"get-feed-campaigns"`
+	UpdateCampaignFeedGUID      *sqlx.Stmt `query:"update-campaign-feed-guid"`
+	CreateFeedCampaignRun       *sqlx.Stmt `query:"create-feed-campaign-run"`
+
 	InsertMedia *sqlx.Stmt `query:"insert-media"`
 	GetMedia    *sqlx.Stmt `query:"get-media"`
 	QueryMedia  *sqlx.Stmt `query:"query-media"`
@@ -108,6 +135,9 @@ type Queries struct {
 	UpdateSettings      *sqlx.Stmt `query:"update-settings"`
 	UpdateSettingsByKey *sqlx.Stmt `query:"update-settings-by-key"`
 
+	GetSMTPWarmup *sqlx.Stmt `query:"get-smtp-warmup"`
+	AddSMTPWarmup *sqlx.Stmt `query:"add-smtp-warmup"`
+
 	// GetStats *sqlx.Stmt `query:"get-stats"`
 	RecordBounce                *sqlx.Stmt `query:"record-bounce"`
 	QueryBounces                string     `query:"query-bounces"`
@@ -139,6 +169,49 @@ type Queries struct {
 	GetAutorespondersForList *sqlx.Stmt `query:"get-autoresponders-for-list"`
 	CheckAutoresponderSent   *sqlx.Stmt `query:"check-autoresponder-sent"`
 	RecordAutoresponderSent  *sqlx.Stmt `query:"record-autoresponder-sent"`
+	GetAutoresponder         *sqlx.Stmt `query:"get-autoresponder"`
+
+	GetAutoresponderSequences        *sqlx.Stmt `query:"get-autoresponder-sequences"`
+	CreateAutoresponderSequence      *sqlx.Stmt `query:"create-autoresponder-sequence"`
+	UpdateAutoresponderSequence      *sqlx.Stmt `query:"update-autoresponder-sequence"`
+	DeleteAutoresponderSequence      *sqlx.Stmt `query:"delete-autoresponder-sequence"`
+	UpsertAutoresponderSteps         *sqlx.Stmt `query:"upsert-autoresponder-steps"`
+	ScheduleAutoresponderSequences   *sqlx.Stmt `query:"schedule-autoresponder-sequences"`
+	DeleteStaleAutoresponderSchedule *sqlx.Stmt `query:"delete-stale-autoresponder-schedule"`
+	GetDueAutoresponders             *sqlx.Stmt `query:"get-due-autoresponders"`
+	RetryScheduledAutoresponder      *sqlx.Stmt `query:"retry-scheduled-autoresponder"`
+	DeleteScheduledAutoresponder     *sqlx.Stmt `query:"delete-scheduled-autoresponder"`
+
+	// Webhooks
+	CreateWebhookDelivery    *sqlx.Stmt `query:"create-webhook-delivery"`
+	NextWebhookDeliveries    *sqlx.Stmt `query:"next-webhook-deliveries"`
+	RetryWebhookDelivery     *sqlx.Stmt `query:"retry-webhook-delivery"`
+	DeleteWebhookDelivery    *sqlx.Stmt `query:"delete-webhook-delivery"`
+	FailWebhookDelivery      *sqlx.Stmt `query:"fail-webhook-delivery"`
+	QueryWebhookDeadLetters  *sqlx.Stmt `query:"query-webhook-dead-letters"`
+	ReplayWebhookDeadLetters *sqlx.Stmt `query:"replay-webhook-dead-letters"`
+	DeleteWebhookDeadLetters *sqlx.Stmt `query:"delete-webhook-dead-letters"`
+	InsertWebhookLog         *sqlx.Stmt `query:"insert-webhook-log"`
+	QueryWebhookLog          *sqlx.Stmt `query:"query-webhook-log"`
+	DeleteWebhookLog         *sqlx.Stmt `query:"delete-webhook-log"`
+
+	// Automation
+	GetAutomationRules   *sqlx.Stmt `query:"get-automation-rules"`
+	CreateAutomationRule *sqlx.Stmt `query:"create-automation-rule"`
+	UpdateAutomationRule *sqlx.Stmt `query:"update-automation-rule"`
+	DeleteAutomationRule *sqlx.Stmt `query:"delete-automation-rule"`
+	InsertAutomationLog  *sqlx.Stmt `query:"insert-automation-log"`
+	QueryAutomationLogs  *sqlx.Stmt `query:"query-automation-logs"`
+
+	// Campaign send log
+	InsertCampaignSends *sqlx.Stmt `query:"insert-campaign-sends"`
+	QueryCampaignSends  *sqlx.Stmt `query:"query-campaign-sends"`
+	DeleteCampaignSends *sqlx.Stmt `query:"delete-campaign-sends"`
+
+	// Frequency capping
+	InsertFrequencySends *sqlx.Stmt `query:"insert-frequency-sends"`
+	GetFrequencyCounts   *sqlx.Stmt `query:"get-frequency-counts"`
+	DeleteFrequencySends *sqlx.Stmt `query:"delete-frequency-sends"`
 }
 
 // compileSubscriberQueryTpl takes an arbitrary WHERE expressions
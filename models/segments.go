@@ -0,0 +1,14 @@
+package models
+
+// Segment is a saved subscriber query expression that campaigns can be sent
+// to, in addition to lists. The expression is evaluated when a campaign is sent.
+type Segment struct {
+	Base
+
+	Name        string `db:"name" json:"name"`
+	Description string `db:"description" json:"description"`
+	Query       string `db:"query" json:"query"`
+
+	// Live count of the subscribers in the segment that campaigns are sent to.
+	SubscriberCount int `db:"-" json:"subscriber_count"`
+}
@@ -2,6 +2,14 @@ package models
 
 import "gopkg.in/volatiletech/null.v6"
 
+// FrequencyCap is the max number of campaign messages (Max) that a subscriber
+// receives in a rolling window (Window, eg: 24h).
+type FrequencyCap struct {
+	Enabled bool   `json:"enabled"`
+	Max     int    `json:"max"`
+	Window  string `json:"window"`
+}
+
 // Settings represents the app settings stored in the DB.
 type Settings struct {
 	AppSiteName                   string   `json:"app.site_name"`
@@ -28,6 +36,27 @@ type Settings struct {
 	AppMessageSlidingWindowDuration string `json:"app.message_sliding_window_duration"`
 	AppMessageSlidingWindowRate     int    `json:"app.message_sliding_window_rate"`
 
+	// Rate limits of individual messengers.
+	AppMessengerLimits []struct {
+		Messenger             string `json:"messenger"`
+		MessageRate           int    `json:"message_rate"`
+		SlidingWindow         bool   `json:"sliding_window"`
+		SlidingWindowDuration string `json:"sliding_window_duration"`
+		SlidingWindowRate     int    `json:"sliding_window_rate"`
+	} `json:"app.messenger_limits"`
+
+	// Per minute rate limits of recipient domains, eg: gmail.com.
+	AppDomainLimits []struct {
+		Domain string `json:"domain"`
+		Rate   int    `json:"rate"`
+	} `json:"app.domain_limits"`
+
+	// Hours and days during which campaigns aren't sent.
+	AppQuietHours QuietHours `json:"app.quiet_hours"`
+
+	// Max number of campaign messages a subscriber receives in a rolling window.
+	AppFrequencyCap FrequencyCap `json:"app.frequency_cap"`
+
 	PrivacyIndividualTracking bool     `json:"privacy.individual_tracking"`
 	PrivacyUnsubHeader        bool     `json:"privacy.unsubscribe_header"`
 	PrivacyAllowBlocklist     bool     `json:"privacy.allow_blocklist"`
@@ -96,6 +125,9 @@ type Settings struct {
 		WaitTimeout   string              `json:"wait_timeout"`
 		TLSType       string              `json:"tls_type"`
 		TLSSkipVerify bool                `json:"tls_skip_verify"`
+		WarmupEnabled bool                `json:"warmup_enabled"`
+		WarmupStart   string              `json:"warmup_start"`
+		WarmupVolumes string              `json:"warmup_volumes"`
 	} `json:"smtp"`
 
 	Messengers []struct {
@@ -111,14 +143,30 @@ type Settings struct {
 	} `json:"messengers"`
 
 	Webhooks []struct {
-		UUID     string   `json:"uuid"`
-		Enabled  bool     `json:"enabled"`
-		Name     string   `json:"name"`
-		URL      string   `json:"url"`
-		Secret   string   `json:"secret,omitempty"`
-		Events   []string `json:"events"`
-		MaxConns int      `json:"max_conns"`
-		Timeout  string   `json:"timeout"`
+		UUID       string   `json:"uuid"`
+		Enabled    bool     `json:"enabled"`
+		Name       string   `json:"name"`
+		URL        string   `json:"url"`
+		Secret     string   `json:"secret,omitempty"`
+		Events     []string `json:"events"`
+		MaxConns   int      `json:"max_conns"`
+		MaxRetries int      `json:"max_retries"`
+		Timeout    string   `json:"timeout"`
+
+		// Events are sent in batches if BatchSize > 1.
+		BatchSize     int    `json:"batch_size"`
+		BatchInterval string `json:"batch_interval"`
+
+		Filter struct {
+			CampaignTags []string       `json:"campaign_tags"`
+			ListIDs      []int          `json:"list_ids"`
+			Attribs      map[string]any `json:"attribs"`
+		} `json:"filter"`
+		Fields []string `json:"fields"`
+
+		// Rotated out secret that remains valid until its expiry.
+		PreviousSecret       string `json:"previous_secret,omitempty"`
+		PreviousSecretExpiry string `json:"previous_secret_expiry,omitempty"`
 	} `json:"webhooks"`
 
 	BounceEnabled        bool `json:"bounce.enabled"`
@@ -152,6 +200,10 @@ type Settings struct {
 		TLSEnabled    bool   `json:"tls_enabled"`
 		TLSSkipVerify bool   `json:"tls_skip_verify"`
 		ScanInterval  string `json:"scan_interval"`
+		Folder        string `json:"folder"`
+		MoveTo        string `json:"move_to"`
+		UnseenOnly    bool   `json:"unseen_only"`
+		IDLE          bool   `json:"idle"`
 	} `json:"bounce.mailboxes"`
 
 	MaintenanceDB struct {
@@ -159,6 +211,16 @@ type Settings struct {
 		VacuumInterval string `json:"vacuum_cron_interval"`
 	} `json:"maintenance.db"`
 
+	MaintenanceWebhookLog struct {
+		Enabled       bool `json:"enabled"`
+		RetentionDays int  `json:"retention_days"`
+	} `json:"maintenance.webhook_log"`
+
+	MaintenanceSendLog struct {
+		Enabled       bool `json:"enabled"`
+		RetentionDays int  `json:"retention_days"`
+	} `json:"maintenance.send_log"`
+
 	AdminCustomCSS  string `json:"appearance.admin.custom_css"`
 	AdminCustomJS   string `json:"appearance.admin.custom_js"`
 	PublicCustomCSS string `json:"appearance.public.custom_css"`
@@ -133,4 +133,7 @@ type SubscriberExportProfile struct {
 type SubscriberActivity struct {
 	CampaignViews json.RawMessage `db:"campaign_views" json:"campaign_views"`
 	LinkClicks    json.RawMessage `db:"link_clicks" json:"link_clicks"`
+
+	// Recent entries from the campaign send log.
+	CampaignSends json.RawMessage `db:"campaign_sends" json:"campaign_sends"`
 }
@@ -67,6 +67,20 @@ type CampaignStats struct {
 	UpdatedAt null.Time `db:"updated_at" json:"updated_at"`
 	Rate      int       `json:"rate"`
 	NetRate   int       `json:"net_rate"`
+
+	Domains []CampaignDomainStats `json:"domains"`
+
+	// A running campaign that's suspended during quiet hours and the time at which it resumes.
+	Suspended bool      `json:"suspended"`
+	ResumeAt  null.Time `json:"resume_at"`
+}
+
+// CampaignDomainStats represents the number of messages of a running campaign
+// that have been sent to, and are being held back for, a throttled domain.
+type CampaignDomainStats struct {
+	Domain   string `json:"domain"`
+	Sent     int    `json:"sent"`
+	Deferred int    `json:"deferred"`
 }
 
 type CampaignAnalyticsCount struct {
@@ -75,6 +89,20 @@ type CampaignAnalyticsCount struct {
 	Timestamp  time.Time `db:"timestamp" json:"timestamp"`
 }
 
+// CampaignAnalyticsVariant represents the stats of an A/B test variant of a campaign.
+// Views and clicks are the unique views and clicks of the subscribers the variant
+// was sent to in the test.
+type CampaignAnalyticsVariant struct {
+	ID         int    `db:"id" json:"id"`
+	CampaignID int    `db:"campaign_id" json:"campaign_id"`
+	Label      string `db:"label" json:"label"`
+	Subject    string `db:"subject" json:"subject"`
+	Sent       int    `db:"sent" json:"sent"`
+	Views      int    `db:"views" json:"views"`
+	Clicks     int    `db:"clicks" json:"clicks"`
+	Winner     bool   `db:"winner" json:"winner"`
+}
+
 type CampaignAnalyticsLink struct {
 	URL   string `db:"url" json:"url"`
 	Count int    `db:"count" json:"count"`
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/json"
+
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// WebhookDelivery represents a pending webhook delivery to an endpoint.
+type WebhookDelivery struct {
+	ID            int64           `db:"id" json:"id"`
+	UUID          string          `db:"uuid" json:"uuid"`
+	EndpointUUID  string          `db:"endpoint_uuid" json:"endpoint_uuid"`
+	Event         string          `db:"event" json:"event"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+	Attempts      int             `db:"attempts" json:"attempts"`
+	LastError     string          `db:"last_error" json:"last_error"`
+	NextAttemptAt null.Time       `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     null.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt     null.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// WebhookDeadLetter represents a webhook delivery that has permanently
+// failed and can be inspected and replayed.
+type WebhookDeadLetter struct {
+	ID           int64           `db:"id" json:"id"`
+	UUID         string          `db:"uuid" json:"uuid"`
+	EndpointUUID string          `db:"endpoint_uuid" json:"endpoint_uuid"`
+	Event        string          `db:"event" json:"event"`
+	Payload      json.RawMessage `db:"payload" json:"payload"`
+	Attempts     int             `db:"attempts" json:"attempts"`
+	LastError    string          `db:"last_error" json:"last_error"`
+	CreatedAt    null.Time       `db:"created_at" json:"created_at"`
+	FailedAt     null.Time       `db:"failed_at" json:"failed_at"`
+
+	// Pseudofield for getting the total number of records
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// WebhookLog represents an attempt at delivering an event to a webhook
+// endpoint and the endpoint's response.
+type WebhookLog struct {
+	ID           int64           `db:"id" json:"id"`
+	EndpointUUID string          `db:"endpoint_uuid" json:"endpoint_uuid"`
+	DeliveryID   null.Int64      `db:"delivery_id" json:"delivery_id"`
+	DeliveryUUID string          `db:"delivery_uuid" json:"delivery_uuid"`
+	Event        string          `db:"event" json:"event"`
+	Payload      json.RawMessage `db:"payload" json:"payload"`
+	Attempt      int             `db:"attempt" json:"attempt"`
+	Status       int             `db:"status" json:"status"`
+	Response     string          `db:"response" json:"response"`
+	Error        string          `db:"error" json:"error"`
+	LatencyMS    int             `db:"latency_ms" json:"latency_ms"`
+	CreatedAt    null.Time       `db:"created_at" json:"created_at"`
+
+	// Pseudofield for getting the total number of records
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
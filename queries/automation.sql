@@ -0,0 +1,27 @@
+-- automation
+-- name: get-automation-rules
+-- Get one ($1) or all automation rules. $2 = true returns only enabled rules.
+SELECT * FROM automation_rules
+    WHERE (CASE WHEN $1::INT != 0 THEN id = $1 ELSE TRUE END)
+    AND (CASE WHEN $2::BOOLEAN THEN enabled = true ELSE TRUE END)
+    ORDER BY created_at;
+
+-- name: create-automation-rule
+INSERT INTO automation_rules (uuid, name, enabled, trigger, trigger_attrib, condition, actions)
+    VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id;
+
+-- name: update-automation-rule
+UPDATE automation_rules SET name=$2, enabled=$3, trigger=$4, trigger_attrib=$5, condition=$6, actions=$7, updated_at=NOW()
+    WHERE id = $1;
+
+-- name: delete-automation-rule
+DELETE FROM automation_rules WHERE id = $1;
+
+-- name: insert-automation-log
+INSERT INTO automation_logs (rule_id, subscriber_id, event, status, error) VALUES($1, $2, $3, $4, $5);
+
+-- name: query-automation-logs
+SELECT COUNT(*) OVER () AS total, * FROM automation_logs
+    WHERE rule_id = $1
+    AND ($2 = '' OR status = $2)
+    ORDER BY id DESC OFFSET $3 LIMIT (CASE WHEN $4 < 1 THEN NULL ELSE $4 END);
@@ -8,7 +8,17 @@ LEFT JOIN templates ON templates.id = c.template_id
 JOIN campaign_lists cl ON cl.campaign_id = c.id
 WHERE c.type = 'autoresponder'
     AND c.status = 'running'
-    AND cl.list_id = $1;
+    AND cl.list_id = $1
+    -- Campaigns that are steps of a sequence are sent by the scheduler.
+    AND NOT EXISTS (SELECT 1 FROM autoresponder_steps WHERE campaign_id = c.id);
+
+-- name: get-autoresponder
+-- Get a running autoresponder campaign along with its template body.
+SELECT c.*,
+    COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1), '') AS template_body
+FROM campaigns c
+LEFT JOIN templates ON templates.id = c.template_id
+WHERE c.id = $1 AND c.type = 'autoresponder' AND c.status = 'running';
 
 -- name: check-autoresponder-sent
 -- Check if an autoresponder has already been sent to a subscriber for a specific list.
@@ -22,3 +32,102 @@ SELECT EXISTS(
 INSERT INTO autoresponder_history (campaign_id, subscriber_id, list_id)
 VALUES ($1, $2, $3)
 ON CONFLICT (campaign_id, subscriber_id, list_id) DO NOTHING;
+
+-- name: get-autoresponder-sequences
+-- Get one ($1) or all autoresponder sequences along with their ordered steps.
+WITH steps AS (
+    SELECT s.sequence_id,
+        JSONB_AGG(JSONB_BUILD_OBJECT('id', s.id, 'campaign_id', s.campaign_id, 'campaign_name', c.name,
+            'campaign_status', c.status, 'position', s.position, 'delay', s.delay::TEXT) ORDER BY s.position) AS steps
+    FROM autoresponder_steps s
+    JOIN campaigns c ON c.id = s.campaign_id
+    GROUP BY s.sequence_id
+)
+SELECT sq.*, COALESCE(lists.name, '') AS list_name, COALESCE(steps.steps, '[]'::JSONB) AS steps
+    FROM autoresponder_sequences sq
+    LEFT JOIN lists ON lists.id = sq.list_id
+    LEFT JOIN steps ON steps.sequence_id = sq.id
+    WHERE CASE WHEN $1::INT != 0 THEN sq.id = $1 ELSE TRUE END
+    ORDER BY sq.created_at;
+
+-- name: create-autoresponder-sequence
+INSERT INTO autoresponder_sequences (uuid, name, list_id, trigger_on_confirm, enabled)
+    VALUES($1, $2, $3, $4, $5) RETURNING id;
+
+-- name: update-autoresponder-sequence
+UPDATE autoresponder_sequences SET name=$2, list_id=$3, trigger_on_confirm=$4, enabled=$5, updated_at=NOW()
+    WHERE id = $1;
+
+-- name: delete-autoresponder-sequence
+DELETE FROM autoresponder_sequences WHERE id = $1;
+
+-- name: upsert-autoresponder-steps
+-- Replace the steps of a sequence ($1) with the given campaign IDs ($2) and delays ($3).
+-- The position of a step is its position in the arrays.
+WITH d AS (
+    -- Delete steps that aren't included.
+    DELETE FROM autoresponder_steps WHERE sequence_id = $1 AND campaign_id != ALL($2::INT[])
+)
+INSERT INTO autoresponder_steps (sequence_id, campaign_id, position, delay)
+    SELECT $1, s.campaign_id, s.position, s.delay::INTERVAL
+    FROM UNNEST($2::INT[], $3::TEXT[]) WITH ORDINALITY AS s(campaign_id, delay, position)
+    ON CONFLICT (sequence_id, campaign_id) DO UPDATE SET position = EXCLUDED.position, delay = EXCLUDED.delay;
+
+-- name: schedule-autoresponder-sequences
+-- Schedule the steps of all enabled sequences on the given lists ($2) for a subscriber ($1).
+-- $3 is true if the trigger is an opt-in confirmation. Steps that have already been
+-- sent to the subscriber (autoresponder_history) are skipped.
+INSERT INTO autoresponder_schedule (step_id, campaign_id, subscriber_id, list_id, send_at)
+    SELECT st.id, st.campaign_id, $1, sq.list_id, NOW() + st.delay
+    FROM autoresponder_sequences sq
+    JOIN autoresponder_steps st ON st.sequence_id = sq.id
+    WHERE sq.list_id = ANY($2::INT[]) AND sq.enabled = true AND sq.trigger_on_confirm = $3
+        AND NOT EXISTS (
+            SELECT 1 FROM autoresponder_history h
+            WHERE h.campaign_id = st.campaign_id AND h.subscriber_id = $1 AND h.list_id = sq.list_id
+        )
+    ON CONFLICT (campaign_id, subscriber_id, list_id) DO NOTHING;
+
+-- name: delete-stale-autoresponder-schedule
+-- Delete scheduled sends that are no longer applicable: the subscriber is no longer
+-- enabled, has unsubscribed from the list, the sequence is disabled, or the step
+-- has already been sent.
+DELETE FROM autoresponder_schedule s
+    USING autoresponder_steps st, autoresponder_sequences sq, subscribers sub
+    WHERE st.id = s.step_id AND sq.id = st.sequence_id AND sub.id = s.subscriber_id
+    AND (
+        sub.status != 'enabled'
+        OR sq.enabled = false
+        OR NOT EXISTS (
+            SELECT 1 FROM subscriber_lists sl WHERE sl.subscriber_id = s.subscriber_id
+                AND sl.list_id = s.list_id AND sl.status != 'unsubscribed'
+        )
+        OR EXISTS (
+            SELECT 1 FROM autoresponder_history h WHERE h.campaign_id = s.campaign_id
+                AND h.subscriber_id = s.subscriber_id AND h.list_id = s.list_id
+        )
+    );
+
+-- name: get-due-autoresponders
+-- Get scheduled sends ($1 = limit) that are due and whose campaigns are running, and reserve
+-- them by pushing their send_at by the lease duration ($2 seconds) so that they aren't picked
+-- up by other instances. Sends that aren't sent or rescheduled in the meantime (eg: on a crash)
+-- are picked up again after the lease. Sends of paused autoresponder campaigns stay in the
+-- schedule until they're resumed.
+UPDATE autoresponder_schedule SET send_at = NOW() + MAKE_INTERVAL(secs => $2)
+    WHERE id IN (
+        SELECT s.id FROM autoresponder_schedule s
+        JOIN campaigns c ON c.id = s.campaign_id
+        WHERE s.send_at <= NOW() AND c.status = 'running'
+        ORDER BY s.send_at, s.id
+        LIMIT $1
+        FOR UPDATE OF s SKIP LOCKED
+    )
+    RETURNING *;
+
+-- name: retry-scheduled-autoresponder
+-- Reschedule a send that failed to be retried at $3.
+UPDATE autoresponder_schedule SET attempts=$2, send_at=$3 WHERE id = $1;
+
+-- name: delete-scheduled-autoresponder
+DELETE FROM autoresponder_schedule WHERE id = $1;
@@ -1,6 +1,6 @@
 -- campaigns
 -- name: create-campaign
--- This creates the campaign and inserts campaign_lists relationships.
+-- This creates the campaign and inserts campaign_lists and campaign_segments relationships.
 WITH tpl AS (
     -- Select the template for the given template ID or use the default template.
     SELECT
@@ -26,7 +26,9 @@ camp AS (
     INSERT INTO campaigns (uuid, type, name, subject, from_email, body, altbody,
         content_type, send_at, headers, tags, messenger, template_id, to_send,
         max_subscriber_id, archive, archive_slug, archive_template_id, archive_meta, body_source,
-        ar_trigger_on_confirm)
+        ar_trigger_on_confirm, ab_percent, ab_metric, ab_wait, local_send, local_timezone,
+        priority, message_rate, sliding_window_rate, sliding_window_duration, recurrence,
+        feed_url, feed_interval, feed_min_items, quiet_hours, exclusions, frequency_cap_exempt)
         SELECT $1, $2, $3, $4, $5,
             -- body
             COALESCE(NULLIF($6, ''), (SELECT body FROM tpl), ''),
@@ -43,9 +45,31 @@ camp AS (
             -- body_source
             COALESCE($20, (SELECT body_source FROM tpl)),
             -- ar_trigger_on_confirm
-            $21
+            $21,
+            $22, $23, $24,
+            -- local_send, local_timezone
+            $28, $29,
+            -- priority and rate limits
+            $30, $31, $32, $33,
+            -- recurrence
+            $34,
+            -- feed
+            $35, $36, $37,
+            -- quiet_hours
+            $38,
+            -- exclusions
+            $40,
+            -- frequency_cap_exempt
+            $41
         RETURNING id
 ),
+vars AS (
+    -- A/B test variants ($25 labels, $26 subjects, $27 bodies) in order.
+    INSERT INTO campaign_variants (campaign_id, label, subject, body)
+        SELECT (SELECT id FROM camp), v.label, v.subject, v.body
+        FROM UNNEST($25::TEXT[], $26::TEXT[], $27::TEXT[]) WITH ORDINALITY AS v(label, subject, body, n)
+        ORDER BY v.n
+),
 med AS (
     INSERT INTO campaign_media (campaign_id, media_id, filename)
         (SELECT (SELECT id FROM camp), id, filename FROM media WHERE id=ANY($19::INT[]))
@@ -53,6 +77,131 @@ med AS (
 insLists AS (
     INSERT INTO campaign_lists (campaign_id, list_id, list_name)
         SELECT (SELECT id FROM camp), id, name FROM lists WHERE id=ANY($14::INT[])
+),
+insSegments AS (
+    INSERT INTO campaign_segments (campaign_id, segment_id, segment_name)
+        SELECT (SELECT id FROM camp), id, name FROM segments WHERE id=ANY($39::INT[])
+)
+SELECT id FROM camp;
+
+-- name: resend-campaign
+-- Clones a finished campaign ($1) into a draft that resends it to an audience ($4) of its
+-- recipients. campaign_lists and campaign_segments are copied as-is, including the names of deleted
+-- lists, so that the resend goes to the same lists and segments as the original.
+WITH camp AS (
+    INSERT INTO campaigns (uuid, type, name, subject, from_email, body, body_source, altbody,
+        content_type, headers, tags, messenger, template_id, archive_template_id, archive_meta,
+        ar_trigger_on_confirm, priority, message_rate, sliding_window_rate, sliding_window_duration,
+        quiet_hours, exclusions, frequency_cap_exempt, resend_of, resend_audience)
+        SELECT $2, type, $3, subject, from_email, body, body_source, altbody,
+            content_type, headers, tags, messenger, template_id, archive_template_id, archive_meta,
+            ar_trigger_on_confirm, priority, message_rate, sliding_window_rate, sliding_window_duration,
+            quiet_hours, exclusions, frequency_cap_exempt, id, $4
+        FROM campaigns WHERE id = $1 AND status = 'finished'
+        RETURNING id
+),
+med AS (
+    INSERT INTO campaign_media (campaign_id, media_id, filename)
+        SELECT camp.id, cm.media_id, cm.filename FROM camp, campaign_media cm WHERE cm.campaign_id = $1
+),
+insLists AS (
+    INSERT INTO campaign_lists (campaign_id, list_id, list_name)
+        SELECT camp.id, cl.list_id, cl.list_name FROM camp, campaign_lists cl WHERE cl.campaign_id = $1
+),
+insSegments AS (
+    INSERT INTO campaign_segments (campaign_id, segment_id, segment_name)
+        SELECT camp.id, cs.segment_id, cs.segment_name FROM camp, campaign_segments cs WHERE cs.campaign_id = $1
+)
+SELECT id FROM camp;
+
+-- name: get-recurring-campaigns
+-- Retrieves the recurring campaigns that are active (scheduled).
+SELECT * FROM campaigns WHERE status = 'scheduled' AND recurrence != '';
+
+-- name: update-campaign-recurrence
+-- Moves the next occurrence of a recurring campaign from $2 to $3, eg: to skip an occurrence.
+UPDATE campaigns SET recurrence_next=$3
+    WHERE id=$1 AND status='scheduled' AND recurrence != '' AND recurrence_next IS NOT DISTINCT FROM $2;
+
+-- name: create-campaign-run
+-- Creates a run of a recurring campaign ($1) for its occurrence at $2 and moves its next
+-- occurrence to $3. The run is a copy of the campaign that's scheduled to be sent right away.
+-- Nothing is created if the occurrence has already been run or skipped.
+WITH parent AS (
+    UPDATE campaigns SET recurrence_next=$3
+        WHERE id=$1 AND status='scheduled' AND recurrence != '' AND recurrence_next = $2
+        RETURNING *
+),
+camp AS (
+    INSERT INTO campaigns (uuid, type, name, subject, from_email, body, body_source, altbody,
+        content_type, send_at, status, headers, tags, messenger, template_id, archive, archive_slug,
+        archive_template_id, archive_meta, priority, message_rate, sliding_window_rate,
+        sliding_window_duration, quiet_hours, exclusions, frequency_cap_exempt, parent_id)
+        SELECT $4, type, $5, subject, from_email, body, body_source, altbody,
+            content_type, NOW(), 'scheduled', headers, tags, messenger, template_id, archive,
+            (CASE WHEN archive_slug IS NOT NULL THEN archive_slug || '-' || TO_CHAR($2::TIMESTAMP WITH TIME ZONE, 'YYYY-MM-DD-HH24MI') END),
+            archive_template_id, archive_meta, priority, message_rate, sliding_window_rate,
+            sliding_window_duration, quiet_hours, exclusions, frequency_cap_exempt, id
+        FROM parent
+        RETURNING id
+),
+med AS (
+    INSERT INTO campaign_media (campaign_id, media_id, filename)
+        SELECT camp.id, cm.media_id, cm.filename FROM camp, campaign_media cm WHERE cm.campaign_id = $1
+),
+insLists AS (
+    INSERT INTO campaign_lists (campaign_id, list_id, list_name)
+        SELECT camp.id, cl.list_id, cl.list_name FROM camp, campaign_lists cl WHERE cl.campaign_id = $1
+),
+insSegments AS (
+    INSERT INTO campaign_segments (campaign_id, segment_id, segment_name)
+        SELECT camp.id, cs.segment_id, cs.segment_name FROM camp, campaign_segments cs WHERE cs.campaign_id = $1
+)
+SELECT id FROM camp;
+
+-- name: get-feed-campaigns
+-- Retrieves the feed campaigns that are active (scheduled) and whose feeds are to be watched.
+SELECT * FROM campaigns WHERE status = 'scheduled' AND feed_url != '' AND (send_at IS NULL OR send_at <= NOW());
+
+-- name: update-campaign-feed-guid
+-- Records the last seen item ($3) of a feed campaign and its date ($4) if it hasn't changed from $2.
+UPDATE campaigns SET feed_last_guid=$3, feed_last_published=$4
+    WHERE id=$1 AND status='scheduled' AND feed_url != '' AND feed_last_guid = $2;
+
+-- name: create-feed-campaign-run
+-- Creates a run of a feed campaign ($1) with the new items of its feed ($6) and records the
+-- last seen item ($3) and its date ($7). The run is a copy of the campaign that's scheduled to be
+-- sent right away. Nothing is created if the last seen item has changed from $2, ie: the items
+-- have already been run.
+WITH parent AS (
+    UPDATE campaigns SET feed_last_guid=$3, feed_last_published=$7, feed_last_run=NOW()
+        WHERE id=$1 AND status='scheduled' AND feed_url != '' AND feed_last_guid = $2
+        RETURNING *
+),
+camp AS (
+    INSERT INTO campaigns (uuid, type, name, subject, from_email, body, body_source, altbody,
+        content_type, send_at, status, headers, tags, messenger, template_id, archive, archive_slug,
+        archive_template_id, archive_meta, priority, message_rate, sliding_window_rate,
+        sliding_window_duration, quiet_hours, exclusions, frequency_cap_exempt, parent_id, feed)
+        SELECT $4, type, $5, subject, from_email, body, body_source, altbody,
+            content_type, NOW(), 'scheduled', headers, tags, messenger, template_id, archive,
+            (CASE WHEN archive_slug IS NOT NULL THEN archive_slug || '-' || TO_CHAR(NOW(), 'YYYY-MM-DD-HH24MI') END),
+            archive_template_id, archive_meta, priority, message_rate, sliding_window_rate,
+            sliding_window_duration, quiet_hours, exclusions, frequency_cap_exempt, id, $6
+        FROM parent
+        RETURNING id
+),
+med AS (
+    INSERT INTO campaign_media (campaign_id, media_id, filename)
+        SELECT camp.id, cm.media_id, cm.filename FROM camp, campaign_media cm WHERE cm.campaign_id = $1
+),
+insLists AS (
+    INSERT INTO campaign_lists (campaign_id, list_id, list_name)
+        SELECT camp.id, cl.list_id, cl.list_name FROM camp, campaign_lists cl WHERE cl.campaign_id = $1
+),
+insSegments AS (
+    INSERT INTO campaign_segments (campaign_id, segment_id, segment_name)
+        SELECT camp.id, cs.segment_id, cs.segment_name FROM camp, campaign_segments cs WHERE cs.campaign_id = $1
 )
 SELECT id FROM camp;
 
@@ -83,11 +232,18 @@ WHERE ($1 = 0 OR id = $1)
             SELECT 1 FROM campaign_lists WHERE campaign_id = c.id AND list_id = ANY($6::INT[])
         )
     )
+    -- Runs of a recurring or feed campaign.
+    AND ($9 = 0 OR c.parent_id = $9)
 ORDER BY %order% OFFSET $7 LIMIT (CASE WHEN $8 < 1 THEN NULL ELSE $8 END);
 
 -- name: get-campaign
 SELECT campaigns.*,
-    COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1), '') AS template_body
+    COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1), '') AS template_body,
+    (
+        SELECT COALESCE(JSON_AGG(JSON_BUILD_OBJECT('id', v.id, 'label', v.label, 'subject', v.subject,
+            'body', v.body, 'sent', v.sent) ORDER BY v.id), '[]')
+        FROM campaign_variants v WHERE v.campaign_id = campaigns.id
+    ) AS variants
     FROM campaigns
     LEFT JOIN templates ON (
         CASE WHEN $4 = 'default' THEN templates.id = campaigns.template_id
@@ -111,7 +267,7 @@ SELECT COUNT(*) OVER () AS total, campaigns.*,
     ORDER by campaigns.created_at DESC OFFSET $1 LIMIT $2;
 
 -- name: get-campaign-stats
--- This query is used to lazy load campaign stats (views, counts, list of lists) given a list of campaign IDs.
+-- This query is used to lazy load campaign stats (views, counts, list of lists and segments) given a list of campaign IDs.
 -- The query returns results in the same order as the given campaign IDs, and for non-existent campaign IDs,
 -- the query still returns a row with 0 values. Thus, for lazy loading, the application simply iterate on the results in
 -- the same order as the list of campaigns it would've queried and attach the results.
@@ -119,10 +275,18 @@ WITH lists AS (
     SELECT campaign_id, JSON_AGG(JSON_BUILD_OBJECT('id', list_id, 'name', list_name)) AS lists FROM campaign_lists
     WHERE campaign_id = ANY($1) GROUP BY campaign_id
 ),
+segs AS (
+    SELECT campaign_id, JSON_AGG(JSON_BUILD_OBJECT('id', segment_id, 'name', segment_name)) AS segments FROM campaign_segments
+    WHERE campaign_id = ANY($1) GROUP BY campaign_id
+),
 media AS (
     SELECT campaign_id, JSON_AGG(JSON_BUILD_OBJECT('id', media_id, 'filename', filename)) AS media FROM campaign_media
     WHERE campaign_id = ANY($1) GROUP BY campaign_id
 ),
+capped AS (
+    SELECT campaign_id, COUNT(*) AS num FROM frequency_sends
+    WHERE campaign_id = ANY($1) AND capped GROUP BY campaign_id
+),
 views AS (
     SELECT campaign_id, COUNT(campaign_id) as num FROM campaign_views
     WHERE campaign_id = ANY($1)
@@ -142,14 +306,18 @@ SELECT id as campaign_id,
     COALESCE(v.num, 0) AS views,
     COALESCE(c.num, 0) AS clicks,
     COALESCE(b.num, 0) AS bounces,
+    COALESCE(cp.num, 0) AS capped,
     COALESCE(l.lists, '[]') AS lists,
+    COALESCE(sg.segments, '[]') AS segments,
     COALESCE(m.media, '[]') AS media
 FROM (SELECT id FROM UNNEST($1) AS id) x
 LEFT JOIN lists AS l ON (l.campaign_id = id)
+LEFT JOIN segs AS sg ON (sg.campaign_id = id)
 LEFT JOIN media AS m ON (m.campaign_id = id)
 LEFT JOIN views AS v ON (v.campaign_id = id)
 LEFT JOIN clicks AS c ON (c.campaign_id = id)
 LEFT JOIN bounces AS b ON (b.campaign_id = id)
+LEFT JOIN capped AS cp ON (cp.campaign_id = id)
 ORDER BY ARRAY_POSITION($1, id);
 
 -- name: get-campaign-for-preview
@@ -174,6 +342,73 @@ SELECT EXISTS (
     SELECT TRUE FROM campaign_lists WHERE campaign_id = $1 AND list_id = ANY($2::INT[])
 );
 
+-- name: campaign-audience
+-- raw: true
+-- The audience settings of campaigns that the campaign send filters below use, the resend
+-- audience and the exclusions. It's substituted for %campaign_audience% in next-campaigns and
+-- count-campaign-segment-subscribers, which join it as aud. next-campaign-subscribers takes
+-- the same columns as arguments.
+SELECT c.id AS campaign_id, c.type,
+    COALESCE(c.resend_of, 0) AS resend_of,
+    COALESCE(c.resend_audience, '') AS resend_audience,
+    COALESCE(orig.last_subscriber_id, 0) AS resend_last_subscriber_id,
+    ARRAY(SELECT JSONB_ARRAY_ELEMENTS_TEXT(COALESCE(c.exclusions->'lists', '[]'))::INT) AS exclude_lists,
+    COALESCE((c.exclusions->>'sent_within_days')::INT, 0) AS sent_within_days
+FROM campaigns c
+LEFT JOIN campaigns orig ON (orig.id = c.resend_of)
+
+-- name: campaign-list-optin-filter
+-- raw: true
+-- Picks the subscriptions (sl) to the lists (l) of a campaign (aud) that it's sent to. Opt-in
+-- campaigns are only sent to the unconfirmed subscribers of double opt-in lists, and the rest
+-- to the confirmed subscribers of double opt-in lists and the ones of single opt-in lists
+-- who haven't unsubscribed. It's substituted for %list_optin_filter%.
+CASE
+    WHEN aud.type = 'optin' THEN sl.status = 'unconfirmed' AND l.optin = 'double'
+    WHEN l.optin = 'double' THEN sl.status = 'confirmed'
+    ELSE sl.status != 'unsubscribed'
+END
+
+-- name: campaign-segment-optin-filter
+-- raw: true
+-- Picks the subscribers (s) of a campaign's segments who are subscribed to at least one list,
+-- as per the list's opt-in. It's substituted for %segment_optin_filter%.
+EXISTS (
+    SELECT 1 FROM subscriber_lists sl JOIN lists l ON (l.id = sl.list_id)
+    WHERE sl.subscriber_id = s.id
+    AND (CASE WHEN l.optin = 'double' THEN sl.status = 'confirmed' ELSE sl.status != 'unsubscribed' END)
+)
+
+-- name: campaign-resend-filter
+-- raw: true
+-- For resends, picks the subscribers (s) who are recipients of the original campaign (resend_of)
+-- in the resend audience of the campaign (aud). Subscribers up to the original campaign's
+-- last_subscriber_id are the ones that it was sent to. It's substituted for %resend_filter%.
+aud.resend_audience = ''
+OR (aud.resend_audience = 'failed' AND EXISTS (
+    SELECT 1 FROM campaign_sends cs WHERE cs.campaign_id = aud.resend_of AND cs.subscriber_id = s.id AND cs.status = 'failed'
+))
+OR (aud.resend_audience = 'not_opened' AND s.id <= aud.resend_last_subscriber_id AND NOT EXISTS (
+    SELECT 1 FROM campaign_views cv WHERE cv.campaign_id = aud.resend_of AND cv.subscriber_id = s.id
+))
+OR (aud.resend_audience = 'not_clicked' AND s.id <= aud.resend_last_subscriber_id AND NOT EXISTS (
+    SELECT 1 FROM link_clicks lc WHERE lc.campaign_id = aud.resend_of AND lc.subscriber_id = s.id
+))
+
+-- name: campaign-exclusion-filter
+-- raw: true
+-- Leaves out the subscribers (s) of a campaign's (aud) excluded lists and the ones sent another
+-- campaign in the last sent_within_days days (0 to not exclude any). The subscribers of its
+-- excluded segments are left out by the queries that have them. It's substituted for %exclusion_filter%.
+NOT EXISTS (
+    SELECT 1 FROM subscriber_lists xl WHERE xl.subscriber_id = s.id AND xl.status != 'unsubscribed'
+    AND xl.list_id = ANY(aud.exclude_lists)
+)
+AND (aud.sent_within_days = 0 OR NOT EXISTS (
+    SELECT 1 FROM campaign_sends xs WHERE xs.subscriber_id = s.id AND xs.campaign_id != aud.campaign_id AND xs.status = 'sent'
+    AND xs.created_at > NOW() - MAKE_INTERVAL(days => aud.sent_within_days)
+))
+
 -- name: next-campaigns
 -- Retreives campaigns that are running (or scheduled and the time's up) and need
 -- to be processed. It updates the to_send count and max_subscriber_id of the campaign,
@@ -181,14 +416,44 @@ SELECT EXISTS (
 -- Thus, it has a sideaffect.
 -- In addition, it finds the max_subscriber_id, the upper limit across all lists of
 -- a campaign. This is used to fetch and slice subscribers for the campaign in next-campaign-subscribers.
+-- Excluded subscribers aren't counted, except for the ones in excluded segments.
+-- Campaigns with segments or excluded segments are counted with count-campaign-segment-subscribers
+-- instead when they start, for which it returns their query expressions, and keep those counts.
 WITH camps AS (
     -- Get all running campaigns and their template bodies (if the template's deleted, the default template body instead)
-    SELECT campaigns.*, COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1), '') AS template_body
+    SELECT campaigns.*, COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1), '') AS template_body,
+        ARRAY(
+            SELECT segments.query FROM campaign_segments JOIN segments ON (segments.id = campaign_segments.segment_id)
+            WHERE campaign_segments.campaign_id = campaigns.id ORDER BY segments.id
+        ) AS segment_queries,
+        ARRAY(
+            SELECT segments.query FROM segments WHERE campaigns.exclusions->'segments' @> TO_JSONB(segments.id)
+            ORDER BY segments.id
+        ) AS exclude_segment_queries
     FROM campaigns
     LEFT JOIN templates ON (templates.id = campaigns.template_id)
-    WHERE (status='running' OR (status='scheduled' AND NOW() >= campaigns.send_at))
+    -- Campaigns sent in subscribers' local time start when send_at's local time arrives
+    -- in the earliest timezone, UTC+14.
+    WHERE (status='running' OR (status='scheduled' AND NOW() >= (
+        CASE WHEN campaigns.local_send THEN (campaigns.send_at AT TIME ZONE campaigns.local_timezone) AT TIME ZONE 'Etc/GMT-14'
+        ELSE campaigns.send_at END
+    )))
     AND campaigns.type != 'autoresponder'
+    -- Recurring and feed campaigns aren't sent themselves, their runs are.
+    AND campaigns.recurrence = ''
+    AND campaigns.feed_url = ''
     AND NOT(campaigns.id = ANY($1::INT[]))
+    -- Skip A/B tested campaigns whose test has been sent and are waiting for the results.
+    AND NOT (
+        campaigns.ab_percent > 0 AND campaigns.ab_winner_id IS NULL AND campaigns.ab_tested_at IS NOT NULL
+        AND NOW() < campaigns.ab_tested_at + MAKE_INTERVAL(mins => campaigns.ab_wait)
+    )
+    -- Skip local time campaigns between waves. Waves are started every 15 minutes,
+    -- the granularity of timezone offsets.
+    AND NOT (
+        campaigns.local_send AND campaigns.local_wave_until IS NULL AND campaigns.local_sent_until IS NOT NULL
+        AND NOW() < campaigns.local_sent_until + INTERVAL '15 minutes'
+    )
 ),
 campLists AS (
     -- Get the list_ids and their optin statuses for the campaigns found in the previous step.
@@ -203,19 +468,15 @@ campMedia AS (
     GROUP BY campaign_id
 ),
 counts AS (
-    SELECT camps.id AS campaign_id, COUNT(DISTINCT sl.subscriber_id) AS to_send, COALESCE(MAX(sl.subscriber_id), 0) AS max_subscriber_id
+    SELECT camps.id AS campaign_id, COUNT(DISTINCT sl.subscriber_id) AS to_send, COALESCE(MAX(sl.subscriber_id), 0) AS max_subscriber_id,
+        CARDINALITY(camps.segment_queries) + CARDINALITY(camps.exclude_segment_queries) > 0 AS segmented
     FROM camps
-    JOIN campLists cl ON cl.campaign_id = camps.id
-    JOIN subscriber_lists sl ON sl.list_id = cl.list_id
-        AND (
-            CASE
-                WHEN camps.type = 'optin' THEN sl.status = 'unconfirmed' AND cl.optin = 'double'
-                WHEN cl.optin = 'double' THEN sl.status = 'confirmed'
-                ELSE sl.status != 'unsubscribed'
-            END
-        )
+    JOIN (%campaign_audience%) aud ON (aud.campaign_id = camps.id)
+    JOIN campLists l ON l.campaign_id = camps.id
+    JOIN subscriber_lists sl ON sl.list_id = l.list_id AND (%list_optin_filter%)
     JOIN subscribers s ON (s.id = sl.subscriber_id AND s.status != 'blocklisted')
-    GROUP BY camps.id
+    WHERE (%resend_filter%) AND (%exclusion_filter%)
+    GROUP BY camps.id, camps.segment_queries, camps.exclude_segment_queries
 ),
 updateCounts AS (
     WITH uc (campaign_id, sent_count) AS (SELECT * FROM unnest($1::INT[], $2::INT[]))
@@ -224,16 +485,71 @@ updateCounts AS (
     FROM uc WHERE campaigns.id = uc.campaign_id
 ),
 u AS (
-    -- For each campaign, update the to_send count and set the max_subscriber_id.
+    -- For each campaign, update the to_send count and set the max_subscriber_id. The ones with
+    -- segments are counted with count-campaign-segment-subscribers, which also starts them.
     UPDATE campaigns AS ca
-    SET to_send = co.to_send,
+    SET to_send = (CASE WHEN co.segmented THEN ca.to_send ELSE co.to_send END),
         status = (CASE WHEN status != 'running' THEN 'running' ELSE status END),
-        max_subscriber_id = co.max_subscriber_id,
-        started_at=(CASE WHEN ca.started_at IS NULL THEN NOW() ELSE ca.started_at END)
+        max_subscriber_id = (CASE WHEN co.segmented THEN ca.max_subscriber_id ELSE co.max_subscriber_id END),
+        started_at=(CASE WHEN ca.started_at IS NULL AND NOT co.segmented THEN NOW() ELSE ca.started_at END),
+        -- Start a new wave of a local time campaign that covers the subscribers whose
+        -- local time has arrived.
+        local_wave_until=(CASE WHEN ca.local_send AND ca.local_wave_until IS NULL THEN NOW() ELSE ca.local_wave_until END)
     FROM (SELECT * FROM counts) co
     WHERE ca.id = co.campaign_id
 )
-SELECT camps.*, campMedia.media_id FROM camps LEFT JOIN campMedia ON (campMedia.campaign_id = camps.id);
+SELECT camps.*, campMedia.media_id,
+    (
+        SELECT COALESCE(JSON_AGG(JSON_BUILD_OBJECT('id', v.id, 'label', v.label, 'subject', v.subject,
+            'body', v.body, 'sent', v.sent) ORDER BY v.id), '[]')
+        FROM campaign_variants v WHERE v.campaign_id = camps.id
+    ) AS variants
+FROM camps LEFT JOIN campMedia ON (campMedia.campaign_id = camps.id);
+
+-- name: count-campaign-segment-subscribers
+-- raw: true
+-- Counts the subscribers (to_send) and max_subscriber_id of a campaign ($1) with segments when
+-- next-campaigns starts it (or a wave of it), which only counts the subscribers of lists, to cover
+-- the subscribers of its segments too (%segments%, their query expressions) and leave out the
+-- ones in its excluded segments (%exclude_segments%). It's run in a read-only transaction as the segments' expressions are
+-- arbitrary SQL, and the counts are then recorded with update-campaign-segment-counts.
+WITH aud AS (
+    SELECT aud.* FROM campaigns
+    JOIN (%campaign_audience%) aud ON (aud.campaign_id = campaigns.id)
+    WHERE campaigns.id = $1 AND campaigns.status IN ('scheduled', 'running')
+),
+subs AS (
+    -- Opt-in campaigns aren't sent to segments.
+    SELECT sl.subscriber_id AS id FROM aud
+    JOIN campaign_lists cl ON (cl.campaign_id = aud.campaign_id)
+    JOIN lists l ON (l.id = cl.list_id)
+    JOIN subscriber_lists sl ON (sl.list_id = l.id) AND (%list_optin_filter%)
+    UNION
+    SELECT s.id FROM aud, subscribers s
+    WHERE aud.type != 'optin'
+        AND EXISTS (SELECT 1 FROM subscribers WHERE subscribers.id = s.id AND (%segments%))
+        AND %segment_optin_filter%
+),
+counts AS (
+    SELECT COUNT(*) AS to_send, COALESCE(MAX(s.id), 0) AS max_subscriber_id
+    FROM aud, subs
+    JOIN subscribers s ON (s.id = subs.id AND s.status != 'blocklisted')
+    WHERE (%resend_filter%) AND (%exclusion_filter%)
+    AND NOT EXISTS (SELECT 1 FROM subscribers WHERE subscribers.id = s.id AND (%exclude_segments%))
+)
+SELECT counts.to_send, counts.max_subscriber_id FROM aud, counts;
+
+-- name: update-campaign-segment-counts
+-- Records the to_send count ($2) and max_subscriber_id ($3) of a campaign ($1) with segments
+-- counted by count-campaign-segment-subscribers. Like next-campaigns, it marks the campaign as running
+-- and started.
+UPDATE campaigns AS ca
+SET to_send = $2,
+    max_subscriber_id = $3,
+    status = 'running',
+    started_at = COALESCE(ca.started_at, NOW()),
+    local_wave_until = (CASE WHEN ca.local_send AND ca.local_wave_until IS NULL THEN NOW() ELSE ca.local_wave_until END)
+WHERE ca.id = $1 AND ca.status IN ('scheduled', 'running');
 
 -- name: get-campaign-analytics-unique-counts
 WITH intval AS (
@@ -279,19 +595,67 @@ SELECT COUNT(%s) AS "count", url
     WHERE campaign_id=ANY($1) AND link_clicks.created_at >= $2 AND link_clicks.created_at <= $3
     GROUP BY links.url ORDER BY "count" DESC LIMIT 50;
 
+-- name: get-campaign-variant-stats
+-- Returns the sent counts and the unique views and clicks of the A/B test variants of
+-- campaigns ($1) by the subscribers in the test between $2 and $3. Subscribers in the test
+-- are the ones whose ID % 100 < ab_percent and the variant of a subscriber is the one at
+-- the position ID % (number of variants).
+WITH vars AS (
+    SELECT v.id, v.campaign_id, v.label, v.subject, v.sent, c.ab_percent, (v.id = c.ab_winner_id) AS winner,
+        ROW_NUMBER() OVER (PARTITION BY v.campaign_id ORDER BY v.id) - 1 AS idx,
+        COUNT(*) OVER (PARTITION BY v.campaign_id) AS num
+    FROM campaign_variants v
+    JOIN campaigns c ON (c.id = v.campaign_id)
+    WHERE v.campaign_id = ANY($1::INT[])
+)
+SELECT id, campaign_id, label, subject, sent, COALESCE(winner, false) AS winner,
+    (
+        SELECT COUNT(DISTINCT cv.subscriber_id) FROM campaign_views cv
+        WHERE cv.campaign_id = vars.campaign_id AND cv.created_at >= $2 AND cv.created_at <= $3
+            AND cv.subscriber_id % 100 < vars.ab_percent AND cv.subscriber_id % vars.num = vars.idx
+    ) AS views,
+    (
+        SELECT COUNT(DISTINCT lc.subscriber_id) FROM link_clicks lc
+        WHERE lc.campaign_id = vars.campaign_id AND lc.created_at >= $2 AND lc.created_at <= $3
+            AND lc.subscriber_id % 100 < vars.ab_percent AND lc.subscriber_id % vars.num = vars.idx
+    ) AS clicks
+FROM vars ORDER BY campaign_id, id;
+
 -- name: get-running-campaign
 -- Returns the metadata for a running campaign that is required by next-campaign-subscribers to retrieve
 -- a batch of campaign subscribers for processing.
-SELECT campaigns.id AS campaign_id, campaigns.type as campaign_type, last_subscriber_id, max_subscriber_id, lists.id AS list_id
+-- For resends, it also returns the original campaign and its last_subscriber_id, the last
+-- subscriber that the original campaign was sent to. For A/B tested campaigns, ab_testing
+-- is true until a winning variant is picked. For local time campaigns, it returns send_at's
+-- local time and the range of the current wave, and its exclusions.
+SELECT campaigns.id AS campaign_id, campaigns.type as campaign_type, campaigns.last_subscriber_id,
+    campaigns.max_subscriber_id, COALESCE(lists.id, 0) AS list_id,
+    COALESCE(campaigns.resend_of, 0) AS resend_of,
+    COALESCE(campaigns.resend_audience, '') AS resend_audience,
+    COALESCE(orig.last_subscriber_id, 0) AS resend_last_subscriber_id,
+    campaigns.ab_percent, (campaigns.ab_winner_id IS NULL) AS ab_testing,
+    campaigns.local_send, campaigns.local_timezone,
+    COALESCE(campaigns.send_at AT TIME ZONE campaigns.local_timezone, NOW()::TIMESTAMP) AS local_time,
+    COALESCE(campaigns.local_sent_until, TO_TIMESTAMP(0)) AS local_wave_from,
+    COALESCE(campaigns.local_wave_until, NOW()) AS local_wave_until,
+    campaigns.exclusions
     FROM campaigns
     LEFT JOIN campaign_lists ON (campaign_lists.campaign_id = campaigns.id)
     LEFT JOIN lists ON (lists.id = campaign_lists.list_id)
+    LEFT JOIN campaigns orig ON (orig.id = campaigns.resend_of)
     WHERE campaigns.id = $1 AND campaigns.status='running';
 
 -- name: next-campaign-subscribers
+-- raw: true
 -- Returns a batch of subscribers in a given campaign starting from the last checkpoint
--- (last_subscriber_id). Every fetch updates the checkpoint and the sent count, which means
--- every fetch returns a new batch of subscribers until all rows are exhausted.
+-- (last_subscriber_id). After every fetch, the checkpoint is moved to the last subscriber
+-- in the batch (update-campaign-counts), which means every fetch returns a new batch of
+-- subscribers until all rows are exhausted.
+--
+-- The subscribers of the campaign's segments are added to the subscribers of its lists.
+-- %segments% is replaced with the segments' query expressions, or FALSE if there are none.
+-- Likewise, %exclude_segments% with the expressions of its excluded segments. As they're
+-- arbitrary SQL, the query is run in a read-only transaction.
 --
 -- In previous versions, get-running-campaign + this was a single query spread across multiple
 -- CTEs, but despite numerous permutations and combinations, Postgres query planner simply would not use
@@ -300,17 +664,44 @@ SELECT campaigns.id AS campaign_id, campaigns.type as campaign_type, last_subscr
 -- the query planner works as expected. The difference is staggering. ~15 seconds on a subscribers table with 15m
 -- rows and a subscriber_lists table with 70 million rows when fetching subscribers for a campaign with a single list,
 -- vs. a few million seconds using this current approach.
-WITH campLists AS (
+WITH aud AS NOT MATERIALIZED (
+    -- The campaign's audience settings used by the filters, the same columns as campaign-audience.
+    -- It's inlined so that the planner sees them as the constant arguments they are.
+    SELECT $1::INT AS campaign_id, $2::TEXT AS type, $7::INT AS resend_of, $8::TEXT AS resend_audience,
+        $9::INT AS resend_last_subscriber_id, $17::INT[] AS exclude_lists, $18::INT AS sent_within_days
+),
+campLists AS (
     SELECT lists.id AS list_id, optin FROM lists
     LEFT JOIN campaign_lists ON campaign_lists.list_id = lists.id
     WHERE campaign_lists.campaign_id = $1
 ),
+segSubs AS (
+    -- Subscribers in the segments who are subscribed to at least one list. The rest are the same
+    -- as the filters below. Opt-in campaigns aren't sent to segments.
+    SELECT s.id FROM aud, subscribers s
+    WHERE $2 != 'optin'
+        AND EXISTS (SELECT 1 FROM subscribers WHERE subscribers.id = s.id AND (%segments%))
+        AND s.id > $3
+        AND s.id <= $4
+        AND s.status != 'blocklisted'
+        AND %segment_optin_filter%
+        AND (%resend_filter%)
+        AND ($10 = 0 OR (s.id % 100 < $10) = $11)
+        AND (NOT $12 OR TSTZRANGE($15::TIMESTAMPTZ, $16::TIMESTAMPTZ, '(]') @> (
+            $14::TIMESTAMP AT TIME ZONE (
+                CASE WHEN s.attribs->>'timezone' IN (SELECT name FROM pg_timezone_names) THEN s.attribs->>'timezone' ELSE $13 END
+            )
+        ))
+        AND (%exclusion_filter%)
+        AND NOT EXISTS (SELECT 1 FROM subscribers WHERE subscribers.id = s.id AND (%exclude_segments%))
+    ORDER BY s.id LIMIT $6
+),
 subs AS (
     SELECT s.*
     FROM (
-        SELECT DISTINCT s.id
-        FROM subscriber_lists sl
-        JOIN campLists ON sl.list_id = campLists.list_id
+        (SELECT DISTINCT s.id
+        FROM aud, subscriber_lists sl
+        JOIN campLists l ON sl.list_id = l.list_id
         JOIN subscribers s ON s.id = sl.subscriber_id
         WHERE
             sl.list_id = ANY($5::INT[])
@@ -320,27 +711,30 @@ subs AS (
             AND s.id <= $4
              -- Subscriber should not be blacklisted.
             AND s.status != 'blocklisted'
-            AND (
-                -- If it's an optin campaign and the list is double-optin, only pick unconfirmed subscribers.
-                ($2 = 'optin' AND sl.status = 'unconfirmed' AND campLists.optin = 'double')
-                OR (
-                    -- It is a regular campaign.
-                    $2 != 'optin' AND (
-                        -- It is a double optin list. Only pick confirmed subscribers.
-                        (campLists.optin = 'double' AND sl.status = 'confirmed') OR
-
-                        -- It is a single optin list. Pick all non-unsubscribed subscribers.
-                        (campLists.optin != 'double' AND sl.status != 'unsubscribed')
-                    )
+            -- For resends, only pick the recipients of the original campaign ($7) that are in
+            -- the resend audience ($8).
+            AND (%resend_filter%)
+            -- For A/B tested campaigns, pick the subscribers in the test, $10 % of the subscribers
+            -- by ID, while testing ($11), and the rest of the subscribers after that.
+            AND ($10 = 0 OR (s.id % 100 < $10) = $11)
+            -- For local time campaigns ($12), pick the subscribers for whom the campaign's local time ($14)
+            -- in their timezone (attribs.timezone, or the campaign's timezone, $13, if it's not set or invalid)
+            -- falls in the current wave ($15, $16].
+            AND (NOT $12 OR TSTZRANGE($15::TIMESTAMPTZ, $16::TIMESTAMPTZ, '(]') @> (
+                $14::TIMESTAMP AT TIME ZONE (
+                    CASE WHEN s.attribs->>'timezone' IN (SELECT name FROM pg_timezone_names) THEN s.attribs->>'timezone' ELSE $13 END
                 )
-            )
-        ORDER BY s.id LIMIT $6
+            ))
+            -- Exclude the subscribers of the excluded lists ($17), the ones sent another campaign in the
+            -- last $18 days (0 to not exclude any), and the ones in the excluded segments.
+            AND (%exclusion_filter%)
+            AND NOT EXISTS (SELECT 1 FROM subscribers WHERE subscribers.id = s.id AND (%exclude_segments%))
+            AND (%list_optin_filter%)
+        ORDER BY s.id LIMIT $6)
+        UNION
+        SELECT id FROM segSubs
+        ORDER BY id LIMIT $6
     ) subIDs JOIN subscribers s ON (s.id = subIDs.id) ORDER BY s.id
-),
-u AS (
-    UPDATE campaigns
-    SET last_subscriber_id = (SELECT MAX(id) FROM subs), updated_at = NOW()
-    WHERE (SELECT COUNT(id) FROM subs) > 0 AND id=$1
 )
 SELECT * FROM subs;
 
@@ -385,13 +779,58 @@ WITH camp AS (
         archive_meta=$17,
         body_source=$19,
         ar_trigger_on_confirm=$20,
+        -- A/B test settings can't be changed once the campaign has started.
+        ab_percent=(CASE WHEN started_at IS NULL THEN $21 ELSE ab_percent END),
+        ab_metric=(CASE WHEN started_at IS NULL THEN $22 ELSE ab_metric END),
+        ab_wait=(CASE WHEN started_at IS NULL THEN $23 ELSE ab_wait END),
+        -- Same with local time sending.
+        local_send=(CASE WHEN started_at IS NULL THEN $27 ELSE local_send END),
+        local_timezone=(CASE WHEN started_at IS NULL THEN $28 ELSE local_timezone END),
+        priority=$29,
+        message_rate=$30,
+        sliding_window_rate=$31,
+        sliding_window_duration=$32,
+        recurrence=$33,
+        -- The next occurrence is recomputed if the recurrence or its start (send_at) changes.
+        recurrence_next=(CASE WHEN recurrence = $33 AND send_at IS NOT DISTINCT FROM $8::TIMESTAMP WITH TIME ZONE
+            THEN recurrence_next ELSE NULL END),
+        -- A different feed is watched afresh.
+        feed_last_guid=(CASE WHEN feed_url = $34 THEN feed_last_guid ELSE '' END),
+        feed_last_published=(CASE WHEN feed_url = $34 THEN feed_last_published ELSE NULL END),
+        feed_url=$34,
+        feed_interval=$35,
+        feed_min_items=$36,
+        quiet_hours=$37,
+        exclusions=$39,
+        frequency_cap_exempt=$40,
         updated_at=NOW()
     WHERE id = $1 RETURNING id
 ),
+delVars AS (
+    -- Replace the A/B test variants ($24 labels, $25 subjects, $26 bodies) if the campaign hasn't started.
+    DELETE FROM campaign_variants WHERE campaign_id = $1
+        AND (SELECT started_at IS NULL FROM campaigns WHERE id = $1)
+),
+insVars AS (
+    INSERT INTO campaign_variants (campaign_id, label, subject, body)
+        SELECT $1, v.label, v.subject, v.body
+        FROM UNNEST($24::TEXT[], $25::TEXT[], $26::TEXT[]) WITH ORDINALITY AS v(label, subject, body, n)
+        WHERE (SELECT started_at IS NULL FROM campaigns WHERE id = $1)
+        ORDER BY v.n
+),
 clists AS (
     -- Reset list relationships
     DELETE FROM campaign_lists WHERE campaign_id = $1 AND NOT(list_id = ANY($13))
 ),
+csegments AS (
+    -- Reset segment relationships ($38).
+    DELETE FROM campaign_segments WHERE campaign_id = $1 AND NOT(segment_id = ANY($38))
+),
+isegments AS (
+    INSERT INTO campaign_segments (campaign_id, segment_id, segment_name)
+        (SELECT $1 AS campaign_id, id, name FROM segments WHERE id=ANY($38::INT[]))
+        ON CONFLICT (campaign_id, segment_id) DO UPDATE SET segment_name = EXCLUDED.segment_name
+),
 med AS (
     DELETE FROM campaign_media WHERE campaign_id = $1
     AND ( media_id IS NULL or NOT(media_id = ANY($18))) RETURNING media_id
@@ -406,13 +845,39 @@ INSERT INTO campaign_lists (campaign_id, list_id, list_name)
     ON CONFLICT (campaign_id, list_id) DO UPDATE SET list_name = EXCLUDED.list_name;
 
 -- name: update-campaign-counts
+-- Updates the sent count and the subscriber checkpoint ($4) that the campaign is resumed from.
 UPDATE campaigns SET
     to_send=(CASE WHEN $2 != 0 THEN $2 ELSE to_send END),
     sent=sent+$3,
-    last_subscriber_id=(CASE WHEN $4 > 0 THEN $4 ELSE to_send END),
+    last_subscriber_id=$4,
     updated_at=NOW()
 WHERE id=$1;
 
+-- name: update-campaign-variant-counts
+-- Increments the sent counts of the A/B test variants ($1) of a campaign by the given counts ($2).
+UPDATE campaign_variants SET sent = sent + c.sent
+    FROM (SELECT * FROM UNNEST($1::INT[], $2::INT[])) AS c(id, sent)
+    WHERE campaign_variants.id = c.id;
+
+-- name: finish-campaign-ab-test
+-- Marks the A/B test of a campaign as sent and resets the subscriber checkpoint so that
+-- the winning variant can be sent to the rest of the subscribers from the beginning.
+UPDATE campaigns SET ab_tested_at=NOW(), last_subscriber_id=0, updated_at=NOW() WHERE id=$1;
+
+-- name: finish-campaign-local-wave
+-- Marks the current wave of a local time campaign as sent and resets the subscriber checkpoint
+-- for the next wave. Returns the end of the wave. The manager checks whether the campaign's
+-- local time has passed in all timezones, the last one being UTC-12.
+UPDATE campaigns SET local_sent_until=COALESCE(local_wave_until, NOW()), local_wave_until=NULL,
+    last_subscriber_id=0, updated_at=NOW()
+    WHERE id=$1
+    RETURNING local_sent_until;
+
+-- name: update-campaign-ab-winner
+-- Records the winning A/B test variant ($2) of a campaign ($1), picked by the manager
+-- from get-campaign-variant-stats.
+UPDATE campaigns SET ab_winner_id=$2, updated_at=NOW() WHERE id=$1;
+
 -- name: update-campaign-status
 UPDATE campaigns SET
     status=(
@@ -421,6 +886,8 @@ UPDATE campaigns SET
             ELSE $2::campaign_status
         END
     ),
+    -- The next occurrence of recurring campaigns is recomputed when they're (re)scheduled.
+    recurrence_next=NULL,
     updated_at=NOW()
 WHERE id = $1;
 
@@ -458,5 +925,58 @@ WITH view AS (
     WHERE campaigns.uuid = $1
 )
 INSERT INTO campaign_views (campaign_id, subscriber_id)
-    VALUES((SELECT campaign_id FROM view), (SELECT subscriber_id FROM view));
+    VALUES((SELECT campaign_id FROM view), (SELECT subscriber_id FROM view))
+    RETURNING (SELECT tags FROM campaigns WHERE id = campaign_views.campaign_id);
+
+
+-- campaign send log
+-- name: insert-campaign-sends
+-- Record a batch of campaign message sends. Sends to subscribers or of campaigns
+-- that have been deleted in the meantime are skipped.
+INSERT INTO campaign_sends (campaign_id, subscriber_id, messenger, status, error, created_at)
+    SELECT s.campaign_id, s.subscriber_id, s.messenger, s.status, s.error, s.created_at
+    FROM UNNEST($1::INT[], $2::INT[], $3::TEXT[], $4::TEXT[], $5::TEXT[], $6::TIMESTAMP WITH TIME ZONE[])
+        AS s(campaign_id, subscriber_id, messenger, status, error, created_at)
+    JOIN campaigns c ON c.id = s.campaign_id
+    JOIN subscribers sub ON sub.id = s.subscriber_id;
 
+-- name: query-campaign-sends
+-- Query the send log of a campaign ($1) and/or a subscriber ($2), optionally by status ($3).
+SELECT COUNT(*) OVER () AS total, cs.*, c.name AS campaign_name, s.email FROM campaign_sends cs
+    JOIN campaigns c ON c.id = cs.campaign_id
+    JOIN subscribers s ON s.id = cs.subscriber_id
+    WHERE ($1 = 0 OR cs.campaign_id = $1)
+    AND ($2 = 0 OR cs.subscriber_id = $2)
+    AND ($3 = '' OR cs.status = $3)
+    ORDER BY cs.id DESC OFFSET $4 LIMIT (CASE WHEN $5 < 1 THEN NULL ELSE $5 END);
+
+-- name: delete-campaign-sends
+-- Delete send log entries older than $1 days.
+WITH d AS (
+    DELETE FROM campaign_sends WHERE created_at < NOW() - MAKE_INTERVAL(days => $1) RETURNING 1
+)
+SELECT COUNT(*) FROM d;
+
+-- name: insert-frequency-sends
+-- Record a batch of campaign messages sent to, or skipped for, subscribers for the frequency cap.
+-- Sends to subscribers or of campaigns that have been deleted in the meantime are skipped.
+INSERT INTO frequency_sends (campaign_id, subscriber_id, capped, created_at)
+    SELECT s.campaign_id, s.subscriber_id, s.capped, s.created_at
+    FROM UNNEST($1::INT[], $2::INT[], $3::BOOLEAN[], $4::TIMESTAMP WITH TIME ZONE[])
+        AS s(campaign_id, subscriber_id, capped, created_at)
+    JOIN campaigns c ON c.id = s.campaign_id
+    JOIN subscribers sub ON sub.id = s.subscriber_id;
+
+-- name: get-frequency-counts
+-- Returns the number of campaign messages sent to each of the given subscribers ($1) since $2.
+SELECT subscriber_id, COUNT(*) AS num FROM frequency_sends
+    WHERE subscriber_id = ANY($1::INT[]) AND NOT capped AND created_at > $2
+    GROUP BY subscriber_id;
+
+-- name: delete-frequency-sends
+-- Deletes the sent messages older than $1 that no longer count towards the frequency cap.
+-- Skipped (capped) messages are retained for the campaigns' stats.
+WITH d AS (
+    DELETE FROM frequency_sends WHERE NOT capped AND created_at < $1 RETURNING 1
+)
+SELECT COUNT(*) FROM d;
@@ -12,4 +12,4 @@ INSERT INTO link_clicks (campaign_id, subscriber_id, link_id) VALUES(
         (CASE WHEN $3::TEXT != '' THEN subscribers.uuid = $3::UUID ELSE FALSE END)
     ),
     (SELECT id FROM link)
-) RETURNING (SELECT url FROM link);
+) RETURNING (SELECT url FROM link), (SELECT tags FROM campaigns WHERE id = link_clicks.campaign_id);
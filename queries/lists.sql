@@ -85,5 +85,6 @@ END
 AND CASE
     -- Optional list IDs based on user permission.
     WHEN $3 = TRUE THEN TRUE ELSE id = ANY($4::INT[])
-END;
+END
+RETURNING id, uuid, name;
 
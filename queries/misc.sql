@@ -18,3 +18,11 @@ UPDATE settings SET value = $2, updated_at = NOW() WHERE key = $1;
 -- name: get-db-info
 SELECT JSON_BUILD_OBJECT('version', (SELECT VERSION()),
                         'size_mb', (SELECT ROUND(pg_database_size((SELECT CURRENT_DATABASE()))/(1024^2)))) AS info;
+
+-- name: get-smtp-warmup
+SELECT server_uuid, sent FROM smtp_warmup WHERE day = $1;
+
+-- name: add-smtp-warmup
+INSERT INTO smtp_warmup (server_uuid, day, sent)
+    SELECT UNNEST($1::TEXT[]), $2::DATE, UNNEST($3::INT[])
+    ON CONFLICT (server_uuid, day) DO UPDATE SET sent = smtp_warmup.sent + EXCLUDED.sent;
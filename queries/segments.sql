@@ -0,0 +1,60 @@
+-- segments
+-- name: get-segments
+-- Get one ($1) or all segments.
+SELECT * FROM segments WHERE (CASE WHEN $1::INT != 0 THEN id = $1 ELSE TRUE END) ORDER BY name;
+
+-- name: create-segment
+INSERT INTO segments (name, description, query) VALUES($1, $2, $3) RETURNING id;
+
+-- name: update-segment
+WITH s AS (
+    UPDATE segments SET name=$2, description=$3, query=$4, updated_at=NOW()
+    WHERE id = $1
+    RETURNING id, name
+),
+c AS (
+    UPDATE campaign_segments SET segment_name = s.name FROM s WHERE campaign_segments.segment_id = s.id
+)
+SELECT id FROM s;
+
+-- name: delete-segment
+DELETE FROM segments WHERE id = $1;
+
+-- name: count-segment-subscribers
+-- raw: true
+-- Counts the subscribers in a segment (%query%, its query expression) that campaigns are sent to,
+-- that is, the ones who aren't blocklisted and are subscribed to at least one list. This
+-- is the same as the segment filter in next-campaign-subscribers.
+SELECT COUNT(*) FROM subscribers
+    WHERE subscribers.status != 'blocklisted'
+    AND EXISTS (
+        SELECT 1 FROM subscriber_lists sl JOIN lists ON (lists.id = sl.list_id)
+        WHERE sl.subscriber_id = subscribers.id
+        AND (CASE WHEN lists.optin = 'double' THEN sl.status = 'confirmed' ELSE sl.status != 'unsubscribed' END)
+    )
+    AND (%query%);
+
+-- name: count-segments-subscribers
+-- raw: true
+-- Counts the subscribers in multiple segments in a single scan. %counts% is replaced with a
+-- COUNT(*) FILTER (WHERE <query expression>) of every segment. The rest is the same as
+-- count-segment-subscribers.
+SELECT ARRAY[%counts%]::INT[] FROM subscribers
+    WHERE subscribers.status != 'blocklisted'
+    AND EXISTS (
+        SELECT 1 FROM subscriber_lists sl JOIN lists ON (lists.id = sl.list_id)
+        WHERE sl.subscriber_id = subscribers.id
+        AND (CASE WHEN lists.optin = 'double' THEN sl.status = 'confirmed' ELSE sl.status != 'unsubscribed' END)
+    );
+
+-- name: get-campaign-segments
+-- Returns the query expressions of the (existing) segments of a campaign.
+SELECT segments.query FROM campaign_segments
+    JOIN segments ON (segments.id = campaign_segments.segment_id)
+    WHERE campaign_segments.campaign_id = $1 ORDER BY segments.id;
+
+-- name: get-campaign-exclusion-segments
+-- Returns the query expressions of the (existing) segments excluded from a campaign.
+SELECT segments.query FROM campaigns
+    JOIN segments ON (campaigns.exclusions->'segments' @> TO_JSONB(segments.id))
+    WHERE campaigns.id = $1 ORDER BY segments.id;
@@ -247,19 +247,26 @@ UPDATE subscriber_lists SET status='unsubscribed', updated_at=NOW()
 -- Unsubscribes a subscriber given a campaign UUID (from all the lists in the campaign) and the subscriber UUID.
 -- If $3 is TRUE, then all subscriptions of the subscriber is blocklisted
 -- and all existing subscriptions, irrespective of lists, unsubscribed.
+-- Campaigns sent to segments aren't limited to their lists, so their subscribers are
+-- unsubscribed from all lists.
 WITH lists AS (
     SELECT list_id FROM campaign_lists
     LEFT JOIN campaigns ON (campaign_lists.campaign_id = campaigns.id)
     WHERE campaigns.uuid = $1
 ),
+segments AS (
+    SELECT 1 FROM campaign_segments
+    LEFT JOIN campaigns ON (campaign_segments.campaign_id = campaigns.id)
+    WHERE campaigns.uuid = $1
+),
 sub AS (
     UPDATE subscribers SET status = (CASE WHEN $3 IS TRUE THEN 'blocklisted' ELSE status END)
     WHERE uuid = $2 RETURNING id
 )
 UPDATE subscriber_lists SET status = 'unsubscribed', updated_at=NOW() WHERE
     subscriber_id = (SELECT id FROM sub) AND status != 'unsubscribed' AND
-    -- If $3 is false, unsubscribe from the campaign's lists, otherwise all lists.
-    CASE WHEN $3 IS FALSE THEN list_id = ANY(SELECT list_id FROM lists) ELSE list_id != 0 END;
+    -- If $3 is false, unsubscribe from the campaign's lists, otherwise (or if it has segments) all lists.
+    CASE WHEN $3 IS FALSE AND NOT EXISTS (SELECT 1 FROM segments) THEN list_id = ANY(SELECT list_id FROM lists) ELSE list_id != 0 END;
 
 -- name: delete-unconfirmed-subscriptions
 WITH optins AS (
@@ -428,8 +435,8 @@ SELECT (SELECT email FROM prof) as email,
         COALESCE((SELECT JSON_AGG(t) FROM clicks t), '[]') AS link_clicks;
 
 -- name: get-subscriber-activity
--- Gets the subscriber's campaign views and link clicks with detailed information
--- for display in the Activity tab
+-- Gets the subscriber's campaign views, link clicks, and recent campaign sends with
+-- detailed information for display in the Activity tab
 WITH views AS (
     SELECT
         c.id,
@@ -460,7 +467,25 @@ clicks AS (
     WHERE lc.subscriber_id = $1
     GROUP BY l.id, l.url, c.id, c.uuid, c.name, c.subject
     ORDER BY last_clicked_at DESC
+),
+sends AS (
+    -- Recent entries from the campaign send log (if it's enabled).
+    SELECT
+        c.id as campaign_id,
+        c.uuid as campaign_uuid,
+        c.name as campaign_name,
+        c.subject as campaign_subject,
+        cs.messenger,
+        cs.status,
+        cs.error,
+        cs.created_at
+    FROM campaign_sends cs
+    LEFT JOIN campaigns c ON c.id = cs.campaign_id
+    WHERE cs.subscriber_id = $1
+    ORDER BY cs.id DESC
+    LIMIT 100
 )
 SELECT
     COALESCE((SELECT JSON_AGG(v) FROM views v), '[]') as campaign_views,
-    COALESCE((SELECT JSON_AGG(c) FROM clicks c), '[]') as link_clicks;
+    COALESCE((SELECT JSON_AGG(c) FROM clicks c), '[]') as link_clicks,
+    COALESCE((SELECT JSON_AGG(s) FROM sends s), '[]') as campaign_sends;
@@ -0,0 +1,71 @@
+-- webhooks
+-- name: create-webhook-delivery
+INSERT INTO webhook_deliveries (uuid, endpoint_uuid, event, payload, next_attempt_at)
+    VALUES($1, $2, $3, $4, $5) RETURNING id;
+
+-- name: next-webhook-deliveries
+-- Fetch pending deliveries of the given endpoints ($1) that are due and reserve
+-- them by pushing their next attempt by the lease duration ($3 seconds).
+UPDATE webhook_deliveries SET next_attempt_at = NOW() + MAKE_INTERVAL(secs => $3)
+    WHERE id IN (
+        SELECT id FROM webhook_deliveries
+        WHERE endpoint_uuid = ANY($1::TEXT[]) AND next_attempt_at <= NOW()
+        ORDER BY next_attempt_at, id
+        LIMIT $2
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING *;
+
+-- name: retry-webhook-delivery
+UPDATE webhook_deliveries SET attempts=$2, last_error=$3, next_attempt_at=$4, updated_at=NOW() WHERE id = $1;
+
+-- name: delete-webhook-delivery
+DELETE FROM webhook_deliveries WHERE id = $1;
+
+-- name: fail-webhook-delivery
+-- Move a pending delivery to the dead-letter queue.
+WITH d AS (
+    DELETE FROM webhook_deliveries WHERE id = $1 RETURNING *
+)
+INSERT INTO webhook_dead_letters (uuid, endpoint_uuid, event, payload, attempts, last_error, created_at)
+    SELECT uuid, endpoint_uuid, event, payload, $2, $3, created_at FROM d;
+
+-- name: query-webhook-dead-letters
+SELECT COUNT(*) OVER () AS total, * FROM webhook_dead_letters
+    WHERE ($1 = 0 OR id = $1)
+    AND ($2 = '' OR endpoint_uuid = $2)
+    AND ($3 = '' OR event = $3)
+    ORDER BY id DESC OFFSET $4 LIMIT (CASE WHEN $5 < 1 THEN NULL ELSE $5 END);
+
+-- name: replay-webhook-dead-letters
+-- Move dead-lettered deliveries back to the pending queue with a fresh set of attempts.
+WITH d AS (
+    DELETE FROM webhook_dead_letters WHERE id = ANY($1::BIGINT[]) RETURNING *
+)
+INSERT INTO webhook_deliveries (uuid, endpoint_uuid, event, payload, next_attempt_at, created_at)
+    SELECT uuid, endpoint_uuid, event, payload, NOW(), created_at FROM d;
+
+-- name: delete-webhook-dead-letters
+DELETE FROM webhook_dead_letters WHERE $2 = TRUE OR id = ANY($1::BIGINT[]);
+
+-- name: insert-webhook-log
+INSERT INTO webhook_delivery_log (endpoint_uuid, delivery_id, delivery_uuid, event, payload, attempt, status, response, error, latency_ms)
+    VALUES($1, NULLIF($2, 0), $3, $4, $5, $6, $7, $8, $9, $10);
+
+-- name: query-webhook-log
+SELECT COUNT(*) OVER () AS total, * FROM webhook_delivery_log
+    WHERE endpoint_uuid = $1
+    AND ($2 = '' OR event = $2)
+    AND (CASE
+        WHEN $3 = 'success' THEN status BETWEEN 200 AND 399
+        WHEN $3 = 'failed' THEN (status = 0 OR status >= 400)
+        ELSE TRUE
+    END)
+    ORDER BY id DESC OFFSET $4 LIMIT (CASE WHEN $5 < 1 THEN NULL ELSE $5 END);
+
+-- name: delete-webhook-log
+-- Delete log entries older than $1 days.
+WITH d AS (
+    DELETE FROM webhook_delivery_log WHERE created_at < NOW() - MAKE_INTERVAL(days => $1) RETURNING 1
+)
+SELECT COUNT(*) FROM d;
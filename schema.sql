@@ -130,6 +130,62 @@ CREATE TABLE campaigns (
     -- Autoresponder settings: trigger on opt-in confirmation (true) or subscription (false).
     ar_trigger_on_confirm BOOLEAN NOT NULL DEFAULT true,
 
+    -- Resends: the finished campaign that this campaign resends and the audience
+    -- of its recipients (failed, not_opened, not_clicked) that it's sent to.
+    resend_of        INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    resend_audience  TEXT NULL,
+
+    -- A/B testing: the variants are sent to ab_percent % of the subscribers and after
+    -- ab_wait minutes from ab_tested_at (when the test was sent), the variant with the best
+    -- ab_metric (opens|clicks) rate, ab_winner_id, is sent to the rest.
+    ab_percent       INT NOT NULL DEFAULT 0,
+    ab_metric        TEXT NOT NULL DEFAULT 'opens',
+    ab_wait          INT NOT NULL DEFAULT 240,
+    ab_tested_at     TIMESTAMP WITH TIME ZONE NULL,
+    ab_winner_id     INTEGER NULL,
+
+    -- Local time sending: send_at's time in local_timezone is the time at which the campaign
+    -- is sent to each subscriber in their timezone (attribs.timezone), in waves. local_wave_until
+    -- is the end of the wave being sent and local_sent_until, the end of the last sent wave.
+    local_send       BOOLEAN NOT NULL DEFAULT false,
+    local_timezone   TEXT NOT NULL DEFAULT 'UTC',
+    local_wave_until TIMESTAMP WITH TIME ZONE NULL,
+    local_sent_until TIMESTAMP WITH TIME ZONE NULL,
+
+    -- Sending: priority (1-10) of the campaign among running campaigns and its optional
+    -- rate limits, messages per second and per sliding window. 0 is no limit.
+    priority                 INT NOT NULL DEFAULT 5,
+    message_rate             INT NOT NULL DEFAULT 0,
+    sliding_window_rate      INT NOT NULL DEFAULT 0,
+    sliding_window_duration  TEXT NOT NULL DEFAULT '1h',
+
+    -- Recurring campaigns: a cron expression and the next occurrence. Every occurrence
+    -- creates a run, a copy of the campaign, whose parent_id is the recurring campaign.
+    recurrence       TEXT NOT NULL DEFAULT '',
+    recurrence_next  TIMESTAMP WITH TIME ZONE NULL,
+    parent_id        INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+    -- RSS/Atom feed campaigns: the feed to watch and the last seen item in it (and its date,
+    -- in case it disappears from the feed). Runs are created with the new items (feed) at
+    -- most once every feed_interval.
+    feed_url         TEXT NOT NULL DEFAULT '',
+    feed_interval    TEXT NOT NULL DEFAULT '1h',
+    feed_min_items   INT NOT NULL DEFAULT 1,
+    feed_last_guid   TEXT NOT NULL DEFAULT '',
+    feed_last_published TIMESTAMP WITH TIME ZONE NULL,
+    feed_last_run    TIMESTAMP WITH TIME ZONE NULL,
+    feed             JSONB NOT NULL DEFAULT '{}',
+
+    -- Hours and days during which the campaign isn't sent, in addition to app.quiet_hours.
+    quiet_hours      JSONB NOT NULL DEFAULT '{}',
+
+    -- Lists and segments whose subscribers are excluded from the campaign, and the number
+    -- of days within which subscribers sent any other campaign are excluded.
+    exclusions       JSONB NOT NULL DEFAULT '{"lists": [], "segments": [], "sent_within_days": 0}',
+
+    -- Exempt campaigns are sent regardless of app.frequency_cap.
+    frequency_cap_exempt BOOLEAN NOT NULL DEFAULT false,
+
     started_at       TIMESTAMP WITH TIME ZONE,
     created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
@@ -137,9 +193,26 @@ CREATE TABLE campaigns (
 DROP INDEX IF EXISTS idx_camps_status; CREATE INDEX idx_camps_status ON campaigns(status);
 DROP INDEX IF EXISTS idx_camps_name; CREATE INDEX idx_camps_name ON campaigns(name);
 DROP INDEX IF EXISTS idx_camps_created_at; CREATE INDEX idx_camps_created_at ON campaigns(created_at);
+DROP INDEX IF EXISTS idx_camps_parent_id; CREATE INDEX idx_camps_parent_id ON campaigns(parent_id);
 DROP INDEX IF EXISTS idx_camps_updated_at; CREATE INDEX idx_camps_updated_at ON campaigns(updated_at);
 
 
+-- A/B test variants of a campaign's subject and body. Empty fields fall back to the campaign's.
+-- Variants are ordered by ID.
+DROP TABLE IF EXISTS campaign_variants CASCADE;
+CREATE TABLE campaign_variants (
+    id           SERIAL PRIMARY KEY,
+    campaign_id  INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    label        TEXT NOT NULL,
+    subject      TEXT NOT NULL DEFAULT '',
+    body         TEXT NOT NULL DEFAULT '',
+
+    -- Number of test messages sent with the variant.
+    sent         INT NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_camp_variants_camp_id; CREATE INDEX idx_camp_variants_camp_id ON campaign_variants(campaign_id);
+
 DROP TABLE IF EXISTS campaign_lists CASCADE;
 CREATE TABLE campaign_lists (
     id           BIGSERIAL PRIMARY KEY,
@@ -154,6 +227,31 @@ CREATE UNIQUE INDEX ON campaign_lists (campaign_id, list_id);
 DROP INDEX IF EXISTS idx_camp_lists_camp_id; CREATE INDEX idx_camp_lists_camp_id ON campaign_lists(campaign_id);
 DROP INDEX IF EXISTS idx_camp_lists_list_id; CREATE INDEX idx_camp_lists_list_id ON campaign_lists(list_id);
 
+-- segments are saved subscriber query expressions that campaigns can be sent to
+-- in addition to lists. The expressions are evaluated when the campaigns are sent.
+DROP TABLE IF EXISTS segments CASCADE;
+CREATE TABLE segments (
+    id              SERIAL PRIMARY KEY,
+    name            TEXT NOT NULL,
+    description     TEXT NOT NULL DEFAULT '',
+    query           TEXT NOT NULL,
+
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+DROP TABLE IF EXISTS campaign_segments CASCADE;
+CREATE TABLE campaign_segments (
+    id            BIGSERIAL PRIMARY KEY,
+    campaign_id   INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    -- Like lists, segments may be deleted and a copy of the name is maintained.
+    segment_id    INTEGER NULL REFERENCES segments(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    segment_name  TEXT NOT NULL DEFAULT ''
+);
+DROP INDEX IF EXISTS idx_camp_segments_id; CREATE UNIQUE INDEX idx_camp_segments_id ON campaign_segments (campaign_id, segment_id);
+DROP INDEX IF EXISTS idx_camp_segments_camp_id; CREATE INDEX idx_camp_segments_camp_id ON campaign_segments(campaign_id);
+
 -- autoresponder_history tracks which autoresponders have been sent to which subscribers
 -- to prevent duplicate sends.
 DROP TABLE IF EXISTS autoresponder_history CASCADE;
@@ -167,6 +265,54 @@ CREATE TABLE autoresponder_history (
 );
 DROP INDEX IF EXISTS idx_ar_history_lookup; CREATE INDEX idx_ar_history_lookup ON autoresponder_history(campaign_id, subscriber_id, list_id);
 
+-- autoresponder_sequences are ordered sets of autoresponder campaigns (drip sequences)
+-- that are sent to subscribers of a list after a delay.
+DROP TABLE IF EXISTS autoresponder_sequences CASCADE;
+CREATE TABLE autoresponder_sequences (
+    id                 SERIAL PRIMARY KEY,
+    uuid uuid          NOT NULL UNIQUE,
+    name               TEXT NOT NULL,
+    list_id            INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    -- Start the sequence on opt-in confirmation (true) or subscription (false).
+    trigger_on_confirm BOOLEAN NOT NULL DEFAULT true,
+    enabled            BOOLEAN NOT NULL DEFAULT true,
+
+    created_at         TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at         TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_ar_seqs_list_id; CREATE INDEX idx_ar_seqs_list_id ON autoresponder_sequences(list_id);
+
+DROP TABLE IF EXISTS autoresponder_steps CASCADE;
+CREATE TABLE autoresponder_steps (
+    id               SERIAL PRIMARY KEY,
+    sequence_id      INTEGER NOT NULL REFERENCES autoresponder_sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    position         INTEGER NOT NULL DEFAULT 0,
+
+    -- Delay after the trigger (subscription or confirmation) after which the step is sent.
+    delay            INTERVAL NOT NULL DEFAULT '0',
+    UNIQUE(sequence_id, campaign_id)
+);
+DROP INDEX IF EXISTS idx_ar_steps_camp_id; CREATE INDEX idx_ar_steps_camp_id ON autoresponder_steps(campaign_id);
+
+-- autoresponder_schedule holds pending sequence sends that are picked up by the scheduler.
+DROP TABLE IF EXISTS autoresponder_schedule CASCADE;
+CREATE TABLE autoresponder_schedule (
+    id               BIGSERIAL PRIMARY KEY,
+    step_id          INTEGER NOT NULL REFERENCES autoresponder_steps(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    send_at          TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    -- Number of failed attempts to send. Failed sends are retried at send_at.
+    attempts         INT NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(campaign_id, subscriber_id, list_id)
+);
+DROP INDEX IF EXISTS idx_ar_schedule_send_at; CREATE INDEX idx_ar_schedule_send_at ON autoresponder_schedule(send_at);
+
 DROP TABLE IF EXISTS campaign_views CASCADE;
 CREATE TABLE campaign_views (
     id               BIGSERIAL PRIMARY KEY,
@@ -254,6 +400,10 @@ INSERT INTO settings (key, value) VALUES
     ('app.message_sliding_window', 'false'),
     ('app.message_sliding_window_duration', '"1h"'),
     ('app.message_sliding_window_rate', '10000'),
+    ('app.messenger_limits', '[]'),
+    ('app.domain_limits', '[]'),
+    ('app.quiet_hours', '{"enabled": false, "start": "22:00", "end": "07:00", "days": [], "timezone": ""}'),
+    ('app.frequency_cap', '{"enabled": false, "max": 3, "window": "24h"}'),
     ('app.cache_slow_queries', 'false'),
     ('app.cache_slow_queries_interval', '"0 3 * * *"'),
     ('app.enable_public_archive', 'true'),
@@ -310,7 +460,9 @@ INSERT INTO settings (key, value) VALUES
     ('appearance.admin.custom_js', '""'),
     ('appearance.public.custom_css', '""'),
     ('appearance.public.custom_js', '""'),
-    ('maintenance.db', '{"vacuum": false, "vacuum_cron_interval": "0 2 * * *"}');
+    ('maintenance.db', '{"vacuum": false, "vacuum_cron_interval": "0 2 * * *"}'),
+    ('maintenance.webhook_log', '{"enabled": true, "retention_days": 30}'),
+    ('maintenance.send_log', '{"enabled": false, "retention_days": 90}');
 
 -- bounces
 DROP TABLE IF EXISTS bounces CASCADE;
@@ -328,6 +480,121 @@ DROP INDEX IF EXISTS idx_bounces_camp_id; CREATE INDEX idx_bounces_camp_id ON bo
 DROP INDEX IF EXISTS idx_bounces_source; CREATE INDEX idx_bounces_source ON bounces(source);
 DROP INDEX IF EXISTS idx_bounces_date; CREATE INDEX idx_bounces_date ON bounces((TIMEZONE('UTC', created_at)::DATE));
 
+-- webhook deliveries that are pending or due for a retry
+DROP TABLE IF EXISTS webhook_deliveries CASCADE;
+CREATE TABLE webhook_deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    uuid             uuid NOT NULL UNIQUE,
+    endpoint_uuid    TEXT NOT NULL,
+    event            TEXT NOT NULL,
+    payload          JSONB NOT NULL DEFAULT '{}',
+    attempts         INT NOT NULL DEFAULT 0,
+    last_error       TEXT NOT NULL DEFAULT '',
+    next_attempt_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_webhook_deliveries_next; CREATE INDEX idx_webhook_deliveries_next ON webhook_deliveries(endpoint_uuid, next_attempt_at);
+
+-- webhook deliveries that have permanently failed (dead-letter queue)
+DROP TABLE IF EXISTS webhook_dead_letters CASCADE;
+CREATE TABLE webhook_dead_letters (
+    id               BIGSERIAL PRIMARY KEY,
+    uuid             uuid NOT NULL UNIQUE,
+    endpoint_uuid    TEXT NOT NULL,
+    event            TEXT NOT NULL,
+    payload          JSONB NOT NULL DEFAULT '{}',
+    attempts         INT NOT NULL DEFAULT 0,
+    last_error       TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    failed_at        TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_webhook_dead_letters_endpoint; CREATE INDEX idx_webhook_dead_letters_endpoint ON webhook_dead_letters(endpoint_uuid);
+
+-- log of every webhook delivery attempt and the endpoint's response
+DROP TABLE IF EXISTS webhook_delivery_log CASCADE;
+CREATE TABLE webhook_delivery_log (
+    id               BIGSERIAL PRIMARY KEY,
+    endpoint_uuid    TEXT NOT NULL,
+    delivery_id      BIGINT NULL,
+    delivery_uuid    uuid NOT NULL,
+    event            TEXT NOT NULL,
+    payload          JSONB NOT NULL DEFAULT '{}',
+    attempt          INT NOT NULL DEFAULT 1,
+    status           INT NOT NULL DEFAULT 0,
+    response         TEXT NOT NULL DEFAULT '',
+    error            TEXT NOT NULL DEFAULT '',
+    latency_ms       INT NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_webhook_delivery_log_endpoint; CREATE INDEX idx_webhook_delivery_log_endpoint ON webhook_delivery_log(endpoint_uuid, created_at);
+DROP INDEX IF EXISTS idx_webhook_delivery_log_date; CREATE INDEX idx_webhook_delivery_log_date ON webhook_delivery_log(created_at);
+
+-- automation rules that run actions on subscribers when events occur
+DROP TABLE IF EXISTS automation_rules CASCADE;
+CREATE TABLE automation_rules (
+    id               SERIAL PRIMARY KEY,
+    uuid             uuid NOT NULL UNIQUE,
+    name             TEXT NOT NULL,
+    enabled          BOOLEAN NOT NULL DEFAULT true,
+    trigger          TEXT NOT NULL,
+    trigger_attrib   TEXT NOT NULL DEFAULT '',
+    condition        TEXT NOT NULL DEFAULT '',
+    actions          JSONB NOT NULL DEFAULT '[]',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- log of automation rule runs
+DROP TABLE IF EXISTS automation_logs CASCADE;
+CREATE TABLE automation_logs (
+    id               BIGSERIAL PRIMARY KEY,
+    rule_id          INTEGER NOT NULL REFERENCES automation_rules(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    event            TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    error            TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_automation_logs_rule; CREATE INDEX idx_automation_logs_rule ON automation_logs(rule_id, created_at);
+
+-- log of campaign messages sent to subscribers
+DROP TABLE IF EXISTS campaign_sends CASCADE;
+CREATE TABLE campaign_sends (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    messenger        TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    error            TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_campaign_sends_camp; CREATE INDEX idx_campaign_sends_camp ON campaign_sends(campaign_id, subscriber_id);
+DROP INDEX IF EXISTS idx_campaign_sends_sub; CREATE INDEX idx_campaign_sends_sub ON campaign_sends(subscriber_id);
+DROP INDEX IF EXISTS idx_campaign_sends_date; CREATE INDEX idx_campaign_sends_date ON campaign_sends(created_at);
+
+-- campaign messages sent to subscribers, and the ones skipped (capped) as the subscribers had
+-- reached app.frequency_cap. The sent ones are deleted once they're past the cap's window.
+DROP TABLE IF EXISTS frequency_sends CASCADE;
+CREATE TABLE frequency_sends (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    capped           BOOLEAN NOT NULL DEFAULT false,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_frequency_sends_sub; CREATE INDEX idx_frequency_sends_sub ON frequency_sends(subscriber_id, created_at);
+DROP INDEX IF EXISTS idx_frequency_sends_camp; CREATE INDEX idx_frequency_sends_camp ON frequency_sends(campaign_id) WHERE capped;
+
+-- daily number of messages sent by SMTP servers that are being warmed up
+DROP TABLE IF EXISTS smtp_warmup CASCADE;
+CREATE TABLE smtp_warmup (
+    server_uuid      TEXT NOT NULL,
+    day              DATE NOT NULL,
+    sent             INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (server_uuid, day)
+);
+
 -- roles
 DROP TABLE IF EXISTS roles CASCADE;
 CREATE TABLE roles (